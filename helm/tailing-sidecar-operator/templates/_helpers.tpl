@@ -63,3 +63,13 @@ Tailing sidecar configmap name
 {{- define "tailing-sidecar.configMap.name" -}}
 {{- printf "%s-%s" .Release.Name "sidecar-config" | trunc 63 | trimSuffix "-" }}
 {{- end }}
+
+{{/*
+Webhook CA, generated once per release render and shared by admission webhooks and CRD conversion webhook
+*/}}
+{{- define "tailing-sidecar-operator.webhookCA" -}}
+{{- if not (hasKey . "webhookCA") -}}
+{{- $tmpperioddays := int .Values.autoCertPeriodDays | default 365 -}}
+{{- $_ := set . "webhookCA" (genCA "tailing-sidecar-operator-ca" $tmpperioddays) -}}
+{{- end -}}
+{{- end }}
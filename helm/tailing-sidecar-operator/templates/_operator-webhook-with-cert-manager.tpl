@@ -19,7 +19,12 @@ webhooks:
   failurePolicy:  {{ .Values.webhook.failurePolicy }}
   reinvocationPolicy: {{ .Values.webhook.reinvocationPolicy }}
   objectSelector:
+  {{- if .Values.webhook.managedSelectors.enabled }}
+    matchLabels:
+      {{ .Values.webhook.managedSelectors.optInLabel }}: "true"
+  {{- else }}
   {{- toYaml .Values.webhook.objectSelector | nindent 4 }}
+  {{- end }}
   namespaceSelector:
   {{- toYaml .Values.webhook.namespaceSelector | nindent 4 }}
   name: tailing-sidecar.sumologic.com
@@ -30,10 +35,71 @@ webhooks:
     - v1
     operations:
     - CREATE
+    - UPDATE
     - DELETE
     resources:
     - pods
+  - apiGroups:
+    - ""
+    apiVersions:
+    - v1
+    operations:
+    - UPDATE
+    resources:
+    - pods/resize
   sideEffects: None
+{{- if .Values.webhook.workloadTemplates.enabled }}
+- admissionReviewVersions:
+  - v1
+  - v1beta1
+  clientConfig:
+    caBundle: Cg==
+    service:
+      name: {{ include "tailing-sidecar-operator.fullname" . }}
+      namespace: {{ .Release.Namespace }}
+      path: /add-tailing-sidecars-v1-workload
+  failurePolicy:  {{ .Values.webhook.failurePolicy }}
+  reinvocationPolicy: {{ .Values.webhook.reinvocationPolicy }}
+  objectSelector:
+  {{- toYaml .Values.webhook.workloadTemplates.objectSelector | nindent 4 }}
+  namespaceSelector:
+  {{- toYaml .Values.webhook.namespaceSelector | nindent 4 }}
+  name: workloads.tailing-sidecar.sumologic.com
+  rules:
+  - apiGroups:
+    - apps
+    apiVersions:
+    - v1
+    operations:
+    - CREATE
+    - UPDATE
+    resources:
+    - deployments
+    - statefulsets
+    - daemonsets
+  - apiGroups:
+    - batch
+    apiVersions:
+    - v1
+    operations:
+    - CREATE
+    - UPDATE
+    resources:
+    - jobs
+    - cronjobs
+  {{- range .Values.webhook.workloadTemplates.workloads }}
+  - apiGroups:
+    - {{ .group | quote }}
+    apiVersions:
+    - {{ .version }}
+    operations:
+    - CREATE
+    - UPDATE
+    resources:
+    - {{ .resource }}
+  {{- end }}
+  sideEffects: None
+{{- end }}
 ---
 apiVersion: cert-manager.io/v1
 kind: Certificate
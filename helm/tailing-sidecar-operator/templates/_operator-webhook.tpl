@@ -1,7 +1,8 @@
 {{- define "tailing-sidecar-operator.webhook" -}}
 {{- $altNames := list ( printf "%s.%s" (include "tailing-sidecar-operator.fullname" .) .Release.Namespace ) ( printf "%s.%s.svc" (include "tailing-sidecar-operator.fullname" .) .Release.Namespace ) -}}
 {{- $tmpperioddays := int .Values.autoCertPeriodDays | default 365 }}
-{{- $ca := genCA "tailing-sidecar-operator-ca" $tmpperioddays -}}
+{{- include "tailing-sidecar-operator.webhookCA" . -}}
+{{- $ca := .webhookCA -}}
 {{- $cert := genSignedCert ( include "tailing-sidecar-operator.fullname" . ) nil $altNames $tmpperioddays $ca -}}
 apiVersion: admissionregistration.k8s.io/v1
 kind: MutatingWebhookConfiguration
@@ -12,15 +13,22 @@ webhooks:
 - admissionReviewVersions:
   - v1
   clientConfig:
+    {{- if not .Values.selfManagedCerts.enabled }}
     caBundle: {{ $ca.Cert | b64enc }}
+    {{- end }}
     service:
       name: {{ include "tailing-sidecar-operator.fullname" . }}
       namespace: {{ .Release.Namespace }}
       path: /add-tailing-sidecars-v1-pod
   failurePolicy:  {{ .Values.webhook.failurePolicy }}
   reinvocationPolicy: {{ .Values.webhook.reinvocationPolicy }}
-  objectSelector: 
+  objectSelector:
+  {{- if .Values.webhook.managedSelectors.enabled }}
+    matchLabels:
+      {{ .Values.webhook.managedSelectors.optInLabel }}: "true"
+  {{- else }}
   {{- toYaml .Values.webhook.objectSelector | nindent 4 }}
+  {{- end }}
   namespaceSelector: 
   {{- toYaml .Values.webhook.namespaceSelector | nindent 4 }}
   name: tailing-sidecar.sumologic.com 
@@ -32,10 +40,73 @@ webhooks:
     - v1beta1
     operations:
     - CREATE
+    - UPDATE
     - DELETE
     resources:
     - pods
+  - apiGroups:
+    - ""
+    apiVersions:
+    - v1
+    operations:
+    - UPDATE
+    resources:
+    - pods/resize
   sideEffects: None
+{{- if .Values.webhook.workloadTemplates.enabled }}
+- admissionReviewVersions:
+  - v1
+  clientConfig:
+    {{- if not .Values.selfManagedCerts.enabled }}
+    caBundle: {{ $ca.Cert | b64enc }}
+    {{- end }}
+    service:
+      name: {{ include "tailing-sidecar-operator.fullname" . }}
+      namespace: {{ .Release.Namespace }}
+      path: /add-tailing-sidecars-v1-workload
+  failurePolicy:  {{ .Values.webhook.failurePolicy }}
+  reinvocationPolicy: {{ .Values.webhook.reinvocationPolicy }}
+  objectSelector:
+  {{- toYaml .Values.webhook.workloadTemplates.objectSelector | nindent 4 }}
+  namespaceSelector:
+  {{- toYaml .Values.webhook.namespaceSelector | nindent 4 }}
+  name: workloads.tailing-sidecar.sumologic.com
+  rules:
+  - apiGroups:
+    - apps
+    apiVersions:
+    - v1
+    operations:
+    - CREATE
+    - UPDATE
+    resources:
+    - deployments
+    - statefulsets
+    - daemonsets
+  - apiGroups:
+    - batch
+    apiVersions:
+    - v1
+    operations:
+    - CREATE
+    - UPDATE
+    resources:
+    - jobs
+    - cronjobs
+  {{- range .Values.webhook.workloadTemplates.workloads }}
+  - apiGroups:
+    - {{ .group | quote }}
+    apiVersions:
+    - {{ .version }}
+    operations:
+    - CREATE
+    - UPDATE
+    resources:
+    - {{ .resource }}
+  {{- end }}
+  sideEffects: None
+{{- end }}
+{{- if not .Values.selfManagedCerts.enabled }}
 ---
 apiVersion: v1
 kind: Secret
@@ -52,3 +123,4 @@ data:
   tls.crt: {{ $cert.Cert | b64enc }}
   tls.key: {{ $cert.Key | b64enc }}
 {{- end }}
+{{- end }}
@@ -0,0 +1,70 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1
+
+import (
+	"encoding/json"
+	"maps"
+	"slices"
+	"strings"
+)
+
+const (
+	// SidecarsOrderAnnotation contains JSON list of keys of configs in the order of sidecars from v2 API,
+	// it is set only when this order differs from the sorted order of keys
+	SidecarsOrderAnnotation = "tailing-sidecar.sumologic.com/sidecars-order"
+
+	// UnnamedSidecarKeyPrefix is a prefix of keys of configs for sidecars without name from v2 API,
+	// it cannot be a part of container name, names of these tailing sidecar containers are generated by operator
+	UnnamedSidecarKeyPrefix = "#"
+)
+
+// Hub marks v1 as the version to which other versions of TailingSidecarConfig are converted
+func (*TailingSidecarConfig) Hub() {}
+
+// SidecarKeys returns keys of configs in the order of sidecars from v2 API,
+// keys which are not listed in sidecars-order annotation are sorted and placed at the end
+func (t *TailingSidecarConfig) SidecarKeys() []string {
+	keys := make([]string, 0, len(t.Spec.SidecarSpecs))
+	if value, ok := t.Annotations[SidecarsOrderAnnotation]; ok {
+		order := make([]string, 0)
+		// incorrect annotation is ignored, so keys are sorted
+		if err := json.Unmarshal([]byte(value), &order); err == nil {
+			for _, key := range order {
+				if _, ok := t.Spec.SidecarSpecs[key]; ok && !slices.Contains(keys, key) {
+					keys = append(keys, key)
+				}
+			}
+		}
+	}
+
+	for _, key := range slices.Sorted(maps.Keys(t.Spec.SidecarSpecs)) {
+		if !slices.Contains(keys, key) {
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
+
+// SidecarName returns name of tailing sidecar container for key of configs,
+// it is empty for sidecars without name from v2 API
+func SidecarName(key string) string {
+	if strings.HasPrefix(key, UnnamedSidecarKeyPrefix) {
+		return ""
+	}
+	return key
+}
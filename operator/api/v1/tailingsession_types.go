@@ -0,0 +1,102 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1
+
+import (
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// TailingSessionPhase describes state of TailingSession.
+// +kubebuilder:validation:Enum=Pending;Running;Ended;Failed
+type TailingSessionPhase string
+
+const (
+	// TailingSessionPending means that ephemeral container was not added to Pod yet.
+	TailingSessionPending TailingSessionPhase = "Pending"
+	// TailingSessionRunning means that ephemeral container tails file in Pod.
+	TailingSessionRunning TailingSessionPhase = "Running"
+	// TailingSessionEnded means that ephemeral container stopped.
+	TailingSessionEnded TailingSessionPhase = "Ended"
+	// TailingSessionFailed means that ephemeral container could not be added to Pod.
+	TailingSessionFailed TailingSessionPhase = "Failed"
+)
+
+// TailingSessionSpec defines the desired state of TailingSession
+type TailingSessionSpec struct {
+	// PodName is the name of running Pod in the namespace of TailingSession to which ephemeral container is added.
+	PodName string `json:"podName"`
+
+	// ContainerName is the name of ephemeral container, defaults to tailing-session-<hash of TailingSession name>.
+	ContainerName string `json:"containerName,omitempty"`
+
+	// Path defines path to a file containing logs to tail within ephemeral container.
+	Path string `json:"path"`
+
+	// VolumeMount describes a mounting of a Pod volume within ephemeral container,
+	// mountPath is taken from Pod container with the same volume when it is not set.
+	VolumeMount corev1.VolumeMount `json:"volumeMount"`
+
+	// Duration defines how long ephemeral container tails the file, defaults to 1h.
+	Duration *metav1.Duration `json:"duration,omitempty"`
+}
+
+// TailingSessionStatus defines the observed state of TailingSession
+type TailingSessionStatus struct {
+	// Phase describes state of TailingSession.
+	Phase TailingSessionPhase `json:"phase,omitempty"`
+
+	// ContainerName is the name of ephemeral container added to Pod.
+	ContainerName string `json:"containerName,omitempty"`
+
+	// StartedAt is the time when ephemeral container was added to Pod.
+	StartedAt *metav1.Time `json:"startedAt,omitempty"`
+
+	// EndsAt is the time when ephemeral container stops tailing the file.
+	EndsAt *metav1.Time `json:"endsAt,omitempty"`
+
+	// EndedAt is the time when ephemeral container stopped.
+	EndedAt *metav1.Time `json:"endedAt,omitempty"`
+
+	// Message describes reason of the current phase.
+	Message string `json:"message,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+// +kubebuilder:subresource:status
+
+// TailingSession is the Schema for the tailingsessions API
+type TailingSession struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   TailingSessionSpec   `json:"spec,omitempty"`
+	Status TailingSessionStatus `json:"status,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+
+// TailingSessionList contains a list of TailingSession
+type TailingSessionList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []TailingSession `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&TailingSession{}, &TailingSessionList{})
+}
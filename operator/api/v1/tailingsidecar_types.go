@@ -36,8 +36,111 @@ type SidecarSpec struct {
 
 	// Resources describes the compute resource requirements.
 	Resources corev1.ResourceRequirements `json:"resources,omitempty"`
+
+	// FileStorage describes where a tailing sidecar container stores offsets of tailed files,
+	// when it is not set offsets are stored in emptyDir volume.
+	FileStorage *FileStorageSpec `json:"fileStorage,omitempty"`
+
+	// Volumes describes emptyDir volumes created for tailing sidecar container,
+	// fields which are not set are taken from operator configuration.
+	Volumes *SidecarVolumesSpec `json:"volumes,omitempty"`
+}
+
+// SidecarVolumesSpec defines settings for emptyDir volumes created for tailing sidecar container.
+type SidecarVolumesSpec struct {
+	// Sidecar describes volume mounted in tailing sidecar container at /tailing-sidecar/var.
+	Sidecar *corev1.EmptyDirVolumeSource `json:"sidecar,omitempty"`
+
+	// OtelLogs describes volume storing logs of OpenTelemetry Collector running in tailing sidecar container.
+	OtelLogs *corev1.EmptyDirVolumeSource `json:"otelLogs,omitempty"`
+
+	// OtelFileStorage describes volume storing offsets of tailed files, it is used only when fileStorage is not set.
+	OtelFileStorage *corev1.EmptyDirVolumeSource `json:"otelFileStorage,omitempty"`
+}
+
+// FileStorageSpec defines storage for offsets of tailed files, exactly one of the storages needs to be set.
+type FileStorageSpec struct {
+	// PersistentVolumeClaim stores offsets on PersistentVolumeClaim.
+	PersistentVolumeClaim *PersistentVolumeClaimFileStorage `json:"persistentVolumeClaim,omitempty"`
+
+	// Volume stores offsets in a subPath of a volume defined in Pod specification.
+	Volume *VolumeFileStorage `json:"volume,omitempty"`
+
+	// HostPath stores offsets in a directory on the node.
+	HostPath *HostPathFileStorage `json:"hostPath,omitempty"`
+}
+
+// PersistentVolumeClaimFileStorage references PersistentVolumeClaim used to store offsets.
+type PersistentVolumeClaimFileStorage struct {
+	// ClaimName is the name of PersistentVolumeClaim in the Pod namespace.
+	ClaimName string `json:"claimName,omitempty"`
+
+	// VolumeClaimTemplate is the name of StatefulSet volumeClaimTemplate,
+	// claim name is created in the same way as by StatefulSet controller: <volumeClaimTemplate>-<pod-name>.
+	VolumeClaimTemplate string `json:"volumeClaimTemplate,omitempty"`
+
+	// SubPath is a path within the volume, defaults to <pod-name>/<tailing-sidecar-container-name> for claimName,
+	// so Pods sharing the claim do not overwrite offsets of each other, and to the name of tailing sidecar container for volumeClaimTemplate.
+	SubPath string `json:"subPath,omitempty"`
+}
+
+// VolumeFileStorage references a volume defined in Pod specification used to store offsets.
+type VolumeFileStorage struct {
+	// Name is the name of the volume, defaults to the name of the volume containing logs to tail.
+	Name string `json:"name,omitempty"`
+
+	// SubPath is a path within the volume, defaults to .tailing-sidecar/<tailing-sidecar-container-name>.
+	SubPath string `json:"subPath,omitempty"`
 }
 
+// HostPathFileStorage describes a directory on the node used to store offsets.
+type HostPathFileStorage struct {
+	// Path is the path of the directory on the node.
+	Path string `json:"path"`
+
+	// SubPath is a path within the directory, defaults to <pod-name>/<tailing-sidecar-container-name>,
+	// so Pods on the same node do not overwrite offsets of each other.
+	SubPath string `json:"subPath,omitempty"`
+}
+
+// MergeStrategy defines how configuration with higher priority is applied
+// when it conflicts with configuration with lower priority.
+// +kubebuilder:validation:Enum=Override;Merge;Reject
+type MergeStrategy string
+
+const (
+	// MergeStrategyOverride replaces configuration with lower priority.
+	MergeStrategyOverride MergeStrategy = "Override"
+	// MergeStrategyMerge sets fields from configuration with higher priority in configuration with lower priority.
+	MergeStrategyMerge MergeStrategy = "Merge"
+	// MergeStrategyReject skips both conflicting configurations.
+	MergeStrategyReject MergeStrategy = "Reject"
+)
+
+// Mode defines if configurations from TailingSidecarConfig are applied to Pods.
+// +kubebuilder:validation:Enum=Active;Paused;DryRun
+type Mode string
+
+const (
+	// ModeActive adds tailing sidecars to Pods.
+	ModeActive Mode = "Active"
+	// ModePaused ignores TailingSidecarConfig.
+	ModePaused Mode = "Paused"
+	// ModeDryRun records tailing sidecars which would be added to Pods without changing Pod specification.
+	ModeDryRun Mode = "DryRun"
+)
+
+// ExpiryPolicy defines what happens with TailingSidecarConfig when it expires.
+// +kubebuilder:validation:Enum=Mark;Delete
+type ExpiryPolicy string
+
+const (
+	// ExpiryPolicyMark marks TailingSidecarConfig as expired in status.
+	ExpiryPolicyMark ExpiryPolicy = "Mark"
+	// ExpiryPolicyDelete deletes TailingSidecarConfig.
+	ExpiryPolicyDelete ExpiryPolicy = "Delete"
+)
+
 // TailingSidecarConfigSpec defines the desired state of TailingSidecarConfig
 type TailingSidecarConfigSpec struct {
 	// INSERT ADDITIONAL SPEC FIELDS - desired state of cluster
@@ -52,16 +155,149 @@ type TailingSidecarConfigSpec struct {
 
 	// PodSelector selects Pods to which this tailing sidecar configuration applies.
 	PodSelector *metav1.LabelSelector `json:"podSelector,omitempty"`
+
+	// Priority defines priority of configurations from this TailingSidecarConfig when they conflict
+	// with other configurations for the same tailing sidecar container name or the same file,
+	// configurations from tailing-sidecar annotation have priority 0.
+	Priority int32 `json:"priority,omitempty"`
+
+	// MergeStrategy defines how configurations from this TailingSidecarConfig are applied
+	// when they conflict with configurations with lower or equal priority, defaults to Override.
+	MergeStrategy MergeStrategy `json:"mergeStrategy,omitempty"`
+
+	// Mode defines if configurations from this TailingSidecarConfig are applied to Pods, defaults to Active.
+	// In DryRun mode tailing sidecars which would be added are recorded in Pod annotation and in status.
+	Mode Mode `json:"mode,omitempty"`
+
+	// Canary defines fraction of Pods to which tailing sidecars are added, by default they are added to all Pods.
+	Canary *CanarySpec `json:"canary,omitempty"`
+
+	// TTL defines how long after creation this TailingSidecarConfig is applied to Pods.
+	TTL *metav1.Duration `json:"ttl,omitempty"`
+
+	// ExpiresAt defines time after which this TailingSidecarConfig is not applied to Pods,
+	// when both ttl and expiresAt are set the earlier time is used.
+	ExpiresAt *metav1.Time `json:"expiresAt,omitempty"`
+
+	// Expiry defines what is done when this TailingSidecarConfig expires.
+	Expiry *ExpirySpec `json:"expiry,omitempty"`
+}
+
+// ExpirySpec defines what is done when TailingSidecarConfig expires.
+type ExpirySpec struct {
+	// Rollout restarts Deployments, StatefulSets and DaemonSets with Pods containing tailing sidecars
+	// from TailingSidecarConfig, so tailing sidecars are removed.
+	Rollout bool `json:"rollout,omitempty"`
+
+	// Policy defines what happens with expired TailingSidecarConfig, defaults to Mark.
+	Policy ExpiryPolicy `json:"policy,omitempty"`
+}
+
+// CanarySpec defines fraction of Pods to which tailing sidecars are added.
+type CanarySpec struct {
+	// Percent is the percentage of Pods matching podSelector to which tailing sidecars are added,
+	// Pods are selected using hash of Pod name, or generateName and UID of Pod or admission request for Pods with generated names.
+	// +kubebuilder:validation:Minimum=0
+	// +kubebuilder:validation:Maximum=100
+	Percent int32 `json:"percent"`
+}
+
+// DryRunStatus describes tailing sidecars which would be added to Pods by TailingSidecarConfig in DryRun mode.
+type DryRunStatus struct {
+	// Pods is the number of Pods matching podSelector to which tailing sidecars would be added.
+	Pods int32 `json:"pods"`
+
+	// Sidecars is the number of tailing sidecar containers which would be added to Pods.
+	Sidecars int32 `json:"sidecars"`
+}
+
+// ConfigConflict describes conflict between configuration from TailingSidecarConfig and other configuration.
+type ConfigConflict struct {
+	// Sidecar is the name of tailing sidecar container in this TailingSidecarConfig.
+	Sidecar string `json:"sidecar"`
+
+	// ConflictsWith is <namespace>/<name> of other TailingSidecarConfig
+	// or "annotation" for configuration from tailing-sidecar annotation.
+	ConflictsWith string `json:"conflictsWith"`
+
+	// ConflictingSidecar is the name of tailing sidecar container in other configuration.
+	ConflictingSidecar string `json:"conflictingSidecar,omitempty"`
+
+	// Strategy is the merge strategy used to resolve the conflict.
+	Strategy MergeStrategy `json:"strategy"`
+
+	// Winner is <namespace>/<name> of TailingSidecarConfig or "annotation" for configuration which was applied,
+	// it is empty when both configurations were rejected.
+	Winner string `json:"winner,omitempty"`
+
+	// Pod is <namespace>/<name> of Pod where the conflict occurs.
+	Pod string `json:"pod,omitempty"`
+}
+
+// CanaryStatus describes Pods matching podSelector of TailingSidecarConfig with canary.
+type CanaryStatus struct {
+	// CanaryPods is the number of Pods with tailing sidecars from TailingSidecarConfig.
+	CanaryPods int32 `json:"canaryPods"`
+
+	// NonCanaryPods is the number of Pods without tailing sidecars from TailingSidecarConfig.
+	NonCanaryPods int32 `json:"nonCanaryPods"`
+}
+
+// MissedInjectionStatus describes Pods matching podSelector which were created without tailing sidecars
+// from TailingSidecarConfig, e.g. when webhook was not available.
+type MissedInjectionStatus struct {
+	// Pods is the number of Pods without tailing sidecars from TailingSidecarConfig.
+	Pods int32 `json:"pods"`
+
+	// PodNames lists <namespace>/<name> of up to 10 Pods without tailing sidecars from TailingSidecarConfig.
+	PodNames []string `json:"podNames,omitempty"`
+}
+
+// ResizeStatus describes Pods matching podSelector in which in-place resize of tailing sidecars
+// from TailingSidecarConfig is pending.
+type ResizeStatus struct {
+	// Deferred is the number of Pods in which resize is feasible, but it cannot be applied now.
+	Deferred int32 `json:"deferred,omitempty"`
+
+	// Infeasible is the number of Pods in which resize cannot be applied on their nodes.
+	Infeasible int32 `json:"infeasible,omitempty"`
+
+	// PodNames lists <namespace>/<name> of up to 10 Pods in which resize is deferred or infeasible.
+	PodNames []string `json:"podNames,omitempty"`
 }
 
 // TailingSidecarConfigStatus defines the observed state of TailingSidecarConfig
 type TailingSidecarConfigStatus struct {
 	// INSERT ADDITIONAL STATUS FIELD - define observed state of cluster
 	// Important: Run "make" to regenerate code after modifying this file
+
+	// Conflicts lists conflicts with other configurations found in Pods matching podSelector.
+	Conflicts []ConfigConflict `json:"conflicts,omitempty"`
+
+	// DryRun describes tailing sidecars which would be added to Pods when mode is DryRun.
+	DryRun *DryRunStatus `json:"dryRun,omitempty"`
+
+	// Canary describes Pods with and without tailing sidecars from this TailingSidecarConfig when canary is set.
+	Canary *CanaryStatus `json:"canary,omitempty"`
+
+	// ExpiresAt is the time after which this TailingSidecarConfig is not applied to Pods.
+	ExpiresAt *metav1.Time `json:"expiresAt,omitempty"`
+
+	// Expired is true when this TailingSidecarConfig expired.
+	Expired bool `json:"expired,omitempty"`
+
+	// MissedInjection describes Pods matching podSelector which were created without tailing sidecars
+	// from this TailingSidecarConfig, it is reported when detection of missed injections is enabled in operator.
+	MissedInjection *MissedInjectionStatus `json:"missedInjection,omitempty"`
+
+	// Resize describes Pods matching podSelector in which in-place resize of tailing sidecars from this TailingSidecarConfig
+	// is deferred or infeasible, it is reported when in-place resize is enabled in operator.
+	Resize *ResizeStatus `json:"resize,omitempty"`
 }
 
 // +kubebuilder:object:root=true
 // +kubebuilder:subresource:status
+// +kubebuilder:storageversion
 
 // TailingSidecarConfig is the Schema for the tailingsidecars API
 type TailingSidecarConfig struct {
@@ -0,0 +1,120 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v2
+
+import (
+	"encoding/json"
+	"fmt"
+	"maps"
+	"slices"
+
+	"sigs.k8s.io/controller-runtime/pkg/conversion"
+
+	tailingsidecarv1 "github.com/SumoLogic/tailing-sidecar/operator/api/v1"
+)
+
+// ConvertTo converts TailingSidecarConfig to v1, order of sidecars is stored in sidecars-order annotation
+// and sidecars without name are stored under keys with UnnamedSidecarKeyPrefix, so conversion is lossless
+func (src *TailingSidecarConfig) ConvertTo(dstRaw conversion.Hub) error {
+	dst, ok := dstRaw.(*tailingsidecarv1.TailingSidecarConfig)
+	if !ok {
+		return fmt.Errorf("unsupported conversion from %T to %T", src, dstRaw)
+	}
+
+	dst.ObjectMeta = *src.ObjectMeta.DeepCopy()
+	dst.Spec = tailingsidecarv1.TailingSidecarConfigSpec{
+		AnnotationsPrefix: src.Spec.AnnotationsPrefix,
+		PodSelector:       src.Spec.PodSelector.DeepCopy(),
+		Priority:          src.Spec.Priority,
+		MergeStrategy:     src.Spec.MergeStrategy,
+		Mode:              src.Spec.Mode,
+		Canary:            src.Spec.Canary.DeepCopy(),
+		TTL:               src.Spec.TTL.DeepCopy(),
+		ExpiresAt:         src.Spec.ExpiresAt.DeepCopy(),
+		Expiry:            src.Spec.Expiry.DeepCopy(),
+	}
+	dst.Status = *src.Status.DeepCopy()
+
+	delete(dst.Annotations, tailingsidecarv1.SidecarsOrderAnnotation)
+	if len(src.Spec.Sidecars) > 0 {
+		dst.Spec.SidecarSpecs = make(map[string]tailingsidecarv1.SidecarSpec, len(src.Spec.Sidecars))
+		keys := make([]string, 0, len(src.Spec.Sidecars))
+		for i, sidecar := range src.Spec.Sidecars {
+			key := sidecar.Name
+			if key == "" {
+				key = fmt.Sprintf("%s%d", tailingsidecarv1.UnnamedSidecarKeyPrefix, i)
+			}
+			if _, ok := dst.Spec.SidecarSpecs[key]; ok {
+				return fmt.Errorf("names of sidecars must be unique, duplicated name: %s", key)
+			}
+			dst.Spec.SidecarSpecs[key] = *sidecar.SidecarSpec.DeepCopy()
+			keys = append(keys, key)
+		}
+
+		if !slices.Equal(keys, slices.Sorted(maps.Keys(dst.Spec.SidecarSpecs))) {
+			order, err := json.Marshal(keys)
+			if err != nil {
+				return err
+			}
+			if dst.Annotations == nil {
+				dst.Annotations = make(map[string]string, 1)
+			}
+			dst.Annotations[tailingsidecarv1.SidecarsOrderAnnotation] = string(order)
+		}
+	}
+	if len(dst.Annotations) == 0 {
+		dst.Annotations = nil
+	}
+	return nil
+}
+
+// ConvertFrom converts TailingSidecarConfig from v1, sidecars are ordered according to sidecars-order annotation
+// or by keys of configs when the annotation is not set
+func (dst *TailingSidecarConfig) ConvertFrom(srcRaw conversion.Hub) error {
+	src, ok := srcRaw.(*tailingsidecarv1.TailingSidecarConfig)
+	if !ok {
+		return fmt.Errorf("unsupported conversion from %T to %T", srcRaw, dst)
+	}
+
+	dst.ObjectMeta = *src.ObjectMeta.DeepCopy()
+	dst.Spec = TailingSidecarConfigSpec{
+		AnnotationsPrefix: src.Spec.AnnotationsPrefix,
+		PodSelector:       src.Spec.PodSelector.DeepCopy(),
+		Priority:          src.Spec.Priority,
+		MergeStrategy:     src.Spec.MergeStrategy,
+		Mode:              src.Spec.Mode,
+		Canary:            src.Spec.Canary.DeepCopy(),
+		TTL:               src.Spec.TTL.DeepCopy(),
+		ExpiresAt:         src.Spec.ExpiresAt.DeepCopy(),
+		Expiry:            src.Spec.Expiry.DeepCopy(),
+	}
+	dst.Status = *src.Status.DeepCopy()
+
+	for _, key := range src.SidecarKeys() {
+		spec := src.Spec.SidecarSpecs[key]
+		dst.Spec.Sidecars = append(dst.Spec.Sidecars, Sidecar{
+			Name:        tailingsidecarv1.SidecarName(key),
+			SidecarSpec: *spec.DeepCopy(),
+		})
+	}
+
+	delete(dst.Annotations, tailingsidecarv1.SidecarsOrderAnnotation)
+	if len(dst.Annotations) == 0 {
+		dst.Annotations = nil
+	}
+	return nil
+}
@@ -0,0 +1,110 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v2
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	tailingsidecarv1 "github.com/SumoLogic/tailing-sidecar/operator/api/v1"
+)
+
+func newSidecarSpec(path string) tailingsidecarv1.SidecarSpec {
+	return tailingsidecarv1.SidecarSpec{
+		Path:        path,
+		VolumeMount: corev1.VolumeMount{Name: "varlog", MountPath: "/var/log"},
+	}
+}
+
+func TestConvertFromV1(t *testing.T) {
+	v1 := &tailingsidecarv1.TailingSidecarConfig{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "tsc", Labels: map[string]string{"app": "tsc"}},
+		Spec: tailingsidecarv1.TailingSidecarConfigSpec{
+			AnnotationsPrefix: "prefix",
+			SidecarSpecs: map[string]tailingsidecarv1.SidecarSpec{
+				"sidecar-b": newSidecarSpec("/var/log/b.log"),
+				"sidecar-a": newSidecarSpec("/var/log/a.log"),
+			},
+			PodSelector: &metav1.LabelSelector{MatchLabels: map[string]string{"app": "nginx"}},
+			Priority:    10,
+			Mode:        tailingsidecarv1.ModeDryRun,
+			TTL:         &metav1.Duration{Duration: time.Hour},
+		},
+		Status: tailingsidecarv1.TailingSidecarConfigStatus{Expired: true},
+	}
+
+	v2 := &TailingSidecarConfig{}
+	require.NoError(t, v2.ConvertFrom(v1))
+	require.Equal(t, v1.ObjectMeta, v2.ObjectMeta)
+	require.Equal(t, []Sidecar{
+		{Name: "sidecar-a", SidecarSpec: newSidecarSpec("/var/log/a.log")},
+		{Name: "sidecar-b", SidecarSpec: newSidecarSpec("/var/log/b.log")},
+	}, v2.Spec.Sidecars)
+	require.Equal(t, v1.Spec.PodSelector, v2.Spec.PodSelector)
+	require.Equal(t, v1.Spec.TTL, v2.Spec.TTL)
+	require.Equal(t, v1.Status, v2.Status)
+
+	converted := &tailingsidecarv1.TailingSidecarConfig{}
+	require.NoError(t, v2.ConvertTo(converted))
+	require.Equal(t, v1, converted)
+}
+
+func TestConvertToV1(t *testing.T) {
+	v2 := &TailingSidecarConfig{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "tsc"},
+		Spec: TailingSidecarConfigSpec{
+			Sidecars: []Sidecar{
+				{Name: "sidecar-b", SidecarSpec: newSidecarSpec("/var/log/b.log")},
+				{SidecarSpec: newSidecarSpec("/var/log/unnamed.log")},
+				{Name: "sidecar-a", SidecarSpec: newSidecarSpec("/var/log/a.log")},
+			},
+			Canary: &tailingsidecarv1.CanarySpec{Percent: 50},
+		},
+	}
+
+	v1 := &tailingsidecarv1.TailingSidecarConfig{}
+	require.NoError(t, v2.ConvertTo(v1))
+	require.Equal(t, map[string]tailingsidecarv1.SidecarSpec{
+		"sidecar-b": newSidecarSpec("/var/log/b.log"),
+		"#1":        newSidecarSpec("/var/log/unnamed.log"),
+		"sidecar-a": newSidecarSpec("/var/log/a.log"),
+	}, v1.Spec.SidecarSpecs)
+	require.Equal(t, `["sidecar-b","#1","sidecar-a"]`, v1.Annotations[tailingsidecarv1.SidecarsOrderAnnotation])
+	require.Equal(t, []string{"sidecar-b", "#1", "sidecar-a"}, v1.SidecarKeys())
+	require.Equal(t, "", tailingsidecarv1.SidecarName("#1"))
+	require.Equal(t, v2.Spec.Canary, v1.Spec.Canary)
+
+	converted := &TailingSidecarConfig{}
+	require.NoError(t, converted.ConvertFrom(v1))
+	require.Equal(t, v2, converted)
+}
+
+func TestConvertToV1DuplicatedNames(t *testing.T) {
+	v2 := &TailingSidecarConfig{
+		Spec: TailingSidecarConfigSpec{
+			Sidecars: []Sidecar{
+				{Name: "sidecar", SidecarSpec: newSidecarSpec("/var/log/a.log")},
+				{Name: "sidecar", SidecarSpec: newSidecarSpec("/var/log/b.log")},
+			},
+		},
+	}
+	require.Error(t, v2.ConvertTo(&tailingsidecarv1.TailingSidecarConfig{}))
+}
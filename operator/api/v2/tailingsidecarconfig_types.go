@@ -0,0 +1,97 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v2
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	tailingsidecarv1 "github.com/SumoLogic/tailing-sidecar/operator/api/v1"
+)
+
+// Sidecar defines tailing sidecar container.
+type Sidecar struct {
+	// Name is the name of tailing sidecar container, when it is not set the name is generated by operator
+	// in the same way as for tailing sidecar containers from tailing-sidecar annotation.
+	Name string `json:"name,omitempty"`
+
+	tailingsidecarv1.SidecarSpec `json:",inline"`
+}
+
+// TailingSidecarConfigSpec defines the desired state of TailingSidecarConfig
+type TailingSidecarConfigSpec struct {
+	// AnnotationsPrefix defines prefix for per container annotations.
+	AnnotationsPrefix string `json:"annotationsPrefix,omitempty"`
+
+	// Sidecars defines tailing sidecar containers in the order in which they are added to Pods.
+	// +kubebuilder:validation:MaxItems=64
+	// +kubebuilder:validation:XValidation:rule="self.all(a, !has(a.name) || self.exists_one(b, has(b.name) && b.name == a.name))",message="names of sidecars must be unique"
+	Sidecars []Sidecar `json:"sidecars,omitempty"`
+
+	// PodSelector selects Pods to which this tailing sidecar configuration applies.
+	PodSelector *metav1.LabelSelector `json:"podSelector,omitempty"`
+
+	// Priority defines priority of configurations from this TailingSidecarConfig when they conflict
+	// with other configurations for the same tailing sidecar container name or the same file,
+	// configurations from tailing-sidecar annotation have priority 0.
+	Priority int32 `json:"priority,omitempty"`
+
+	// MergeStrategy defines how configurations from this TailingSidecarConfig are applied
+	// when they conflict with configurations with lower or equal priority, defaults to Override.
+	MergeStrategy tailingsidecarv1.MergeStrategy `json:"mergeStrategy,omitempty"`
+
+	// Mode defines if configurations from this TailingSidecarConfig are applied to Pods, defaults to Active.
+	// In DryRun mode tailing sidecars which would be added are recorded in Pod annotation and in status.
+	Mode tailingsidecarv1.Mode `json:"mode,omitempty"`
+
+	// Canary defines fraction of Pods to which tailing sidecars are added, by default they are added to all Pods.
+	Canary *tailingsidecarv1.CanarySpec `json:"canary,omitempty"`
+
+	// TTL defines how long after creation this TailingSidecarConfig is applied to Pods.
+	TTL *metav1.Duration `json:"ttl,omitempty"`
+
+	// ExpiresAt defines time after which this TailingSidecarConfig is not applied to Pods,
+	// when both ttl and expiresAt are set the earlier time is used.
+	ExpiresAt *metav1.Time `json:"expiresAt,omitempty"`
+
+	// Expiry defines what is done when this TailingSidecarConfig expires.
+	Expiry *tailingsidecarv1.ExpirySpec `json:"expiry,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+// +kubebuilder:subresource:status
+
+// TailingSidecarConfig is the Schema for the tailingsidecars API
+type TailingSidecarConfig struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   TailingSidecarConfigSpec                    `json:"spec,omitempty"`
+	Status tailingsidecarv1.TailingSidecarConfigStatus `json:"status,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+
+// TailingSidecarConfigList contains a list of TailingSidecarConfig
+type TailingSidecarConfigList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []TailingSidecarConfig `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&TailingSidecarConfig{}, &TailingSidecarConfigList{})
+}
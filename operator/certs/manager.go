@@ -0,0 +1,310 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package certs
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	"github.com/go-logr/logr"
+	admissionregistrationv1 "k8s.io/api/admissionregistration/v1"
+	corev1 "k8s.io/api/core/v1"
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/util/retry"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	// CACertKey is the key of CA bundle in Secret with certificates
+	CACertKey = "ca.crt"
+	// CAKeyKey is the key of CA private key in Secret with certificates
+	CAKeyKey = "ca.key"
+
+	// checkPeriod is the maximum time between checks of certificates and CA bundles in webhook configurations,
+	// so CA bundles overwritten e.g. by upgrade of deployment are restored
+	checkPeriod = 10 * time.Minute
+	// retryPeriod is the time after which failed check is retried
+	retryPeriod = 10 * time.Second
+)
+
+// Manager generates CA and serving certificate of webhook server into Secret, rotates them before expiry,
+// injects CA bundle into webhook configurations and provides the current serving certificate to webhook server,
+// so certificates are reloaded without restart
+type Manager struct {
+	Client client.Client
+	// Reader reads objects directly from API server, so Secrets do not need to be cached
+	Reader client.Reader
+	Log    logr.Logger
+
+	// Namespace is the namespace of Secret with certificates and Service of webhook server
+	Namespace string
+	// SecretName is the name of Secret with certificates
+	SecretName string
+	// ServiceName is the name of Service of webhook server, used in DNS names of serving certificate
+	ServiceName string
+	// MutatingWebhookConfigurationName is the name of MutatingWebhookConfiguration in which CA bundle is injected
+	MutatingWebhookConfigurationName string
+	// CustomResourceDefinitionNames lists CustomResourceDefinitions with conversion webhook served by webhook server
+	CustomResourceDefinitionNames []string
+	// Validity is the validity of generated CA and serving certificate
+	Validity time.Duration
+	// RotateBefore is the time before expiry of serving certificate when certificates are rotated
+	RotateBefore time.Duration
+
+	// now returns current time, it is replaced in tests
+	now         func() time.Time
+	certificate atomic.Pointer[tls.Certificate]
+}
+
+// GetCertificate returns the current serving certificate, it is used as GetCertificate in TLS config of webhook server
+func (m *Manager) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	certificate := m.certificate.Load()
+	if certificate == nil {
+		return nil, errors.New("serving certificate is not ready yet")
+	}
+	return certificate, nil
+}
+
+// +kubebuilder:rbac:groups=admissionregistration.k8s.io,resources=mutatingwebhookconfigurations,verbs=get;update
+// +kubebuilder:rbac:groups=apiextensions.k8s.io,resources=customresourcedefinitions,verbs=get;update
+
+// Start checks certificates until context is cancelled, certificates are checked before they need to be rotated
+// and at least every checkPeriod
+func (m *Manager) Start(ctx context.Context) error {
+	for {
+		next, err := m.Reconcile(ctx)
+		if err != nil {
+			m.Log.Error(err, "Failed to reconcile webhook certificates")
+			next = retryPeriod
+		}
+		next = min(max(next, 0), checkPeriod)
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(next):
+		}
+	}
+}
+
+// NeedLeaderElection returns false, because all operator replicas serve webhooks and need serving certificate,
+// concurrent rotations are resolved by optimistic concurrency of Secret updates
+func (m *Manager) NeedLeaderElection() bool {
+	return false
+}
+
+// Reconcile makes sure that Secret contains valid certificates, injects CA bundle into webhook configurations
+// and loads serving certificate, it returns time after which certificates need to be rotated
+func (m *Manager) Reconcile(ctx context.Context) (time.Duration, error) {
+	secret, err := m.ensureSecret(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("cannot ensure Secret %s/%s with webhook certificates: %w", m.Namespace, m.SecretName, err)
+	}
+
+	// CA bundle is injected before serving certificate is loaded, so API server trusts the certificate before it is used
+	if err := m.injectCABundle(ctx, secret.Data[CACertKey]); err != nil {
+		return 0, err
+	}
+
+	certificate, err := tls.X509KeyPair(secret.Data[corev1.TLSCertKey], secret.Data[corev1.TLSPrivateKeyKey])
+	if err != nil {
+		return 0, err
+	}
+	current := m.certificate.Load()
+	if current == nil || !bytes.Equal(current.Certificate[0], certificate.Certificate[0]) {
+		m.Log.Info("Loaded webhook serving certificate", "notAfter", certificate.Leaf.NotAfter)
+	}
+	m.certificate.Store(&certificate)
+
+	return certificate.Leaf.NotAfter.Add(-m.RotateBefore).Sub(m.getNow()), nil
+}
+
+// ensureSecret returns Secret with valid certificates, certificates are generated when Secret does not exist,
+// they are not valid or they need to be rotated
+func (m *Manager) ensureSecret(ctx context.Context) (*corev1.Secret, error) {
+	var secret *corev1.Secret
+	err := retry.OnError(retry.DefaultRetry, func(err error) bool {
+		return apierrors.IsConflict(err) || apierrors.IsAlreadyExists(err)
+	}, func() error {
+		secret = &corev1.Secret{}
+		err := m.Reader.Get(ctx, types.NamespacedName{Namespace: m.Namespace, Name: m.SecretName}, secret)
+		if err != nil && !apierrors.IsNotFound(err) {
+			return err
+		}
+		exists := err == nil
+
+		if exists {
+			reason := m.validate(secret)
+			if reason == "" {
+				return nil
+			}
+			m.Log.Info("Rotating webhook certificates", "reason", reason)
+		} else {
+			m.Log.Info("Generating webhook certificates")
+		}
+
+		data, err := m.generate(secret.Data[CACertKey])
+		if err != nil {
+			return err
+		}
+		secret.Data = data
+
+		if !exists {
+			secret.ObjectMeta = metav1.ObjectMeta{Namespace: m.Namespace, Name: m.SecretName}
+			secret.Type = corev1.SecretTypeTLS
+			return m.Client.Create(ctx, secret)
+		}
+		return m.Client.Update(ctx, secret)
+	})
+	return secret, err
+}
+
+// validate returns reason for which certificates in Secret need to be generated,
+// it returns empty string when certificates are valid
+func (m *Manager) validate(secret *corev1.Secret) string {
+	ca, err := parseKeyPair(secret.Data[CACertKey], secret.Data[CAKeyKey])
+	if err != nil {
+		return fmt.Sprintf("invalid CA: %v", err)
+	}
+	serving, err := parseKeyPair(secret.Data[corev1.TLSCertKey], secret.Data[corev1.TLSPrivateKeyKey])
+	if err != nil {
+		return fmt.Sprintf("invalid serving certificate: %v", err)
+	}
+
+	now := m.getNow()
+	roots := x509.NewCertPool()
+	roots.AddCert(ca.Cert)
+	if _, err := serving.Cert.Verify(x509.VerifyOptions{
+		DNSName:     m.dnsNames()[0],
+		Roots:       roots,
+		CurrentTime: now,
+	}); err != nil {
+		return fmt.Sprintf("invalid serving certificate: %v", err)
+	}
+	if !now.Before(serving.Cert.NotAfter.Add(-m.RotateBefore)) {
+		return fmt.Sprintf("serving certificate expires at %s", serving.Cert.NotAfter.Format(time.RFC3339))
+	}
+	return ""
+}
+
+// generate generates new CA and serving certificate, CA bundle contains also CAs from previous bundle
+// which have not expired yet
+func (m *Manager) generate(previousCABundle []byte) (map[string][]byte, error) {
+	now := m.getNow()
+	ca, err := newCA(now, m.Validity)
+	if err != nil {
+		return nil, err
+	}
+	serving, err := newServingCert(ca, m.dnsNames(), now, m.Validity)
+	if err != nil {
+		return nil, err
+	}
+	return map[string][]byte{
+		CACertKey:               caBundle(ca, previousCABundle, now),
+		CAKeyKey:                ca.KeyPEM,
+		corev1.TLSCertKey:       serving.CertPEM,
+		corev1.TLSPrivateKeyKey: serving.KeyPEM,
+	}, nil
+}
+
+// injectCABundle sets CA bundle in webhooks and conversion webhooks which use Service of webhook server
+func (m *Manager) injectCABundle(ctx context.Context, caBundle []byte) error {
+	if m.MutatingWebhookConfigurationName != "" {
+		err := retry.RetryOnConflict(retry.DefaultRetry, func() error {
+			webhookConfiguration := &admissionregistrationv1.MutatingWebhookConfiguration{}
+			if err := m.Reader.Get(ctx, types.NamespacedName{Name: m.MutatingWebhookConfigurationName}, webhookConfiguration); err != nil {
+				return err
+			}
+			changed := false
+			for i, webhook := range webhookConfiguration.Webhooks {
+				if m.usesService(webhook.ClientConfig.Service) && !bytes.Equal(webhook.ClientConfig.CABundle, caBundle) {
+					webhookConfiguration.Webhooks[i].ClientConfig.CABundle = caBundle
+					changed = true
+				}
+			}
+			if !changed {
+				return nil
+			}
+			m.Log.Info("Injecting CA bundle", "mutatingWebhookConfiguration", m.MutatingWebhookConfigurationName)
+			return m.Client.Update(ctx, webhookConfiguration)
+		})
+		if err != nil {
+			return fmt.Errorf("cannot inject CA bundle into MutatingWebhookConfiguration %s: %w", m.MutatingWebhookConfigurationName, err)
+		}
+	}
+
+	for _, name := range m.CustomResourceDefinitionNames {
+		err := retry.RetryOnConflict(retry.DefaultRetry, func() error {
+			crd := &apiextensionsv1.CustomResourceDefinition{}
+			if err := m.Reader.Get(ctx, types.NamespacedName{Name: name}, crd); err != nil {
+				return client.IgnoreNotFound(err)
+			}
+			conversion := crd.Spec.Conversion
+			if conversion == nil || conversion.Webhook == nil || conversion.Webhook.ClientConfig == nil {
+				return nil
+			}
+			if !m.usesService(conversion.Webhook.ClientConfig.Service) ||
+				bytes.Equal(conversion.Webhook.ClientConfig.CABundle, caBundle) {
+				return nil
+			}
+			conversion.Webhook.ClientConfig.CABundle = caBundle
+			m.Log.Info("Injecting CA bundle", "customResourceDefinition", name)
+			return m.Client.Update(ctx, crd)
+		})
+		if err != nil {
+			return fmt.Errorf("cannot inject CA bundle into CustomResourceDefinition %s: %w", name, err)
+		}
+	}
+	return nil
+}
+
+// usesService returns true when webhook client configuration points to Service of webhook server
+func (m *Manager) usesService(service any) bool {
+	switch s := service.(type) {
+	case *admissionregistrationv1.ServiceReference:
+		return s != nil && s.Namespace == m.Namespace && s.Name == m.ServiceName
+	case *apiextensionsv1.ServiceReference:
+		return s != nil && s.Namespace == m.Namespace && s.Name == m.ServiceName
+	default:
+		return false
+	}
+}
+
+// dnsNames returns DNS names of Service of webhook server
+func (m *Manager) dnsNames() []string {
+	return []string{
+		fmt.Sprintf("%s.%s.svc", m.ServiceName, m.Namespace),
+		fmt.Sprintf("%s.%s.svc.cluster.local", m.ServiceName, m.Namespace),
+		fmt.Sprintf("%s.%s", m.ServiceName, m.Namespace),
+	}
+}
+
+func (m *Manager) getNow() time.Time {
+	if m.now != nil {
+		return m.now()
+	}
+	return time.Now()
+}
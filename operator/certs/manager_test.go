@@ -0,0 +1,194 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package certs
+
+import (
+	"context"
+	"crypto/x509"
+	"testing"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/stretchr/testify/require"
+	admissionregistrationv1 "k8s.io/api/admissionregistration/v1"
+	corev1 "k8s.io/api/core/v1"
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+const (
+	testNamespace   = "tailing-sidecar-system"
+	testService     = "tailing-sidecar-operator"
+	testSecret      = "webhook-server-cert"
+	testWebhookName = "tailing-sidecar-mutating-webhook-configuration"
+	testCRDName     = "tailingsidecarconfigs.tailing-sidecar.sumologic.com"
+)
+
+func newTestManager(t *testing.T, objects ...client.Object) (*Manager, client.Client) {
+	scheme := runtime.NewScheme()
+	require.NoError(t, clientgoscheme.AddToScheme(scheme))
+	require.NoError(t, apiextensionsv1.AddToScheme(scheme))
+
+	service := &admissionregistrationv1.ServiceReference{Namespace: testNamespace, Name: testService}
+	otherService := &admissionregistrationv1.ServiceReference{Namespace: "other", Name: testService}
+	objects = append(objects,
+		&admissionregistrationv1.MutatingWebhookConfiguration{
+			ObjectMeta: metav1.ObjectMeta{Name: testWebhookName},
+			Webhooks: []admissionregistrationv1.MutatingWebhook{
+				{Name: "tailing-sidecar.sumologic.com", ClientConfig: admissionregistrationv1.WebhookClientConfig{Service: service}},
+				{Name: "other.sumologic.com", ClientConfig: admissionregistrationv1.WebhookClientConfig{Service: otherService}},
+			},
+		},
+		&apiextensionsv1.CustomResourceDefinition{
+			ObjectMeta: metav1.ObjectMeta{Name: testCRDName},
+			Spec: apiextensionsv1.CustomResourceDefinitionSpec{
+				Conversion: &apiextensionsv1.CustomResourceConversion{
+					Strategy: apiextensionsv1.WebhookConverter,
+					Webhook: &apiextensionsv1.WebhookConversion{
+						ClientConfig: &apiextensionsv1.WebhookClientConfig{
+							Service: &apiextensionsv1.ServiceReference{Namespace: testNamespace, Name: testService},
+						},
+					},
+				},
+			},
+		},
+	)
+	fakeClient := fake.NewClientBuilder().WithScheme(scheme).WithObjects(objects...).Build()
+
+	now := time.Date(2021, 3, 1, 12, 0, 0, 0, time.UTC)
+	return &Manager{
+		Client:                           fakeClient,
+		Reader:                           fakeClient,
+		Log:                              logr.Discard(),
+		Namespace:                        testNamespace,
+		SecretName:                       testSecret,
+		ServiceName:                      testService,
+		MutatingWebhookConfigurationName: testWebhookName,
+		CustomResourceDefinitionNames:    []string{testCRDName, "missing.tailing-sidecar.sumologic.com"},
+		Validity:                         90 * 24 * time.Hour,
+		RotateBefore:                     30 * 24 * time.Hour,
+		now:                              func() time.Time { return now },
+	}, fakeClient
+}
+
+func getCABundles(t *testing.T, c client.Client) ([]byte, []byte, []byte) {
+	webhookConfiguration := &admissionregistrationv1.MutatingWebhookConfiguration{}
+	require.NoError(t, c.Get(context.Background(), types.NamespacedName{Name: testWebhookName}, webhookConfiguration))
+	crd := &apiextensionsv1.CustomResourceDefinition{}
+	require.NoError(t, c.Get(context.Background(), types.NamespacedName{Name: testCRDName}, crd))
+	return webhookConfiguration.Webhooks[0].ClientConfig.CABundle,
+		webhookConfiguration.Webhooks[1].ClientConfig.CABundle,
+		crd.Spec.Conversion.Webhook.ClientConfig.CABundle
+}
+
+func verifyServingCertificate(t *testing.T, m *Manager, caBundle []byte) *x509.Certificate {
+	certificate, err := m.GetCertificate(nil)
+	require.NoError(t, err)
+	roots := x509.NewCertPool()
+	require.True(t, roots.AppendCertsFromPEM(caBundle))
+	_, err = certificate.Leaf.Verify(x509.VerifyOptions{
+		DNSName:     "tailing-sidecar-operator.tailing-sidecar-system.svc",
+		Roots:       roots,
+		CurrentTime: m.now(),
+	})
+	require.NoError(t, err)
+	return certificate.Leaf
+}
+
+func TestManagerGeneratesCertificates(t *testing.T) {
+	m, c := newTestManager(t)
+
+	_, err := m.GetCertificate(nil)
+	require.Error(t, err)
+
+	next, err := m.Reconcile(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, 60*24*time.Hour, next)
+
+	secret := &corev1.Secret{}
+	require.NoError(t, c.Get(context.Background(), types.NamespacedName{Namespace: testNamespace, Name: testSecret}, secret))
+	require.Equal(t, corev1.SecretTypeTLS, secret.Type)
+
+	webhookCABundle, otherCABundle, crdCABundle := getCABundles(t, c)
+	require.Equal(t, secret.Data[CACertKey], webhookCABundle)
+	require.Empty(t, otherCABundle)
+	require.Equal(t, secret.Data[CACertKey], crdCABundle)
+	serving := verifyServingCertificate(t, m, webhookCABundle)
+	require.ElementsMatch(t, []string{
+		"tailing-sidecar-operator.tailing-sidecar-system.svc",
+		"tailing-sidecar-operator.tailing-sidecar-system.svc.cluster.local",
+		"tailing-sidecar-operator.tailing-sidecar-system",
+	}, serving.DNSNames)
+
+	// certificates are kept until they need to be rotated
+	_, err = m.Reconcile(context.Background())
+	require.NoError(t, err)
+	current := &corev1.Secret{}
+	require.NoError(t, c.Get(context.Background(), types.NamespacedName{Namespace: testNamespace, Name: testSecret}, current))
+	require.Equal(t, secret.Data, current.Data)
+}
+
+func TestManagerRotatesCertificates(t *testing.T) {
+	m, c := newTestManager(t)
+	_, err := m.Reconcile(context.Background())
+	require.NoError(t, err)
+	previous := verifyServingCertificate(t, m, getSecret(t, c).Data[CACertKey])
+
+	rotationTime := m.now().Add(61 * 24 * time.Hour)
+	m.now = func() time.Time { return rotationTime }
+	next, err := m.Reconcile(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, 60*24*time.Hour, next)
+
+	secret := getSecret(t, c)
+	require.Len(t, parseCertificates(secret.Data[CACertKey]), 2, "CA bundle contains new and previous CA")
+	webhookCABundle, _, crdCABundle := getCABundles(t, c)
+	require.Equal(t, secret.Data[CACertKey], webhookCABundle)
+	require.Equal(t, secret.Data[CACertKey], crdCABundle)
+
+	rotated := verifyServingCertificate(t, m, webhookCABundle)
+	require.NotEqual(t, previous.SerialNumber, rotated.SerialNumber)
+	require.Equal(t, rotationTime.Add(m.Validity), rotated.NotAfter)
+}
+
+func TestManagerReplacesInvalidCertificates(t *testing.T) {
+	m, c := newTestManager(t, &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Namespace: testNamespace, Name: testSecret},
+		Type:       corev1.SecretTypeTLS,
+		Data: map[string][]byte{
+			corev1.TLSCertKey:       []byte("certificate generated by Helm"),
+			corev1.TLSPrivateKeyKey: []byte("key generated by Helm"),
+		},
+	})
+
+	_, err := m.Reconcile(context.Background())
+	require.NoError(t, err)
+	secret := getSecret(t, c)
+	require.Len(t, parseCertificates(secret.Data[CACertKey]), 1)
+	verifyServingCertificate(t, m, secret.Data[CACertKey])
+}
+
+func getSecret(t *testing.T, c client.Client) *corev1.Secret {
+	secret := &corev1.Secret{}
+	require.NoError(t, c.Get(context.Background(), types.NamespacedName{Namespace: testNamespace, Name: testSecret}, secret))
+	return secret
+}
@@ -0,0 +1,100 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"text/tabwriter"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/types"
+
+	tailingsidecarv1 "github.com/SumoLogic/tailing-sidecar/operator/api/v1"
+	"github.com/SumoLogic/tailing-sidecar/operator/handler"
+)
+
+// runExplain shows which TailingSidecarConfigs match Pod and why
+func runExplain(ctx context.Context, kube *kubeOptions, args []string, stdout io.Writer) error {
+	flags := flag.NewFlagSet("explain", flag.ContinueOnError)
+	kube.addFlags(flags)
+	positional, err := parseFlags(flags, args)
+	if err != nil {
+		return err
+	}
+	if len(positional) != 1 {
+		return fmt.Errorf("explain requires Pod name")
+	}
+
+	c, err := kube.client()
+	if err != nil {
+		return err
+	}
+	namespace, err := kube.getNamespace()
+	if err != nil {
+		return err
+	}
+
+	pod := &corev1.Pod{}
+	if err := c.Get(ctx, types.NamespacedName{Namespace: namespace, Name: positional[0]}, pod); err != nil {
+		return err
+	}
+
+	tailingSidecarConfigList := &tailingsidecarv1.TailingSidecarConfigList{}
+	if err := c.List(ctx, tailingSidecarConfigList); err != nil {
+		return err
+	}
+
+	annotation, ok := pod.ObjectMeta.Annotations[handler.SidecarAnnotation]
+	if !ok {
+		annotation = "<none>"
+	} else if reason := handler.ExplainAnnotation(pod.ObjectMeta.Annotations); reason != "" {
+		annotation = fmt.Sprintf("%s (not applied, %s)", annotation, reason)
+	}
+
+	writer := tabwriter.NewWriter(stdout, 0, 0, 3, ' ', 0)
+	fmt.Fprintf(writer, "Pod:\t%s/%s\n", pod.Namespace, pod.Name)
+	fmt.Fprintf(writer, "Labels:\t%s\n", labels.Set(pod.ObjectMeta.Labels).String())
+	fmt.Fprintf(writer, "Annotation %s:\t%s\n", handler.SidecarAnnotation, annotation)
+	fmt.Fprintln(writer)
+
+	fmt.Fprintln(writer, "TailingSidecarConfigs:")
+	fmt.Fprintln(writer, "NAMESPACE\tNAME\tMATCHES\tREASON")
+	for _, match := range handler.ExplainTailingSidecarConfigs(tailingSidecarConfigList.Items, pod) {
+		fmt.Fprintf(writer, "%s\t%s\t%t\t%s\n", match.Namespace, match.Name, match.Matches, match.Reason)
+	}
+	fmt.Fprintln(writer)
+
+	fmt.Fprintln(writer, "Tailing sidecars:")
+	descriptions, err := handler.DescribeSidecars(pod, tailingSidecarConfigList.Items)
+	if err != nil {
+		fmt.Fprintf(writer, "<error: %v>\n", err)
+		return writer.Flush()
+	}
+	fmt.Fprintln(writer, "CONTAINER\tPATH\tVOLUME\tSOURCE")
+	for _, description := range descriptions {
+		source := description.Source
+		if source == "" {
+			source = unknownSource
+		}
+		fmt.Fprintf(writer, "%s\t%s\t%s\t%s\n", description.Container, description.Path, description.Volume, source)
+	}
+	return writer.Flush()
+}
@@ -0,0 +1,90 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"text/tabwriter"
+
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	tailingsidecarv1 "github.com/SumoLogic/tailing-sidecar/operator/api/v1"
+	"github.com/SumoLogic/tailing-sidecar/operator/handler"
+)
+
+const unknownSource = "<unknown>"
+
+// runList lists Pods with tailing sidecars, paths of tailed files and sources of configuration
+func runList(ctx context.Context, kube *kubeOptions, args []string, stdout io.Writer) error {
+	var allNamespaces bool
+
+	flags := flag.NewFlagSet("list", flag.ContinueOnError)
+	kube.addFlags(flags)
+	flags.BoolVar(&allNamespaces, "all-namespaces", false, "List Pods in all namespaces")
+	flags.BoolVar(&allNamespaces, "A", false, "List Pods in all namespaces, shorthand for --all-namespaces")
+	if _, err := parseFlags(flags, args); err != nil {
+		return err
+	}
+
+	c, err := kube.client()
+	if err != nil {
+		return err
+	}
+
+	listOptions := []client.ListOption{}
+	if !allNamespaces {
+		namespace, err := kube.getNamespace()
+		if err != nil {
+			return err
+		}
+		listOptions = append(listOptions, client.InNamespace(namespace))
+	}
+
+	podList := &corev1.PodList{}
+	if err := c.List(ctx, podList, listOptions...); err != nil {
+		return err
+	}
+
+	// TailingSidecarConfigs are listed from all namespaces in the same way as in webhook
+	tailingSidecarConfigList := &tailingsidecarv1.TailingSidecarConfigList{}
+	if err := c.List(ctx, tailingSidecarConfigList); err != nil {
+		return err
+	}
+
+	writer := tabwriter.NewWriter(stdout, 0, 0, 3, ' ', 0)
+	fmt.Fprintln(writer, "NAMESPACE\tPOD\tSIDECAR\tPATH\tSOURCE")
+	for i := range podList.Items {
+		pod := &podList.Items[i]
+		descriptions, err := handler.DescribeSidecars(pod, tailingSidecarConfigList.Items)
+		if err != nil {
+			fmt.Fprintf(writer, "%s\t%s\t\t\t<error: %v>\n", pod.Namespace, pod.Name, err)
+			continue
+		}
+		for _, description := range descriptions {
+			source := description.Source
+			if source == "" {
+				source = unknownSource
+			}
+			fmt.Fprintf(writer, "%s\t%s\t%s\t%s\t%s\n", pod.Namespace, pod.Name, description.Container, description.Path, source)
+		}
+	}
+	return writer.Flush()
+}
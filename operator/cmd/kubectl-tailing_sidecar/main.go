@@ -0,0 +1,156 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// kubectl-tailing_sidecar is a kubectl plugin which shows tailing sidecars injected by tailing sidecar operator,
+// it is invoked as `kubectl tailing-sidecar`
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+
+	"k8s.io/apimachinery/pkg/runtime"
+	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/clientcmd"
+	clientcmdapi "k8s.io/client-go/tools/clientcmd/api"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	tailingsidecarv1 "github.com/SumoLogic/tailing-sidecar/operator/api/v1"
+)
+
+const usage = `kubectl tailing-sidecar shows tailing sidecars injected by tailing sidecar operator
+
+Usage:
+  kubectl tailing-sidecar list [-n namespace | -A]
+  kubectl tailing-sidecar explain <pod> [-n namespace]
+  kubectl tailing-sidecar preview -f <file> [-n namespace]
+  kubectl tailing-sidecar tail <pod> [<sidecar>] [-n namespace] [--follow] [--tail lines]
+
+Commands:
+  list     List Pods with tailing sidecars, paths of tailed files and sources of configuration
+  explain  Show which TailingSidecarConfigs match Pod and why
+  preview  Show Pods or workloads extended by tailing sidecar operator without creating them
+  tail     Show output of tailing sidecar container
+`
+
+var scheme = runtime.NewScheme()
+
+func init() {
+	utilruntime.Must(clientgoscheme.AddToScheme(scheme))
+	utilruntime.Must(tailingsidecarv1.AddToScheme(scheme))
+}
+
+// command is a subcommand of kubectl plugin
+type command func(ctx context.Context, kube *kubeOptions, args []string, stdout io.Writer) error
+
+var commands = map[string]command{
+	"list":    runList,
+	"explain": runExplain,
+	"preview": runPreview,
+	"tail":    runTail,
+}
+
+func main() {
+	if len(os.Args) < 2 {
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(1)
+	}
+
+	run, ok := commands[os.Args[1]]
+	if !ok {
+		if os.Args[1] != "-h" && os.Args[1] != "--help" && os.Args[1] != "help" {
+			fmt.Fprintf(os.Stderr, "unknown command %q\n\n", os.Args[1])
+		}
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(1)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	if err := run(ctx, &kubeOptions{}, os.Args[2:], os.Stdout); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+// kubeOptions contains options to connect to Kubernetes API
+type kubeOptions struct {
+	kubeconfig string
+	context    string
+	namespace  string
+}
+
+// addFlags adds flags to connect to Kubernetes API
+func (o *kubeOptions) addFlags(flags *flag.FlagSet) {
+	flags.StringVar(&o.kubeconfig, "kubeconfig", "", "Path to the kubeconfig file")
+	flags.StringVar(&o.context, "context", "", "The name of the kubeconfig context to use")
+	flags.StringVar(&o.namespace, "namespace", "", "Namespace, defaults to namespace from kubeconfig context")
+	flags.StringVar(&o.namespace, "n", "", "Namespace, shorthand for --namespace")
+}
+
+func (o *kubeOptions) clientConfig() clientcmd.ClientConfig {
+	loadingRules := clientcmd.NewDefaultClientConfigLoadingRules()
+	loadingRules.ExplicitPath = o.kubeconfig
+	return clientcmd.NewNonInteractiveDeferredLoadingClientConfig(loadingRules, &clientcmd.ConfigOverrides{
+		CurrentContext: o.context,
+		Context: clientcmdapi.Context{
+			Namespace: o.namespace,
+		},
+	})
+}
+
+// restConfig returns configuration to connect to Kubernetes API
+func (o *kubeOptions) restConfig() (*rest.Config, error) {
+	return o.clientConfig().ClientConfig()
+}
+
+// getNamespace returns namespace from flags or kubeconfig context
+func (o *kubeOptions) getNamespace() (string, error) {
+	namespace, _, err := o.clientConfig().Namespace()
+	return namespace, err
+}
+
+// client returns client for Kubernetes API
+func (o *kubeOptions) client() (client.Client, error) {
+	config, err := o.restConfig()
+	if err != nil {
+		return nil, err
+	}
+	return client.New(config, client.Options{Scheme: scheme})
+}
+
+// parseFlags parses flags provided before and after positional arguments and returns positional arguments
+func parseFlags(flags *flag.FlagSet, args []string) ([]string, error) {
+	positional := make([]string, 0)
+	for {
+		if err := flags.Parse(args); err != nil {
+			return nil, err
+		}
+		args = flags.Args()
+		if len(args) == 0 {
+			return positional, nil
+		}
+		positional = append(positional, args[0])
+		args = args[1:]
+	}
+}
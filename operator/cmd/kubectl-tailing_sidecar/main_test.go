@@ -0,0 +1,53 @@
+package main
+
+import (
+	"flag"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseFlags(t *testing.T) {
+	testCases := []struct {
+		name               string
+		args               []string
+		expectedPositional []string
+		expectedNamespace  string
+		expectedFollow     bool
+	}{
+		{
+			name:               "flags before positional arguments",
+			args:               []string{"-n", "tailing-sidecar-system", "--follow=false", "pod", "sidecar"},
+			expectedPositional: []string{"pod", "sidecar"},
+			expectedNamespace:  "tailing-sidecar-system",
+		},
+		{
+			name:               "flags after positional arguments",
+			args:               []string{"pod", "-n", "tailing-sidecar-system", "sidecar", "--follow"},
+			expectedPositional: []string{"pod", "sidecar"},
+			expectedNamespace:  "tailing-sidecar-system",
+			expectedFollow:     true,
+		},
+		{
+			name:               "no flags",
+			args:               []string{"pod"},
+			expectedPositional: []string{"pod"},
+		},
+	}
+
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			var follow bool
+			kube := &kubeOptions{}
+			flags := flag.NewFlagSet("test", flag.ContinueOnError)
+			kube.addFlags(flags)
+			flags.BoolVar(&follow, "follow", false, "")
+
+			positional, err := parseFlags(flags, tt.args)
+			require.NoError(t, err)
+			require.Equal(t, tt.expectedPositional, positional)
+			require.Equal(t, tt.expectedNamespace, kube.namespace)
+			require.Equal(t, tt.expectedFollow, follow)
+		})
+	}
+}
@@ -0,0 +1,84 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/SumoLogic/tailing-sidecar/operator/render"
+)
+
+// runPreview shows Pods or workloads extended by tailing sidecar operator,
+// objects are created in dry run mode so they are extended by the same webhook as real objects
+func runPreview(ctx context.Context, kube *kubeOptions, args []string, stdout io.Writer) error {
+	var filename string
+
+	flags := flag.NewFlagSet("preview", flag.ContinueOnError)
+	kube.addFlags(flags)
+	flags.StringVar(&filename, "filename", "", "File with manifests, - for standard input")
+	flags.StringVar(&filename, "f", "", "File with manifests, shorthand for --filename")
+	if _, err := parseFlags(flags, args); err != nil {
+		return err
+	}
+	if filename == "" {
+		return fmt.Errorf("preview requires file with manifests")
+	}
+
+	reader := io.Reader(os.Stdin)
+	if filename != "-" {
+		file, err := os.Open(filename)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		reader = file
+	}
+
+	input, err := render.Read(reader)
+	if err != nil {
+		return err
+	}
+
+	c, err := kube.client()
+	if err != nil {
+		return err
+	}
+	namespace, err := kube.getNamespace()
+	if err != nil {
+		return err
+	}
+
+	previews := make([]*unstructured.Unstructured, 0, len(input.Objects))
+	for _, object := range input.Objects {
+		if object.GetNamespace() == "" {
+			object.SetNamespace(namespace)
+		}
+		if err := c.Create(ctx, object, client.DryRunAll); err != nil {
+			return fmt.Errorf("cannot preview %s %s: %w", object.GetKind(), object.GetName(), err)
+		}
+		object.SetManagedFields(nil)
+		previews = append(previews, object)
+	}
+	return render.Write(stdout, render.Input{}, previews)
+}
@@ -0,0 +1,111 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"slices"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+
+	"github.com/SumoLogic/tailing-sidecar/operator/handler"
+)
+
+// runTail shows output of tailing sidecar container,
+// tailing sidecar container can be omitted when there is only one tailing sidecar in Pod
+func runTail(ctx context.Context, kube *kubeOptions, args []string, stdout io.Writer) error {
+	var follow bool
+	var tail int64
+
+	flags := flag.NewFlagSet("tail", flag.ContinueOnError)
+	kube.addFlags(flags)
+	flags.BoolVar(&follow, "follow", false, "Stream output of tailing sidecar")
+	flags.Int64Var(&tail, "tail", 10, "Number of recent lines to show, -1 shows all lines")
+	positional, err := parseFlags(flags, args)
+	if err != nil {
+		return err
+	}
+	if len(positional) < 1 || len(positional) > 2 {
+		return fmt.Errorf("tail requires Pod name and optionally tailing sidecar container name")
+	}
+
+	config, err := kube.restConfig()
+	if err != nil {
+		return err
+	}
+	clientset, err := kubernetes.NewForConfig(config)
+	if err != nil {
+		return err
+	}
+	namespace, err := kube.getNamespace()
+	if err != nil {
+		return err
+	}
+
+	pod, err := clientset.CoreV1().Pods(namespace).Get(ctx, positional[0], metav1.GetOptions{})
+	if err != nil {
+		return err
+	}
+
+	descriptions, err := handler.DescribeSidecars(pod, nil)
+	if err != nil {
+		return err
+	}
+	sidecars := make([]string, 0, len(descriptions))
+	for _, description := range descriptions {
+		sidecars = append(sidecars, description.Container)
+	}
+
+	var sidecar string
+	switch {
+	case len(positional) == 2:
+		sidecar = positional[1]
+		if !slices.Contains(sidecars, sidecar) {
+			return fmt.Errorf("container %s is not a tailing sidecar in Pod %s/%s, tailing sidecars: %v", sidecar, namespace, pod.Name, sidecars)
+		}
+	case len(sidecars) == 1:
+		sidecar = sidecars[0]
+	default:
+		return fmt.Errorf("tailing sidecar container name needs to be provided for Pod %s/%s, tailing sidecars: %v", namespace, pod.Name, sidecars)
+	}
+
+	logOptions := &corev1.PodLogOptions{
+		Container: sidecar,
+		Follow:    follow,
+	}
+	if tail >= 0 {
+		logOptions.TailLines = &tail
+	}
+
+	stream, err := clientset.CoreV1().Pods(namespace).GetLogs(pod.Name, logOptions).Stream(ctx)
+	if err != nil {
+		return err
+	}
+	defer stream.Close()
+
+	_, err = io.Copy(stdout, stream)
+	if err != nil && ctx.Err() != nil {
+		// interrupted by user
+		return nil
+	}
+	return err
+}
@@ -1,25 +1,42 @@
 package main
 
 import (
+	"crypto/tls"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"os"
+	"strings"
 	"time"
 
+	tailingsidecarv1 "github.com/SumoLogic/tailing-sidecar/operator/api/v1"
+	"github.com/SumoLogic/tailing-sidecar/operator/controllers"
+	"github.com/SumoLogic/tailing-sidecar/operator/handler"
 	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"sigs.k8s.io/controller-runtime/pkg/webhook"
 	"sigs.k8s.io/yaml"
 )
 
 type Config struct {
-	Sidecar        SidecarConfig        `yaml:"sidecar,omitempty"`
-	LeaderElection LeaderElectionConfig `yaml:"leaderElection,omitempty"`
+	Sidecar           SidecarConfig           `yaml:"sidecar,omitempty"`
+	LeaderElection    LeaderElectionConfig    `yaml:"leaderElection,omitempty"`
+	WorkloadTemplates WorkloadTemplatesConfig `yaml:"workloadTemplates,omitempty"`
+	Introspection     IntrospectionConfig     `yaml:"introspection,omitempty"`
+	Certificates      CertificatesConfig      `yaml:"certificates,omitempty"`
+	Webhook           WebhookConfig           `yaml:"webhook,omitempty"`
+	WebhookSelectors  WebhookSelectorsConfig  `yaml:"webhookSelectors,omitempty"`
+	MissedInjection   MissedInjectionConfig   `yaml:"missedInjection,omitempty"`
+	InPlaceResize     InPlaceResizeConfig     `yaml:"inPlaceResize,omitempty"`
 }
 
 type SidecarConfig struct {
-	Image     string                      `yaml:"image,omitempty"`
-	Resources corev1.ResourceRequirements `yaml:"resources,omitempty"`
-	Config    SidecarConfigConfig         `yaml:"config,omitempty"`
+	Image     string                              `yaml:"image,omitempty"`
+	Resources corev1.ResourceRequirements         `yaml:"resources,omitempty"`
+	Config    SidecarConfigConfig                 `yaml:"config,omitempty"`
+	Volumes   tailingsidecarv1.SidecarVolumesSpec `yaml:"volumes,omitempty"`
+	Naming    string                              `yaml:"naming,omitempty"`
 }
 
 type LeaderElectionConfig struct {
@@ -28,6 +45,139 @@ type LeaderElectionConfig struct {
 	RetryPeriod   Duration `yaml:"retryPeriod,omitempty"`
 }
 
+// WorkloadTemplatesConfig configures injection of tailing sidecars into Pod templates of workloads
+type WorkloadTemplatesConfig struct {
+	Enabled bool `yaml:"enabled,omitempty"`
+	// Workloads lists additional kinds of workloads, e.g. based on custom resources, with paths to their Pod templates
+	Workloads []handler.WorkloadTemplate `yaml:"workloads,omitempty"`
+}
+
+// IntrospectionConfig configures read-only HTTP API served next to metrics
+type IntrospectionConfig struct {
+	Enabled bool `yaml:"enabled,omitempty"`
+	// Decisions is the number of the last admission decisions kept in memory, defaults to 100
+	Decisions int `yaml:"decisions,omitempty"`
+}
+
+// CertificatesConfig configures webhook certificates generated and rotated by the operator
+type CertificatesConfig struct {
+	Enabled bool `yaml:"enabled,omitempty"`
+	// Namespace is the namespace of Secret with certificates and Service of webhook server
+	Namespace string `yaml:"namespace,omitempty"`
+	// SecretName is the name of Secret in which CA and serving certificate are stored
+	SecretName string `yaml:"secretName,omitempty"`
+	// ServiceName is the name of Service of webhook server, used in DNS names of serving certificate
+	ServiceName string `yaml:"serviceName,omitempty"`
+	// MutatingWebhookConfigurationName is the name of MutatingWebhookConfiguration in which CA bundle is injected
+	MutatingWebhookConfigurationName string `yaml:"mutatingWebhookConfigurationName,omitempty"`
+	// Validity is the validity of generated CA and serving certificate
+	Validity Duration `yaml:"validity,omitempty"`
+	// RotateBefore is the time before expiry when certificates are rotated
+	RotateBefore Duration `yaml:"rotateBefore,omitempty"`
+}
+
+// WebhookConfig configures webhook server
+type WebhookConfig struct {
+	// Host is the address on which webhook server listens, by default it listens on all addresses
+	Host string `yaml:"host,omitempty"`
+	Port int    `yaml:"port,omitempty"`
+	// CertDir is the directory with serving certificate and key, they are not read from it when certificates are managed by operator
+	CertDir  string `yaml:"certDir,omitempty"`
+	CertName string `yaml:"certName,omitempty"`
+	KeyName  string `yaml:"keyName,omitempty"`
+	// ClientCAName is the name of file in CertDir with CA used to verify client certificates,
+	// when it is set clients have to present certificates signed by this CA
+	ClientCAName string `yaml:"clientCAName,omitempty"`
+	// MinTLSVersion is the minimum TLS version, one of VersionTLS12, VersionTLS13
+	MinTLSVersion string `yaml:"minTLSVersion,omitempty"`
+	// CipherSuites lists names of cipher suites used with TLS 1.2, by default Go defaults are used
+	CipherSuites []string `yaml:"cipherSuites,omitempty"`
+}
+
+// WebhookSelectorsConfig configures objectSelectors of Pod webhook kept in sync with podSelectors of TailingSidecarConfigs
+type WebhookSelectorsConfig struct {
+	Enabled bool `yaml:"enabled,omitempty"`
+	// MutatingWebhookConfigurationName is the name of MutatingWebhookConfiguration with Pod webhook
+	MutatingWebhookConfigurationName string `yaml:"mutatingWebhookConfigurationName,omitempty"`
+	// WebhookName is the name of Pod webhook in MutatingWebhookConfiguration
+	WebhookName string `yaml:"webhookName,omitempty"`
+	// OptInLabel is the label which has to be set to "true" in Pods configured with annotation
+	OptInLabel string `yaml:"optInLabel,omitempty"`
+}
+
+// MissedInjectionConfig configures detection of Pods created without tailing sidecars, e.g. when webhook was not available
+type MissedInjectionConfig struct {
+	Enabled bool `yaml:"enabled,omitempty"`
+	// Remediation is None, Evict or RestartOwner, by default Pods without tailing sidecars are only reported
+	Remediation string `yaml:"remediation,omitempty"`
+	// MinPodAge is the minimum age of Pod before it is remediated
+	MinPodAge Duration `yaml:"minPodAge,omitempty"`
+	// MutatingWebhookConfigurationName is the name of MutatingWebhookConfiguration with Pod webhook,
+	// Pods not selected by Pod webhook are not expected to have tailing sidecars
+	MutatingWebhookConfigurationName string `yaml:"mutatingWebhookConfigurationName,omitempty"`
+	// WebhookName is the name of Pod webhook in MutatingWebhookConfiguration
+	WebhookName string `yaml:"webhookName,omitempty"`
+}
+
+// InPlaceResizeConfig configures in-place resize of tailing sidecars in running Pods
+// when their resources in TailingSidecarConfigs or operator defaults change
+type InPlaceResizeConfig struct {
+	Enabled bool `yaml:"enabled,omitempty"`
+}
+
+var tlsVersions = map[string]uint16{
+	"VersionTLS12": tls.VersionTLS12,
+	"VersionTLS13": tls.VersionTLS13,
+}
+
+// Options returns options of webhook server
+func (w WebhookConfig) Options() (webhook.Options, error) {
+	minVersion, ok := tlsVersions[w.MinTLSVersion]
+	if !ok {
+		return webhook.Options{}, fmt.Errorf("invalid webhook minTLSVersion: %s, supported values: VersionTLS12, VersionTLS13", w.MinTLSVersion)
+	}
+	cipherSuites, err := getCipherSuites(w.CipherSuites)
+	if err != nil {
+		return webhook.Options{}, err
+	}
+
+	return webhook.Options{
+		Host:         w.Host,
+		Port:         w.Port,
+		CertDir:      w.CertDir,
+		CertName:     w.CertName,
+		KeyName:      w.KeyName,
+		ClientCAName: w.ClientCAName,
+		TLSOpts: []func(*tls.Config){
+			func(c *tls.Config) {
+				c.MinVersion = minVersion
+				c.CipherSuites = cipherSuites
+			},
+		},
+	}, nil
+}
+
+// getCipherSuites returns IDs of cipher suites, insecure cipher suites are not supported
+func getCipherSuites(names []string) ([]uint16, error) {
+	if len(names) == 0 {
+		return nil, nil
+	}
+	supported := make(map[string]uint16)
+	for _, cipherSuite := range tls.CipherSuites() {
+		supported[cipherSuite.Name] = cipherSuite.ID
+	}
+
+	ids := make([]uint16, 0, len(names))
+	for _, name := range names {
+		id, ok := supported[name]
+		if !ok {
+			return nil, fmt.Errorf("invalid webhook cipher suite: %s", name)
+		}
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
+
 type SidecarConfigConfig struct {
 	Name      string `yaml:"name,omitempty"`
 	MountPath string `yaml:"mountPath,omitempty"`
@@ -76,6 +226,51 @@ func ReadConfig(configPath string, config *Config) error {
 }
 
 func (c *Config) Validate() error {
+	if c.Sidecar.Naming != handler.NamingIndex && c.Sidecar.Naming != handler.NamingHash {
+		return fmt.Errorf("invalid sidecar naming: %s, supported values: %s, %s", c.Sidecar.Naming, handler.NamingIndex, handler.NamingHash)
+	}
+	for _, workload := range c.WorkloadTemplates.Workloads {
+		if err := workload.Validate(); err != nil {
+			return err
+		}
+	}
+	if c.Introspection.Decisions < 0 {
+		return fmt.Errorf("invalid number of introspection decisions: %d, it cannot be negative", c.Introspection.Decisions)
+	}
+	if c.Webhook.Port <= 0 || c.Webhook.Port > 65535 {
+		return fmt.Errorf("invalid webhook port: %d", c.Webhook.Port)
+	}
+	if _, err := c.Webhook.Options(); err != nil {
+		return err
+	}
+	if c.Certificates.Enabled {
+		if c.Certificates.Namespace == "" || c.Certificates.SecretName == "" || c.Certificates.ServiceName == "" {
+			return errors.New("namespace, secretName and serviceName are required for certificates managed by operator")
+		}
+		if c.Certificates.RotateBefore <= 0 || c.Certificates.Validity <= c.Certificates.RotateBefore {
+			return fmt.Errorf("invalid certificates rotateBefore: %s, it has to be positive and shorter than validity: %s",
+				time.Duration(c.Certificates.RotateBefore), time.Duration(c.Certificates.Validity))
+		}
+	}
+	if c.WebhookSelectors.Enabled {
+		if c.WebhookSelectors.MutatingWebhookConfigurationName == "" || c.WebhookSelectors.WebhookName == "" || c.WebhookSelectors.OptInLabel == "" {
+			return errors.New("mutatingWebhookConfigurationName, webhookName and optInLabel are required for webhook selectors")
+		}
+		if errs := validation.IsQualifiedName(c.WebhookSelectors.OptInLabel); len(errs) > 0 {
+			return fmt.Errorf("invalid webhook selectors optInLabel: %s, %s", c.WebhookSelectors.OptInLabel, strings.Join(errs, ", "))
+		}
+	}
+	if c.MissedInjection.Enabled {
+		switch c.MissedInjection.Remediation {
+		case controllers.RemediationNone, controllers.RemediationEvict, controllers.RemediationRestartOwner:
+		default:
+			return fmt.Errorf("invalid missed injection remediation: %s, supported values: %s, %s, %s", c.MissedInjection.Remediation,
+				controllers.RemediationNone, controllers.RemediationEvict, controllers.RemediationRestartOwner)
+		}
+		if c.MissedInjection.MinPodAge < 0 {
+			return fmt.Errorf("invalid missed injection minPodAge: %s, it cannot be negative", time.Duration(c.MissedInjection.MinPodAge))
+		}
+	}
 	return nil
 }
 
@@ -93,6 +288,7 @@ func GetDefaultConfig() Config {
 					corev1.ResourceMemory: resource.MustParse("200Mi"),
 				},
 			},
+			Naming: handler.DefaultNaming,
 		},
 		// reference for values: https://github.com/open-telemetry/opentelemetry-operator/blob/a8653601cd6a6e2b35fd7f3e1a28b4e9608fb794/main.go#L181
 		LeaderElection: LeaderElectionConfig{
@@ -100,5 +296,29 @@ func GetDefaultConfig() Config {
 			RenewDeadline: Duration(time.Second * 107),
 			RetryPeriod:   Duration(time.Second * 26),
 		},
+		Certificates: CertificatesConfig{
+			SecretName:                       "webhook-server-cert",
+			MutatingWebhookConfigurationName: "tailing-sidecar-mutating-webhook-configuration",
+			Validity:                         Duration(time.Hour * 24 * 365),
+			RotateBefore:                     Duration(time.Hour * 24 * 30),
+		},
+		Webhook: WebhookConfig{
+			Port:          9443,
+			CertDir:       "/tmp/k8s-webhook-server/serving-certs",
+			CertName:      "tls.crt",
+			KeyName:       "tls.key",
+			MinTLSVersion: "VersionTLS12",
+		},
+		WebhookSelectors: WebhookSelectorsConfig{
+			MutatingWebhookConfigurationName: "tailing-sidecar-mutating-webhook-configuration",
+			WebhookName:                      "tailing-sidecar.sumologic.com",
+			OptInLabel:                       "tailing-sidecar",
+		},
+		MissedInjection: MissedInjectionConfig{
+			Remediation:                      controllers.RemediationNone,
+			MinPodAge:                        Duration(time.Minute * 5),
+			MutatingWebhookConfigurationName: "tailing-sidecar-mutating-webhook-configuration",
+			WebhookName:                      "tailing-sidecar.sumologic.com",
+		},
 	}
 }
@@ -1,17 +1,24 @@
 package main
 
 import (
+	"crypto/tls"
 	"io/ioutil"
 	"os"
 	"testing"
 	"time"
 
+	tailingsidecarv1 "github.com/SumoLogic/tailing-sidecar/operator/api/v1"
+	"github.com/SumoLogic/tailing-sidecar/operator/controllers"
+	"github.com/SumoLogic/tailing-sidecar/operator/handler"
 	"github.com/stretchr/testify/require"
 	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/resource"
 )
 
 func TestReadConfig(t *testing.T) {
+	otelLogsSizeLimit := resource.MustParse("10Mi")
+	otelFileStorageSizeLimit := resource.MustParse("1Mi")
+
 	testCases := []struct {
 		name          string
 		content       string
@@ -34,12 +41,37 @@ func TestReadConfig(t *testing.T) {
 							corev1.ResourceMemory: resource.MustParse("200Mi"),
 						},
 					},
+					Naming: handler.NamingHash,
 				},
 				LeaderElection: LeaderElectionConfig{
 					LeaseDuration: Duration(time.Second * 137),
 					RenewDeadline: Duration(time.Second * 107),
 					RetryPeriod:   Duration(time.Second * 26),
 				},
+				Certificates: CertificatesConfig{
+					SecretName:                       "webhook-server-cert",
+					MutatingWebhookConfigurationName: "tailing-sidecar-mutating-webhook-configuration",
+					Validity:                         Duration(time.Hour * 24 * 365),
+					RotateBefore:                     Duration(time.Hour * 24 * 30),
+				},
+				Webhook: WebhookConfig{
+					Port:          9443,
+					CertDir:       "/tmp/k8s-webhook-server/serving-certs",
+					CertName:      "tls.crt",
+					KeyName:       "tls.key",
+					MinTLSVersion: "VersionTLS12",
+				},
+				WebhookSelectors: WebhookSelectorsConfig{
+					MutatingWebhookConfigurationName: "tailing-sidecar-mutating-webhook-configuration",
+					WebhookName:                      "tailing-sidecar.sumologic.com",
+					OptInLabel:                       "tailing-sidecar",
+				},
+				MissedInjection: MissedInjectionConfig{
+					Remediation:                      controllers.RemediationNone,
+					MinPodAge:                        Duration(time.Minute * 5),
+					MutatingWebhookConfigurationName: "tailing-sidecar-mutating-webhook-configuration",
+					WebhookName:                      "tailing-sidecar.sumologic.com",
+				},
 			},
 			expectedError: nil,
 		},
@@ -63,12 +95,37 @@ sidecar:
 							corev1.ResourceMemory: resource.MustParse("200Mi"),
 						},
 					},
+					Naming: handler.NamingHash,
 				},
 				LeaderElection: LeaderElectionConfig{
 					LeaseDuration: Duration(time.Second * 137),
 					RenewDeadline: Duration(time.Second * 107),
 					RetryPeriod:   Duration(time.Second * 26),
 				},
+				Certificates: CertificatesConfig{
+					SecretName:                       "webhook-server-cert",
+					MutatingWebhookConfigurationName: "tailing-sidecar-mutating-webhook-configuration",
+					Validity:                         Duration(time.Hour * 24 * 365),
+					RotateBefore:                     Duration(time.Hour * 24 * 30),
+				},
+				Webhook: WebhookConfig{
+					Port:          9443,
+					CertDir:       "/tmp/k8s-webhook-server/serving-certs",
+					CertName:      "tls.crt",
+					KeyName:       "tls.key",
+					MinTLSVersion: "VersionTLS12",
+				},
+				WebhookSelectors: WebhookSelectorsConfig{
+					MutatingWebhookConfigurationName: "tailing-sidecar-mutating-webhook-configuration",
+					WebhookName:                      "tailing-sidecar.sumologic.com",
+					OptInLabel:                       "tailing-sidecar",
+				},
+				MissedInjection: MissedInjectionConfig{
+					Remediation:                      controllers.RemediationNone,
+					MinPodAge:                        Duration(time.Minute * 5),
+					MutatingWebhookConfigurationName: "tailing-sidecar-mutating-webhook-configuration",
+					WebhookName:                      "tailing-sidecar.sumologic.com",
+				},
 			},
 			expectedError: nil,
 		},
@@ -87,7 +144,22 @@ sidecar:
 leaderElection:
   leaseDuration: 10s
   renewDeadline: 10s
-  retryPeriod: 10s`,
+  retryPeriod: 10s
+certificates:
+  enabled: true
+  namespace: tailing-sidecar-system
+  serviceName: tailing-sidecar-operator
+  validity: 2160h
+  rotateBefore: 720h
+webhook:
+  port: 10250
+  certDir: /certs
+  minTLSVersion: VersionTLS13
+webhookSelectors:
+  enabled: true
+  optInLabel: example.com/tailing-sidecar
+inPlaceResize:
+  enabled: true`,
 			expected: Config{
 				Sidecar: SidecarConfig{
 					Image: "my-new-image",
@@ -101,12 +173,178 @@ leaderElection:
 							corev1.ResourceMemory: resource.MustParse("20Mi"),
 						},
 					},
+					Naming: handler.NamingHash,
 				},
 				LeaderElection: LeaderElectionConfig{
 					LeaseDuration: Duration(time.Second * 10),
 					RenewDeadline: Duration(time.Second * 10),
 					RetryPeriod:   Duration(time.Second * 10),
 				},
+				Certificates: CertificatesConfig{
+					Enabled:                          true,
+					Namespace:                        "tailing-sidecar-system",
+					SecretName:                       "webhook-server-cert",
+					ServiceName:                      "tailing-sidecar-operator",
+					MutatingWebhookConfigurationName: "tailing-sidecar-mutating-webhook-configuration",
+					Validity:                         Duration(time.Hour * 24 * 90),
+					RotateBefore:                     Duration(time.Hour * 24 * 30),
+				},
+				Webhook: WebhookConfig{
+					Port:          10250,
+					CertDir:       "/certs",
+					CertName:      "tls.crt",
+					KeyName:       "tls.key",
+					MinTLSVersion: "VersionTLS13",
+				},
+				WebhookSelectors: WebhookSelectorsConfig{
+					Enabled:                          true,
+					MutatingWebhookConfigurationName: "tailing-sidecar-mutating-webhook-configuration",
+					WebhookName:                      "tailing-sidecar.sumologic.com",
+					OptInLabel:                       "example.com/tailing-sidecar",
+				},
+				MissedInjection: MissedInjectionConfig{
+					Remediation:                      controllers.RemediationNone,
+					MinPodAge:                        Duration(time.Minute * 5),
+					MutatingWebhookConfigurationName: "tailing-sidecar-mutating-webhook-configuration",
+					WebhookName:                      "tailing-sidecar.sumologic.com",
+				},
+				InPlaceResize: InPlaceResizeConfig{
+					Enabled: true,
+				},
+			},
+			expectedError: nil,
+		},
+		{
+			name: "sidecar volumes",
+			content: `
+sidecar:
+  volumes:
+    otelLogs:
+      sizeLimit: 10Mi
+    otelFileStorage:
+      medium: Memory
+      sizeLimit: 1Mi`,
+			expected: Config{
+				Sidecar: SidecarConfig{
+					Image: "sumologic/tailing-sidecar:latest",
+					Resources: corev1.ResourceRequirements{
+						Limits: corev1.ResourceList{
+							corev1.ResourceCPU:    resource.MustParse("500m"),
+							corev1.ResourceMemory: resource.MustParse("500Mi"),
+						},
+						Requests: corev1.ResourceList{
+							corev1.ResourceCPU:    resource.MustParse("100m"),
+							corev1.ResourceMemory: resource.MustParse("200Mi"),
+						},
+					},
+					Volumes: tailingsidecarv1.SidecarVolumesSpec{
+						OtelLogs: &corev1.EmptyDirVolumeSource{
+							SizeLimit: &otelLogsSizeLimit,
+						},
+						OtelFileStorage: &corev1.EmptyDirVolumeSource{
+							Medium:    corev1.StorageMediumMemory,
+							SizeLimit: &otelFileStorageSizeLimit,
+						},
+					},
+					Naming: handler.NamingHash,
+				},
+				LeaderElection: LeaderElectionConfig{
+					LeaseDuration: Duration(time.Second * 137),
+					RenewDeadline: Duration(time.Second * 107),
+					RetryPeriod:   Duration(time.Second * 26),
+				},
+				Certificates: CertificatesConfig{
+					SecretName:                       "webhook-server-cert",
+					MutatingWebhookConfigurationName: "tailing-sidecar-mutating-webhook-configuration",
+					Validity:                         Duration(time.Hour * 24 * 365),
+					RotateBefore:                     Duration(time.Hour * 24 * 30),
+				},
+				Webhook: WebhookConfig{
+					Port:          9443,
+					CertDir:       "/tmp/k8s-webhook-server/serving-certs",
+					CertName:      "tls.crt",
+					KeyName:       "tls.key",
+					MinTLSVersion: "VersionTLS12",
+				},
+				WebhookSelectors: WebhookSelectorsConfig{
+					MutatingWebhookConfigurationName: "tailing-sidecar-mutating-webhook-configuration",
+					WebhookName:                      "tailing-sidecar.sumologic.com",
+					OptInLabel:                       "tailing-sidecar",
+				},
+				MissedInjection: MissedInjectionConfig{
+					Remediation:                      controllers.RemediationNone,
+					MinPodAge:                        Duration(time.Minute * 5),
+					MutatingWebhookConfigurationName: "tailing-sidecar-mutating-webhook-configuration",
+					WebhookName:                      "tailing-sidecar.sumologic.com",
+				},
+			},
+			expectedError: nil,
+		},
+		{
+			name: "workload templates",
+			content: `
+workloadTemplates:
+  enabled: true
+  workloads:
+    - group: argoproj.io
+      version: v1alpha1
+      kind: Rollout
+      templatePath: spec.template`,
+			expected: Config{
+				Sidecar: SidecarConfig{
+					Image: "sumologic/tailing-sidecar:latest",
+					Resources: corev1.ResourceRequirements{
+						Limits: corev1.ResourceList{
+							corev1.ResourceCPU:    resource.MustParse("500m"),
+							corev1.ResourceMemory: resource.MustParse("500Mi"),
+						},
+						Requests: corev1.ResourceList{
+							corev1.ResourceCPU:    resource.MustParse("100m"),
+							corev1.ResourceMemory: resource.MustParse("200Mi"),
+						},
+					},
+					Naming: handler.NamingHash,
+				},
+				LeaderElection: LeaderElectionConfig{
+					LeaseDuration: Duration(time.Second * 137),
+					RenewDeadline: Duration(time.Second * 107),
+					RetryPeriod:   Duration(time.Second * 26),
+				},
+				Certificates: CertificatesConfig{
+					SecretName:                       "webhook-server-cert",
+					MutatingWebhookConfigurationName: "tailing-sidecar-mutating-webhook-configuration",
+					Validity:                         Duration(time.Hour * 24 * 365),
+					RotateBefore:                     Duration(time.Hour * 24 * 30),
+				},
+				Webhook: WebhookConfig{
+					Port:          9443,
+					CertDir:       "/tmp/k8s-webhook-server/serving-certs",
+					CertName:      "tls.crt",
+					KeyName:       "tls.key",
+					MinTLSVersion: "VersionTLS12",
+				},
+				WebhookSelectors: WebhookSelectorsConfig{
+					MutatingWebhookConfigurationName: "tailing-sidecar-mutating-webhook-configuration",
+					WebhookName:                      "tailing-sidecar.sumologic.com",
+					OptInLabel:                       "tailing-sidecar",
+				},
+				MissedInjection: MissedInjectionConfig{
+					Remediation:                      controllers.RemediationNone,
+					MinPodAge:                        Duration(time.Minute * 5),
+					MutatingWebhookConfigurationName: "tailing-sidecar-mutating-webhook-configuration",
+					WebhookName:                      "tailing-sidecar.sumologic.com",
+				},
+				WorkloadTemplates: WorkloadTemplatesConfig{
+					Enabled: true,
+					Workloads: []handler.WorkloadTemplate{
+						{
+							Group:        "argoproj.io",
+							Version:      "v1alpha1",
+							Kind:         "Rollout",
+							TemplatePath: "spec.template",
+						},
+					},
+				},
 			},
 			expectedError: nil,
 		},
@@ -141,3 +379,222 @@ func TestReadConfigInvalidFile(t *testing.T) {
 	require.Error(t, err)
 	require.EqualError(t, err, "open non-existing-file: no such file or directory")
 }
+
+func TestConfigValidate(t *testing.T) {
+	testCases := []struct {
+		name             string
+		naming           string
+		workloads        []handler.WorkloadTemplate
+		decisions        int
+		certificates     *CertificatesConfig
+		webhook          *WebhookConfig
+		webhookSelectors *WebhookSelectorsConfig
+		missedInjection  *MissedInjectionConfig
+		expectedError    bool
+	}{
+		{
+			name:   "index naming",
+			naming: handler.NamingIndex,
+		},
+		{
+			name:   "hash naming",
+			naming: handler.NamingHash,
+		},
+		{
+			name:          "unknown naming",
+			naming:        "random",
+			expectedError: true,
+		},
+		{
+			name:   "workload template",
+			naming: handler.NamingIndex,
+			workloads: []handler.WorkloadTemplate{
+				{Group: "apps.kruise.io", Version: "v1alpha1", Kind: "CloneSet", TemplatePath: "spec.template"},
+			},
+		},
+		{
+			name:   "workload template without template path",
+			naming: handler.NamingIndex,
+			workloads: []handler.WorkloadTemplate{
+				{Group: "apps.kruise.io", Version: "v1alpha1", Kind: "CloneSet"},
+			},
+			expectedError: true,
+		},
+		{
+			name:      "introspection decisions",
+			naming:    handler.NamingIndex,
+			decisions: 10,
+		},
+		{
+			name:          "negative introspection decisions",
+			naming:        handler.NamingIndex,
+			decisions:     -1,
+			expectedError: true,
+		},
+		{
+			name:   "certificates",
+			naming: handler.NamingIndex,
+			certificates: &CertificatesConfig{
+				Enabled:      true,
+				Namespace:    "tailing-sidecar-system",
+				SecretName:   "webhook-server-cert",
+				ServiceName:  "tailing-sidecar-operator",
+				Validity:     Duration(time.Hour * 24 * 90),
+				RotateBefore: Duration(time.Hour * 24 * 30),
+			},
+		},
+		{
+			name:   "certificates without service name",
+			naming: handler.NamingIndex,
+			certificates: &CertificatesConfig{
+				Enabled:      true,
+				Namespace:    "tailing-sidecar-system",
+				SecretName:   "webhook-server-cert",
+				Validity:     Duration(time.Hour * 24 * 90),
+				RotateBefore: Duration(time.Hour * 24 * 30),
+			},
+			expectedError: true,
+		},
+		{
+			name:   "certificates rotated before validity",
+			naming: handler.NamingIndex,
+			certificates: &CertificatesConfig{
+				Enabled:      true,
+				Namespace:    "tailing-sidecar-system",
+				SecretName:   "webhook-server-cert",
+				ServiceName:  "tailing-sidecar-operator",
+				Validity:     Duration(time.Hour * 24 * 30),
+				RotateBefore: Duration(time.Hour * 24 * 30),
+			},
+			expectedError: true,
+		},
+		{
+			name:   "webhook cipher suites",
+			naming: handler.NamingIndex,
+			webhook: &WebhookConfig{
+				Port:          9443,
+				MinTLSVersion: "VersionTLS12",
+				CipherSuites:  []string{"TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256", "TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256"},
+			},
+		},
+		{
+			name:   "webhook insecure cipher suite",
+			naming: handler.NamingIndex,
+			webhook: &WebhookConfig{
+				Port:          9443,
+				MinTLSVersion: "VersionTLS12",
+				CipherSuites:  []string{"TLS_RSA_WITH_RC4_128_SHA"},
+			},
+			expectedError: true,
+		},
+		{
+			name:          "webhook unknown TLS version",
+			naming:        handler.NamingIndex,
+			webhook:       &WebhookConfig{Port: 9443, MinTLSVersion: "VersionTLS10"},
+			expectedError: true,
+		},
+		{
+			name:          "webhook invalid port",
+			naming:        handler.NamingIndex,
+			webhook:       &WebhookConfig{Port: 0, MinTLSVersion: "VersionTLS12"},
+			expectedError: true,
+		},
+		{
+			name:   "webhook selectors",
+			naming: handler.NamingIndex,
+			webhookSelectors: &WebhookSelectorsConfig{
+				Enabled:                          true,
+				MutatingWebhookConfigurationName: "tailing-sidecar-mutating-webhook-configuration",
+				WebhookName:                      "tailing-sidecar.sumologic.com",
+				OptInLabel:                       "tailing-sidecar",
+			},
+		},
+		{
+			name:   "webhook selectors without webhook name",
+			naming: handler.NamingIndex,
+			webhookSelectors: &WebhookSelectorsConfig{
+				Enabled:                          true,
+				MutatingWebhookConfigurationName: "tailing-sidecar-mutating-webhook-configuration",
+				OptInLabel:                       "tailing-sidecar",
+			},
+			expectedError: true,
+		},
+		{
+			name:   "webhook selectors invalid opt-in label",
+			naming: handler.NamingIndex,
+			webhookSelectors: &WebhookSelectorsConfig{
+				Enabled:                          true,
+				MutatingWebhookConfigurationName: "tailing-sidecar-mutating-webhook-configuration",
+				WebhookName:                      "tailing-sidecar.sumologic.com",
+				OptInLabel:                       "tailing sidecar",
+			},
+			expectedError: true,
+		},
+		{
+			name:   "missed injection",
+			naming: handler.NamingIndex,
+			missedInjection: &MissedInjectionConfig{
+				Enabled:     true,
+				Remediation: controllers.RemediationEvict,
+				MinPodAge:   Duration(time.Minute),
+			},
+		},
+		{
+			name:   "missed injection unknown remediation",
+			naming: handler.NamingIndex,
+			missedInjection: &MissedInjectionConfig{
+				Enabled:     true,
+				Remediation: "Delete",
+			},
+			expectedError: true,
+		},
+	}
+
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			config := GetDefaultConfig()
+			config.Sidecar.Naming = tt.naming
+			config.WorkloadTemplates.Workloads = tt.workloads
+			config.Introspection.Decisions = tt.decisions
+			if tt.certificates != nil {
+				config.Certificates = *tt.certificates
+			}
+			if tt.webhook != nil {
+				config.Webhook = *tt.webhook
+			}
+			if tt.webhookSelectors != nil {
+				config.WebhookSelectors = *tt.webhookSelectors
+			}
+			if tt.missedInjection != nil {
+				config.MissedInjection = *tt.missedInjection
+			}
+
+			err := config.Validate()
+			if tt.expectedError {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+		})
+	}
+}
+
+func TestWebhookConfigOptions(t *testing.T) {
+	webhookConfig := GetDefaultConfig().Webhook
+	webhookConfig.MinTLSVersion = "VersionTLS13"
+	webhookConfig.ClientCAName = "ca.crt"
+	webhookConfig.CipherSuites = []string{"TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256"}
+
+	options, err := webhookConfig.Options()
+	require.NoError(t, err)
+	require.Equal(t, 9443, options.Port)
+	require.Equal(t, "/tmp/k8s-webhook-server/serving-certs", options.CertDir)
+	require.Equal(t, "ca.crt", options.ClientCAName)
+
+	tlsConfig := &tls.Config{}
+	for _, opt := range options.TLSOpts {
+		opt(tlsConfig)
+	}
+	require.Equal(t, uint16(tls.VersionTLS13), tlsConfig.MinVersion)
+	require.Equal(t, []uint16{tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256}, tlsConfig.CipherSuites)
+}
@@ -0,0 +1,104 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"slices"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	tailingsidecarv1 "github.com/SumoLogic/tailing-sidecar/operator/api/v1"
+	tailingsidecarhandler "github.com/SumoLogic/tailing-sidecar/operator/handler"
+)
+
+// getExpiresAt returns time after which TailingSidecarConfig is not applied to Pods, returns nil when it does not expire
+func getExpiresAt(tailingSidecarConfig *tailingsidecarv1.TailingSidecarConfig) *metav1.Time {
+	expiresAt, ok := tailingsidecarhandler.GetExpirationTime(*tailingSidecarConfig)
+	if !ok {
+		return nil
+	}
+	// time is stored in status with precision to seconds
+	expiresAtStatus := metav1.NewTime(expiresAt).Rfc3339Copy()
+	return &expiresAtStatus
+}
+
+// expire restarts workloads with tailing sidecars from expired TailingSidecarConfig when rollout is enabled
+// and deletes TailingSidecarConfig when expiry policy is Delete, returns true when TailingSidecarConfig was deleted
+func (r *TailingSidecarConfigReconciler) expire(ctx context.Context, tailingSidecarConfig *tailingsidecarv1.TailingSidecarConfig, pods []corev1.Pod) (bool, error) {
+	expiry := tailingSidecarConfig.Spec.Expiry
+	if expiry == nil {
+		return false, nil
+	}
+
+	if expiry.Rollout {
+		if err := r.rolloutWorkloads(ctx, tailingSidecarConfig, pods); err != nil {
+			return false, err
+		}
+	}
+
+	if expiry.Policy != tailingsidecarv1.ExpiryPolicyDelete {
+		return false, nil
+	}
+	if err := r.Delete(ctx, tailingSidecarConfig); err != nil {
+		return false, client.IgnoreNotFound(err)
+	}
+	return true, nil
+}
+
+// rolloutWorkloads restarts workloads of Pods with tailing sidecars from TailingSidecarConfig,
+// restarted Pods are created without these tailing sidecars because TailingSidecarConfig expired
+func (r *TailingSidecarConfigReconciler) rolloutWorkloads(ctx context.Context, tailingSidecarConfig *tailingsidecarv1.TailingSidecarConfig, pods []corev1.Pod) error {
+	workloads := make([]client.Object, 0)
+	for i := range pods {
+		pod := &pods[i]
+		if countSidecars(tailingSidecarConfig, tailingsidecarhandler.GetProvenance(pod.ObjectMeta.Annotations)) == 0 {
+			continue
+		}
+
+		workload, err := getWorkload(ctx, r.Client, pod)
+		if err != nil {
+			return err
+		}
+		if workload == nil {
+			r.Log.Info("Pod is not managed by Deployment, StatefulSet or DaemonSet, tailing sidecars are not removed",
+				"pod", types.NamespacedName{Namespace: pod.Namespace, Name: pod.Name})
+			continue
+		}
+
+		if !slices.ContainsFunc(workloads, func(w client.Object) bool {
+			return w.GetObjectKind().GroupVersionKind() == workload.GetObjectKind().GroupVersionKind() && w.GetName() == workload.GetName()
+		}) {
+			workloads = append(workloads, workload)
+		}
+	}
+
+	restartedAt := time.Now().Format(time.RFC3339)
+	for _, workload := range workloads {
+		r.Log.Info("Restarting workload to remove tailing sidecars from expired TailingSidecarConfig",
+			"kind", workload.GetObjectKind().GroupVersionKind().Kind,
+			"workload", types.NamespacedName{Namespace: workload.GetNamespace(), Name: workload.GetName()})
+		if err := restartWorkload(ctx, r.Client, workload, restartedAt); err != nil {
+			return err
+		}
+	}
+	return nil
+}
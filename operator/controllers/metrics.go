@@ -0,0 +1,76 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+)
+
+const (
+	remediationResultSuccess = "success"
+	remediationResultError   = "error"
+)
+
+// missedInjectionPods is the number of Pods created without tailing sidecars by namespace
+var missedInjectionPods = prometheus.NewGaugeVec(
+	prometheus.GaugeOpts{
+		Name: "tailing_sidecar_missed_injection_pods",
+		Help: "Number of Pods created without tailing sidecars expected by their configuration by namespace",
+	},
+	[]string{"namespace"},
+)
+
+// missedInjectionRemediationsTotal counts remediations of Pods created without tailing sidecars by action and result
+var missedInjectionRemediationsTotal = prometheus.NewCounterVec(
+	prometheus.CounterOpts{
+		Name: "tailing_sidecar_missed_injection_remediations_total",
+		Help: "Number of remediations of Pods created without tailing sidecars by action and result",
+	},
+	[]string{"action", "result"},
+)
+
+// sidecarResizesTotal counts in-place resizes of tailing sidecars by result
+var sidecarResizesTotal = prometheus.NewCounterVec(
+	prometheus.CounterOpts{
+		Name: "tailing_sidecar_resizes_total",
+		Help: "Number of in-place resizes of tailing sidecars in running Pods by result",
+	},
+	[]string{"result"},
+)
+
+func init() {
+	metrics.Registry.MustRegister(missedInjectionPods, missedInjectionRemediationsTotal, sidecarResizesTotal)
+}
+
+// recordMissedInjectionRemediation records result of remediation of Pod created without tailing sidecars
+func recordMissedInjectionRemediation(action string, err error) {
+	result := remediationResultSuccess
+	if err != nil {
+		result = remediationResultError
+	}
+	missedInjectionRemediationsTotal.WithLabelValues(action, result).Inc()
+}
+
+// recordSidecarResize records result of in-place resize of tailing sidecars
+func recordSidecarResize(err error) {
+	result := remediationResultSuccess
+	if err != nil {
+		result = remediationResultError
+	}
+	sidecarResizesTotal.WithLabelValues(result).Inc()
+}
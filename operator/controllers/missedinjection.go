@@ -0,0 +1,159 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"slices"
+	"strings"
+	"time"
+
+	admissionregistrationv1 "k8s.io/api/admissionregistration/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	tailingsidecarv1 "github.com/SumoLogic/tailing-sidecar/operator/api/v1"
+	tailingsidecarhandler "github.com/SumoLogic/tailing-sidecar/operator/handler"
+)
+
+// maxMissedInjectionPodNames is the maximum number of names of Pods without tailing sidecars in status of TailingSidecarConfig
+const maxMissedInjectionPodNames = 10
+
+// MissedInjectionDetector finds tailing sidecars missing in Pods which were created when webhook was not available,
+// webhook uses failurePolicy Ignore, so such Pods are started without tailing sidecars
+type MissedInjectionDetector struct {
+	client.Client
+	// MutatingWebhookConfigurationName is the name of MutatingWebhookConfiguration with Pod webhook,
+	// Pods which are not selected by Pod webhook or webhooks generated from it are not expected to have tailing sidecars
+	MutatingWebhookConfigurationName string
+	// WebhookName is the name of Pod webhook
+	WebhookName string
+}
+
+// FindMissingSidecars describes tailing sidecars which webhook would add to Pod when it was created but which are missing in Pod.
+// Configurations from TailingSidecarConfigs changed after Pod was created are not expected in Pod,
+// as they were not available for webhook.
+func (d *MissedInjectionDetector) FindMissingSidecars(ctx context.Context, pod *corev1.Pod, tailingSidecarConfigs []tailingsidecarv1.TailingSidecarConfig) ([]tailingsidecarhandler.SidecarDescription, error) {
+	if pod.DeletionTimestamp != nil || pod.Status.Phase == corev1.PodSucceeded || pod.Status.Phase == corev1.PodFailed {
+		return nil, nil
+	}
+
+	missing, err := tailingsidecarhandler.FindMissingSidecars(pod, tailingSidecarConfigs)
+	if err != nil || len(missing) == 0 {
+		return nil, err
+	}
+
+	missing = slices.DeleteFunc(missing, func(sidecar tailingsidecarhandler.SidecarDescription) bool {
+		if sidecar.Source == tailingsidecarhandler.SourceAnnotation {
+			return false
+		}
+		index := slices.IndexFunc(tailingSidecarConfigs, func(tailingSidecarConfig tailingsidecarv1.TailingSidecarConfig) bool {
+			return types.NamespacedName{Namespace: tailingSidecarConfig.Namespace, Name: tailingSidecarConfig.Name}.String() == sidecar.Source
+		})
+		// time is stored with precision to seconds, so TailingSidecarConfig changed in the same second is not expected
+		return index < 0 || !getChangedAt(tailingSidecarConfigs[index]).Before(pod.CreationTimestamp.Time)
+	})
+	if len(missing) == 0 {
+		return nil, nil
+	}
+
+	selected, err := d.isSelectedByWebhook(ctx, pod)
+	if err != nil || !selected {
+		return nil, err
+	}
+	return missing, nil
+}
+
+// isSelectedByWebhook checks if Pod is sent to Pod webhook or to one of webhooks generated for podSelectors,
+// Pod is considered selected when Pod webhook is not found, so missing tailing sidecars are not hidden by misconfiguration
+func (d *MissedInjectionDetector) isSelectedByWebhook(ctx context.Context, pod *corev1.Pod) (bool, error) {
+	if d.MutatingWebhookConfigurationName == "" {
+		return true, nil
+	}
+
+	webhookConfiguration := &admissionregistrationv1.MutatingWebhookConfiguration{}
+	if err := d.Get(ctx, types.NamespacedName{Name: d.MutatingWebhookConfigurationName}, webhookConfiguration); err != nil {
+		if apierrors.IsNotFound(err) {
+			return true, nil
+		}
+		return false, err
+	}
+
+	found := false
+	var namespaceLabels labels.Set
+	for _, webhook := range webhookConfiguration.Webhooks {
+		if webhook.Name != d.WebhookName && !isSelectorWebhook(webhook.Name, d.WebhookName) {
+			continue
+		}
+		found = true
+
+		if !matchesWebhookSelector(webhook.ObjectSelector, pod.ObjectMeta.Labels) {
+			continue
+		}
+		if namespaceLabels == nil {
+			namespace := &corev1.Namespace{}
+			if err := d.Get(ctx, types.NamespacedName{Name: pod.Namespace}, namespace); err != nil {
+				return false, err
+			}
+			namespaceLabels = labels.Set(namespace.ObjectMeta.Labels)
+		}
+		if matchesWebhookSelector(webhook.NamespaceSelector, namespaceLabels) {
+			return true, nil
+		}
+	}
+	return !found, nil
+}
+
+// matchesWebhookSelector checks if selector of webhook matches labels, webhook without selector selects all objects
+func matchesWebhookSelector(labelSelector *metav1.LabelSelector, objectLabels map[string]string) bool {
+	if labelSelector == nil {
+		return true
+	}
+	selector, err := metav1.LabelSelectorAsSelector(labelSelector)
+	if err != nil {
+		return false
+	}
+	return selector.Matches(labels.Set(objectLabels))
+}
+
+// getChangedAt returns the last time when TailingSidecarConfig was created or changed, changes of status are omitted
+func getChangedAt(tailingSidecarConfig tailingsidecarv1.TailingSidecarConfig) time.Time {
+	changedAt := tailingSidecarConfig.CreationTimestamp.Time
+	for _, managedFields := range tailingSidecarConfig.ManagedFields {
+		if managedFields.Subresource == "" && managedFields.Time != nil && managedFields.Time.After(changedAt) {
+			changedAt = managedFields.Time.Time
+		}
+	}
+	return changedAt
+}
+
+// describeMissingSidecars returns description of missing tailing sidecars used in logs and Events
+func describeMissingSidecars(missing []tailingsidecarhandler.SidecarDescription) string {
+	descriptions := make([]string, 0, len(missing))
+	for _, sidecar := range missing {
+		description := sidecar.Path + " from " + sidecar.Source
+		if sidecar.Container != "" {
+			description = sidecar.Container + " tailing " + description
+		}
+		descriptions = append(descriptions, description)
+	}
+	return strings.Join(descriptions, ", ")
+}
@@ -0,0 +1,241 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	policyv1 "k8s.io/api/policy/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/events"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	tailingsidecarv1 "github.com/SumoLogic/tailing-sidecar/operator/api/v1"
+)
+
+const (
+	// RemediationNone only reports Pods created without tailing sidecars
+	RemediationNone = "None"
+	// RemediationEvict evicts Pods created without tailing sidecars, so they are recreated by their controllers
+	RemediationEvict = "Evict"
+	// RemediationRestartOwner restarts Deployments, StatefulSets and DaemonSets of Pods created without tailing sidecars
+	RemediationRestartOwner = "RestartOwner"
+
+	missedInjectionReason = "MissingTailingSidecars"
+	// evictionRetryPeriod is the time after which eviction blocked by PodDisruptionBudget is retried
+	evictionRetryPeriod = time.Minute
+)
+
+// MissedInjectionReconciler finds Pods created without tailing sidecars expected by configuration in annotation
+// or in TailingSidecarConfigs, reports them in logs, metrics and Events and optionally remediates them,
+// so they are created again and admitted by webhook
+type MissedInjectionReconciler struct {
+	client.Client
+	Log      logr.Logger
+	Recorder events.EventRecorder
+	Detector *MissedInjectionDetector
+	// Remediation is RemediationNone, RemediationEvict or RemediationRestartOwner
+	Remediation string
+	// MinPodAge is the minimum age of Pod before it is remediated,
+	// it limits how often Pods are recreated when webhook is still not available
+	MinPodAge time.Duration
+
+	mu sync.Mutex
+	// missed keeps Pods without tailing sidecars, they are reported once and counted in metrics
+	missed map[types.NamespacedName]struct{}
+}
+
+// +kubebuilder:rbac:groups="",resources=pods,verbs=get;list;watch
+// +kubebuilder:rbac:groups="",resources=pods/eviction,verbs=create
+// +kubebuilder:rbac:groups="",resources=namespaces,verbs=get;list;watch
+// +kubebuilder:rbac:groups=events.k8s.io,resources=events,verbs=create;patch
+// +kubebuilder:rbac:groups=admissionregistration.k8s.io,resources=mutatingwebhookconfigurations,verbs=get;list;watch
+// +kubebuilder:rbac:groups=apps,resources=replicasets,verbs=get
+// +kubebuilder:rbac:groups=apps,resources=deployments;statefulsets;daemonsets,verbs=get;patch
+
+// Reconcile checks if Pod has tailing sidecars expected by its configuration and remediates Pod without them
+func (r *MissedInjectionReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	log := r.Log.WithValues("pod", req.NamespacedName)
+
+	pod := &corev1.Pod{}
+	if err := r.Get(ctx, req.NamespacedName, pod); err != nil {
+		if apierrors.IsNotFound(err) {
+			r.forget(req.NamespacedName)
+		}
+		return ctrl.Result{}, client.IgnoreNotFound(err)
+	}
+
+	tailingSidecarConfigList := &tailingsidecarv1.TailingSidecarConfigList{}
+	if err := r.List(ctx, tailingSidecarConfigList); err != nil {
+		log.Error(err, "Failed to get list of TailingSidecarConfigs")
+		return ctrl.Result{}, err
+	}
+
+	missing, err := r.Detector.FindMissingSidecars(ctx, pod, tailingSidecarConfigList.Items)
+	if err != nil {
+		log.Error(err, "Failed to find missing tailing sidecars")
+		return ctrl.Result{}, err
+	}
+	if len(missing) == 0 {
+		r.forget(req.NamespacedName)
+		return ctrl.Result{}, nil
+	}
+
+	if r.remember(req.NamespacedName) {
+		description := describeMissingSidecars(missing)
+		log.Info("Pod was created without tailing sidecars", "sidecars", description)
+		r.Recorder.Eventf(pod, nil, corev1.EventTypeWarning, missedInjectionReason, "Detect",
+			"Pod was created without tailing sidecars: %s, Pod needs to be recreated to add them", description)
+	}
+
+	if r.Remediation == "" || r.Remediation == RemediationNone {
+		return ctrl.Result{}, nil
+	}
+	if age := time.Since(pod.CreationTimestamp.Time); age < r.MinPodAge {
+		return ctrl.Result{RequeueAfter: r.MinPodAge - age}, nil
+	}
+
+	switch r.Remediation {
+	case RemediationEvict:
+		return r.evict(ctx, pod, log)
+	case RemediationRestartOwner:
+		return r.restartOwner(ctx, pod, log)
+	}
+	return ctrl.Result{}, nil
+}
+
+// evict evicts Pod managed by controller, so it is recreated and admitted by webhook,
+// Pods without controller are not evicted as they would not be recreated
+func (r *MissedInjectionReconciler) evict(ctx context.Context, pod *corev1.Pod, log logr.Logger) (ctrl.Result, error) {
+	if metav1.GetControllerOf(pod) == nil {
+		log.Info("Pod is not managed by controller, it is not evicted")
+		return ctrl.Result{}, nil
+	}
+
+	eviction := &policyv1.Eviction{ObjectMeta: metav1.ObjectMeta{Namespace: pod.Namespace, Name: pod.Name}}
+	err := r.SubResource("eviction").Create(ctx, pod, eviction)
+	if apierrors.IsTooManyRequests(err) {
+		log.Info("Eviction is blocked by PodDisruptionBudget, it will be retried", "retryAfter", evictionRetryPeriod)
+		return ctrl.Result{RequeueAfter: evictionRetryPeriod}, nil
+	}
+	if apierrors.IsNotFound(err) {
+		return ctrl.Result{}, nil
+	}
+	recordMissedInjectionRemediation(RemediationEvict, err)
+	if err != nil {
+		log.Error(err, "Failed to evict Pod")
+		return ctrl.Result{}, err
+	}
+
+	log.Info("Evicted Pod created without tailing sidecars")
+	r.Recorder.Eventf(pod, nil, corev1.EventTypeNormal, missedInjectionReason, RemediationEvict,
+		"Pod was evicted to be recreated with tailing sidecars")
+	return ctrl.Result{}, nil
+}
+
+// restartOwner restarts Deployment, StatefulSet or DaemonSet of Pod, workload is restarted once
+// for all its Pods created before the restart
+func (r *MissedInjectionReconciler) restartOwner(ctx context.Context, pod *corev1.Pod, log logr.Logger) (ctrl.Result, error) {
+	workload, err := getWorkload(ctx, r.Client, pod)
+	if err != nil {
+		log.Error(err, "Failed to get workload of Pod")
+		return ctrl.Result{}, err
+	}
+	if workload == nil {
+		log.Info("Pod is not managed by Deployment, StatefulSet or DaemonSet, it is not restarted")
+		return ctrl.Result{}, nil
+	}
+	if !getRestartedAt(workload).Before(pod.CreationTimestamp.Time) {
+		return ctrl.Result{}, nil
+	}
+
+	kind := workload.GetObjectKind().GroupVersionKind().Kind
+	log = log.WithValues("kind", kind, "workload", types.NamespacedName{Namespace: workload.GetNamespace(), Name: workload.GetName()})
+	err = restartWorkload(ctx, r.Client, workload, time.Now().Format(time.RFC3339))
+	recordMissedInjectionRemediation(RemediationRestartOwner, err)
+	if err != nil {
+		log.Error(err, "Failed to restart workload")
+		return ctrl.Result{}, err
+	}
+
+	log.Info("Restarted workload of Pod created without tailing sidecars")
+	r.Recorder.Eventf(workload, pod, corev1.EventTypeNormal, missedInjectionReason, RemediationRestartOwner,
+		"%s was restarted to recreate Pod %s with tailing sidecars", kind, pod.Name)
+	return ctrl.Result{}, nil
+}
+
+// remember adds Pod to Pods without tailing sidecars, returns true when Pod was not known
+func (r *MissedInjectionReconciler) remember(key types.NamespacedName) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.missed == nil {
+		r.missed = make(map[types.NamespacedName]struct{})
+	}
+	if _, ok := r.missed[key]; ok {
+		return false
+	}
+	r.missed[key] = struct{}{}
+	missedInjectionPods.WithLabelValues(key.Namespace).Inc()
+	return true
+}
+
+// forget removes Pod from Pods without tailing sidecars
+func (r *MissedInjectionReconciler) forget(key types.NamespacedName) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.missed[key]; !ok {
+		return
+	}
+	delete(r.missed, key)
+	missedInjectionPods.WithLabelValues(key.Namespace).Dec()
+}
+
+// requestsForMissedPods returns requests for Pods without tailing sidecars, they are checked again
+// when TailingSidecarConfig changes, e.g. it is paused or deleted
+func (r *MissedInjectionReconciler) requestsForMissedPods(_ context.Context, _ client.Object) []reconcile.Request {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	requests := make([]reconcile.Request, 0, len(r.missed))
+	for key := range r.missed {
+		requests = append(requests, reconcile.Request{NamespacedName: key})
+	}
+	return requests
+}
+
+// SetupWithManager sets up the controller with the Manager, containers of Pods cannot be changed,
+// so Pods are reconciled only when they are created or their labels or annotations change
+func (r *MissedInjectionReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewControllerManagedBy(mgr).
+		Named("missedinjection").
+		For(&corev1.Pod{}, builder.WithPredicates(predicate.Or(predicate.LabelChangedPredicate{}, predicate.AnnotationChangedPredicate{}))).
+		Watches(
+			&tailingsidecarv1.TailingSidecarConfig{},
+			handler.EnqueueRequestsFromMapFunc(r.requestsForMissedPods),
+		).
+		Complete(r)
+}
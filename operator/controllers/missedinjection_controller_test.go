@@ -0,0 +1,261 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	admissionregistrationv1 "k8s.io/api/admissionregistration/v1"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/events"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+
+	tailingsidecarv1 "github.com/SumoLogic/tailing-sidecar/operator/api/v1"
+)
+
+var _ = Describe("MissedInjectionReconciler", func() {
+	ctx := context.Background()
+
+	missedInjectionScheme := runtime.NewScheme()
+	Expect(clientgoscheme.AddToScheme(missedInjectionScheme)).To(Succeed())
+	Expect(tailingsidecarv1.AddToScheme(missedInjectionScheme)).To(Succeed())
+
+	now := time.Now()
+	tailingSidecarConfig := &tailingsidecarv1.TailingSidecarConfig{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace:         "default",
+			Name:              "example",
+			CreationTimestamp: metav1.NewTime(now.Add(-time.Hour)),
+		},
+		Spec: tailingsidecarv1.TailingSidecarConfigSpec{
+			PodSelector: &metav1.LabelSelector{MatchLabels: map[string]string{"app": "example"}},
+			SidecarSpecs: map[string]tailingsidecarv1.SidecarSpec{
+				"sidecar": {
+					Path:        "/var/log/example.log",
+					VolumeMount: corev1.VolumeMount{Name: "varlog", MountPath: "/var/log"},
+				},
+			},
+		},
+	}
+	newPod := func(name string, createdAt time.Time, containers ...corev1.Container) *corev1.Pod {
+		return &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{
+				Namespace:         "default",
+				Name:              name,
+				Labels:            map[string]string{"app": "example"},
+				CreationTimestamp: metav1.NewTime(createdAt),
+				OwnerReferences: []metav1.OwnerReference{
+					{APIVersion: "apps/v1", Kind: "ReplicaSet", Name: "example", UID: "uid", Controller: ptrTo(true)},
+				},
+			},
+			Spec: corev1.PodSpec{
+				Containers: append([]corev1.Container{
+					{Name: "app", VolumeMounts: []corev1.VolumeMount{{Name: "varlog", MountPath: "/var/log"}}},
+				}, containers...),
+			},
+		}
+	}
+	sidecar := corev1.Container{
+		Name: "sidecar",
+		Env: []corev1.EnvVar{
+			{Name: "PATH_TO_TAIL", Value: "/var/log/example.log"},
+			{Name: "TAILING_SIDECAR", Value: "true"},
+		},
+		VolumeMounts: []corev1.VolumeMount{{Name: "varlog", MountPath: "/var/log"}},
+	}
+	webhookConfiguration := &admissionregistrationv1.MutatingWebhookConfiguration{
+		ObjectMeta: metav1.ObjectMeta{Name: "tailing-sidecar-mutating-webhook-configuration"},
+		Webhooks: []admissionregistrationv1.MutatingWebhook{
+			{
+				Name:              "tailing-sidecar.sumologic.com",
+				NamespaceSelector: &metav1.LabelSelector{MatchLabels: map[string]string{"tailing-sidecar": "enabled"}},
+			},
+		},
+	}
+	namespace := &corev1.Namespace{
+		ObjectMeta: metav1.ObjectMeta{Name: "default", Labels: map[string]string{"tailing-sidecar": "enabled"}},
+	}
+
+	newClient := func(objects ...client.Object) client.WithWatch {
+		return fake.NewClientBuilder().
+			WithScheme(missedInjectionScheme).
+			WithObjects(append(objects, tailingSidecarConfig.DeepCopy(), webhookConfiguration.DeepCopy())...).
+			WithStatusSubresource(&tailingsidecarv1.TailingSidecarConfig{}).
+			Build()
+	}
+
+	When("Pods are created without tailing sidecars", func() {
+		fakeClient := newClient(
+			namespace,
+			newPod("missed", now.Add(-10*time.Minute)),
+			newPod("young", now),
+			newPod("injected", now.Add(-10*time.Minute), sidecar),
+			// Pod created before TailingSidecarConfig
+			newPod("old", now.Add(-2*time.Hour)),
+		)
+		recorder := events.NewFakeRecorder(10)
+		reconciler := &MissedInjectionReconciler{
+			Client:   fakeClient,
+			Log:      logf.Log.WithName("test"),
+			Recorder: recorder,
+			Detector: &MissedInjectionDetector{
+				Client:                           fakeClient,
+				MutatingWebhookConfigurationName: "tailing-sidecar-mutating-webhook-configuration",
+				WebhookName:                      "tailing-sidecar.sumologic.com",
+			},
+			Remediation: RemediationEvict,
+			MinPodAge:   5 * time.Minute,
+		}
+
+		results := make(map[string]ctrl.Result)
+		for _, name := range []string{"missed", "young", "injected", "old"} {
+			result, err := reconciler.Reconcile(ctx, ctrl.Request{NamespacedName: types.NamespacedName{Namespace: "default", Name: name}})
+			Expect(err).ToNot(HaveOccurred())
+			results[name] = result
+		}
+		gauge := testutil.ToFloat64(missedInjectionPods.WithLabelValues("default"))
+		// evicted Pod is reconciled again when it is deleted
+		_, err := reconciler.Reconcile(ctx, ctrl.Request{NamespacedName: types.NamespacedName{Namespace: "default", Name: "missed"}})
+		Expect(err).ToNot(HaveOccurred())
+
+		It("reports Pods without tailing sidecars in Events", func() {
+			Expect(recorder.Events).To(HaveLen(3))
+			Expect(<-recorder.Events).To(Equal("Warning MissingTailingSidecars Pod was created without tailing sidecars: " +
+				"sidecar tailing /var/log/example.log from default/example, Pod needs to be recreated to add them"))
+			Expect(<-recorder.Events).To(Equal("Normal MissingTailingSidecars Pod was evicted to be recreated with tailing sidecars"))
+			Expect(<-recorder.Events).To(HavePrefix("Warning MissingTailingSidecars"))
+		})
+
+		It("counts Pods without tailing sidecars in metrics", func() {
+			Expect(gauge).To(Equal(2.0))
+			Expect(testutil.ToFloat64(missedInjectionPods.WithLabelValues("default"))).To(Equal(1.0))
+		})
+
+		It("evicts Pods older than minimum age", func() {
+			err := fakeClient.Get(ctx, types.NamespacedName{Namespace: "default", Name: "missed"}, &corev1.Pod{})
+			Expect(apierrors.IsNotFound(err)).To(BeTrue())
+			Expect(fakeClient.Get(ctx, types.NamespacedName{Namespace: "default", Name: "young"}, &corev1.Pod{})).To(Succeed())
+			Expect(results["young"].RequeueAfter).To(BeNumerically(">", 4*time.Minute))
+		})
+	})
+
+	When("Pod is not selected by webhook", func() {
+		fakeClient := newClient(
+			&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "default"}},
+			newPod("missed", now.Add(-10*time.Minute)),
+		)
+		detector := &MissedInjectionDetector{
+			Client:                           fakeClient,
+			MutatingWebhookConfigurationName: "tailing-sidecar-mutating-webhook-configuration",
+			WebhookName:                      "tailing-sidecar.sumologic.com",
+		}
+
+		It("does not expect tailing sidecars in Pod", func() {
+			missing, err := detector.FindMissingSidecars(ctx, newPod("missed", now.Add(-10*time.Minute)), []tailingsidecarv1.TailingSidecarConfig{*tailingSidecarConfig})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(missing).To(BeEmpty())
+		})
+	})
+
+	When("remediation restarts owners", func() {
+		replicaSet := &appsv1.ReplicaSet{
+			ObjectMeta: metav1.ObjectMeta{
+				Namespace: "default",
+				Name:      "example",
+				OwnerReferences: []metav1.OwnerReference{
+					{APIVersion: "apps/v1", Kind: "Deployment", Name: "example", UID: "uid", Controller: ptrTo(true)},
+				},
+			},
+		}
+		deployment := &appsv1.Deployment{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "example"}}
+		fakeClient := newClient(
+			namespace, replicaSet, deployment,
+			newPod("first", now.Add(-10*time.Minute)),
+			newPod("second", now.Add(-10*time.Minute)),
+		)
+		recorder := events.NewFakeRecorder(10)
+		reconciler := &MissedInjectionReconciler{
+			Client:      fakeClient,
+			Log:         logf.Log.WithName("test"),
+			Recorder:    recorder,
+			Detector:    &MissedInjectionDetector{Client: fakeClient},
+			Remediation: RemediationRestartOwner,
+		}
+
+		for _, name := range []string{"first", "second"} {
+			_, err := reconciler.Reconcile(ctx, ctrl.Request{NamespacedName: types.NamespacedName{Namespace: "default", Name: name}})
+			Expect(err).ToNot(HaveOccurred())
+		}
+		// Pods are removed from metrics when they are deleted
+		for _, name := range []string{"first", "second"} {
+			reconciler.forget(types.NamespacedName{Namespace: "default", Name: name})
+		}
+
+		It("restarts workload once", func() {
+			restarted := &appsv1.Deployment{}
+			Expect(fakeClient.Get(ctx, types.NamespacedName{Namespace: "default", Name: "example"}, restarted)).To(Succeed())
+			Expect(restarted.Spec.Template.ObjectMeta.Annotations).To(HaveKey(restartedAtAnnotation))
+			Expect(recorder.Events).To(HaveLen(3))
+			Expect(<-recorder.Events).To(HavePrefix("Warning MissingTailingSidecars"))
+			Expect(<-recorder.Events).To(Equal("Normal MissingTailingSidecars Deployment was restarted to recreate Pod first with tailing sidecars"))
+			Expect(<-recorder.Events).To(HavePrefix("Warning MissingTailingSidecars"))
+		})
+	})
+
+	When("TailingSidecarConfig matches Pods without tailing sidecars", func() {
+		fakeClient := newClient(
+			namespace,
+			newPod("missed", now.Add(-10*time.Minute)),
+			newPod("injected", now.Add(-10*time.Minute), sidecar),
+		)
+		reconciler := &TailingSidecarConfigReconciler{
+			Client:                  fakeClient,
+			Log:                     logf.Log.WithName("test"),
+			Scheme:                  missedInjectionScheme,
+			MissedInjectionDetector: &MissedInjectionDetector{Client: fakeClient},
+		}
+
+		_, err := reconciler.Reconcile(ctx, ctrl.Request{NamespacedName: types.NamespacedName{Namespace: "default", Name: "example"}})
+		Expect(err).ToNot(HaveOccurred())
+
+		It("reports Pods in status", func() {
+			reconciled := &tailingsidecarv1.TailingSidecarConfig{}
+			Expect(fakeClient.Get(ctx, types.NamespacedName{Namespace: "default", Name: "example"}, reconciled)).To(Succeed())
+			Expect(reconciled.Status.MissedInjection).To(Equal(&tailingsidecarv1.MissedInjectionStatus{
+				Pods:     1,
+				PodNames: []string{"default/missed"},
+			}))
+		})
+	})
+})
+
+func ptrTo[T any](value T) *T {
+	return &value
+}
@@ -0,0 +1,98 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"slices"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+
+	tailingsidecarv1 "github.com/SumoLogic/tailing-sidecar/operator/api/v1"
+	tailingsidecarhandler "github.com/SumoLogic/tailing-sidecar/operator/handler"
+)
+
+const (
+	// resizeSubResource is the subresource of Pod used to change resources of containers in place
+	resizeSubResource = "resize"
+	// maxResizePodNames is the maximum number of names of Pods with pending resize in status of TailingSidecarConfig
+	maxResizePodNames = 10
+)
+
+// getPendingResize returns reason why resize of Pod is pending, Deferred or Infeasible,
+// it is empty when resize is not pending. Clusters before Kubernetes 1.33 report it in deprecated status field.
+func getPendingResize(pod *corev1.Pod) string {
+	for _, condition := range pod.Status.Conditions {
+		if condition.Type == corev1.PodResizePending && condition.Status == corev1.ConditionTrue {
+			return condition.Reason
+		}
+	}
+	switch pod.Status.Resize {
+	case corev1.PodResizeStatusDeferred:
+		return corev1.PodReasonDeferred
+	case corev1.PodResizeStatusInfeasible:
+		return corev1.PodReasonInfeasible
+	}
+	return ""
+}
+
+// pendingResizeChangedPredicate passes updates of Pods in which resize becomes pending or stops being pending
+var pendingResizeChangedPredicate = predicate.Funcs{
+	UpdateFunc: func(e event.UpdateEvent) bool {
+		oldPod, ok := e.ObjectOld.(*corev1.Pod)
+		if !ok {
+			return false
+		}
+		newPod, ok := e.ObjectNew.(*corev1.Pod)
+		if !ok {
+			return false
+		}
+		return getPendingResize(oldPod) != getPendingResize(newPod)
+	},
+}
+
+// getResizeStatus returns number and names of Pods with tailing sidecars from TailingSidecarConfig in which resize is deferred
+// or infeasible, names of Pods are sorted, so status does not change between reconciliations
+func getResizeStatus(tailingSidecarConfig *tailingsidecarv1.TailingSidecarConfig, pods []corev1.Pod) *tailingsidecarv1.ResizeStatus {
+	status := &tailingsidecarv1.ResizeStatus{}
+	podNames := make([]string, 0)
+	for i := range pods {
+		pod := &pods[i]
+		if countSidecars(tailingSidecarConfig, tailingsidecarhandler.GetProvenance(pod.ObjectMeta.Annotations)) == 0 {
+			continue
+		}
+
+		switch getPendingResize(pod) {
+		case corev1.PodReasonDeferred:
+			status.Deferred++
+		case corev1.PodReasonInfeasible:
+			status.Infeasible++
+		default:
+			continue
+		}
+		podNames = append(podNames, types.NamespacedName{Namespace: pod.Namespace, Name: pod.Name}.String())
+	}
+
+	if len(podNames) == 0 {
+		return nil
+	}
+	slices.Sort(podNames)
+	status.PodNames = podNames[:min(len(podNames), maxResizePodNames)]
+	return status
+}
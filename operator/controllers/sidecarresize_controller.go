@@ -0,0 +1,141 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	tailingsidecarv1 "github.com/SumoLogic/tailing-sidecar/operator/api/v1"
+	tailingsidecarhandler "github.com/SumoLogic/tailing-sidecar/operator/handler"
+)
+
+// SidecarResizeReconciler resizes tailing sidecars in running Pods in place when their resources
+// in TailingSidecarConfigs or operator defaults change, so Pods do not need to be restarted,
+// limits from which environment variables of Go runtime were derived are changed only when Pods are recreated
+type SidecarResizeReconciler struct {
+	client.Client
+	Log logr.Logger
+	// PodExtender provides resources of tailing sidecars in the same way as webhook
+	PodExtender *tailingsidecarhandler.PodExtender
+}
+
+// +kubebuilder:rbac:groups="",resources=pods,verbs=get;list;watch
+// +kubebuilder:rbac:groups="",resources=pods/resize,verbs=patch
+
+// Reconcile patches resize subresource of Pod when CPU or memory of its tailing sidecars differ from configuration,
+// Pods are reconciled when the operator starts, so changes of operator defaults are also applied
+func (r *SidecarResizeReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	log := r.Log.WithValues("pod", req.NamespacedName)
+
+	pod := &corev1.Pod{}
+	if err := r.Get(ctx, req.NamespacedName, pod); err != nil {
+		return ctrl.Result{}, client.IgnoreNotFound(err)
+	}
+	if pod.DeletionTimestamp != nil || pod.Status.Phase == corev1.PodSucceeded || pod.Status.Phase == corev1.PodFailed {
+		return ctrl.Result{}, nil
+	}
+
+	tailingSidecarConfigList := &tailingsidecarv1.TailingSidecarConfigList{}
+	if err := r.List(ctx, tailingSidecarConfigList); err != nil {
+		log.Error(err, "Failed to get list of TailingSidecarConfigs")
+		return ctrl.Result{}, err
+	}
+
+	resized := pod.DeepCopy()
+	containers, recreated, err := r.PodExtender.ResizeSidecars(resized, tailingSidecarConfigList.Items)
+	if err != nil {
+		log.Error(err, "Failed to get resources of tailing sidecars")
+		return ctrl.Result{}, nil
+	}
+	if len(recreated) > 0 {
+		// Pods are not deleted by the operator, they are recreated by their owners, e.g. on rollout of Deployment
+		log.Info("Pod has to be recreated to change limits of tailing sidecars used by Go runtime", "containers", recreated)
+	}
+	if len(containers) == 0 {
+		return ctrl.Result{}, nil
+	}
+
+	// strategic merge patch contains only names and resources of resized containers
+	err = r.SubResource(resizeSubResource).Patch(ctx, resized, client.StrategicMergeFrom(pod))
+	recordSidecarResize(err)
+	switch {
+	case apierrors.IsNotFound(err):
+		return ctrl.Result{}, nil
+	case apierrors.IsInvalid(err) || apierrors.IsForbidden(err):
+		// resize which is not allowed e.g. because it changes QoS class of Pod is not retried
+		log.Error(err, "Tailing sidecars cannot be resized in place", "containers", containers)
+		return ctrl.Result{}, nil
+	case err != nil:
+		log.Error(err, "Failed to resize tailing sidecars", "containers", containers)
+		return ctrl.Result{}, err
+	}
+
+	log.Info("Resized tailing sidecars", "containers", containers)
+	return ctrl.Result{}, nil
+}
+
+// requestsForMatchedPods returns requests for Pods matching podSelector of TailingSidecarConfig
+func (r *SidecarResizeReconciler) requestsForMatchedPods(ctx context.Context, object client.Object) []reconcile.Request {
+	tailingSidecarConfig, ok := object.(*tailingsidecarv1.TailingSidecarConfig)
+	if !ok || tailingSidecarConfig.Spec.PodSelector == nil {
+		return nil
+	}
+	selector, err := metav1.LabelSelectorAsSelector(tailingSidecarConfig.Spec.PodSelector)
+	if err != nil || selector.Empty() {
+		return nil
+	}
+
+	podList := &corev1.PodList{}
+	if err := r.List(ctx, podList, client.MatchingLabelsSelector{Selector: selector}); err != nil {
+		r.Log.Error(err, "Failed to get list of Pods")
+		return nil
+	}
+
+	requests := make([]reconcile.Request, 0, len(podList.Items))
+	for _, pod := range podList.Items {
+		requests = append(requests, reconcile.Request{
+			NamespacedName: types.NamespacedName{Namespace: pod.Namespace, Name: pod.Name},
+		})
+	}
+	return requests
+}
+
+// SetupWithManager sets up the controller with the Manager, Pods are reconciled when they are created
+// or their labels or annotations change and when specification of TailingSidecarConfig matching them changes
+func (r *SidecarResizeReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewControllerManagedBy(mgr).
+		Named("sidecarresize").
+		For(&corev1.Pod{}, builder.WithPredicates(predicate.Or(predicate.LabelChangedPredicate{}, predicate.AnnotationChangedPredicate{}))).
+		Watches(
+			&tailingsidecarv1.TailingSidecarConfig{},
+			handler.EnqueueRequestsFromMapFunc(r.requestsForMatchedPods),
+			builder.WithPredicates(predicate.GenerationChangedPredicate{}),
+		).
+		Complete(r)
+}
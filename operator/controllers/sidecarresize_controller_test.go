@@ -0,0 +1,202 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+
+	tailingsidecarv1 "github.com/SumoLogic/tailing-sidecar/operator/api/v1"
+	tailingsidecarhandler "github.com/SumoLogic/tailing-sidecar/operator/handler"
+)
+
+var _ = Describe("SidecarResizeReconciler", func() {
+	ctx := context.Background()
+
+	sidecarResizeScheme := runtime.NewScheme()
+	Expect(clientgoscheme.AddToScheme(sidecarResizeScheme)).To(Succeed())
+	Expect(tailingsidecarv1.AddToScheme(sidecarResizeScheme)).To(Succeed())
+
+	tailingSidecarConfig := &tailingsidecarv1.TailingSidecarConfig{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "example"},
+		Spec: tailingsidecarv1.TailingSidecarConfigSpec{
+			PodSelector: &metav1.LabelSelector{MatchLabels: map[string]string{"app": "example"}},
+			SidecarSpecs: map[string]tailingsidecarv1.SidecarSpec{
+				"sidecar": {
+					Path:        "/var/log/example.log",
+					VolumeMount: corev1.VolumeMount{Name: "varlog", MountPath: "/var/log"},
+					Resources: corev1.ResourceRequirements{
+						Requests: corev1.ResourceList{corev1.ResourceCPU: resource.MustParse("200m")},
+					},
+				},
+			},
+		},
+	}
+	newPod := func(name string, cpu string) *corev1.Pod {
+		return &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{
+				Namespace: "default",
+				Name:      name,
+				Labels:    map[string]string{"app": "example"},
+			},
+			Spec: corev1.PodSpec{
+				Containers: []corev1.Container{
+					{Name: "app", VolumeMounts: []corev1.VolumeMount{{Name: "varlog", MountPath: "/var/log"}}},
+					{
+						Name: "sidecar",
+						Env: []corev1.EnvVar{
+							{Name: "PATH_TO_TAIL", Value: "/var/log/example.log"},
+							{Name: "TAILING_SIDECAR", Value: "true"},
+						},
+						VolumeMounts: []corev1.VolumeMount{{Name: "varlog", MountPath: "/var/log"}},
+						Resources: corev1.ResourceRequirements{
+							Requests: corev1.ResourceList{
+								corev1.ResourceCPU:    resource.MustParse(cpu),
+								corev1.ResourceMemory: resource.MustParse("200Mi"),
+							},
+						},
+					},
+				},
+			},
+		}
+	}
+	podExtender := &tailingsidecarhandler.PodExtender{
+		TailingSidecarResources: corev1.ResourceRequirements{
+			Requests: corev1.ResourceList{
+				corev1.ResourceCPU:    resource.MustParse("100m"),
+				corev1.ResourceMemory: resource.MustParse("300Mi"),
+			},
+		},
+	}
+
+	When("resources of tailing sidecar differ from configuration", func() {
+		fakeClient := fake.NewClientBuilder().
+			WithScheme(sidecarResizeScheme).
+			WithObjects(tailingSidecarConfig.DeepCopy(), newPod("resized", "100m"), newPod("unchanged", "200m")).
+			Build()
+		reconciler := &SidecarResizeReconciler{
+			Client:      fakeClient,
+			Log:         logf.Log.WithName("test"),
+			PodExtender: podExtender,
+		}
+
+		for _, name := range []string{"resized", "unchanged", "removed"} {
+			_, err := reconciler.Reconcile(ctx, ctrl.Request{NamespacedName: types.NamespacedName{Namespace: "default", Name: name}})
+			Expect(err).ToNot(HaveOccurred())
+		}
+
+		getSidecarResources := func(name string) corev1.ResourceRequirements {
+			pod := &corev1.Pod{}
+			Expect(fakeClient.Get(ctx, types.NamespacedName{Namespace: "default", Name: name}, pod)).To(Succeed())
+			return pod.Spec.Containers[1].Resources
+		}
+
+		It("resizes tailing sidecar to configured resources", func() {
+			resources := getSidecarResources("resized")
+			Expect(resources.Requests.Cpu().String()).To(Equal("200m"))
+			Expect(resources.Requests.Memory().String()).To(Equal("200Mi"))
+		})
+
+		It("does not change tailing sidecar matching configuration", func() {
+			resources := getSidecarResources("unchanged")
+			Expect(resources.Requests.Cpu().String()).To(Equal("200m"))
+		})
+	})
+
+	When("memory limit of tailing sidecar is used by Go runtime", func() {
+		pod := newPod("runtime", "100m")
+		pod.Spec.Containers[1].Resources.Limits = corev1.ResourceList{corev1.ResourceMemory: resource.MustParse("200Mi")}
+		pod.Spec.Containers[1].Env = append(pod.Spec.Containers[1].Env, corev1.EnvVar{Name: "GOMEMLIMIT", Value: "160MiB"})
+		tailingSidecarConfig := tailingSidecarConfig.DeepCopy()
+		tailingSidecarConfig.Spec.SidecarSpecs["sidecar"] = tailingsidecarv1.SidecarSpec{
+			Path:        "/var/log/example.log",
+			VolumeMount: corev1.VolumeMount{Name: "varlog", MountPath: "/var/log"},
+			Resources: corev1.ResourceRequirements{
+				Requests: corev1.ResourceList{corev1.ResourceCPU: resource.MustParse("200m")},
+				Limits:   corev1.ResourceList{corev1.ResourceMemory: resource.MustParse("100Mi")},
+			},
+		}
+		fakeClient := fake.NewClientBuilder().
+			WithScheme(sidecarResizeScheme).
+			WithObjects(tailingSidecarConfig, pod).
+			Build()
+		reconciler := &SidecarResizeReconciler{
+			Client:      fakeClient,
+			Log:         logf.Log.WithName("test"),
+			PodExtender: podExtender,
+		}
+
+		_, err := reconciler.Reconcile(ctx, ctrl.Request{NamespacedName: types.NamespacedName{Namespace: "default", Name: "runtime"}})
+		Expect(err).ToNot(HaveOccurred())
+
+		It("does not change memory limit in place", func() {
+			resized := &corev1.Pod{}
+			Expect(fakeClient.Get(ctx, types.NamespacedName{Namespace: "default", Name: "runtime"}, resized)).To(Succeed())
+			Expect(resized.Spec.Containers[1].Resources.Requests.Cpu().String()).To(Equal("200m"))
+			Expect(resized.Spec.Containers[1].Resources.Limits.Memory().String()).To(Equal("200Mi"))
+		})
+	})
+
+	When("resize of Pods with tailing sidecars is pending", func() {
+		provenanceAnnotation := map[string]string{
+			"tailing-sidecar.sumologic.com/provenance": `[{"container":"sidecar","source":"TailingSidecarConfig","namespace":"default","name":"example","image":"image"}]`,
+		}
+		newPendingPod := func(name string, reason string, annotations map[string]string) corev1.Pod {
+			pod := newPod(name, "100m")
+			pod.ObjectMeta.Annotations = annotations
+			if reason != "" {
+				pod.Status.Conditions = []corev1.PodCondition{
+					{Type: corev1.PodResizePending, Status: corev1.ConditionTrue, Reason: reason},
+				}
+			}
+			return *pod
+		}
+		pods := []corev1.Pod{
+			newPendingPod("pod-2", corev1.PodReasonInfeasible, provenanceAnnotation),
+			newPendingPod("pod-1", corev1.PodReasonDeferred, provenanceAnnotation),
+			newPendingPod("pod-0", "", provenanceAnnotation),
+			// Pod without tailing sidecars from TailingSidecarConfig
+			newPendingPod("pod-3", corev1.PodReasonDeferred, nil),
+		}
+		deprecated := newPendingPod("pod-4", "", provenanceAnnotation)
+		deprecated.Status.Resize = corev1.PodResizeStatusDeferred
+		pods = append(pods, deprecated)
+
+		It("reports Pods in which resize is deferred or infeasible", func() {
+			Expect(getResizeStatus(tailingSidecarConfig, pods)).To(Equal(&tailingsidecarv1.ResizeStatus{
+				Deferred:   2,
+				Infeasible: 1,
+				PodNames:   []string{"default/pod-1", "default/pod-2", "default/pod-4"},
+			}))
+		})
+
+		It("does not report status when resize is not pending", func() {
+			Expect(getResizeStatus(tailingSidecarConfig, pods[2:3])).To(BeNil())
+		})
+	})
+})
@@ -0,0 +1,126 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/go-logr/logr"
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/util/retry"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	tailingsidecarv1 "github.com/SumoLogic/tailing-sidecar/operator/api/v1"
+)
+
+const (
+	// TailingSidecarConfigCRDName is the name of CustomResourceDefinition of TailingSidecarConfig
+	TailingSidecarConfigCRDName = "tailingsidecarconfigs.tailing-sidecar.sumologic.com"
+	storageVersionRetryPeriod   = 30 * time.Second
+)
+
+// StorageVersionMigrator rewrites TailingSidecarConfigs stored in other API versions in the storage version
+// and removes other API versions from storedVersions in status of CustomResourceDefinition.
+// Storage version is the version read by the operator, so the operator does not depend on its own conversion webhook
+// to read TailingSidecarConfigs once they are migrated.
+type StorageVersionMigrator struct {
+	Client client.Client
+	// Reader reads objects directly from API server, so they do not need to be cached
+	Reader client.Reader
+	Log    logr.Logger
+}
+
+// +kubebuilder:rbac:groups=apiextensions.k8s.io,resources=customresourcedefinitions,verbs=get
+// +kubebuilder:rbac:groups=apiextensions.k8s.io,resources=customresourcedefinitions/status,verbs=update
+
+// Start migrates TailingSidecarConfigs, failed migration is retried until it succeeds,
+// because conversion webhook used to read TailingSidecarConfigs may not be available yet
+func (m *StorageVersionMigrator) Start(ctx context.Context) error {
+	_ = wait.PollUntilContextCancel(ctx, storageVersionRetryPeriod, true, func(ctx context.Context) (bool, error) {
+		if err := m.Migrate(ctx); err != nil {
+			m.Log.Error(err, "Failed to migrate TailingSidecarConfigs to storage version")
+			return false, nil
+		}
+		return true, nil
+	})
+	return nil
+}
+
+// NeedLeaderElection makes sure that only one operator migrates TailingSidecarConfigs
+func (m *StorageVersionMigrator) NeedLeaderElection() bool {
+	return true
+}
+
+// Migrate rewrites TailingSidecarConfigs when CustomResourceDefinition lists API versions other than the storage version
+// in storedVersions, no-op updates are enough, because API server always writes objects in the storage version
+func (m *StorageVersionMigrator) Migrate(ctx context.Context) error {
+	crd := &apiextensionsv1.CustomResourceDefinition{}
+	if err := m.Reader.Get(ctx, types.NamespacedName{Name: TailingSidecarConfigCRDName}, crd); err != nil {
+		return err
+	}
+
+	storageVersion := ""
+	for _, version := range crd.Spec.Versions {
+		if version.Storage {
+			storageVersion = version.Name
+		}
+	}
+	if storageVersion != tailingsidecarv1.GroupVersion.Version {
+		return fmt.Errorf("unexpected storage version of TailingSidecarConfig: %s", storageVersion)
+	}
+	if slices.Equal(crd.Status.StoredVersions, []string{storageVersion}) {
+		return nil
+	}
+
+	m.Log.Info("Migrating TailingSidecarConfigs to storage version",
+		"storedVersions", crd.Status.StoredVersions,
+		"storageVersion", storageVersion,
+	)
+
+	tailingSidecarConfigList := &tailingsidecarv1.TailingSidecarConfigList{}
+	if err := m.Reader.List(ctx, tailingSidecarConfigList); err != nil {
+		return err
+	}
+	for _, tailingSidecarConfig := range tailingSidecarConfigList.Items {
+		key := client.ObjectKeyFromObject(&tailingSidecarConfig)
+		err := retry.RetryOnConflict(retry.DefaultRetry, func() error {
+			current := &tailingsidecarv1.TailingSidecarConfig{}
+			if err := m.Reader.Get(ctx, key, current); err != nil {
+				return err
+			}
+			return m.Client.Update(ctx, current)
+		})
+		if err != nil && !apierrors.IsNotFound(err) {
+			return fmt.Errorf("cannot migrate TailingSidecarConfig %s: %w", key, err)
+		}
+	}
+
+	return retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		crd := &apiextensionsv1.CustomResourceDefinition{}
+		if err := m.Reader.Get(ctx, types.NamespacedName{Name: TailingSidecarConfigCRDName}, crd); err != nil {
+			return err
+		}
+		crd.Status.StoredVersions = []string{storageVersion}
+		return m.Client.Status().Update(ctx, crd)
+	})
+}
@@ -0,0 +1,93 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/client/interceptor"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+
+	tailingsidecarv1 "github.com/SumoLogic/tailing-sidecar/operator/api/v1"
+	tailingsidecarv2 "github.com/SumoLogic/tailing-sidecar/operator/api/v2"
+)
+
+var _ = Describe("StorageVersionMigrator", func() {
+	ctx := context.Background()
+
+	migratorScheme := runtime.NewScheme()
+	Expect(clientgoscheme.AddToScheme(migratorScheme)).To(Succeed())
+	Expect(apiextensionsv1.AddToScheme(migratorScheme)).To(Succeed())
+	Expect(tailingsidecarv1.AddToScheme(migratorScheme)).To(Succeed())
+	Expect(tailingsidecarv2.AddToScheme(migratorScheme)).To(Succeed())
+
+	crd := &apiextensionsv1.CustomResourceDefinition{
+		ObjectMeta: metav1.ObjectMeta{Name: TailingSidecarConfigCRDName},
+		Spec: apiextensionsv1.CustomResourceDefinitionSpec{
+			Versions: []apiextensionsv1.CustomResourceDefinitionVersion{
+				{Name: "v1", Served: true, Storage: true},
+				{Name: "v2", Served: true},
+			},
+		},
+		Status: apiextensionsv1.CustomResourceDefinitionStatus{StoredVersions: []string{"v1", "v2"}},
+	}
+	tailingSidecarConfigs := []client.Object{
+		&tailingsidecarv1.TailingSidecarConfig{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "first"}},
+		&tailingsidecarv1.TailingSidecarConfig{ObjectMeta: metav1.ObjectMeta{Namespace: "other", Name: "second"}},
+	}
+
+	updated := make([]string, 0)
+	fakeClient := fake.NewClientBuilder().
+		WithScheme(migratorScheme).
+		WithObjects(append(tailingSidecarConfigs, crd)...).
+		WithStatusSubresource(&apiextensionsv1.CustomResourceDefinition{}).
+		WithInterceptorFuncs(interceptor.Funcs{
+			Update: func(ctx context.Context, c client.WithWatch, obj client.Object, opts ...client.UpdateOption) error {
+				updated = append(updated, client.ObjectKeyFromObject(obj).String())
+				return c.Update(ctx, obj, opts...)
+			},
+		}).
+		Build()
+	migrator := &StorageVersionMigrator{
+		Client: fakeClient,
+		Reader: fakeClient,
+		Log:    logf.Log.WithName("test"),
+	}
+
+	Expect(migrator.Migrate(ctx)).To(Succeed())
+	// TailingSidecarConfigs are migrated once
+	Expect(migrator.Migrate(ctx)).To(Succeed())
+
+	It("rewrites TailingSidecarConfigs", func() {
+		Expect(updated).To(ConsistOf("default/first", "other/second"))
+	})
+
+	It("removes previous versions from storedVersions", func() {
+		migrated := &apiextensionsv1.CustomResourceDefinition{}
+		Expect(fakeClient.Get(ctx, types.NamespacedName{Name: TailingSidecarConfigCRDName}, migrated)).To(Succeed())
+		Expect(migrated.Status.StoredVersions).To(Equal([]string{"v1"}))
+	})
+})
@@ -0,0 +1,311 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"hash/fnv"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	tailingsidecarv1 "github.com/SumoLogic/tailing-sidecar/operator/api/v1"
+	tailingsidecarhandler "github.com/SumoLogic/tailing-sidecar/operator/handler"
+)
+
+const (
+	defaultSessionDuration = time.Hour
+	sessionContainerName   = "tailing-session-%x"
+	sessionName            = "%s-session-%x"
+	// maxSessionPodNameLength keeps name of TailingSession created for Pod within limit of object name length
+	maxSessionPodNameLength = 230
+)
+
+// TailingSessionReconciler reconciles a TailingSession object
+type TailingSessionReconciler struct {
+	client.Client
+	Log         logr.Logger
+	Scheme      *runtime.Scheme
+	PodExtender *tailingsidecarhandler.PodExtender
+}
+
+// +kubebuilder:rbac:groups=tailing-sidecar.sumologic.com,resources=tailingsessions,verbs=get;list;watch;create;update;patch;delete
+// +kubebuilder:rbac:groups=tailing-sidecar.sumologic.com,resources=tailingsessions/status,verbs=get;update;patch
+// +kubebuilder:rbac:groups="",resources=pods/ephemeralcontainers,verbs=update;patch
+
+// Reconcile adds ephemeral container tailing file to running Pod and reports state of the container in status of TailingSession.
+// Ephemeral containers cannot be removed from Pod, so the container stops itself when TailingSession ends.
+func (r *TailingSessionReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	log := r.Log.WithValues("tailingsession", req.NamespacedName)
+
+	tailingSession := &tailingsidecarv1.TailingSession{}
+	if err := r.Get(ctx, req.NamespacedName, tailingSession); err != nil {
+		return ctrl.Result{}, client.IgnoreNotFound(err)
+	}
+
+	phase := tailingSession.Status.Phase
+	if phase == tailingsidecarv1.TailingSessionEnded || phase == tailingsidecarv1.TailingSessionFailed {
+		return ctrl.Result{}, nil
+	}
+
+	pod := &corev1.Pod{}
+	if err := r.Get(ctx, types.NamespacedName{Namespace: tailingSession.Namespace, Name: tailingSession.Spec.PodName}, pod); err != nil {
+		if !apierrors.IsNotFound(err) {
+			log.Error(err, "Failed to get Pod")
+			return ctrl.Result{}, err
+		}
+		return ctrl.Result{}, r.updateStatus(ctx, tailingSession, endSession(tailingSession.Status, phase, "Pod not found"))
+	}
+
+	status, err := r.startSession(ctx, tailingSession, pod)
+	if err != nil {
+		log.Error(err, "Failed to add ephemeral container")
+		return ctrl.Result{}, err
+	}
+	return ctrl.Result{}, r.updateStatus(ctx, tailingSession, status)
+}
+
+// startSession adds ephemeral container to Pod if it was not added yet and returns status of TailingSession
+func (r *TailingSessionReconciler) startSession(ctx context.Context, tailingSession *tailingsidecarv1.TailingSession, pod *corev1.Pod) (tailingsidecarv1.TailingSessionStatus, error) {
+	status := *tailingSession.Status.DeepCopy()
+	containerName := getSessionContainerName(tailingSession)
+
+	if slices.ContainsFunc(pod.Spec.EphemeralContainers, func(c corev1.EphemeralContainer) bool { return c.Name == containerName }) {
+		return getSessionStatus(status, pod, containerName), nil
+	}
+
+	if status.Phase == tailingsidecarv1.TailingSessionRunning {
+		return endSession(status, status.Phase, "Ephemeral container is not available in Pod, Pod was recreated"), nil
+	}
+
+	switch pod.Status.Phase {
+	case corev1.PodRunning:
+	case corev1.PodSucceeded, corev1.PodFailed:
+		return endSession(status, status.Phase, "Pod is not running"), nil
+	default:
+		status.Phase = tailingsidecarv1.TailingSessionPending
+		status.Message = "Waiting for Pod to start"
+		return status, nil
+	}
+
+	duration := defaultSessionDuration
+	if tailingSession.Spec.Duration != nil {
+		duration = tailingSession.Spec.Duration.Duration
+	}
+
+	container, err := r.PodExtender.NewEphemeralContainer(pod, containerName, tailingSession.Spec.VolumeMount, tailingSession.Spec.Path, duration)
+	if err != nil {
+		return endSession(status, status.Phase, err.Error()), nil
+	}
+
+	pod.Spec.EphemeralContainers = append(pod.Spec.EphemeralContainers, container)
+	if err := r.SubResource("ephemeralcontainers").Update(ctx, pod); err != nil {
+		return status, err
+	}
+
+	startedAt := metav1.Now().Rfc3339Copy()
+	endsAt := metav1.NewTime(startedAt.Add(duration))
+	return tailingsidecarv1.TailingSessionStatus{
+		Phase:         tailingsidecarv1.TailingSessionRunning,
+		ContainerName: containerName,
+		StartedAt:     &startedAt,
+		EndsAt:        &endsAt,
+		Message:       "Ephemeral container added to Pod",
+	}, nil
+}
+
+// getSessionStatus returns status of TailingSession with state of ephemeral container
+func getSessionStatus(status tailingsidecarv1.TailingSessionStatus, pod *corev1.Pod, containerName string) tailingsidecarv1.TailingSessionStatus {
+	status.ContainerName = containerName
+	for _, containerStatus := range pod.Status.EphemeralContainerStatuses {
+		if containerStatus.Name != containerName || containerStatus.State.Terminated == nil {
+			continue
+		}
+		terminated := containerStatus.State.Terminated
+		status.Phase = tailingsidecarv1.TailingSessionEnded
+		status.EndedAt = terminated.FinishedAt.DeepCopy()
+		status.Message = fmt.Sprintf("Ephemeral container terminated, reason: %s, exit code: %d", terminated.Reason, terminated.ExitCode)
+		return status
+	}
+
+	status.Phase = tailingsidecarv1.TailingSessionRunning
+	return status
+}
+
+// endSession returns status of TailingSession which ended, TailingSession which did not start fails
+func endSession(status tailingsidecarv1.TailingSessionStatus, phase tailingsidecarv1.TailingSessionPhase, message string) tailingsidecarv1.TailingSessionStatus {
+	status.Phase = tailingsidecarv1.TailingSessionFailed
+	if phase == tailingsidecarv1.TailingSessionRunning {
+		status.Phase = tailingsidecarv1.TailingSessionEnded
+		endedAt := metav1.Now().Rfc3339Copy()
+		status.EndedAt = &endedAt
+	}
+	status.Message = message
+	return status
+}
+
+// updateStatus updates status of TailingSession when it changed
+func (r *TailingSessionReconciler) updateStatus(ctx context.Context, tailingSession *tailingsidecarv1.TailingSession, status tailingsidecarv1.TailingSessionStatus) error {
+	if equality.Semantic.DeepEqual(status, tailingSession.Status) {
+		return nil
+	}
+
+	tailingSession.Status = status
+	if err := r.Status().Update(ctx, tailingSession); err != nil {
+		r.Log.Error(err, "Failed to update status", "tailingsession", types.NamespacedName{Namespace: tailingSession.Namespace, Name: tailingSession.Name})
+		return err
+	}
+	return nil
+}
+
+// getSessionContainerName returns name of ephemeral container for TailingSession
+func getSessionContainerName(tailingSession *tailingsidecarv1.TailingSession) string {
+	if tailingSession.Spec.ContainerName != "" {
+		return tailingSession.Spec.ContainerName
+	}
+	return fmt.Sprintf(sessionContainerName, hashString(tailingSession.Name))
+}
+
+// hashString returns stable hash of given string
+func hashString(value string) uint32 {
+	hash := fnv.New32a()
+	hash.Write([]byte(value))
+	return hash.Sum32()
+}
+
+// requestsForPod returns requests for TailingSessions of Pod
+func (r *TailingSessionReconciler) requestsForPod(ctx context.Context, object client.Object) []reconcile.Request {
+	tailingSessionList := &tailingsidecarv1.TailingSessionList{}
+	if err := r.List(ctx, tailingSessionList, client.InNamespace(object.GetNamespace())); err != nil {
+		r.Log.Error(err, "Failed to get list of TailingSessions")
+		return nil
+	}
+
+	requests := make([]reconcile.Request, 0)
+	for _, tailingSession := range tailingSessionList.Items {
+		if tailingSession.Spec.PodName == object.GetName() {
+			requests = append(requests, reconcile.Request{
+				NamespacedName: types.NamespacedName{Namespace: tailingSession.Namespace, Name: tailingSession.Name},
+			})
+		}
+	}
+	return requests
+}
+
+func (r *TailingSessionReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewControllerManagedBy(mgr).
+		For(&tailingsidecarv1.TailingSession{}).
+		Watches(
+			&corev1.Pod{},
+			handler.EnqueueRequestsFromMapFunc(r.requestsForPod),
+		).
+		Complete(r)
+}
+
+// PodSessionReconciler creates TailingSessions for Pods with session annotation
+type PodSessionReconciler struct {
+	client.Client
+	Log    logr.Logger
+	Scheme *runtime.Scheme
+}
+
+// Reconcile creates TailingSession owned by Pod for every configuration in session annotation,
+// TailingSessions are not created again after they end and they are deleted together with Pod.
+func (r *PodSessionReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	log := r.Log.WithValues("pod", req.NamespacedName)
+
+	pod := &corev1.Pod{}
+	if err := r.Get(ctx, req.NamespacedName, pod); err != nil {
+		return ctrl.Result{}, client.IgnoreNotFound(err)
+	}
+	if !pod.ObjectMeta.DeletionTimestamp.IsZero() {
+		return ctrl.Result{}, nil
+	}
+
+	var duration *metav1.Duration
+	if value, ok := pod.ObjectMeta.Annotations[tailingsidecarhandler.SessionDurationAnnotation]; ok {
+		parsed, err := time.ParseDuration(value)
+		if err != nil {
+			log.Info("Incorrect session duration annotation, default duration is used", "annotation", value, "error", err.Error())
+		} else {
+			duration = &metav1.Duration{Duration: parsed}
+		}
+	}
+
+	for _, config := range tailingsidecarhandler.GetSessionConfigs(pod.ObjectMeta.Annotations) {
+		tailingSession := &tailingsidecarv1.TailingSession{
+			ObjectMeta: metav1.ObjectMeta{
+				Namespace: pod.Namespace,
+				Name:      getPodSessionName(pod.Name, config),
+			},
+			Spec: tailingsidecarv1.TailingSessionSpec{
+				PodName:       pod.Name,
+				ContainerName: config.ContainerName,
+				Path:          config.Path,
+				VolumeMount:   corev1.VolumeMount{Name: config.Volume},
+				Duration:      duration,
+			},
+		}
+		if err := controllerutil.SetOwnerReference(pod, tailingSession, r.Scheme); err != nil {
+			return ctrl.Result{}, err
+		}
+
+		if err := r.Create(ctx, tailingSession); err != nil {
+			if apierrors.IsAlreadyExists(err) {
+				continue
+			}
+			log.Error(err, "Failed to create TailingSession", "name", tailingSession.Name)
+			return ctrl.Result{}, err
+		}
+		log.Info("Created TailingSession", "name", tailingSession.Name)
+	}
+	return ctrl.Result{}, nil
+}
+
+// getPodSessionName returns name of TailingSession for configuration from session annotation of Pod
+func getPodSessionName(podName string, config tailingsidecarhandler.SessionConfig) string {
+	if len(podName) > maxSessionPodNameLength {
+		podName = strings.TrimRight(podName[:maxSessionPodNameLength], "-.")
+	}
+	return fmt.Sprintf(sessionName, podName, hashString(config.ContainerName+":"+config.Volume+":"+config.Path))
+}
+
+func (r *PodSessionReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewControllerManagedBy(mgr).
+		Named("podsession").
+		For(&corev1.Pod{}, builder.WithPredicates(predicate.NewPredicateFuncs(func(object client.Object) bool {
+			_, ok := object.GetAnnotations()[tailingsidecarhandler.SessionAnnotation]
+			return ok
+		}))).
+		Complete(r)
+}
@@ -0,0 +1,222 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/client/interceptor"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+
+	tailingsidecarv1 "github.com/SumoLogic/tailing-sidecar/operator/api/v1"
+	tailingsidecarhandler "github.com/SumoLogic/tailing-sidecar/operator/handler"
+)
+
+var _ = Describe("TailingSessionReconciler", func() {
+	ctx := context.Background()
+
+	sessionScheme := runtime.NewScheme()
+	Expect(clientgoscheme.AddToScheme(sessionScheme)).To(Succeed())
+	Expect(tailingsidecarv1.AddToScheme(sessionScheme)).To(Succeed())
+
+	newPod := func(name string, annotations map[string]string) *corev1.Pod {
+		return &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: name, UID: types.UID(name), Annotations: annotations},
+			Spec: corev1.PodSpec{
+				Containers: []corev1.Container{
+					{
+						Name:         "app",
+						Image:        "busybox",
+						VolumeMounts: []corev1.VolumeMount{{Name: "varlog", MountPath: "/var/log"}},
+					},
+				},
+			},
+			Status: corev1.PodStatus{Phase: corev1.PodRunning},
+		}
+	}
+	newTailingSession := func(name string, podName string) *tailingsidecarv1.TailingSession {
+		return &tailingsidecarv1.TailingSession{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: name},
+			Spec: tailingsidecarv1.TailingSessionSpec{
+				PodName:     podName,
+				Path:        "/var/log/debug.log",
+				VolumeMount: corev1.VolumeMount{Name: "varlog"},
+				Duration:    &metav1.Duration{Duration: 30 * time.Minute},
+			},
+		}
+	}
+
+	endedPod := newPod("ended", nil)
+	endedPod.Spec.EphemeralContainers = []corev1.EphemeralContainer{
+		{EphemeralContainerCommon: corev1.EphemeralContainerCommon{Name: "debug"}},
+	}
+	endedPod.Status.EphemeralContainerStatuses = []corev1.ContainerStatus{
+		{
+			Name: "debug",
+			State: corev1.ContainerState{
+				Terminated: &corev1.ContainerStateTerminated{ExitCode: 143, Reason: "Error", FinishedAt: metav1.Now().Rfc3339Copy()},
+			},
+		},
+	}
+	endedSession := newTailingSession("ended", "ended")
+	endedSession.Spec.ContainerName = "debug"
+	endedSession.Status.Phase = tailingsidecarv1.TailingSessionRunning
+
+	fakeClient := fake.NewClientBuilder().
+		WithScheme(sessionScheme).
+		WithObjects(
+			newPod("running", nil), newTailingSession("running", "running"),
+			endedPod, endedSession,
+			newTailingSession("missing", "missing"),
+		).
+		WithStatusSubresource(&tailingsidecarv1.TailingSession{}).
+		WithInterceptorFuncs(interceptor.Funcs{
+			// fake client updates only status for subresources, ephemeral containers are in Pod specification
+			SubResourceUpdate: func(ctx context.Context, c client.Client, subResource string, obj client.Object, opts ...client.SubResourceUpdateOption) error {
+				if subResource == "ephemeralcontainers" {
+					return c.Update(ctx, obj)
+				}
+				return c.SubResource(subResource).Update(ctx, obj, opts...)
+			},
+		}).
+		Build()
+	reconciler := &TailingSessionReconciler{
+		Client: fakeClient,
+		Log:    logf.Log.WithName("test"),
+		Scheme: sessionScheme,
+		PodExtender: &tailingsidecarhandler.PodExtender{
+			TailingSidecarImage: "sumologic/tailing-sidecar:latest",
+		},
+	}
+
+	for _, name := range []string{"running", "ended", "missing"} {
+		_, err := reconciler.Reconcile(ctx, ctrl.Request{NamespacedName: types.NamespacedName{Namespace: "default", Name: name}})
+		Expect(err).ToNot(HaveOccurred())
+	}
+
+	getStatus := func(name string) tailingsidecarv1.TailingSessionStatus {
+		tailingSession := &tailingsidecarv1.TailingSession{}
+		Expect(fakeClient.Get(ctx, types.NamespacedName{Namespace: "default", Name: name}, tailingSession)).To(Succeed())
+		return tailingSession.Status
+	}
+
+	It("adds ephemeral container to running Pod", func() {
+		status := getStatus("running")
+		Expect(status.Phase).To(Equal(tailingsidecarv1.TailingSessionRunning))
+		Expect(status.ContainerName).To(HavePrefix("tailing-session-"))
+		Expect(status.EndsAt.Sub(status.StartedAt.Time)).To(Equal(30 * time.Minute))
+
+		pod := &corev1.Pod{}
+		Expect(fakeClient.Get(ctx, types.NamespacedName{Namespace: "default", Name: "running"}, pod)).To(Succeed())
+		Expect(pod.Spec.EphemeralContainers).To(HaveLen(1))
+		container := pod.Spec.EphemeralContainers[0]
+		Expect(container.Name).To(Equal(status.ContainerName))
+		Expect(container.Image).To(Equal("sumologic/tailing-sidecar:latest"))
+		Expect(container.Command).To(Equal([]string{"timeout", "1800", "/otelcol-sumo", "--config", "/etc/otel/config.yaml"}))
+		Expect(container.VolumeMounts).To(Equal([]corev1.VolumeMount{{Name: "varlog", MountPath: "/var/log"}}))
+		Expect(container.Env).To(ContainElement(corev1.EnvVar{Name: "PATH_TO_TAIL", Value: "/var/log/debug.log"}))
+	})
+
+	It("ends session when ephemeral container terminated", func() {
+		status := getStatus("ended")
+		Expect(status.Phase).To(Equal(tailingsidecarv1.TailingSessionEnded))
+		Expect(status.EndedAt).ToNot(BeNil())
+		Expect(status.Message).To(ContainSubstring("exit code: 143"))
+	})
+
+	It("fails session for missing Pod", func() {
+		status := getStatus("missing")
+		Expect(status.Phase).To(Equal(tailingsidecarv1.TailingSessionFailed))
+		Expect(status.Message).To(Equal("Pod not found"))
+	})
+})
+
+var _ = Describe("PodSessionReconciler", func() {
+	ctx := context.Background()
+
+	sessionScheme := runtime.NewScheme()
+	Expect(clientgoscheme.AddToScheme(sessionScheme)).To(Succeed())
+	Expect(tailingsidecarv1.AddToScheme(sessionScheme)).To(Succeed())
+
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: "default",
+			Name:      "pod",
+			UID:       "pod-uid",
+			Annotations: map[string]string{
+				tailingsidecarhandler.SessionAnnotation:         "varlog:/var/log/debug.log;debug:varlog:/var/log/trace.log",
+				tailingsidecarhandler.SessionDurationAnnotation: "15m",
+			},
+		},
+	}
+
+	fakeClient := fake.NewClientBuilder().
+		WithScheme(sessionScheme).
+		WithObjects(pod).
+		Build()
+	reconciler := &PodSessionReconciler{
+		Client: fakeClient,
+		Log:    logf.Log.WithName("test"),
+		Scheme: sessionScheme,
+	}
+
+	// TailingSessions are created once
+	for i := 0; i < 2; i++ {
+		_, err := reconciler.Reconcile(ctx, ctrl.Request{NamespacedName: types.NamespacedName{Namespace: "default", Name: "pod"}})
+		Expect(err).ToNot(HaveOccurred())
+	}
+
+	It("creates TailingSessions owned by Pod", func() {
+		tailingSessionList := &tailingsidecarv1.TailingSessionList{}
+		Expect(fakeClient.List(ctx, tailingSessionList)).To(Succeed())
+		Expect(tailingSessionList.Items).To(HaveLen(2))
+
+		specs := make([]tailingsidecarv1.TailingSessionSpec, 0)
+		for _, tailingSession := range tailingSessionList.Items {
+			Expect(tailingSession.Name).To(HavePrefix("pod-session-"))
+			Expect(tailingSession.OwnerReferences).To(HaveLen(1))
+			Expect(tailingSession.OwnerReferences[0].UID).To(Equal(types.UID("pod-uid")))
+			specs = append(specs, tailingSession.Spec)
+		}
+		Expect(specs).To(ConsistOf(
+			tailingsidecarv1.TailingSessionSpec{
+				PodName:     "pod",
+				Path:        "/var/log/debug.log",
+				VolumeMount: corev1.VolumeMount{Name: "varlog"},
+				Duration:    &metav1.Duration{Duration: 15 * time.Minute},
+			},
+			tailingsidecarv1.TailingSessionSpec{
+				PodName:       "pod",
+				ContainerName: "debug",
+				Path:          "/var/log/trace.log",
+				VolumeMount:   corev1.VolumeMount{Name: "varlog"},
+				Duration:      &metav1.Duration{Duration: 15 * time.Minute},
+			},
+		))
+	})
+})
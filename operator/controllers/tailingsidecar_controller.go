@@ -17,14 +17,26 @@ limitations under the License.
 package controllers
 
 import (
+	"cmp"
 	"context"
+	"slices"
+	"time"
 
 	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
 
 	tailingsidecarv1 "github.com/SumoLogic/tailing-sidecar/operator/api/v1"
+	tailingsidecarhandler "github.com/SumoLogic/tailing-sidecar/operator/handler"
 )
 
 // TailingSidecarConfigReconciler reconciles a TailingSidecarConfig object
@@ -32,32 +44,330 @@ type TailingSidecarConfigReconciler struct {
 	client.Client
 	Log    logr.Logger
 	Scheme *runtime.Scheme
+	// MissedInjectionDetector finds Pods created without tailing sidecars, they are not reported when it is not set
+	MissedInjectionDetector *MissedInjectionDetector
+	// InPlaceResize enables reporting of Pods in which in-place resize of tailing sidecars is deferred or infeasible
+	InPlaceResize bool
 }
 
 // +kubebuilder:rbac:groups=tailing-sidecar.sumologic.com,resources=tailingsidecarconfigs,verbs=get;list;watch;create;update;patch;delete
 // +kubebuilder:rbac:groups=tailing-sidecar.sumologic.com,resources=tailingsidecarconfigs/status,verbs=get;update;patch
 // +kubebuilder:rbac:groups=tailing-sidecar.sumologic.com,resources=tailingsidecars/finalizers,verbs=update
+// +kubebuilder:rbac:groups="",resources=pods,verbs=get;list;watch
+// +kubebuilder:rbac:groups=apps,resources=replicasets,verbs=get
+// +kubebuilder:rbac:groups=apps,resources=deployments;statefulsets;daemonsets,verbs=get;patch
 
-// Reconcile is part of the main kubernetes reconciliation loop which aims to
-// move the current state of the cluster closer to the desired state.
-// TODO(user): Modify the Reconcile function to compare the state specified by
-// the TailingSidecar object against the actual cluster state, and then
-// perform operations to make the cluster state reflect the state specified by
-// the user.
+// Reconcile reports in status of TailingSidecarConfig conflicts between its configurations and other configurations,
+// tailing sidecars which would be added in DryRun mode and pending in-place resizes for Pods matching podSelector.
+// When TailingSidecarConfig expires, workloads with its tailing sidecars are restarted if rollout is enabled
+// and TailingSidecarConfig is deleted or marked as expired.
 //
 // For more details, check Reconcile and its Result here:
 // - https://pkg.go.dev/sigs.k8s.io/controller-runtime@v0.8.3/pkg/reconcile
 func (r *TailingSidecarConfigReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
-	_ = context.Background()
-	_ = r.Log.WithValues("tailingsidecarconfigs", req.NamespacedName)
+	log := r.Log.WithValues("tailingsidecarconfigs", req.NamespacedName)
 
-	// your logic here
+	tailingSidecarConfig := &tailingsidecarv1.TailingSidecarConfig{}
+	if err := r.Get(ctx, req.NamespacedName, tailingSidecarConfig); err != nil {
+		return ctrl.Result{}, client.IgnoreNotFound(err)
+	}
 
-	return ctrl.Result{}, nil
+	pods, err := r.getPods(ctx, tailingSidecarConfig)
+	if err != nil {
+		log.Error(err, "Failed to get list of Pods")
+		return ctrl.Result{}, err
+	}
+
+	expiresAt := getExpiresAt(tailingSidecarConfig)
+	expired := expiresAt != nil && !time.Now().Before(expiresAt.Time)
+	if expired && !tailingSidecarConfig.Status.Expired {
+		log.Info("TailingSidecarConfig expired", "expiresAt", expiresAt)
+		deleted, err := r.expire(ctx, tailingSidecarConfig, pods)
+		if err != nil {
+			log.Error(err, "Failed to handle expiry")
+			return ctrl.Result{}, err
+		}
+		if deleted {
+			return ctrl.Result{}, nil
+		}
+	}
+
+	conflicts, err := r.getConflicts(ctx, tailingSidecarConfig, pods)
+	if err != nil {
+		log.Error(err, "Failed to get conflicts")
+		return ctrl.Result{}, err
+	}
+
+	missedInjection, err := r.getMissedInjectionStatus(ctx, tailingSidecarConfig, pods)
+	if err != nil {
+		log.Error(err, "Failed to find Pods without tailing sidecars")
+		return ctrl.Result{}, err
+	}
+
+	status := tailingsidecarv1.TailingSidecarConfigStatus{
+		Conflicts:       conflicts,
+		DryRun:          getDryRunStatus(tailingSidecarConfig, pods),
+		Canary:          getCanaryStatus(tailingSidecarConfig, pods),
+		ExpiresAt:       expiresAt,
+		Expired:         expired,
+		MissedInjection: missedInjection,
+	}
+	if r.InPlaceResize {
+		status.Resize = getResizeStatus(tailingSidecarConfig, pods)
+	}
+
+	// TailingSidecarConfig is reconciled again when it expires
+	result := ctrl.Result{}
+	if expiresAt != nil && !expired {
+		result.RequeueAfter = time.Until(expiresAt.Time)
+	}
+
+	if equality.Semantic.DeepEqual(status, tailingSidecarConfig.Status) {
+		return result, nil
+	}
+
+	tailingSidecarConfig.Status = status
+	if err := r.Status().Update(ctx, tailingSidecarConfig); err != nil {
+		log.Error(err, "Failed to update status")
+		return ctrl.Result{}, err
+	}
+	return result, nil
+}
+
+// getPods returns Pods matching podSelector of TailingSidecarConfig
+func (r *TailingSidecarConfigReconciler) getPods(ctx context.Context, tailingSidecarConfig *tailingsidecarv1.TailingSidecarConfig) ([]corev1.Pod, error) {
+	if tailingSidecarConfig.Spec.PodSelector == nil {
+		return nil, nil
+	}
+	selector, err := metav1.LabelSelectorAsSelector(tailingSidecarConfig.Spec.PodSelector)
+	if err != nil || selector.Empty() {
+		return nil, nil
+	}
+
+	podList := &corev1.PodList{}
+	if err := r.List(ctx, podList, client.MatchingLabelsSelector{Selector: selector}); err != nil {
+		return nil, err
+	}
+	return podList.Items, nil
+}
+
+// getConflicts returns conflicts of configurations from TailingSidecarConfig found in Pods matching its podSelector,
+// conflict is reported once for each pair of conflicting configurations
+func (r *TailingSidecarConfigReconciler) getConflicts(ctx context.Context, tailingSidecarConfig *tailingsidecarv1.TailingSidecarConfig, pods []corev1.Pod) ([]tailingsidecarv1.ConfigConflict, error) {
+	if len(pods) == 0 || !isActive(*tailingSidecarConfig) {
+		return nil, nil
+	}
+
+	tailingSidecarConfigList := &tailingsidecarv1.TailingSidecarConfigList{}
+	if err := r.List(ctx, tailingSidecarConfigList); err != nil {
+		return nil, err
+	}
+	// only active TailingSidecarConfigs are applied to Pods
+	tailingSidecarConfigs := slices.DeleteFunc(tailingSidecarConfigList.Items, func(t tailingsidecarv1.TailingSidecarConfig) bool {
+		return !isActive(t)
+	})
+
+	source := types.NamespacedName{Namespace: tailingSidecarConfig.Namespace, Name: tailingSidecarConfig.Name}.String()
+	conflicts := make([]tailingsidecarv1.ConfigConflict, 0)
+	for i := range pods {
+		pod := &pods[i]
+		podConflicts, err := tailingsidecarhandler.FindConflicts(pod, tailingSidecarConfigs)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, podConflict := range podConflicts {
+			conflict := tailingsidecarv1.ConfigConflict{
+				Strategy: podConflict.Strategy,
+				Winner:   podConflict.Winner(),
+				Pod:      types.NamespacedName{Namespace: pod.Namespace, Name: pod.Name}.String(),
+			}
+			switch source {
+			case podConflict.Source:
+				conflict.Sidecar = podConflict.Sidecar
+				conflict.ConflictsWith = podConflict.ConflictingSource
+				conflict.ConflictingSidecar = podConflict.ConflictingSidecar
+			case podConflict.ConflictingSource:
+				conflict.Sidecar = podConflict.ConflictingSidecar
+				conflict.ConflictsWith = podConflict.Source
+				conflict.ConflictingSidecar = podConflict.Sidecar
+			default:
+				continue
+			}
+
+			if !slices.ContainsFunc(conflicts, func(c tailingsidecarv1.ConfigConflict) bool {
+				return c.Sidecar == conflict.Sidecar &&
+					c.ConflictsWith == conflict.ConflictsWith &&
+					c.ConflictingSidecar == conflict.ConflictingSidecar
+			}) {
+				conflicts = append(conflicts, conflict)
+			}
+		}
+	}
+
+	if len(conflicts) == 0 {
+		return nil, nil
+	}
+	slices.SortFunc(conflicts, func(a, b tailingsidecarv1.ConfigConflict) int {
+		return cmp.Or(
+			cmp.Compare(a.Sidecar, b.Sidecar),
+			cmp.Compare(a.ConflictsWith, b.ConflictsWith),
+			cmp.Compare(a.ConflictingSidecar, b.ConflictingSidecar),
+		)
+	})
+	return conflicts, nil
+}
+
+// isActive checks if configurations from TailingSidecarConfig are applied to Pods
+func isActive(tailingSidecarConfig tailingsidecarv1.TailingSidecarConfig) bool {
+	if tailingsidecarhandler.IsExpired(tailingSidecarConfig, time.Now()) {
+		return false
+	}
+	return tailingSidecarConfig.Spec.Mode == "" || tailingSidecarConfig.Spec.Mode == tailingsidecarv1.ModeActive
+}
+
+// getDryRunStatus returns number of Pods and tailing sidecars which would be added to Pods by TailingSidecarConfig
+// in DryRun mode, they are read from annotations set by webhook
+func getDryRunStatus(tailingSidecarConfig *tailingsidecarv1.TailingSidecarConfig, pods []corev1.Pod) *tailingsidecarv1.DryRunStatus {
+	if tailingSidecarConfig.Spec.Mode != tailingsidecarv1.ModeDryRun {
+		return nil
+	}
+
+	status := &tailingsidecarv1.DryRunStatus{}
+	for _, pod := range pods {
+		sidecars := countSidecars(tailingSidecarConfig, tailingsidecarhandler.GetDryRunSidecars(pod.ObjectMeta.Annotations))
+		if sidecars > 0 {
+			status.Pods++
+			status.Sidecars += sidecars
+		}
+	}
+	return status
+}
+
+// getCanaryStatus returns number of Pods with and without tailing sidecars from TailingSidecarConfig with canary,
+// tailing sidecars are read from provenance annotation or from dry-run annotation in DryRun mode
+func getCanaryStatus(tailingSidecarConfig *tailingsidecarv1.TailingSidecarConfig, pods []corev1.Pod) *tailingsidecarv1.CanaryStatus {
+	if tailingSidecarConfig.Spec.Canary == nil {
+		return nil
+	}
+
+	status := &tailingsidecarv1.CanaryStatus{}
+	for _, pod := range pods {
+		sidecars := tailingsidecarhandler.GetProvenance(pod.ObjectMeta.Annotations)
+		if tailingSidecarConfig.Spec.Mode == tailingsidecarv1.ModeDryRun {
+			sidecars = tailingsidecarhandler.GetDryRunSidecars(pod.ObjectMeta.Annotations)
+		}
+
+		if countSidecars(tailingSidecarConfig, sidecars) > 0 {
+			status.CanaryPods++
+		} else {
+			status.NonCanaryPods++
+		}
+	}
+	return status
+}
+
+// getMissedInjectionStatus returns number and names of Pods matching podSelector which were created
+// without tailing sidecars from TailingSidecarConfig, names of Pods are sorted, so status does not change between reconciliations
+func (r *TailingSidecarConfigReconciler) getMissedInjectionStatus(ctx context.Context, tailingSidecarConfig *tailingsidecarv1.TailingSidecarConfig, pods []corev1.Pod) (*tailingsidecarv1.MissedInjectionStatus, error) {
+	if r.MissedInjectionDetector == nil || len(pods) == 0 || !isActive(*tailingSidecarConfig) {
+		return nil, nil
+	}
+
+	tailingSidecarConfigList := &tailingsidecarv1.TailingSidecarConfigList{}
+	if err := r.List(ctx, tailingSidecarConfigList); err != nil {
+		return nil, err
+	}
+
+	source := types.NamespacedName{Namespace: tailingSidecarConfig.Namespace, Name: tailingSidecarConfig.Name}.String()
+	podNames := make([]string, 0)
+	for i := range pods {
+		pod := &pods[i]
+		missing, err := r.MissedInjectionDetector.FindMissingSidecars(ctx, pod, tailingSidecarConfigList.Items)
+		if err != nil {
+			return nil, err
+		}
+		if slices.ContainsFunc(missing, func(sidecar tailingsidecarhandler.SidecarDescription) bool { return sidecar.Source == source }) {
+			podNames = append(podNames, types.NamespacedName{Namespace: pod.Namespace, Name: pod.Name}.String())
+		}
+	}
+
+	if len(podNames) == 0 {
+		return nil, nil
+	}
+	slices.Sort(podNames)
+	return &tailingsidecarv1.MissedInjectionStatus{
+		Pods:     int32(len(podNames)),
+		PodNames: podNames[:min(len(podNames), maxMissedInjectionPodNames)],
+	}, nil
+}
+
+// countSidecars returns number of tailing sidecars from TailingSidecarConfig
+func countSidecars(tailingSidecarConfig *tailingsidecarv1.TailingSidecarConfig, sidecars []tailingsidecarhandler.SidecarProvenance) int32 {
+	count := int32(0)
+	for _, sidecar := range sidecars {
+		if sidecar.Source == tailingsidecarhandler.SourceTailingSidecarConfig &&
+			sidecar.Namespace == tailingSidecarConfig.Namespace &&
+			sidecar.Name == tailingSidecarConfig.Name {
+			count++
+		}
+	}
+	return count
+}
+
+// requestsForAllTailingSidecarConfigs returns requests for all TailingSidecarConfigs,
+// change in one TailingSidecarConfig can add or remove conflicts in other TailingSidecarConfigs
+func (r *TailingSidecarConfigReconciler) requestsForAllTailingSidecarConfigs(ctx context.Context, _ client.Object) []reconcile.Request {
+	tailingSidecarConfigList := &tailingsidecarv1.TailingSidecarConfigList{}
+	if err := r.List(ctx, tailingSidecarConfigList); err != nil {
+		r.Log.Error(err, "Failed to get list of TailingSidecarConfigs")
+		return nil
+	}
+
+	requests := make([]reconcile.Request, 0, len(tailingSidecarConfigList.Items))
+	for _, tailingSidecarConfig := range tailingSidecarConfigList.Items {
+		requests = append(requests, reconcile.Request{
+			NamespacedName: types.NamespacedName{Namespace: tailingSidecarConfig.Namespace, Name: tailingSidecarConfig.Name},
+		})
+	}
+	return requests
+}
+
+// requestsForPod returns requests for TailingSidecarConfigs matching Pod labels
+func (r *TailingSidecarConfigReconciler) requestsForPod(ctx context.Context, object client.Object) []reconcile.Request {
+	tailingSidecarConfigList := &tailingsidecarv1.TailingSidecarConfigList{}
+	if err := r.List(ctx, tailingSidecarConfigList); err != nil {
+		r.Log.Error(err, "Failed to get list of TailingSidecarConfigs")
+		return nil
+	}
+
+	matched, err := tailingsidecarhandler.MatchTailingSidecarConfigs(tailingSidecarConfigList.Items, object.GetLabels())
+	if err != nil {
+		r.Log.Error(err, "Failed to match TailingSidecarConfigs")
+		return nil
+	}
+
+	requests := make([]reconcile.Request, 0, len(matched))
+	for _, tailingSidecarConfig := range matched {
+		requests = append(requests, reconcile.Request{
+			NamespacedName: types.NamespacedName{Namespace: tailingSidecarConfig.Namespace, Name: tailingSidecarConfig.Name},
+		})
+	}
+	return requests
 }
 
 func (r *TailingSidecarConfigReconciler) SetupWithManager(mgr ctrl.Manager) error {
 	return ctrl.NewControllerManagedBy(mgr).
 		For(&tailingsidecarv1.TailingSidecarConfig{}).
+		Watches(
+			&tailingsidecarv1.TailingSidecarConfig{},
+			handler.EnqueueRequestsFromMapFunc(r.requestsForAllTailingSidecarConfigs),
+			builder.WithPredicates(predicate.GenerationChangedPredicate{}),
+		).
+		Watches(
+			&corev1.Pod{},
+			handler.EnqueueRequestsFromMapFunc(r.requestsForPod),
+			builder.WithPredicates(predicate.Or[client.Object](predicate.LabelChangedPredicate{}, predicate.AnnotationChangedPredicate{}, pendingResizeChangedPredicate)),
+		).
 		Complete(r)
 }
@@ -0,0 +1,318 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+
+	tailingsidecarv1 "github.com/SumoLogic/tailing-sidecar/operator/api/v1"
+)
+
+var _ = Describe("TailingSidecarConfigReconciler", func() {
+	ctx := context.Background()
+
+	reconcilerScheme := runtime.NewScheme()
+	Expect(clientgoscheme.AddToScheme(reconcilerScheme)).To(Succeed())
+	Expect(tailingsidecarv1.AddToScheme(reconcilerScheme)).To(Succeed())
+
+	newTailingSidecarConfig := func(name string, priority int32, strategy tailingsidecarv1.MergeStrategy) *tailingsidecarv1.TailingSidecarConfig {
+		return &tailingsidecarv1.TailingSidecarConfig{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: name},
+			Spec: tailingsidecarv1.TailingSidecarConfigSpec{
+				PodSelector: &metav1.LabelSelector{
+					MatchLabels: map[string]string{"app": "example"},
+				},
+				Priority:      priority,
+				MergeStrategy: strategy,
+				SidecarSpecs: map[string]tailingsidecarv1.SidecarSpec{
+					"sidecar": {
+						Path:        "/var/log/" + name + ".log",
+						VolumeMount: corev1.VolumeMount{Name: "varlog", MountPath: "/var/log"},
+					},
+				},
+			},
+		}
+	}
+
+	When("TailingSidecarConfigs with the same sidecar name match Pod", func() {
+		platform := newTailingSidecarConfig("platform", 0, "")
+		team := newTailingSidecarConfig("team", 10, tailingsidecarv1.MergeStrategyMerge)
+		unrelated := newTailingSidecarConfig("unrelated", 0, "")
+		unrelated.Spec.PodSelector.MatchLabels = map[string]string{"app": "other"}
+		pod := &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{
+				Namespace: "default",
+				Name:      "pod",
+				Labels:    map[string]string{"app": "example"},
+			},
+		}
+
+		fakeClient := fake.NewClientBuilder().
+			WithScheme(reconcilerScheme).
+			WithObjects(platform, team, unrelated, pod).
+			WithStatusSubresource(&tailingsidecarv1.TailingSidecarConfig{}).
+			Build()
+		reconciler := &TailingSidecarConfigReconciler{
+			Client: fakeClient,
+			Log:    logf.Log.WithName("test"),
+			Scheme: reconcilerScheme,
+		}
+
+		for _, name := range []string{"platform", "team", "unrelated"} {
+			_, err := reconciler.Reconcile(ctx, ctrl.Request{NamespacedName: types.NamespacedName{Namespace: "default", Name: name}})
+			Expect(err).ToNot(HaveOccurred())
+		}
+
+		getStatus := func(name string) tailingsidecarv1.TailingSidecarConfigStatus {
+			tailingSidecarConfig := &tailingsidecarv1.TailingSidecarConfig{}
+			Expect(fakeClient.Get(ctx, types.NamespacedName{Namespace: "default", Name: name}, tailingSidecarConfig)).To(Succeed())
+			return tailingSidecarConfig.Status
+		}
+
+		It("reports conflict in statuses of both TailingSidecarConfigs", func() {
+			Expect(getStatus("team").Conflicts).To(Equal([]tailingsidecarv1.ConfigConflict{
+				{
+					Sidecar:            "sidecar",
+					ConflictsWith:      "default/platform",
+					ConflictingSidecar: "sidecar",
+					Strategy:           tailingsidecarv1.MergeStrategyMerge,
+					Winner:             "default/team",
+					Pod:                "default/pod",
+				},
+			}))
+			Expect(getStatus("platform").Conflicts).To(Equal([]tailingsidecarv1.ConfigConflict{
+				{
+					Sidecar:            "sidecar",
+					ConflictsWith:      "default/team",
+					ConflictingSidecar: "sidecar",
+					Strategy:           tailingsidecarv1.MergeStrategyMerge,
+					Winner:             "default/team",
+					Pod:                "default/pod",
+				},
+			}))
+			Expect(getStatus("unrelated").Conflicts).To(BeEmpty())
+		})
+	})
+
+	When("TailingSidecarConfig is in DryRun mode", func() {
+		shadow := newTailingSidecarConfig("shadow", 0, "")
+		shadow.Spec.Mode = tailingsidecarv1.ModeDryRun
+		newPod := func(name string, annotations map[string]string) *corev1.Pod {
+			return &corev1.Pod{
+				ObjectMeta: metav1.ObjectMeta{
+					Namespace:   "default",
+					Name:        name,
+					Labels:      map[string]string{"app": "example"},
+					Annotations: annotations,
+				},
+			}
+		}
+		dryRunAnnotation := map[string]string{
+			"tailing-sidecar.sumologic.com/dry-run": `[{"container":"sidecar","source":"TailingSidecarConfig","namespace":"default","name":"shadow","image":"image"}]`,
+		}
+
+		fakeClient := fake.NewClientBuilder().
+			WithScheme(reconcilerScheme).
+			WithObjects(shadow, newPod("pod-0", dryRunAnnotation), newPod("pod-1", dryRunAnnotation), newPod("pod-2", nil)).
+			WithStatusSubresource(&tailingsidecarv1.TailingSidecarConfig{}).
+			Build()
+		reconciler := &TailingSidecarConfigReconciler{
+			Client: fakeClient,
+			Log:    logf.Log.WithName("test"),
+			Scheme: reconcilerScheme,
+		}
+
+		_, err := reconciler.Reconcile(ctx, ctrl.Request{NamespacedName: types.NamespacedName{Namespace: "default", Name: "shadow"}})
+		Expect(err).ToNot(HaveOccurred())
+
+		It("reports tailing sidecars which would be added to Pods", func() {
+			tailingSidecarConfig := &tailingsidecarv1.TailingSidecarConfig{}
+			Expect(fakeClient.Get(ctx, types.NamespacedName{Namespace: "default", Name: "shadow"}, tailingSidecarConfig)).To(Succeed())
+			Expect(tailingSidecarConfig.Status.DryRun).To(Equal(&tailingsidecarv1.DryRunStatus{Pods: 2, Sidecars: 2}))
+			Expect(tailingSidecarConfig.Status.Conflicts).To(BeEmpty())
+		})
+	})
+
+	When("TailingSidecarConfig has canary", func() {
+		canary := newTailingSidecarConfig("canary", 0, "")
+		canary.Spec.Canary = &tailingsidecarv1.CanarySpec{Percent: 10}
+		newPod := func(name string, annotations map[string]string) *corev1.Pod {
+			return &corev1.Pod{
+				ObjectMeta: metav1.ObjectMeta{
+					Namespace:   "default",
+					Name:        name,
+					Labels:      map[string]string{"app": "example"},
+					Annotations: annotations,
+				},
+			}
+		}
+		provenanceAnnotation := map[string]string{
+			"tailing-sidecar.sumologic.com/provenance": `[{"container":"sidecar","source":"TailingSidecarConfig","namespace":"default","name":"canary","image":"image"}]`,
+		}
+
+		fakeClient := fake.NewClientBuilder().
+			WithScheme(reconcilerScheme).
+			WithObjects(canary, newPod("pod-0", provenanceAnnotation), newPod("pod-1", nil), newPod("pod-2", nil)).
+			WithStatusSubresource(&tailingsidecarv1.TailingSidecarConfig{}).
+			Build()
+		reconciler := &TailingSidecarConfigReconciler{
+			Client: fakeClient,
+			Log:    logf.Log.WithName("test"),
+			Scheme: reconcilerScheme,
+		}
+
+		_, err := reconciler.Reconcile(ctx, ctrl.Request{NamespacedName: types.NamespacedName{Namespace: "default", Name: "canary"}})
+		Expect(err).ToNot(HaveOccurred())
+
+		It("reports canary and non-canary Pods", func() {
+			tailingSidecarConfig := &tailingsidecarv1.TailingSidecarConfig{}
+			Expect(fakeClient.Get(ctx, types.NamespacedName{Namespace: "default", Name: "canary"}, tailingSidecarConfig)).To(Succeed())
+			Expect(tailingSidecarConfig.Status.Canary).To(Equal(&tailingsidecarv1.CanaryStatus{CanaryPods: 1, NonCanaryPods: 2}))
+			Expect(tailingSidecarConfig.Status.DryRun).To(BeNil())
+		})
+	})
+
+	When("TailingSidecarConfig expired", func() {
+		expiresAt := metav1.NewTime(time.Now().Add(-time.Minute))
+		newExpiredTailingSidecarConfig := func(name string, policy tailingsidecarv1.ExpiryPolicy) *tailingsidecarv1.TailingSidecarConfig {
+			tailingSidecarConfig := newTailingSidecarConfig(name, 0, "")
+			tailingSidecarConfig.Spec.ExpiresAt = &expiresAt
+			tailingSidecarConfig.Spec.Expiry = &tailingsidecarv1.ExpirySpec{Rollout: true, Policy: policy}
+			return tailingSidecarConfig
+		}
+		marked := newExpiredTailingSidecarConfig("marked", tailingsidecarv1.ExpiryPolicyMark)
+		deleted := newExpiredTailingSidecarConfig("deleted", tailingsidecarv1.ExpiryPolicyDelete)
+
+		isController := true
+		deployment := &appsv1.Deployment{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "deployment"}}
+		replicaSet := &appsv1.ReplicaSet{
+			ObjectMeta: metav1.ObjectMeta{
+				Namespace: "default",
+				Name:      "deployment-5d8f9",
+				OwnerReferences: []metav1.OwnerReference{
+					{APIVersion: "apps/v1", Kind: "Deployment", Name: "deployment", Controller: &isController},
+				},
+			},
+		}
+		pod := &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{
+				Namespace: "default",
+				Name:      "deployment-5d8f9-x2k4p",
+				Labels:    map[string]string{"app": "example"},
+				Annotations: map[string]string{
+					"tailing-sidecar.sumologic.com/provenance": `[{"container":"sidecar","source":"TailingSidecarConfig","namespace":"default","name":"marked","image":"image"}]`,
+				},
+				OwnerReferences: []metav1.OwnerReference{
+					{APIVersion: "apps/v1", Kind: "ReplicaSet", Name: "deployment-5d8f9", Controller: &isController},
+				},
+			},
+		}
+		statefulSet := &appsv1.StatefulSet{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "statefulset"}}
+		statefulSetPod := &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{
+				Namespace: "default",
+				Name:      "statefulset-0",
+				Labels:    map[string]string{"app": "example"},
+				OwnerReferences: []metav1.OwnerReference{
+					{APIVersion: "apps/v1", Kind: "StatefulSet", Name: "statefulset", Controller: &isController},
+				},
+			},
+		}
+
+		fakeClient := fake.NewClientBuilder().
+			WithScheme(reconcilerScheme).
+			WithObjects(marked, deleted, deployment, replicaSet, pod, statefulSet, statefulSetPod).
+			WithStatusSubresource(&tailingsidecarv1.TailingSidecarConfig{}).
+			Build()
+		reconciler := &TailingSidecarConfigReconciler{
+			Client: fakeClient,
+			Log:    logf.Log.WithName("test"),
+			Scheme: reconcilerScheme,
+		}
+
+		for _, name := range []string{"marked", "deleted"} {
+			_, err := reconciler.Reconcile(ctx, ctrl.Request{NamespacedName: types.NamespacedName{Namespace: "default", Name: name}})
+			Expect(err).ToNot(HaveOccurred())
+		}
+
+		It("marks TailingSidecarConfig as expired", func() {
+			tailingSidecarConfig := &tailingsidecarv1.TailingSidecarConfig{}
+			Expect(fakeClient.Get(ctx, types.NamespacedName{Namespace: "default", Name: "marked"}, tailingSidecarConfig)).To(Succeed())
+			Expect(tailingSidecarConfig.Status.Expired).To(BeTrue())
+			Expect(tailingSidecarConfig.Status.ExpiresAt.Time).To(BeTemporally("~", expiresAt.Time, time.Second))
+		})
+
+		It("deletes TailingSidecarConfig with Delete policy", func() {
+			err := fakeClient.Get(ctx, types.NamespacedName{Namespace: "default", Name: "deleted"}, &tailingsidecarv1.TailingSidecarConfig{})
+			Expect(apierrors.IsNotFound(err)).To(BeTrue())
+		})
+
+		It("restarts only workloads with tailing sidecars from TailingSidecarConfig", func() {
+			restartedDeployment := &appsv1.Deployment{}
+			Expect(fakeClient.Get(ctx, types.NamespacedName{Namespace: "default", Name: "deployment"}, restartedDeployment)).To(Succeed())
+			Expect(restartedDeployment.Spec.Template.Annotations).To(HaveKey(restartedAtAnnotation))
+
+			notRestartedStatefulSet := &appsv1.StatefulSet{}
+			Expect(fakeClient.Get(ctx, types.NamespacedName{Namespace: "default", Name: "statefulset"}, notRestartedStatefulSet)).To(Succeed())
+			Expect(notRestartedStatefulSet.Spec.Template.Annotations).ToNot(HaveKey(restartedAtAnnotation))
+		})
+	})
+
+	When("TailingSidecarConfig expires in the future", func() {
+		ttl := newTailingSidecarConfig("ttl", 0, "")
+		ttl.CreationTimestamp = metav1.Now()
+		ttl.Spec.TTL = &metav1.Duration{Duration: time.Hour}
+
+		fakeClient := fake.NewClientBuilder().
+			WithScheme(reconcilerScheme).
+			WithObjects(ttl).
+			WithStatusSubresource(&tailingsidecarv1.TailingSidecarConfig{}).
+			Build()
+		reconciler := &TailingSidecarConfigReconciler{
+			Client: fakeClient,
+			Log:    logf.Log.WithName("test"),
+			Scheme: reconcilerScheme,
+		}
+
+		result, err := reconciler.Reconcile(ctx, ctrl.Request{NamespacedName: types.NamespacedName{Namespace: "default", Name: "ttl"}})
+		Expect(err).ToNot(HaveOccurred())
+
+		It("reconciles TailingSidecarConfig again when it expires", func() {
+			Expect(result.RequeueAfter).To(BeNumerically(">", 0))
+			Expect(result.RequeueAfter).To(BeNumerically("<=", time.Hour))
+
+			tailingSidecarConfig := &tailingsidecarv1.TailingSidecarConfig{}
+			Expect(fakeClient.Get(ctx, types.NamespacedName{Namespace: "default", Name: "ttl"}, tailingSidecarConfig)).To(Succeed())
+			Expect(tailingSidecarConfig.Status.Expired).To(BeFalse())
+			Expect(tailingSidecarConfig.Status.ExpiresAt).ToNot(BeNil())
+		})
+	})
+})
@@ -0,0 +1,241 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+
+	"github.com/go-logr/logr"
+	admissionregistrationv1 "k8s.io/api/admissionregistration/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	tailingsidecarv1 "github.com/SumoLogic/tailing-sidecar/operator/api/v1"
+	tailingsidecarhandler "github.com/SumoLogic/tailing-sidecar/operator/handler"
+)
+
+const (
+	// selectorWebhookPrefix is the prefix of names of webhooks generated for podSelectors of TailingSidecarConfigs
+	selectorWebhookPrefix = "selector-"
+	optInLabelValue       = "true"
+	// maxOptInPodNames is the maximum number of names of Pods without opt-in label which are logged
+	maxOptInPodNames = 10
+	// optInPodsPageSize is the number of Pods listed in one request when Pods without opt-in label are found
+	optInPodsPageSize = 500
+)
+
+// WebhookSelectorReconciler keeps objectSelectors of Pod webhook in sync with podSelectors of TailingSidecarConfigs,
+// so API server sends to webhook only Pods which can be extended by tailing sidecars.
+// Label selector cannot express alternative of selectors, so Pod webhook is copied for each distinct podSelector
+// and Pod webhook itself selects Pods with opt-in label, e.g. Pods configured with annotation.
+type WebhookSelectorReconciler struct {
+	client.Client
+	Log logr.Logger
+	// MutatingWebhookConfigurationName is the name of MutatingWebhookConfiguration with Pod webhook
+	MutatingWebhookConfigurationName string
+	// WebhookName is the name of Pod webhook, it is used as a template for webhooks generated for podSelectors
+	WebhookName string
+	// OptInLabel is the label which has to be set to "true" in Pods which are not selected by TailingSidecarConfigs
+	OptInLabel string
+	// Reader reads Pods directly from API server when the operator starts, so they do not need to be cached
+	Reader client.Reader
+}
+
+// +kubebuilder:rbac:groups=admissionregistration.k8s.io,resources=mutatingwebhookconfigurations,verbs=get;list;watch;update
+// +kubebuilder:rbac:groups="",resources=pods,verbs=list
+
+// Reconcile updates webhooks in MutatingWebhookConfiguration, all events are reconciled in the same way,
+// because objectSelectors depend on all TailingSidecarConfigs
+func (r *WebhookSelectorReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	log := r.Log.WithValues("mutatingwebhookconfiguration", r.MutatingWebhookConfigurationName)
+
+	webhookConfiguration := &admissionregistrationv1.MutatingWebhookConfiguration{}
+	if err := r.Get(ctx, types.NamespacedName{Name: r.MutatingWebhookConfigurationName}, webhookConfiguration); err != nil {
+		return ctrl.Result{}, client.IgnoreNotFound(err)
+	}
+
+	index := slices.IndexFunc(webhookConfiguration.Webhooks, func(webhook admissionregistrationv1.MutatingWebhook) bool {
+		return webhook.Name == r.WebhookName
+	})
+	if index < 0 {
+		log.Info("Pod webhook not found in MutatingWebhookConfiguration", "webhook", r.WebhookName)
+		return ctrl.Result{}, nil
+	}
+
+	tailingSidecarConfigList := &tailingsidecarv1.TailingSidecarConfigList{}
+	if err := r.List(ctx, tailingSidecarConfigList); err != nil {
+		log.Error(err, "Failed to get list of TailingSidecarConfigs")
+		return ctrl.Result{}, err
+	}
+
+	podSelectors := getPodSelectors(tailingSidecarConfigList.Items, log)
+	webhooks := r.getWebhooks(webhookConfiguration.Webhooks, webhookConfiguration.Webhooks[index], podSelectors)
+	if equality.Semantic.DeepEqual(webhooks, webhookConfiguration.Webhooks) {
+		return ctrl.Result{}, nil
+	}
+
+	webhookConfiguration.Webhooks = webhooks
+	if err := r.Update(ctx, webhookConfiguration); err != nil {
+		log.Error(err, "Failed to update objectSelectors of webhooks")
+		return ctrl.Result{}, err
+	}
+	log.Info("Updated objectSelectors of webhooks", "podSelectors", len(podSelectors))
+	return ctrl.Result{}, nil
+}
+
+// getWebhooks returns webhooks with Pod webhook selecting Pods with opt-in label followed by webhooks
+// generated for podSelectors, other webhooks e.g. for workloads are not changed
+func (r *WebhookSelectorReconciler) getWebhooks(current []admissionregistrationv1.MutatingWebhook, podWebhook admissionregistrationv1.MutatingWebhook, podSelectors []*metav1.LabelSelector) []admissionregistrationv1.MutatingWebhook {
+	podWebhook = *podWebhook.DeepCopy()
+	podWebhook.ObjectSelector = &metav1.LabelSelector{MatchLabels: map[string]string{r.OptInLabel: optInLabelValue}}
+
+	webhooks := make([]admissionregistrationv1.MutatingWebhook, 0, len(current)+len(podSelectors))
+	for _, webhook := range current {
+		switch {
+		case webhook.Name == r.WebhookName:
+			webhooks = append(webhooks, podWebhook)
+			for i, podSelector := range podSelectors {
+				// webhooks generated for podSelectors differ from Pod webhook only in names and objectSelectors,
+				// namespaceSelector is not changed, because TailingSidecarConfigs select Pods in all namespaces
+				selectorWebhook := *podWebhook.DeepCopy()
+				selectorWebhook.Name = fmt.Sprintf("%s%d.%s", selectorWebhookPrefix, i, r.WebhookName)
+				selectorWebhook.ObjectSelector = podSelector
+				webhooks = append(webhooks, selectorWebhook)
+			}
+		case isSelectorWebhook(webhook.Name, r.WebhookName):
+			// webhooks generated for podSelectors are added after Pod webhook
+		default:
+			webhooks = append(webhooks, webhook)
+		}
+	}
+	return webhooks
+}
+
+// isSelectorWebhook checks if webhook was generated from Pod webhook for podSelector
+func isSelectorWebhook(name string, webhookName string) bool {
+	return strings.HasPrefix(name, selectorWebhookPrefix) && strings.HasSuffix(name, "."+webhookName)
+}
+
+// getPodSelectors returns distinct podSelectors of TailingSidecarConfigs sorted by their string representation,
+// paused TailingSidecarConfigs and TailingSidecarConfigs with podSelectors matching nothing are omitted
+func getPodSelectors(tailingSidecarConfigs []tailingsidecarv1.TailingSidecarConfig, log logr.Logger) []*metav1.LabelSelector {
+	podSelectors := make(map[string]*metav1.LabelSelector)
+	for _, tailingSidecarConfig := range tailingSidecarConfigs {
+		if tailingSidecarConfig.Spec.Mode == tailingsidecarv1.ModePaused || tailingSidecarConfig.Spec.PodSelector == nil {
+			continue
+		}
+		selector, err := metav1.LabelSelectorAsSelector(tailingSidecarConfig.Spec.PodSelector)
+		if err != nil {
+			log.Error(err, "Invalid podSelector in TailingSidecarConfig",
+				"tailingsidecarconfig", types.NamespacedName{Namespace: tailingSidecarConfig.Namespace, Name: tailingSidecarConfig.Name})
+			continue
+		}
+		if selector.Empty() {
+			continue
+		}
+		podSelectors[selector.String()] = tailingSidecarConfig.Spec.PodSelector
+	}
+
+	sorted := make([]*metav1.LabelSelector, 0, len(podSelectors))
+	for _, key := range slices.Sorted(maps.Keys(podSelectors)) {
+		sorted = append(sorted, podSelectors[key].DeepCopy())
+	}
+	return sorted
+}
+
+// checkOptInLabel logs Pods configured with tailing-sidecar annotation which do not have opt-in label, Pod webhook
+// selects only Pods with opt-in label, so tailing sidecars are not added to Pods created from the same templates,
+// e.g. after rollout of Deployment. Pods are checked once when the operator starts and errors do not stop the operator.
+func (r *WebhookSelectorReconciler) checkOptInLabel(ctx context.Context) error {
+	podNames, err := r.findPodsWithoutOptInLabel(ctx)
+	if err != nil {
+		r.Log.Error(err, "Failed to find Pods configured with annotation without opt-in label")
+		return nil
+	}
+	if len(podNames) > 0 {
+		err := fmt.Errorf("%d Pods configured with %s annotation do not have %s label set to %q",
+			len(podNames), tailingsidecarhandler.SidecarAnnotation, r.OptInLabel, optInLabelValue)
+		r.Log.Error(err, "Tailing sidecars configured with annotation are not added to new Pods without opt-in label, add it to Pod templates",
+			"pods", podNames[:min(len(podNames), maxOptInPodNames)])
+	}
+	return nil
+}
+
+// findPodsWithoutOptInLabel returns <namespace>/<name> of Pods with tailing-sidecar annotation without opt-in label
+func (r *WebhookSelectorReconciler) findPodsWithoutOptInLabel(ctx context.Context) ([]string, error) {
+	selector, err := labels.Parse(fmt.Sprintf("%s!=%s", r.OptInLabel, optInLabelValue))
+	if err != nil {
+		return nil, err
+	}
+
+	podNames := make([]string, 0)
+	podList := &corev1.PodList{}
+	for {
+		if err := r.Reader.List(ctx, podList,
+			client.MatchingLabelsSelector{Selector: selector},
+			client.Limit(optInPodsPageSize),
+			client.Continue(podList.Continue),
+		); err != nil {
+			return nil, err
+		}
+		for _, pod := range podList.Items {
+			if _, ok := pod.ObjectMeta.Annotations[tailingsidecarhandler.SidecarAnnotation]; ok {
+				podNames = append(podNames, pod.Namespace+"/"+pod.Name)
+			}
+		}
+		if podList.Continue == "" {
+			return podNames, nil
+		}
+	}
+}
+
+// requestForWebhookConfiguration returns the only request reconciled by WebhookSelectorReconciler
+func (r *WebhookSelectorReconciler) requestForWebhookConfiguration(_ context.Context, _ client.Object) []reconcile.Request {
+	return []reconcile.Request{{NamespacedName: types.NamespacedName{Name: r.MutatingWebhookConfigurationName}}}
+}
+
+// SetupWithManager sets up the controller with the Manager, MutatingWebhookConfiguration is watched
+// to restore generated webhooks e.g. after it is replaced during upgrade
+func (r *WebhookSelectorReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	if err := mgr.Add(manager.RunnableFunc(r.checkOptInLabel)); err != nil {
+		return err
+	}
+	return ctrl.NewControllerManagedBy(mgr).
+		Named("webhookselector").
+		For(&admissionregistrationv1.MutatingWebhookConfiguration{}, builder.WithPredicates(predicate.NewPredicateFuncs(func(object client.Object) bool {
+			return object.GetName() == r.MutatingWebhookConfigurationName
+		}))).
+		Watches(
+			&tailingsidecarv1.TailingSidecarConfig{},
+			handler.EnqueueRequestsFromMapFunc(r.requestForWebhookConfiguration),
+		).
+		Complete(r)
+}
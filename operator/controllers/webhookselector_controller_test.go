@@ -0,0 +1,175 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	admissionregistrationv1 "k8s.io/api/admissionregistration/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/client/interceptor"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	tailingsidecarv1 "github.com/SumoLogic/tailing-sidecar/operator/api/v1"
+)
+
+var _ = Describe("WebhookSelectorReconciler", func() {
+	ctx := context.Background()
+
+	selectorScheme := runtime.NewScheme()
+	Expect(clientgoscheme.AddToScheme(selectorScheme)).To(Succeed())
+	Expect(tailingsidecarv1.AddToScheme(selectorScheme)).To(Succeed())
+
+	namespaceSelector := &metav1.LabelSelector{MatchLabels: map[string]string{"tailing-sidecar": "enabled"}}
+	webhookConfiguration := &admissionregistrationv1.MutatingWebhookConfiguration{
+		ObjectMeta: metav1.ObjectMeta{Name: "tailing-sidecar-mutating-webhook-configuration"},
+		Webhooks: []admissionregistrationv1.MutatingWebhook{
+			{Name: "tailing-sidecar.sumologic.com", NamespaceSelector: namespaceSelector},
+			// generated for podSelector which is not used anymore
+			{Name: "selector-2.tailing-sidecar.sumologic.com", NamespaceSelector: namespaceSelector},
+			{Name: "workloads.tailing-sidecar.sumologic.com"},
+		},
+	}
+	tailingSidecarConfigs := []client.Object{
+		&tailingsidecarv1.TailingSidecarConfig{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "nginx"},
+			Spec: tailingsidecarv1.TailingSidecarConfigSpec{
+				PodSelector: &metav1.LabelSelector{MatchLabels: map[string]string{"app": "nginx"}},
+			},
+		},
+		&tailingsidecarv1.TailingSidecarConfig{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "other", Name: "nginx"},
+			Spec: tailingsidecarv1.TailingSidecarConfigSpec{
+				PodSelector: &metav1.LabelSelector{MatchLabels: map[string]string{"app": "nginx"}},
+			},
+		},
+		&tailingsidecarv1.TailingSidecarConfig{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "backend"},
+			Spec: tailingsidecarv1.TailingSidecarConfigSpec{
+				PodSelector: &metav1.LabelSelector{
+					MatchExpressions: []metav1.LabelSelectorRequirement{
+						{Key: "tier", Operator: metav1.LabelSelectorOpIn, Values: []string{"backend"}},
+					},
+				},
+			},
+		},
+		&tailingsidecarv1.TailingSidecarConfig{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "paused"},
+			Spec: tailingsidecarv1.TailingSidecarConfigSpec{
+				Mode:        tailingsidecarv1.ModePaused,
+				PodSelector: &metav1.LabelSelector{MatchLabels: map[string]string{"app": "paused"}},
+			},
+		},
+		&tailingsidecarv1.TailingSidecarConfig{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "empty"},
+			Spec: tailingsidecarv1.TailingSidecarConfigSpec{
+				PodSelector: &metav1.LabelSelector{},
+			},
+		},
+	}
+
+	updates := 0
+	fakeClient := fake.NewClientBuilder().
+		WithScheme(selectorScheme).
+		WithObjects(append(tailingSidecarConfigs, webhookConfiguration)...).
+		WithInterceptorFuncs(interceptor.Funcs{
+			Update: func(ctx context.Context, c client.WithWatch, obj client.Object, opts ...client.UpdateOption) error {
+				updates++
+				return c.Update(ctx, obj, opts...)
+			},
+		}).
+		Build()
+	reconciler := &WebhookSelectorReconciler{
+		Client:                           fakeClient,
+		Log:                              logf.Log.WithName("test"),
+		MutatingWebhookConfigurationName: "tailing-sidecar-mutating-webhook-configuration",
+		WebhookName:                      "tailing-sidecar.sumologic.com",
+		OptInLabel:                       "tailing-sidecar",
+	}
+	request := reconcile.Request{NamespacedName: types.NamespacedName{Name: "tailing-sidecar-mutating-webhook-configuration"}}
+
+	_, err := reconciler.Reconcile(ctx, request)
+	Expect(err).ToNot(HaveOccurred())
+	// webhooks are updated only when podSelectors change
+	_, err = reconciler.Reconcile(ctx, request)
+	Expect(err).ToNot(HaveOccurred())
+
+	reconciled := &admissionregistrationv1.MutatingWebhookConfiguration{}
+	Expect(fakeClient.Get(ctx, request.NamespacedName, reconciled)).To(Succeed())
+
+	It("adds webhook for each distinct podSelector after Pod webhook", func() {
+		Expect(reconciled.Webhooks).To(HaveLen(4))
+		Expect(reconciled.Webhooks[0].Name).To(Equal("tailing-sidecar.sumologic.com"))
+		Expect(reconciled.Webhooks[1].Name).To(Equal("selector-0.tailing-sidecar.sumologic.com"))
+		Expect(reconciled.Webhooks[1].ObjectSelector).To(Equal(&metav1.LabelSelector{MatchLabels: map[string]string{"app": "nginx"}}))
+		Expect(reconciled.Webhooks[2].Name).To(Equal("selector-1.tailing-sidecar.sumologic.com"))
+		Expect(reconciled.Webhooks[2].ObjectSelector.MatchExpressions).To(HaveLen(1))
+		Expect(reconciled.Webhooks[3].Name).To(Equal("workloads.tailing-sidecar.sumologic.com"))
+	})
+
+	It("selects Pods with opt-in label in Pod webhook", func() {
+		Expect(reconciled.Webhooks[0].ObjectSelector).To(Equal(&metav1.LabelSelector{MatchLabels: map[string]string{"tailing-sidecar": "true"}}))
+	})
+
+	It("keeps namespaceSelector of Pod webhook", func() {
+		Expect(reconciled.Webhooks[1].NamespaceSelector).To(Equal(namespaceSelector))
+		Expect(reconciled.Webhooks[2].NamespaceSelector).To(Equal(namespaceSelector))
+	})
+
+	It("updates MutatingWebhookConfiguration once", func() {
+		Expect(updates).To(Equal(1))
+	})
+
+	When("Pods are configured with annotation", func() {
+		newPod := func(name string, labels map[string]string, annotations map[string]string) client.Object {
+			return &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: name, Labels: labels, Annotations: annotations}}
+		}
+		annotation := map[string]string{"tailing-sidecar": "varlog:/var/log/example.log"}
+		reconciler := &WebhookSelectorReconciler{
+			Log:        logf.Log.WithName("test"),
+			OptInLabel: "tailing-sidecar",
+			Reader: fake.NewClientBuilder().
+				WithScheme(selectorScheme).
+				WithObjects(
+					newPod("opted-in", map[string]string{"tailing-sidecar": "true"}, annotation),
+					newPod("not-opted-in", map[string]string{"app": "example"}, annotation),
+					newPod("opted-out", map[string]string{"tailing-sidecar": "false"}, annotation),
+					newPod("not-configured", nil, nil),
+				).
+				Build(),
+		}
+		podNames, err := reconciler.findPodsWithoutOptInLabel(ctx)
+
+		It("finds Pods without opt-in label", func() {
+			Expect(err).ToNot(HaveOccurred())
+			Expect(podNames).To(ConsistOf("default/not-opted-in", "default/opted-out"))
+		})
+
+		It("does not stop the operator", func() {
+			Expect(reconciler.checkOptInLabel(ctx)).To(Succeed())
+		})
+	})
+})
@@ -0,0 +1,111 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// restartedAtAnnotation is set in Pod template of workload to restart its Pods, in the same way as by kubectl rollout restart
+const restartedAtAnnotation = "tailing-sidecar.sumologic.com/restarted-at"
+
+// getWorkload returns Deployment, StatefulSet or DaemonSet managing Pod, returns nil for other Pods
+func getWorkload(ctx context.Context, reader client.Reader, pod *corev1.Pod) (client.Object, error) {
+	owner := metav1.GetControllerOf(pod)
+	if owner == nil || owner.APIVersion != appsv1.SchemeGroupVersion.String() {
+		return nil, nil
+	}
+
+	if owner.Kind == "ReplicaSet" {
+		replicaSet := &appsv1.ReplicaSet{}
+		if err := reader.Get(ctx, types.NamespacedName{Namespace: pod.Namespace, Name: owner.Name}, replicaSet); err != nil {
+			return nil, client.IgnoreNotFound(err)
+		}
+		owner = metav1.GetControllerOf(replicaSet)
+		if owner == nil || owner.APIVersion != appsv1.SchemeGroupVersion.String() {
+			return nil, nil
+		}
+	}
+
+	var workload client.Object
+	switch owner.Kind {
+	case "Deployment":
+		workload = &appsv1.Deployment{}
+	case "StatefulSet":
+		workload = &appsv1.StatefulSet{}
+	case "DaemonSet":
+		workload = &appsv1.DaemonSet{}
+	default:
+		return nil, nil
+	}
+
+	if err := reader.Get(ctx, types.NamespacedName{Namespace: pod.Namespace, Name: owner.Name}, workload); err != nil {
+		return nil, client.IgnoreNotFound(err)
+	}
+	workload.GetObjectKind().SetGroupVersionKind(appsv1.SchemeGroupVersion.WithKind(owner.Kind))
+	return workload, nil
+}
+
+// restartWorkload sets annotation with restart time in Pod template of workload, so its Pods are recreated
+func restartWorkload(ctx context.Context, c client.Client, workload client.Object, restartedAt string) error {
+	patch := client.MergeFrom(workload.DeepCopyObject().(client.Object))
+
+	template, err := getPodTemplate(workload)
+	if err != nil {
+		return err
+	}
+	if template.ObjectMeta.Annotations == nil {
+		template.ObjectMeta.Annotations = make(map[string]string, 1)
+	}
+	template.ObjectMeta.Annotations[restartedAtAnnotation] = restartedAt
+	return c.Patch(ctx, workload, patch)
+}
+
+// getRestartedAt returns time when workload was restarted by operator, returns zero time when it was not restarted
+func getRestartedAt(workload client.Object) time.Time {
+	template, err := getPodTemplate(workload)
+	if err != nil {
+		return time.Time{}
+	}
+	restartedAt, err := time.Parse(time.RFC3339, template.ObjectMeta.Annotations[restartedAtAnnotation])
+	if err != nil {
+		return time.Time{}
+	}
+	return restartedAt
+}
+
+// getPodTemplate returns Pod template of Deployment, StatefulSet or DaemonSet
+func getPodTemplate(workload client.Object) (*corev1.PodTemplateSpec, error) {
+	switch w := workload.(type) {
+	case *appsv1.Deployment:
+		return &w.Spec.Template, nil
+	case *appsv1.StatefulSet:
+		return &w.Spec.Template, nil
+	case *appsv1.DaemonSet:
+		return &w.Spec.Template, nil
+	default:
+		return nil, fmt.Errorf("unsupported workload %T", workload)
+	}
+}
@@ -0,0 +1,153 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"testing"
+
+	tailingsidecarv1 "github.com/SumoLogic/tailing-sidecar/operator/api/v1"
+	admv1 "k8s.io/api/admission/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+)
+
+// cachedListClient lists TailingSidecarConfigs in the same way as client reading from informer cache,
+// so benchmarks measure webhook instead of fake client
+type cachedListClient struct {
+	client.Client
+	tailingSidecarConfigs tailingsidecarv1.TailingSidecarConfigList
+}
+
+func (c *cachedListClient) List(_ context.Context, list client.ObjectList, opts ...client.ListOption) error {
+	listOpts := client.ListOptions{}
+	listOpts.ApplyOptions(opts)
+	tailingSidecarConfigList := list.(*tailingsidecarv1.TailingSidecarConfigList)
+	if listOpts.UnsafeDisableDeepCopy != nil && *listOpts.UnsafeDisableDeepCopy {
+		tailingSidecarConfigList.Items = slices.Clone(c.tailingSidecarConfigs.Items)
+		return nil
+	}
+	c.tailingSidecarConfigs.DeepCopyInto(tailingSidecarConfigList)
+	return nil
+}
+
+// newBenchmarkRequest returns request creating Pod with given number of containers writing logs to shared volume
+func newBenchmarkRequest(b *testing.B, containers int) admission.Request {
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: "pod", Namespace: "default", Labels: map[string]string{"app": "example"}},
+		Spec: corev1.PodSpec{
+			Volumes: []corev1.Volume{{Name: "varlog", VolumeSource: corev1.VolumeSource{EmptyDir: &corev1.EmptyDirVolumeSource{}}}},
+		},
+	}
+	for i := range containers {
+		pod.Spec.Containers = append(pod.Spec.Containers, corev1.Container{
+			Name:         fmt.Sprintf("container-%d", i),
+			Image:        "busybox",
+			Args:         []string{"/bin/sh", "-c", fmt.Sprintf("while true; do date >> /var/log/container-%d.log; sleep 1; done", i)},
+			Env:          []corev1.EnvVar{{Name: "CONTAINER", Value: fmt.Sprintf("container-%d", i)}},
+			VolumeMounts: []corev1.VolumeMount{{Name: "varlog", MountPath: "/var/log"}},
+		})
+	}
+	raw, err := json.Marshal(pod)
+	if err != nil {
+		b.Fatal(err)
+	}
+	return admission.Request{AdmissionRequest: admv1.AdmissionRequest{
+		Operation: admv1.Create,
+		Namespace: "default",
+		Object:    runtime.RawExtension{Raw: raw},
+	}}
+}
+
+// newBenchmarkPodExtender returns PodExtender with given number of TailingSidecarConfigs,
+// only one of them matches Pod created by benchmark request
+func newBenchmarkPodExtender(configs int) *PodExtender {
+	list := tailingsidecarv1.TailingSidecarConfigList{}
+	for i := range configs {
+		app := fmt.Sprintf("other-%d", i)
+		if i == configs-1 {
+			app = "example"
+		}
+		list.Items = append(list.Items, tailingsidecarv1.TailingSidecarConfig{
+			ObjectMeta: metav1.ObjectMeta{
+				Namespace:       "default",
+				Name:            fmt.Sprintf("config-%d", i),
+				UID:             "uid",
+				ResourceVersion: "1",
+			},
+			Spec: tailingsidecarv1.TailingSidecarConfigSpec{
+				PodSelector: &metav1.LabelSelector{
+					MatchLabels: map[string]string{"app": app},
+					MatchExpressions: []metav1.LabelSelectorRequirement{
+						{Key: "tier", Operator: metav1.LabelSelectorOpNotIn, Values: []string{"test"}},
+					},
+				},
+				SidecarSpecs: map[string]tailingsidecarv1.SidecarSpec{
+					"sidecar": {
+						Path:        "/var/log/container-0.log",
+						VolumeMount: corev1.VolumeMount{Name: "varlog", MountPath: "/var/log"},
+					},
+				},
+			},
+		})
+	}
+	return &PodExtender{
+		Client:              &cachedListClient{tailingSidecarConfigs: list},
+		TailingSidecarImage: "tailing-sidecar-image:test",
+		OperatorVersion:     "test",
+		Decoder:             admission.NewDecoder(clientgoscheme.Scheme),
+	}
+}
+
+func BenchmarkPodExtenderHandle(b *testing.B) {
+	for _, containers := range []int{1, 10, 50} {
+		for _, configs := range []int{1, 100, 1000} {
+			b.Run(fmt.Sprintf("containers=%d/configs=%d", containers, configs), func(b *testing.B) {
+				req := newBenchmarkRequest(b, containers)
+				podExtender := newBenchmarkPodExtender(configs)
+				b.ReportAllocs()
+				for b.Loop() {
+					if resp := podExtender.Handle(context.Background(), req); !resp.Allowed || len(resp.Patches) == 0 {
+						b.Fatalf("tailing sidecar is not added: %+v", resp.Result)
+					}
+				}
+			})
+		}
+	}
+}
+
+func BenchmarkMatchTailingSidecarConfigs(b *testing.B) {
+	for _, configs := range []int{100, 1000} {
+		b.Run(fmt.Sprintf("configs=%d", configs), func(b *testing.B) {
+			tailingSidecarConfigs := newBenchmarkPodExtender(configs).Client.(*cachedListClient).tailingSidecarConfigs.Items
+			podLabels := map[string]string{"app": "example"}
+			b.ReportAllocs()
+			for b.Loop() {
+				if _, err := MatchTailingSidecarConfigs(tailingSidecarConfigs, podLabels); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,86 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package handler
+
+import (
+	"hash/fnv"
+	"slices"
+
+	tailingsidecarv1 "github.com/SumoLogic/tailing-sidecar/operator/api/v1"
+	admv1 "k8s.io/api/admission/v1"
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+)
+
+const canaryPercentMax = 100
+
+// hasCanary checks if TailingSidecarConfig adds tailing sidecars only to a fraction of Pods
+func hasCanary(tailingSidecarConfig tailingsidecarv1.TailingSidecarConfig) bool {
+	return tailingSidecarConfig.Spec.Canary != nil && tailingSidecarConfig.Spec.Canary.Percent < canaryPercentMax
+}
+
+// getCanaryKey returns key used to select Pod for canary, it is empty when Pod is not created
+// as selection of new Pods for canary cannot change tailing sidecars in existing Pods
+func getCanaryKey(pod *corev1.Pod, req admission.Request) string {
+	if req.Operation != admv1.Create {
+		return ""
+	}
+	if pod.ObjectMeta.Name != "" {
+		return pod.ObjectMeta.Name
+	}
+
+	// UID of Pod with generated name may not be available yet, UID of admission request is used then,
+	// so Pods created from the same template are selected independently of each other
+	uid := string(pod.ObjectMeta.UID)
+	if uid == "" {
+		uid = string(req.UID)
+	}
+	return pod.ObjectMeta.GenerateName + uid
+}
+
+// isCanary checks if TailingSidecarConfig with canary adds tailing sidecars to Pod,
+// Pod with tailing sidecars from TailingSidecarConfig keeps them
+func isCanary(tailingSidecarConfig tailingsidecarv1.TailingSidecarConfig, pod *corev1.Pod, key string) bool {
+	if !hasCanary(tailingSidecarConfig) {
+		return true
+	}
+
+	if slices.ContainsFunc(GetProvenance(pod.ObjectMeta.Annotations), func(p SidecarProvenance) bool {
+		return p.Source == SourceTailingSidecarConfig &&
+			p.Namespace == tailingSidecarConfig.Namespace &&
+			p.Name == tailingSidecarConfig.Name
+	}) {
+		return true
+	}
+
+	if key == "" {
+		return false
+	}
+
+	hash := fnv.New32a()
+	// TailingSidecarConfig is a part of hash, so different TailingSidecarConfigs select different Pods
+	hash.Write([]byte(tailingSidecarConfig.Namespace + "/" + tailingSidecarConfig.Name + "/" + key))
+	return int32(hash.Sum32()%canaryPercentMax) < tailingSidecarConfig.Spec.Canary.Percent
+}
+
+// filterCanary removes TailingSidecarConfigs with canary which do not select Pod
+func filterCanary(tailingSidecarConfigs []tailingsidecarv1.TailingSidecarConfig, pod *corev1.Pod, req admission.Request) []tailingsidecarv1.TailingSidecarConfig {
+	key := getCanaryKey(pod, req)
+	return slices.DeleteFunc(slices.Clone(tailingSidecarConfigs), func(tailingSidecarConfig tailingsidecarv1.TailingSidecarConfig) bool {
+		return !isCanary(tailingSidecarConfig, pod, key)
+	})
+}
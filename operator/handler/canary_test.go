@@ -0,0 +1,130 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package handler
+
+import (
+	"fmt"
+
+	tailingsidecarv1 "github.com/SumoLogic/tailing-sidecar/operator/api/v1"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	admv1 "k8s.io/api/admission/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+)
+
+var _ = Describe("canary", func() {
+	newTailingSidecarConfig := func(name string, canary *tailingsidecarv1.CanarySpec) tailingsidecarv1.TailingSidecarConfig {
+		return tailingsidecarv1.TailingSidecarConfig{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: name},
+			Spec:       tailingsidecarv1.TailingSidecarConfigSpec{Canary: canary},
+		}
+	}
+	newPod := func(name string) *corev1.Pod {
+		return &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: name}}
+	}
+	createRequest := admission.Request{AdmissionRequest: admv1.AdmissionRequest{Operation: admv1.Create}}
+	updateRequest := admission.Request{AdmissionRequest: admv1.AdmissionRequest{Operation: admv1.Update}}
+
+	half := newTailingSidecarConfig("half", &tailingsidecarv1.CanarySpec{Percent: 50})
+	selected := 0
+	for i := 0; i < 1000; i++ {
+		if len(filterCanary([]tailingsidecarv1.TailingSidecarConfig{half}, newPod(fmt.Sprintf("pod-%d", i)), createRequest)) == 1 {
+			selected++
+		}
+	}
+
+	// Pods of one ReplicaSet have the same generated name, owner and labels, they differ only in admission requests
+	newReplicaSetPod := func() *corev1.Pod {
+		return &corev1.Pod{ObjectMeta: metav1.ObjectMeta{
+			Namespace:       "default",
+			GenerateName:    "deployment-5f8f5f555d-",
+			OwnerReferences: []metav1.OwnerReference{{Kind: "ReplicaSet", Name: "deployment-5f8f5f555d", UID: "owner-uid"}},
+			Labels:          map[string]string{"pod-template-hash": "5f8f5f555d"},
+		}}
+	}
+	tenth := newTailingSidecarConfig("tenth", &tailingsidecarv1.CanarySpec{Percent: 10})
+	selectedReplicaSetPods := 0
+	for i := 0; i < 1000; i++ {
+		req := admission.Request{AdmissionRequest: admv1.AdmissionRequest{Operation: admv1.Create, UID: types.UID(fmt.Sprintf("request-%d", i))}}
+		if len(filterCanary([]tailingsidecarv1.TailingSidecarConfig{tenth}, newReplicaSetPod(), req)) == 1 {
+			selectedReplicaSetPods++
+		}
+	}
+
+	It("selects part of Pods", func() {
+		Expect(selected).To(BeNumerically("~", 500, 100))
+	})
+
+	It("selects part of Pods of one ReplicaSet", func() {
+		Expect(selectedReplicaSetPods).To(BeNumerically("~", 100, 50))
+	})
+
+	It("selects Pod in the same way when webhook is called again for it", func() {
+		pod := newReplicaSetPod()
+		pod.ObjectMeta.Annotations = map[string]string{
+			provenanceAnnotation: `[{"container":"sidecar","source":"TailingSidecarConfig","namespace":"default","name":"tenth"}]`,
+		}
+		for i := 0; i < 10; i++ {
+			req := admission.Request{AdmissionRequest: admv1.AdmissionRequest{Operation: admv1.Create, UID: types.UID(fmt.Sprintf("reinvocation-%d", i))}}
+			Expect(filterCanary([]tailingsidecarv1.TailingSidecarConfig{tenth}, pod, req)).To(HaveLen(1))
+		}
+	})
+
+	It("selects the same Pod every time", func() {
+		key := getCanaryKey(newPod("pod"), createRequest)
+		first := isCanary(half, newPod("pod"), key)
+		for i := 0; i < 10; i++ {
+			Expect(isCanary(half, newPod("pod"), key)).To(Equal(first))
+		}
+	})
+
+	It("uses generated name and UID of Pod", func() {
+		pod := &corev1.Pod{ObjectMeta: metav1.ObjectMeta{GenerateName: "pod-", UID: "uid"}}
+		Expect(getCanaryKey(pod, createRequest)).To(Equal("pod-uid"))
+
+		pod.ObjectMeta.UID = ""
+		req := admission.Request{AdmissionRequest: admv1.AdmissionRequest{Operation: admv1.Create, UID: "request-uid"}}
+		Expect(getCanaryKey(pod, req)).To(Equal("pod-request-uid"))
+	})
+
+	It("selects all Pods or none of them", func() {
+		none := newTailingSidecarConfig("none", &tailingsidecarv1.CanarySpec{Percent: 0})
+		all := newTailingSidecarConfig("all", &tailingsidecarv1.CanarySpec{Percent: 100})
+		withoutCanary := newTailingSidecarConfig("without-canary", nil)
+		for i := 0; i < 100; i++ {
+			Expect(filterCanary([]tailingsidecarv1.TailingSidecarConfig{none, all, withoutCanary}, newPod(fmt.Sprintf("pod-%d", i)), createRequest)).
+				To(Equal([]tailingsidecarv1.TailingSidecarConfig{all, withoutCanary}))
+		}
+	})
+
+	It("does not select Pods on update", func() {
+		almostAll := newTailingSidecarConfig("almost-all", &tailingsidecarv1.CanarySpec{Percent: 99})
+		Expect(filterCanary([]tailingsidecarv1.TailingSidecarConfig{almostAll}, newPod("pod"), updateRequest)).To(BeEmpty())
+	})
+
+	It("keeps tailing sidecars in Pods on update", func() {
+		none := newTailingSidecarConfig("none", &tailingsidecarv1.CanarySpec{Percent: 0})
+		pod := newPod("pod")
+		pod.ObjectMeta.Annotations = map[string]string{
+			provenanceAnnotation: `[{"container":"sidecar","source":"TailingSidecarConfig","namespace":"default","name":"none"}]`,
+		}
+		Expect(filterCanary([]tailingsidecarv1.TailingSidecarConfig{none}, pod, updateRequest)).To(HaveLen(1))
+	})
+})
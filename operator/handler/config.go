@@ -17,8 +17,11 @@ limitations under the License.
 package handler
 
 import (
+	"cmp"
 	"fmt"
+	"slices"
 	"strings"
+	"time"
 
 	tailingsidecarv1 "github.com/SumoLogic/tailing-sidecar/operator/api/v1"
 	corev1 "k8s.io/api/core/v1"
@@ -35,26 +38,43 @@ const (
 	volumeFileSeparator = ":"
 	configSeparator     = ";"
 
-	sidecarAnnotation = "tailing-sidecar"
+	// SidecarAnnotation is the annotation of Pod with configuration of tailing sidecars
+	SidecarAnnotation = "tailing-sidecar"
 )
 
 type sidecarConfig struct {
 	annotationsPrefix string
 	name              string
 	spec              tailingsidecarv1.SidecarSpec
+	// source identifies origin of configuration, it is empty for configuration from annotation
+	// and contains <namespace>/<name> of TailingSidecarConfig for configuration from TailingSidecarConfig
+	source string
+	// resourceVersion is a resourceVersion of TailingSidecarConfig with configuration
+	resourceVersion string
+	// priority and mergeStrategy are used to resolve conflicts between configurations,
+	// configurations from annotation have priority 0 and no merge strategy
+	priority      int32
+	mergeStrategy tailingsidecarv1.MergeStrategy
 }
 
-// getConfigs gets configurations from TailingSidecars and annotations
+// getConfigs gets configurations from TailingSidecars and annotations,
+// conflicts between configurations are resolved according to their priorities and merge strategies
 func getConfigs(annotations map[string]string, tailingSidecarConfigs []tailingsidecarv1.TailingSidecarConfig) ([]sidecarConfig, error) {
-	crConfigs, err := convertTailingSidecarConfigs(tailingSidecarConfigs)
-	if err != nil {
-		return nil, err
-	}
-
 	configs := parseAnnotation(annotations)
-	configs = append(configs, crConfigs...)
+	configs = append(configs, convertTailingSidecarConfigs(tailingSidecarConfigs)...)
+
+	configs, conflicts := resolveConfigs(configs)
+	for _, conflict := range conflicts {
+		handlerLog.Info("Conflicting tailing sidecar configurations",
+			"source", conflict.Source,
+			"sidecar", conflict.Sidecar,
+			"conflictingSource", conflict.ConflictingSource,
+			"conflictingSidecar", conflict.ConflictingSidecar,
+			"strategy", conflict.Strategy,
+		)
+	}
 
-	if err = validateConfigs(configs); err != nil {
+	if err := validateConfigs(configs); err != nil {
 		return nil, err
 	}
 	return configs, nil
@@ -62,7 +82,7 @@ func getConfigs(annotations map[string]string, tailingSidecarConfigs []tailingsi
 
 // parseAnnotation parses configurations from 'tailing-sidecar' annotation
 func parseAnnotation(annotations map[string]string) []sidecarConfig {
-	annotation, ok := annotations[sidecarAnnotation]
+	annotation, ok := annotations[SidecarAnnotation]
 	if !ok {
 		return nil
 	}
@@ -73,6 +93,12 @@ func parseAnnotation(annotations map[string]string) []sidecarConfig {
 		return nil
 	}
 
+	if isAnnotationExpired(annotations, time.Now()) {
+		handlerLog.Info("Expired tailing-sidecar annotation",
+			"expiresAt", annotations[expiresAtAnnotation])
+		return nil
+	}
+
 	configs := make([]sidecarConfig, 0)
 	configElements := strings.Split(annotation, configSeparator)
 
@@ -111,27 +137,35 @@ func parseAnnotation(annotations map[string]string) []sidecarConfig {
 	return configs
 }
 
-// convertTailingSidecarConfigs converts configurations defined in TailingSidecarConfigs to sidecarConfig
-func convertTailingSidecarConfigs(tailingSidecarConfigs []tailingsidecarv1.TailingSidecarConfig) ([]sidecarConfig, error) {
-	sidecarNames := make(map[string]struct{}, len(tailingSidecarConfigs))
+// convertTailingSidecarConfigs converts configurations defined in TailingSidecarConfigs to sidecarConfig,
+// configurations are ordered by namespace and name of TailingSidecarConfig and then by the order of sidecars
+func convertTailingSidecarConfigs(tailingSidecarConfigs []tailingsidecarv1.TailingSidecarConfig) []sidecarConfig {
 	configs := []sidecarConfig{}
 
-	for _, tailitailinSidecarConfig := range tailingSidecarConfigs {
-		for name, spec := range tailitailinSidecarConfig.Spec.SidecarSpecs {
-			if _, ok := sidecarNames[name]; ok {
-				return nil, fmt.Errorf("not unique names for tailing sidecar containers in TailingSidecarConfigs, name: %s", name)
-			}
-			sidecarNames[name] = struct{}{}
-
+	sortedTailingSidecarConfigs := slices.Clone(tailingSidecarConfigs)
+	slices.SortStableFunc(sortedTailingSidecarConfigs, func(a, b tailingsidecarv1.TailingSidecarConfig) int {
+		return cmp.Or(
+			cmp.Compare(a.Namespace, b.Namespace),
+			cmp.Compare(a.Name, b.Name),
+		)
+	})
+
+	for _, tailitailinSidecarConfig := range sortedTailingSidecarConfigs {
+		for _, key := range tailitailinSidecarConfig.SidecarKeys() {
+			spec := tailitailinSidecarConfig.Spec.SidecarSpecs[key]
 			config := sidecarConfig{
 				annotationsPrefix: tailitailinSidecarConfig.Spec.AnnotationsPrefix,
-				name:              name,
+				name:              tailingsidecarv1.SidecarName(key),
 				spec:              spec,
+				source:            fmt.Sprintf("%s/%s", tailitailinSidecarConfig.Namespace, tailitailinSidecarConfig.Name),
+				resourceVersion:   tailitailinSidecarConfig.ResourceVersion,
+				priority:          tailitailinSidecarConfig.Spec.Priority,
+				mergeStrategy:     tailitailinSidecarConfig.Spec.MergeStrategy,
 			}
 			configs = append(configs, config)
 		}
 	}
-	return configs, nil
+	return configs
 }
 
 // removeEmptyConfigs removes empty elements from configuration e.g. when there is ":" in annotation
@@ -22,6 +22,7 @@ import (
 	. "github.com/onsi/ginkgo/extensions/table"
 	. "github.com/onsi/gomega"
 	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
 var _ = Describe("config", func() {
@@ -30,9 +31,8 @@ var _ = Describe("config", func() {
 			input []tailingsidecarv1.TailingSidecarConfig,
 			expectedOutputLength int,
 		) {
-			converted, err := convertTailingSidecarConfigs(input)
+			converted := convertTailingSidecarConfigs(input)
 
-			Expect(err).NotTo(HaveOccurred())
 			Expect(converted).To(HaveLen(expectedOutputLength))
 		},
 
@@ -176,4 +176,78 @@ var _ = Describe("config", func() {
 			5,
 		),
 	)
+
+	Context("convertTailingSidecarConfigs ordering", func() {
+		sidecarSpec := tailingsidecarv1.SidecarSpec{
+			Path: "/var/log/file.log",
+			VolumeMount: corev1.VolumeMount{
+				Name:      "logs-dir",
+				MountPath: "/var/log",
+			},
+		}
+		input := []tailingsidecarv1.TailingSidecarConfig{
+			{
+				ObjectMeta: metav1.ObjectMeta{Namespace: "namespace-b", Name: "config"},
+				Spec: tailingsidecarv1.TailingSidecarConfigSpec{
+					SidecarSpecs: map[string]tailingsidecarv1.SidecarSpec{
+						"sidecar-d": sidecarSpec,
+					},
+				},
+			},
+			{
+				ObjectMeta: metav1.ObjectMeta{Namespace: "namespace-a", Name: "config-b"},
+				Spec: tailingsidecarv1.TailingSidecarConfigSpec{
+					SidecarSpecs: map[string]tailingsidecarv1.SidecarSpec{
+						"sidecar-c": sidecarSpec,
+					},
+				},
+			},
+			{
+				ObjectMeta: metav1.ObjectMeta{Namespace: "namespace-a", Name: "config-a"},
+				Spec: tailingsidecarv1.TailingSidecarConfigSpec{
+					SidecarSpecs: map[string]tailingsidecarv1.SidecarSpec{
+						"sidecar-b": sidecarSpec,
+						"sidecar-a": sidecarSpec,
+					},
+				},
+			},
+		}
+
+		It("returns configurations in deterministic order", func() {
+			for i := 0; i < 10; i++ {
+				converted := convertTailingSidecarConfigs(input)
+
+				names := make([]string, 0, len(converted))
+				for _, config := range converted {
+					names = append(names, config.name)
+				}
+				Expect(names).To(Equal([]string{"sidecar-a", "sidecar-b", "sidecar-c", "sidecar-d"}))
+				Expect(converted[0].source).To(Equal("namespace-a/config-a"))
+			}
+		})
+
+		It("keeps order of sidecars converted from v2 API", func() {
+			tailingSidecarConfig := tailingsidecarv1.TailingSidecarConfig{
+				ObjectMeta: metav1.ObjectMeta{
+					Namespace:   "namespace-a",
+					Name:        "config",
+					Annotations: map[string]string{tailingsidecarv1.SidecarsOrderAnnotation: `["sidecar-b","#1","sidecar-a"]`},
+				},
+				Spec: tailingsidecarv1.TailingSidecarConfigSpec{
+					SidecarSpecs: map[string]tailingsidecarv1.SidecarSpec{
+						"sidecar-a": sidecarSpec,
+						"sidecar-b": sidecarSpec,
+						"#1":        sidecarSpec,
+					},
+				},
+			}
+			converted := convertTailingSidecarConfigs([]tailingsidecarv1.TailingSidecarConfig{tailingSidecarConfig})
+
+			names := make([]string, 0, len(converted))
+			for _, config := range converted {
+				names = append(names, config.name)
+			}
+			Expect(names).To(Equal([]string{"sidecar-b", "", "sidecar-a"}))
+		})
+	})
 })
@@ -0,0 +1,179 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package handler
+
+import (
+	"cmp"
+	"maps"
+	"slices"
+
+	tailingsidecarv1 "github.com/SumoLogic/tailing-sidecar/operator/api/v1"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// Conflict describes conflict between two configurations of tailing sidecars,
+// Source and Sidecar describe configuration with higher priority
+// and ConflictingSource and ConflictingSidecar describe configuration with lower or equal priority
+type Conflict struct {
+	// Source and ConflictingSource are SourceAnnotation or <namespace>/<name> of TailingSidecarConfig
+	Source             string
+	Sidecar            string
+	ConflictingSource  string
+	ConflictingSidecar string
+	// Strategy is merge strategy of configuration with higher priority used to resolve the conflict
+	Strategy tailingsidecarv1.MergeStrategy
+}
+
+// Winner returns source of configuration which was applied, it is empty when both configurations were rejected
+func (c Conflict) Winner() string {
+	if c.Strategy == tailingsidecarv1.MergeStrategyReject {
+		return ""
+	}
+	return c.Source
+}
+
+// FindConflicts returns conflicts between configurations from annotation and TailingSidecarConfigs for Pod
+func FindConflicts(pod *corev1.Pod, tailingSidecarConfigs []tailingsidecarv1.TailingSidecarConfig) ([]Conflict, error) {
+	matched, err := MatchTailingSidecarConfigs(tailingSidecarConfigs, pod.ObjectMeta.Labels)
+	if err != nil {
+		return nil, err
+	}
+
+	configs := parseAnnotation(pod.ObjectMeta.Annotations)
+	configs = append(configs, convertTailingSidecarConfigs(matched)...)
+
+	_, conflicts := resolveConfigs(configs)
+	return conflicts, nil
+}
+
+// resolveConfigs resolves conflicts between configurations from different sources,
+// configurations conflict when they have the same tailing sidecar container name or tail the same file.
+// Configurations are processed from the highest priority, for the same priority in the order of configurations,
+// so configuration from annotation takes precedence over configuration from TailingSidecarConfig with the same priority.
+// Returned configurations keep the order of provided configurations.
+func resolveConfigs(configs []sidecarConfig) ([]sidecarConfig, []Conflict) {
+	order := make([]int, 0, len(configs))
+	for i := range configs {
+		order = append(order, i)
+	}
+	slices.SortStableFunc(order, func(a, b int) int {
+		return cmp.Compare(configs[b].priority, configs[a].priority)
+	})
+
+	resolved := slices.Clone(configs)
+	skipped := make([]bool, len(configs))
+	accepted := make([]int, 0, len(configs))
+	conflicts := make([]Conflict, 0)
+
+	for _, i := range order {
+		j := slices.IndexFunc(accepted, func(j int) bool {
+			return isConflict(resolved[j], configs[i])
+		})
+		if j == -1 {
+			accepted = append(accepted, i)
+			continue
+		}
+
+		winner := accepted[j]
+		strategy := getMergeStrategy(resolved[winner])
+		conflicts = append(conflicts, Conflict{
+			Source:             getSource(resolved[winner]),
+			Sidecar:            resolved[winner].name,
+			ConflictingSource:  getSource(configs[i]),
+			ConflictingSidecar: configs[i].name,
+			Strategy:           strategy,
+		})
+
+		skipped[i] = true
+		switch strategy {
+		case tailingsidecarv1.MergeStrategyMerge:
+			resolved[winner] = mergeConfigs(resolved[winner], configs[i])
+		case tailingsidecarv1.MergeStrategyReject:
+			// rejected configuration stays accepted to reject also next conflicting configurations
+			skipped[winner] = true
+		}
+	}
+
+	result := make([]sidecarConfig, 0, len(resolved))
+	for i, config := range resolved {
+		if !skipped[i] {
+			result = append(result, config)
+		}
+	}
+	return result, conflicts
+}
+
+// isConflict checks if configurations from different sources have the same tailing sidecar container name
+// or tail the same file
+func isConflict(a, b sidecarConfig) bool {
+	if a.source == b.source {
+		return false
+	}
+	if a.name != "" && a.name == b.name {
+		return true
+	}
+	return a.spec.Path != "" &&
+		a.spec.Path == b.spec.Path &&
+		a.spec.VolumeMount.Name == b.spec.VolumeMount.Name
+}
+
+// getMergeStrategy returns merge strategy of configuration, Override is used when it is not set
+func getMergeStrategy(config sidecarConfig) tailingsidecarv1.MergeStrategy {
+	if config.mergeStrategy == "" {
+		return tailingsidecarv1.MergeStrategyOverride
+	}
+	return config.mergeStrategy
+}
+
+// mergeConfigs sets fields from configuration with higher priority in configuration with lower priority
+func mergeConfigs(higher, lower sidecarConfig) sidecarConfig {
+	merged := lower
+	merged.source = higher.source
+	merged.resourceVersion = higher.resourceVersion
+	merged.priority = higher.priority
+	merged.mergeStrategy = higher.mergeStrategy
+	if higher.name != "" {
+		merged.name = higher.name
+	}
+	if higher.annotationsPrefix != "" {
+		merged.annotationsPrefix = higher.annotationsPrefix
+	}
+
+	if len(higher.spec.Annotations) != 0 {
+		merged.spec.Annotations = maps.Clone(lower.spec.Annotations)
+		if merged.spec.Annotations == nil {
+			merged.spec.Annotations = make(map[string]string, len(higher.spec.Annotations))
+		}
+		maps.Copy(merged.spec.Annotations, higher.spec.Annotations)
+	}
+	if higher.spec.Path != "" {
+		merged.spec.Path = higher.spec.Path
+	}
+	if higher.spec.VolumeMount.Name != "" {
+		merged.spec.VolumeMount = higher.spec.VolumeMount
+	}
+	if len(higher.spec.Resources.Limits) != 0 || len(higher.spec.Resources.Requests) != 0 || len(higher.spec.Resources.Claims) != 0 {
+		merged.spec.Resources = higher.spec.Resources
+	}
+	if higher.spec.FileStorage != nil {
+		merged.spec.FileStorage = higher.spec.FileStorage
+	}
+	if higher.spec.Volumes != nil {
+		merged.spec.Volumes = higher.spec.Volumes
+	}
+	return merged
+}
@@ -0,0 +1,186 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package handler
+
+import (
+	tailingsidecarv1 "github.com/SumoLogic/tailing-sidecar/operator/api/v1"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+var _ = Describe("conflict", func() {
+	newTailingSidecarConfig := func(name string, priority int32, strategy tailingsidecarv1.MergeStrategy, specs map[string]tailingsidecarv1.SidecarSpec) tailingsidecarv1.TailingSidecarConfig {
+		return tailingsidecarv1.TailingSidecarConfig{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: name},
+			Spec: tailingsidecarv1.TailingSidecarConfigSpec{
+				PodSelector: &metav1.LabelSelector{
+					MatchLabels: map[string]string{"app": "example"},
+				},
+				Priority:      priority,
+				MergeStrategy: strategy,
+				SidecarSpecs:  specs,
+			},
+		}
+	}
+	varlog := corev1.VolumeMount{Name: "varlog", MountPath: "/var/log"}
+	resources := corev1.ResourceRequirements{
+		Limits: corev1.ResourceList{corev1.ResourceMemory: resource.MustParse("100Mi")},
+	}
+
+	getNames := func(configs []sidecarConfig) []string {
+		names := make([]string, 0, len(configs))
+		for _, config := range configs {
+			names = append(names, config.name)
+		}
+		return names
+	}
+
+	When("TailingSidecarConfig with higher priority uses the same sidecar name", func() {
+		platform := newTailingSidecarConfig("platform", 0, "", map[string]tailingsidecarv1.SidecarSpec{
+			"sidecar": {Path: "/var/log/platform.log", VolumeMount: varlog, Resources: resources},
+		})
+		team := newTailingSidecarConfig("team", 10, "", map[string]tailingsidecarv1.SidecarSpec{
+			"sidecar": {Path: "/var/log/team.log", VolumeMount: varlog},
+		})
+
+		configs, err := getConfigs(nil, []tailingsidecarv1.TailingSidecarConfig{platform, team})
+
+		It("overrides configuration with lower priority", func() {
+			Expect(err).ToNot(HaveOccurred())
+			Expect(configs).To(HaveLen(1))
+			Expect(configs[0].source).To(Equal("default/team"))
+			Expect(configs[0].spec.Path).To(Equal("/var/log/team.log"))
+			Expect(configs[0].spec.Resources.Limits).To(BeEmpty())
+		})
+	})
+
+	When("TailingSidecarConfig with higher priority uses Merge strategy", func() {
+		platform := newTailingSidecarConfig("platform", 0, "", map[string]tailingsidecarv1.SidecarSpec{
+			"sidecar": {
+				Path:        "/var/log/platform.log",
+				VolumeMount: varlog,
+				Resources:   resources,
+				Annotations: map[string]string{"platform": "true"},
+			},
+		})
+		team := newTailingSidecarConfig("team", 10, tailingsidecarv1.MergeStrategyMerge, map[string]tailingsidecarv1.SidecarSpec{
+			"sidecar": {
+				Path:        "/var/log/team.log",
+				Annotations: map[string]string{"team": "true"},
+			},
+		})
+
+		configs, err := getConfigs(nil, []tailingsidecarv1.TailingSidecarConfig{platform, team})
+
+		It("merges fields which are set into configuration with lower priority", func() {
+			Expect(err).ToNot(HaveOccurred())
+			Expect(configs).To(HaveLen(1))
+			Expect(configs[0].source).To(Equal("default/team"))
+			Expect(configs[0].spec.Path).To(Equal("/var/log/team.log"))
+			Expect(configs[0].spec.VolumeMount).To(Equal(varlog))
+			Expect(configs[0].spec.Resources).To(Equal(resources))
+			Expect(configs[0].spec.Annotations).To(Equal(map[string]string{"platform": "true", "team": "true"}))
+			Expect(platform.Spec.SidecarSpecs["sidecar"].Annotations).To(Equal(map[string]string{"platform": "true"}))
+		})
+	})
+
+	When("TailingSidecarConfig with higher priority uses Reject strategy", func() {
+		platform := newTailingSidecarConfig("platform", 0, "", map[string]tailingsidecarv1.SidecarSpec{
+			"sidecar":       {Path: "/var/log/platform.log", VolumeMount: varlog},
+			"other-sidecar": {Path: "/var/log/other.log", VolumeMount: varlog},
+		})
+		team := newTailingSidecarConfig("team", 10, tailingsidecarv1.MergeStrategyReject, map[string]tailingsidecarv1.SidecarSpec{
+			"sidecar": {Path: "/var/log/team.log", VolumeMount: varlog},
+		})
+
+		configs, err := getConfigs(nil, []tailingsidecarv1.TailingSidecarConfig{platform, team})
+
+		It("skips both conflicting configurations", func() {
+			Expect(err).ToNot(HaveOccurred())
+			Expect(getNames(configs)).To(Equal([]string{"other-sidecar"}))
+		})
+	})
+
+	When("annotation and TailingSidecarConfig tail the same file", func() {
+		annotations := map[string]string{
+			SidecarAnnotation: "varlog:/var/log/example0.log;varlog:/var/log/example1.log",
+		}
+		platform := newTailingSidecarConfig("platform", 0, "", map[string]tailingsidecarv1.SidecarSpec{
+			"sidecar-0": {Path: "/var/log/example0.log", VolumeMount: varlog},
+		})
+		team := newTailingSidecarConfig("team", 1, "", map[string]tailingsidecarv1.SidecarSpec{
+			"sidecar-1": {Path: "/var/log/example1.log", VolumeMount: varlog},
+		})
+
+		configs, err := getConfigs(annotations, []tailingsidecarv1.TailingSidecarConfig{platform, team})
+		pod := &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{
+				Labels:      map[string]string{"app": "example"},
+				Annotations: annotations,
+			},
+		}
+		conflicts, conflictsErr := FindConflicts(pod, []tailingsidecarv1.TailingSidecarConfig{team, platform})
+
+		It("applies annotation for the same priority and TailingSidecarConfig with higher priority keeping order", func() {
+			Expect(err).ToNot(HaveOccurred())
+			Expect(getNames(configs)).To(Equal([]string{"", "sidecar-1"}))
+			Expect(configs[0].spec.Path).To(Equal("/var/log/example0.log"))
+			Expect(configs[0].source).To(BeEmpty())
+		})
+
+		It("returns conflicts", func() {
+			Expect(conflictsErr).ToNot(HaveOccurred())
+			Expect(conflicts).To(Equal([]Conflict{
+				{
+					Source:             "default/team",
+					Sidecar:            "sidecar-1",
+					ConflictingSource:  SourceAnnotation,
+					ConflictingSidecar: "",
+					Strategy:           tailingsidecarv1.MergeStrategyOverride,
+				},
+				{
+					Source:             SourceAnnotation,
+					Sidecar:            "",
+					ConflictingSource:  "default/platform",
+					ConflictingSidecar: "sidecar-0",
+					Strategy:           tailingsidecarv1.MergeStrategyOverride,
+				},
+			}))
+			Expect(conflicts[0].Winner()).To(Equal("default/team"))
+		})
+	})
+
+	When("TailingSidecarConfigs with the same priority use the same sidecar name", func() {
+		first := newTailingSidecarConfig("a", 0, "", map[string]tailingsidecarv1.SidecarSpec{
+			"sidecar": {Path: "/var/log/a.log", VolumeMount: varlog},
+		})
+		second := newTailingSidecarConfig("b", 0, "", map[string]tailingsidecarv1.SidecarSpec{
+			"sidecar": {Path: "/var/log/b.log", VolumeMount: varlog},
+		})
+
+		configs, err := getConfigs(nil, []tailingsidecarv1.TailingSidecarConfig{second, first})
+
+		It("applies the first TailingSidecarConfig ordered by namespace and name", func() {
+			Expect(err).ToNot(HaveOccurred())
+			Expect(configs).To(HaveLen(1))
+			Expect(configs[0].source).To(Equal("default/a"))
+		})
+	})
+})
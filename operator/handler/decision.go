@@ -0,0 +1,201 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package handler
+
+import (
+	"encoding/json"
+	"slices"
+	"sync"
+
+	jsonpatch "github.com/evanphx/json-patch/v5"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+)
+
+const defaultDecisionLogSize = 100
+
+// Decision describes result of handling admission request by webhook
+type Decision struct {
+	Time      metav1.Time `json:"time"`
+	Kind      string      `json:"kind"`
+	Namespace string      `json:"namespace"`
+	Name      string      `json:"name"`
+	Operation string      `json:"operation"`
+	Allowed   bool        `json:"allowed"`
+	// Added lists names of tailing sidecar containers added by webhook
+	Added []string `json:"added,omitempty"`
+	// Removed lists names of tailing sidecar containers removed by webhook
+	Removed []string `json:"removed,omitempty"`
+	Message string   `json:"message,omitempty"`
+	Error   string   `json:"error,omitempty"`
+}
+
+// DecisionLog keeps the last admission decisions in memory, nil DecisionLog does not record decisions
+type DecisionLog struct {
+	mu        sync.Mutex
+	decisions []Decision
+	size      int
+}
+
+// NewDecisionLog returns DecisionLog keeping given number of the last decisions, 100 by default
+func NewDecisionLog(size int) *DecisionLog {
+	if size <= 0 {
+		size = defaultDecisionLogSize
+	}
+	return &DecisionLog{
+		decisions: make([]Decision, 0, size),
+		size:      size,
+	}
+}
+
+// List returns the last decisions starting from the newest one
+func (l *DecisionLog) List() []Decision {
+	if l == nil {
+		return nil
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	decisions := slices.Clone(l.decisions)
+	slices.Reverse(decisions)
+	return decisions
+}
+
+// record adds decision for admission request, tailing sidecars added and removed by webhook are found
+// by comparing containers of object before and after applying patches, dry-run requests are not recorded
+func (l *DecisionLog) record(req admission.Request, resp admission.Response, getContainers func(raw []byte) ([]corev1.Container, error)) {
+	if l == nil || isDryRun(req) {
+		return
+	}
+
+	name := req.Name
+	if name == "" {
+		// object with generated name does not have name in admission request
+		name = getGenerateName(req.Object.Raw)
+	}
+	decision := Decision{
+		Time:      metav1.Now(),
+		Kind:      req.Kind.Kind,
+		Namespace: req.Namespace,
+		Name:      name,
+		Operation: string(req.Operation),
+		Allowed:   resp.Allowed,
+	}
+	if resp.Result != nil {
+		if resp.Allowed {
+			decision.Message = resp.Result.Message
+		} else {
+			decision.Error = resp.Result.Message
+		}
+	}
+	if resp.Allowed && len(resp.Patches) > 0 {
+		added, removed, err := getChangedSidecars(req.Object.Raw, resp, getContainers)
+		if err != nil {
+			decision.Error = err.Error()
+		}
+		decision.Added, decision.Removed = added, removed
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if len(l.decisions) == l.size {
+		l.decisions = slices.Delete(l.decisions, 0, 1)
+	}
+	l.decisions = append(l.decisions, decision)
+}
+
+// isDryRun checks if admission request is a dry-run request
+func isDryRun(req admission.Request) bool {
+	return req.DryRun != nil && *req.DryRun
+}
+
+// getPodContainers returns containers of serialized Pod
+func getPodContainers(raw []byte) ([]corev1.Container, error) {
+	pod := &corev1.Pod{}
+	if err := json.Unmarshal(raw, pod); err != nil {
+		return nil, err
+	}
+	return pod.Spec.Containers, nil
+}
+
+// getChangedSidecars returns names of tailing sidecar containers added and removed by patches from admission response
+func getChangedSidecars(raw []byte, resp admission.Response, getContainers func(raw []byte) ([]corev1.Container, error)) ([]string, []string, error) {
+	patched, err := applyPatches(raw, resp)
+	if err != nil {
+		return nil, nil, err
+	}
+	before, err := getContainers(raw)
+	if err != nil {
+		return nil, nil, err
+	}
+	after, err := getContainers(patched)
+	if err != nil {
+		return nil, nil, err
+	}
+	added, removed := diffTailingSidecars(before, after)
+	return added, removed, nil
+}
+
+// getGenerateName returns generateName from metadata of serialized object
+func getGenerateName(raw []byte) string {
+	object := struct {
+		Metadata metav1.ObjectMeta `json:"metadata"`
+	}{}
+	if err := json.Unmarshal(raw, &object); err != nil {
+		return ""
+	}
+	return object.Metadata.GenerateName
+}
+
+// diffTailingSidecars returns names of tailing sidecar containers added and removed in containers after change
+func diffTailingSidecars(before []corev1.Container, after []corev1.Container) ([]string, []string) {
+	names := func(containers []corev1.Container) []string {
+		result := make([]string, 0)
+		for _, container := range getTailingSidecars(containers) {
+			result = append(result, container.Name)
+		}
+		return result
+	}
+	beforeNames, afterNames := names(before), names(after)
+
+	added := slices.DeleteFunc(slices.Clone(afterNames), func(name string) bool { return slices.Contains(beforeNames, name) })
+	removed := slices.DeleteFunc(slices.Clone(beforeNames), func(name string) bool { return slices.Contains(afterNames, name) })
+	if len(added) == 0 {
+		added = nil
+	}
+	if len(removed) == 0 {
+		removed = nil
+	}
+	return added, removed
+}
+
+// applyPatches returns object after applying patches from admission response
+func applyPatches(raw []byte, resp admission.Response) ([]byte, error) {
+	if len(resp.Patches) == 0 {
+		return raw, nil
+	}
+	rawPatch, err := json.Marshal(resp.Patches)
+	if err != nil {
+		return nil, err
+	}
+	patch, err := jsonpatch.DecodePatch(rawPatch)
+	if err != nil {
+		return nil, err
+	}
+	return patch.Apply(raw)
+}
@@ -0,0 +1,122 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package handler
+
+import (
+	"encoding/json"
+	"fmt"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	admv1 "k8s.io/api/admission/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+)
+
+var _ = Describe("DecisionLog", func() {
+	newContainer := func(name string, tailingSidecar bool) corev1.Container {
+		container := corev1.Container{Name: name}
+		if tailingSidecar {
+			container.Env = []corev1.EnvVar{{Name: sidecarEnvMarker, Value: sidecarEnvMarkerVal}}
+		}
+		return container
+	}
+	newRequest := func(name string, operation admv1.Operation, containers ...corev1.Container) admission.Request {
+		pod := &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "default", GenerateName: "pod-"},
+			Spec:       corev1.PodSpec{Containers: containers},
+		}
+		raw, err := json.Marshal(pod)
+		Expect(err).ToNot(HaveOccurred())
+		return admission.Request{AdmissionRequest: admv1.AdmissionRequest{
+			Name:      name,
+			Namespace: "default",
+			Kind:      metav1.GroupVersionKind{Version: "v1", Kind: "Pod"},
+			Operation: operation,
+			Object:    runtime.RawExtension{Raw: raw},
+		}}
+	}
+	newResponse := func(req admission.Request, containers ...corev1.Container) admission.Response {
+		pod := &corev1.Pod{}
+		Expect(json.Unmarshal(req.Object.Raw, pod)).To(Succeed())
+		pod.Spec.Containers = containers
+		raw, err := json.Marshal(pod)
+		Expect(err).ToNot(HaveOccurred())
+		return admission.PatchResponseFromRaw(req.Object.Raw, raw)
+	}
+
+	It("records added and removed tailing sidecars", func() {
+		decisions := NewDecisionLog(10)
+
+		req := newRequest("", admv1.Create, newContainer("app", false))
+		decisions.record(req, newResponse(req, newContainer("app", false), newContainer("sidecar", true)), getPodContainers)
+
+		req = newRequest("pod", admv1.Update, newContainer("app", false), newContainer("sidecar", true))
+		decisions.record(req, newResponse(req, newContainer("app", false), newContainer("other-sidecar", true)), getPodContainers)
+
+		list := decisions.List()
+		Expect(list).To(HaveLen(2))
+		Expect(list[0].Name).To(Equal("pod"))
+		Expect(list[0].Operation).To(Equal("UPDATE"))
+		Expect(list[0].Added).To(Equal([]string{"other-sidecar"}))
+		Expect(list[0].Removed).To(Equal([]string{"sidecar"}))
+		Expect(list[1].Name).To(Equal("pod-"))
+		Expect(list[1].Operation).To(Equal("CREATE"))
+		Expect(list[1].Added).To(Equal([]string{"sidecar"}))
+		Expect(list[1].Removed).To(BeNil())
+	})
+
+	It("records errors", func() {
+		decisions := NewDecisionLog(10)
+		req := newRequest("pod", admv1.Create, newContainer("app", false))
+		decisions.record(req, admission.Errored(500, fmt.Errorf("incorrect configuration")), getPodContainers)
+
+		list := decisions.List()
+		Expect(list).To(HaveLen(1))
+		Expect(list[0].Allowed).To(BeFalse())
+		Expect(list[0].Error).To(Equal("incorrect configuration"))
+	})
+
+	It("keeps the last decisions", func() {
+		decisions := NewDecisionLog(3)
+		for i := 0; i < 5; i++ {
+			req := newRequest(fmt.Sprintf("pod-%d", i), admv1.Create)
+			decisions.record(req, admission.Allowed(""), getPodContainers)
+		}
+
+		names := make([]string, 0)
+		for _, decision := range decisions.List() {
+			names = append(names, decision.Name)
+		}
+		Expect(names).To(Equal([]string{"pod-4", "pod-3", "pod-2"}))
+	})
+
+	It("does not record dry-run requests", func() {
+		decisions := NewDecisionLog(3)
+		dryRun := true
+		req := newRequest("pod", admv1.Create)
+		req.DryRun = &dryRun
+		decisions.record(req, admission.Allowed(""), getPodContainers)
+		Expect(decisions.List()).To(BeEmpty())
+
+		var nilDecisions *DecisionLog
+		nilDecisions.record(newRequest("pod", admv1.Create), admission.Allowed(""), getPodContainers)
+		Expect(nilDecisions.List()).To(BeNil())
+	})
+})
@@ -0,0 +1,120 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package handler
+
+import (
+	"encoding/json"
+	"slices"
+
+	tailingsidecarv1 "github.com/SumoLogic/tailing-sidecar/operator/api/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// dryRunAnnotation contains JSON list of tailing sidecar containers which would be added to Pod
+// by TailingSidecarConfigs in DryRun mode
+const dryRunAnnotation = "tailing-sidecar.sumologic.com/dry-run"
+
+// GetDryRunSidecars returns tailing sidecars which would be added to Pod by TailingSidecarConfigs in DryRun mode
+// from Pod annotations, returns nil when annotation is not available or it is not valid
+func GetDryRunSidecars(annotations map[string]string) []SidecarProvenance {
+	value, ok := annotations[dryRunAnnotation]
+	if !ok {
+		return nil
+	}
+
+	sidecars := make([]SidecarProvenance, 0)
+	if err := json.Unmarshal([]byte(value), &sidecars); err != nil {
+		handlerLog.Info("Incorrect dry-run annotation", "annotation", value, "error", err.Error())
+		return nil
+	}
+	return sidecars
+}
+
+// isPaused checks if TailingSidecarConfig is ignored
+func isPaused(tailingSidecarConfig tailingsidecarv1.TailingSidecarConfig) bool {
+	return tailingSidecarConfig.Spec.Mode == tailingsidecarv1.ModePaused
+}
+
+// splitDryRun splits TailingSidecarConfigs into active ones and ones in DryRun mode
+func splitDryRun(tailingSidecarConfigs []tailingsidecarv1.TailingSidecarConfig) ([]tailingsidecarv1.TailingSidecarConfig, []tailingsidecarv1.TailingSidecarConfig) {
+	active := make([]tailingsidecarv1.TailingSidecarConfig, 0, len(tailingSidecarConfigs))
+	dryRun := make([]tailingsidecarv1.TailingSidecarConfig, 0)
+	for _, tailingSidecarConfig := range tailingSidecarConfigs {
+		if tailingSidecarConfig.Spec.Mode == tailingsidecarv1.ModeDryRun {
+			dryRun = append(dryRun, tailingSidecarConfig)
+		} else {
+			active = append(active, tailingSidecarConfig)
+		}
+	}
+	return active, dryRun
+}
+
+// getDryRunSidecars returns tailing sidecars which would be added to Pod if TailingSidecarConfigs in DryRun mode were active,
+// conflicts with other configurations are resolved in the same way as for active TailingSidecarConfigs
+func (e PodExtender) getDryRunSidecars(pod *corev1.Pod, active []tailingsidecarv1.TailingSidecarConfig, dryRun []tailingsidecarv1.TailingSidecarConfig) []SidecarProvenance {
+	if len(dryRun) == 0 {
+		return nil
+	}
+
+	configs, err := getConfigs(pod.ObjectMeta.Annotations, append(slices.Clone(active), dryRun...))
+	if err != nil {
+		handlerLog.Error(err, "Incorrect configuration in DryRun mode")
+		return nil
+	}
+
+	sources := make([]string, 0, len(dryRun))
+	for _, tailingSidecarConfig := range dryRun {
+		sources = append(sources, types.NamespacedName{Namespace: tailingSidecarConfig.Namespace, Name: tailingSidecarConfig.Name}.String())
+	}
+
+	sidecars := make([]SidecarProvenance, 0)
+	for _, config := range configs {
+		if !slices.Contains(sources, config.source) {
+			continue
+		}
+		if err := prepareVolume(pod.Spec.Containers, &config.spec.VolumeMount); err != nil {
+			continue
+		}
+		if isSidecarAvailable(pod.Spec.Containers, config) {
+			continue
+		}
+		sidecars = append(sidecars, newSidecarProvenance(config, e.TailingSidecarImage, e.OperatorVersion))
+	}
+	return sidecars
+}
+
+// setDryRunSidecars sets annotation with tailing sidecars which would be added to Pod
+// by TailingSidecarConfigs in DryRun mode, annotation is removed when there are no such tailing sidecars
+func setDryRunSidecars(annotations map[string]string, sidecars []SidecarProvenance) map[string]string {
+	if len(sidecars) == 0 {
+		delete(annotations, dryRunAnnotation)
+		return annotations
+	}
+
+	value, err := json.Marshal(sidecars)
+	if err != nil {
+		handlerLog.Error(err, "Failed to marshal dry-run sidecars", "sidecars", sidecars)
+		return annotations
+	}
+
+	if annotations == nil {
+		annotations = make(map[string]string, 1)
+	}
+	annotations[dryRunAnnotation] = string(value)
+	return annotations
+}
@@ -0,0 +1,136 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package handler
+
+import (
+	"context"
+	"encoding/json"
+
+	tailingsidecarv1 "github.com/SumoLogic/tailing-sidecar/operator/api/v1"
+	jsonpatch "github.com/evanphx/json-patch/v5"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	admv1 "k8s.io/api/admission/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+)
+
+var _ = Describe("dry run", func() {
+	dryRunScheme := runtime.NewScheme()
+	Expect(clientgoscheme.AddToScheme(dryRunScheme)).To(Succeed())
+	Expect(tailingsidecarv1.AddToScheme(dryRunScheme)).To(Succeed())
+
+	newTailingSidecarConfig := func(name string, mode tailingsidecarv1.Mode) *tailingsidecarv1.TailingSidecarConfig {
+		return &tailingsidecarv1.TailingSidecarConfig{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: name},
+			Spec: tailingsidecarv1.TailingSidecarConfigSpec{
+				Mode: mode,
+				PodSelector: &metav1.LabelSelector{
+					MatchLabels: map[string]string{"app": "dry-run"},
+				},
+				SidecarSpecs: map[string]tailingsidecarv1.SidecarSpec{
+					name: {
+						Path:        "/var/log/" + name + ".log",
+						VolumeMount: corev1.VolumeMount{Name: "varlog", MountPath: "/var/log"},
+					},
+				},
+			},
+		}
+	}
+
+	podExtender := &PodExtender{
+		Client: fake.NewClientBuilder().
+			WithScheme(dryRunScheme).
+			WithObjects(
+				newTailingSidecarConfig("active", tailingsidecarv1.ModeActive),
+				newTailingSidecarConfig("paused", tailingsidecarv1.ModePaused),
+				newTailingSidecarConfig("shadow", tailingsidecarv1.ModeDryRun),
+			).
+			Build(),
+		Decoder:              admission.NewDecoder(dryRunScheme),
+		TailingSidecarImage:  "sumologic/tailing-sidecar:latest",
+		TailingSidecarNaming: NamingIndex,
+	}
+
+	pod := corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "pod",
+			Namespace: "default",
+			Labels:    map[string]string{"app": "dry-run"},
+		},
+		Spec: corev1.PodSpec{
+			Containers: []corev1.Container{
+				{
+					Name:         "count",
+					Image:        "busybox",
+					VolumeMounts: []corev1.VolumeMount{{Name: "varlog", MountPath: "/var/log"}},
+				},
+			},
+			Volumes: []corev1.Volume{
+				{Name: "varlog", VolumeSource: corev1.VolumeSource{EmptyDir: &corev1.EmptyDirVolumeSource{}}},
+			},
+		},
+	}
+	raw, err := json.Marshal(pod)
+	Expect(err).ToNot(HaveOccurred())
+
+	metricBefore := testutil.ToFloat64(dryRunSidecarsTotal.WithLabelValues("default", "shadow"))
+	resp := podExtender.Handle(context.Background(), admission.Request{
+		AdmissionRequest: admv1.AdmissionRequest{
+			Operation: admv1.Create,
+			Namespace: "default",
+			Object:    runtime.RawExtension{Raw: raw},
+		},
+	})
+
+	Expect(resp.Allowed).To(BeTrue())
+	rawPatch, err := json.Marshal(resp.Patches)
+	Expect(err).ToNot(HaveOccurred())
+	patch, err := jsonpatch.DecodePatch(rawPatch)
+	Expect(err).ToNot(HaveOccurred())
+	patched, err := patch.Apply(raw)
+	Expect(err).ToNot(HaveOccurred())
+	patchedPod := corev1.Pod{}
+	Expect(json.Unmarshal(patched, &patchedPod)).To(Succeed())
+
+	It("adds tailing sidecars only from active TailingSidecarConfig", func() {
+		names := make([]string, 0)
+		for _, container := range patchedPod.Spec.Containers {
+			names = append(names, container.Name)
+		}
+		Expect(names).To(Equal([]string{"count", "active"}))
+	})
+
+	It("records tailing sidecars from TailingSidecarConfig in DryRun mode", func() {
+		Expect(GetDryRunSidecars(patchedPod.Annotations)).To(Equal([]SidecarProvenance{
+			{
+				Container:       "shadow",
+				Source:          SourceTailingSidecarConfig,
+				Namespace:       "default",
+				Name:            "shadow",
+				ResourceVersion: "999",
+				Image:           "sumologic/tailing-sidecar:latest",
+			},
+		}))
+		Expect(testutil.ToFloat64(dryRunSidecarsTotal.WithLabelValues("default", "shadow"))).To(Equal(metricBefore + 1))
+	})
+})
@@ -0,0 +1,61 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package handler
+
+import (
+	"time"
+
+	tailingsidecarv1 "github.com/SumoLogic/tailing-sidecar/operator/api/v1"
+)
+
+// expiresAtAnnotation contains time in RFC 3339 format after which configuration from tailing-sidecar annotation is ignored
+const expiresAtAnnotation = "tailing-sidecar.sumologic.com/expires-at"
+
+// GetExpirationTime returns time after which TailingSidecarConfig is not applied to Pods,
+// the earlier of creation time increased by ttl and expiresAt is used, returns false when TailingSidecarConfig does not expire
+func GetExpirationTime(tailingSidecarConfig tailingsidecarv1.TailingSidecarConfig) (time.Time, bool) {
+	var expiresAt time.Time
+	if tailingSidecarConfig.Spec.TTL != nil {
+		expiresAt = tailingSidecarConfig.CreationTimestamp.Add(tailingSidecarConfig.Spec.TTL.Duration)
+	}
+	if tailingSidecarConfig.Spec.ExpiresAt != nil && (expiresAt.IsZero() || tailingSidecarConfig.Spec.ExpiresAt.Time.Before(expiresAt)) {
+		expiresAt = tailingSidecarConfig.Spec.ExpiresAt.Time
+	}
+	return expiresAt, !expiresAt.IsZero()
+}
+
+// IsExpired checks if TailingSidecarConfig expired at given time
+func IsExpired(tailingSidecarConfig tailingsidecarv1.TailingSidecarConfig, now time.Time) bool {
+	expiresAt, ok := GetExpirationTime(tailingSidecarConfig)
+	return ok && !now.Before(expiresAt)
+}
+
+// isAnnotationExpired checks if configuration from tailing-sidecar annotation expired at given time,
+// configuration with incorrect expires-at annotation does not expire
+func isAnnotationExpired(annotations map[string]string, now time.Time) bool {
+	value, ok := annotations[expiresAtAnnotation]
+	if !ok {
+		return false
+	}
+
+	expiresAt, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		handlerLog.Info("Incorrect expires-at annotation", "annotation", value, "error", err.Error())
+		return false
+	}
+	return !now.Before(expiresAt)
+}
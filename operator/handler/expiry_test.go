@@ -0,0 +1,77 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package handler
+
+import (
+	"time"
+
+	tailingsidecarv1 "github.com/SumoLogic/tailing-sidecar/operator/api/v1"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+var _ = Describe("expiry", func() {
+	created := time.Date(2021, time.March, 1, 10, 0, 0, 0, time.UTC)
+	newTailingSidecarConfig := func(ttl *metav1.Duration, expiresAt *metav1.Time) tailingsidecarv1.TailingSidecarConfig {
+		return tailingsidecarv1.TailingSidecarConfig{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "debug", CreationTimestamp: metav1.NewTime(created)},
+			Spec:       tailingsidecarv1.TailingSidecarConfigSpec{TTL: ttl, ExpiresAt: expiresAt},
+		}
+	}
+
+	It("does not expire without ttl and expiresAt", func() {
+		_, ok := GetExpirationTime(newTailingSidecarConfig(nil, nil))
+		Expect(ok).To(BeFalse())
+		Expect(IsExpired(newTailingSidecarConfig(nil, nil), created.Add(24*time.Hour))).To(BeFalse())
+	})
+
+	It("expires after ttl", func() {
+		tailingSidecarConfig := newTailingSidecarConfig(&metav1.Duration{Duration: 2 * time.Hour}, nil)
+		expiresAt, ok := GetExpirationTime(tailingSidecarConfig)
+		Expect(ok).To(BeTrue())
+		Expect(expiresAt).To(Equal(created.Add(2 * time.Hour)))
+		Expect(IsExpired(tailingSidecarConfig, created.Add(time.Hour))).To(BeFalse())
+		Expect(IsExpired(tailingSidecarConfig, created.Add(2*time.Hour))).To(BeTrue())
+	})
+
+	It("uses the earlier of ttl and expiresAt", func() {
+		expiresAt := metav1.NewTime(created.Add(time.Hour))
+		expirationTime, _ := GetExpirationTime(newTailingSidecarConfig(&metav1.Duration{Duration: 2 * time.Hour}, &expiresAt))
+		Expect(expirationTime).To(Equal(created.Add(time.Hour)))
+
+		expirationTime, _ = GetExpirationTime(newTailingSidecarConfig(&metav1.Duration{Duration: 30 * time.Minute}, &expiresAt))
+		Expect(expirationTime).To(Equal(created.Add(30 * time.Minute)))
+	})
+
+	It("ignores tailing-sidecar annotation after expiry", func() {
+		annotations := map[string]string{
+			SidecarAnnotation:   "varlog:/var/log/example.log",
+			expiresAtAnnotation: created.Format(time.RFC3339),
+		}
+		Expect(isAnnotationExpired(annotations, created.Add(-time.Minute))).To(BeFalse())
+		Expect(isAnnotationExpired(annotations, created)).To(BeTrue())
+		Expect(parseAnnotation(annotations)).To(BeEmpty())
+
+		annotations[expiresAtAnnotation] = time.Now().Add(time.Hour).Format(time.RFC3339)
+		Expect(parseAnnotation(annotations)).To(HaveLen(1))
+	})
+
+	It("does not expire tailing-sidecar annotation with incorrect expires-at annotation", func() {
+		Expect(isAnnotationExpired(map[string]string{expiresAtAnnotation: "tomorrow"}, created)).To(BeFalse())
+	})
+})
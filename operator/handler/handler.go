@@ -18,43 +18,42 @@ package handler
 
 import (
 	"context"
-	"encoding/json"
 	"errors"
 	"fmt"
 	"net/http"
-	"reflect"
+	"slices"
 	"strings"
+	"time"
 
 	tailingsidecarv1 "github.com/SumoLogic/tailing-sidecar/operator/api/v1"
 	admv1 "k8s.io/api/admission/v1"
 	corev1 "k8s.io/api/core/v1"
-	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
-	"k8s.io/apimachinery/pkg/labels"
 	ctrl "sigs.k8s.io/controller-runtime"
 
 	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/utils/ptr"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
 )
 
-// +kubebuilder:webhook:path=/add-tailing-sidecars-v1-pod,mutating=true,failurePolicy=ignore,groups="",resources=pods,verbs=create;update;delete,versions=v1,name=tailing-sidecar.sumologic.com,sideEffects=none,admissionReviewVersions={v1,v1beta1}
+// +kubebuilder:webhook:path=/add-tailing-sidecars-v1-pod,mutating=true,failurePolicy=ignore,groups="",resources=pods;pods/resize,verbs=create;update;delete,versions=v1,name=tailing-sidecar.sumologic.com,sideEffects=none,admissionReviewVersions={v1,v1beta1}
 
 const (
 	sidecarEnvPath                   = "PATH_TO_TAIL"
 	sidecarOtelFileStoragePathEnv    = "OTEL_FILE_STORAGE_PATH"
-	sidecarOtelFileStoragePath       = "/var/lib/otc/tailing-sidecar-%d"
-	sidecarOtelFileStorageVolumeName = "tailing-sidecar-otel-file-storage-tailing-sidecar-%d"
+	sidecarOtelFileStoragePath       = "/var/lib/otc/tailing-sidecar-%s"
+	sidecarOtelFileStorageVolumeName = "tailing-sidecar-otel-file-storage-tailing-sidecar-%s"
 	sidecarOtelLogsPathEnv           = "SIDECAR_OTEL_LOG_PATH"
-	sidecarOtelLogsPath              = "/var/log/tailing-sidecar-%d"
-	sidecarOtelLogsVolumeName        = "tailing-sidecar-otel-logs-tailing-sidecar-%d"
+	sidecarOtelLogsPath              = "/var/log/tailing-sidecar-%s"
+	sidecarOtelLogsVolumeName        = "tailing-sidecar-otel-logs-tailing-sidecar-%s"
 	sidecarEnvMarker                 = "TAILING_SIDECAR"
 	sidecarEnvMarkerVal              = "true"
 
-	sidecarContainerName    = "tailing-sidecar-%d"
+	sidecarContainerName    = "tailing-sidecar-%s"
 	sidecarContainerNameEnv = "SIDECAR_CONTAINER_NAME"
 	sidecarContainerPrefix  = "tailing-sidecar-"
 
-	sidecarVolumeName   = "volume-sidecar-%d"
+	sidecarVolumeName   = "volume-sidecar-%s"
 	sidecarVolumePrefix = "volume-sidecar-"
 	sidecarMountPath    = "/tailing-sidecar/var"
 
@@ -65,15 +64,28 @@ const (
 
 var handlerLog = ctrl.Log.WithName("tailing-sidecar.operator.handler.PodExtender")
 
+// sidecarResizePolicy allows to resize CPU and memory of tailing sidecars in place without restarting them
+var sidecarResizePolicy = []corev1.ContainerResizePolicy{
+	{ResourceName: corev1.ResourceCPU, RestartPolicy: corev1.NotRequired},
+	{ResourceName: corev1.ResourceMemory, RestartPolicy: corev1.NotRequired},
+}
+
 // PodExtender extends Pods by tailling sidecar containers
 type PodExtender struct {
 	Client                  client.Client
 	TailingSidecarImage     string
 	TailingSidecarResources corev1.ResourceRequirements
+	TailingSidecarVolumes   tailingsidecarv1.SidecarVolumesSpec
+	TailingSidecarNaming    string
+	OperatorVersion         string
 	Decoder                 admission.Decoder
 	ConfigMapName           string
 	ConfigMapNamespace      string
 	ConfigMountPath         string
+	// Decisions records admission decisions, decisions are not recorded when it is nil
+	Decisions *DecisionLog
+	// OperatorUsername is the user of the operator, only resize requests sent by the operator change tailing sidecars
+	OperatorUsername string
 }
 
 // Handle handles requests to create/update Pod and extends it by adding tailing sidecars
@@ -82,6 +94,13 @@ func (e *PodExtender) Handle(ctx context.Context, req admission.Request) admissi
 		return admission.Allowed("Received startupProbe/livenessProbe")
 	}
 
+	resp := e.handle(ctx, req)
+	e.Decisions.record(req, resp, getPodContainers)
+	return resp
+}
+
+func (e *PodExtender) handle(ctx context.Context, req admission.Request) admission.Response {
+
 	if req.Operation == admv1.Delete {
 		return e.handleDelete(ctx, req)
 	}
@@ -92,12 +111,16 @@ func (e *PodExtender) Handle(ctx context.Context, req admission.Request) admissi
 		return admission.Errored(http.StatusBadRequest, err)
 	}
 
+	if isInjectedInTemplate(pod) {
+		return admission.Allowed(templateInjectedMessage)
+	}
+
 	tailingSidecarConfigs, err := e.getTailingSidecarConfigs(ctx, pod.ObjectMeta.Labels)
 	if err != nil {
 		return admission.Errored(http.StatusInternalServerError, err)
 	}
 
-	if _, ok := pod.ObjectMeta.Annotations[sidecarAnnotation]; !ok && len(tailingSidecarConfigs) == 0 {
+	if _, ok := pod.ObjectMeta.Annotations[SidecarAnnotation]; !ok && len(tailingSidecarConfigs) == 0 {
 		return admission.Allowed("Configuration for Tailing Sidecar Operator is not provided")
 	}
 
@@ -109,6 +132,11 @@ func (e *PodExtender) Handle(ctx context.Context, req admission.Request) admissi
 		"Operation", req.Operation,
 	)
 
+	if req.Operation == admv1.Update {
+		return e.handleUpdate(ctx, pod, tailingSidecarConfigs, req)
+	}
+
+	snapshot := newPodSnapshot(pod)
 	if err := e.extendPod(ctx, pod, tailingSidecarConfigs, req); err != nil {
 		return admission.Errored(http.StatusInternalServerError, err)
 	}
@@ -117,17 +145,30 @@ func (e *PodExtender) Handle(ctx context.Context, req admission.Request) admissi
 		return admission.Errored(http.StatusInternalServerError, err)
 	}
 
-	marshaledPod, err := json.Marshal(pod)
-	if err != nil {
-		return admission.Errored(http.StatusInternalServerError, err)
-	}
-	return admission.PatchResponseFromRaw(req.Object.Raw, marshaledPod)
+	// patches are built only for fields changed by webhook, comparing whole serialized Pods is expensive
+	resp := admission.Patched("", snapshot.patches(pod)...)
+	resp.AuditAnnotations = getProvenanceAuditAnnotations(pod.ObjectMeta.Annotations)
+	return resp
 }
 
 // extendPod extends Pod by adding tailing sidecars according to configuration in annotation
 func (e PodExtender) extendPod(ctx context.Context, pod *corev1.Pod, tailingSidecarConfigs []tailingsidecarv1.TailingSidecarConfig, req admission.Request) error {
 	// Get number of existing tailing sidecars
 	sidecarsCount := len(getTailingSidecars(pod.Spec.Containers))
+	sidecarIndex := sidecarsCount
+
+	// TailingSidecarConfigs with canary are applied only to selected Pods
+	tailingSidecarConfigs = filterCanary(tailingSidecarConfigs, pod, req)
+
+	// TailingSidecarConfigs in DryRun mode are only recorded in annotation
+	tailingSidecarConfigs, dryRunTailingSidecarConfigs := splitDryRun(tailingSidecarConfigs)
+	dryRunSidecars := e.getDryRunSidecars(pod, tailingSidecarConfigs, dryRunTailingSidecarConfigs)
+	if !isDryRun(req) {
+		for _, sidecar := range dryRunSidecars {
+			recordDryRunSidecar(sidecar.Namespace, sidecar.Name)
+		}
+	}
+	pod.ObjectMeta.Annotations = setDryRunSidecars(pod.ObjectMeta.Annotations, dryRunSidecars)
 
 	// Get configurations from TailingSidecars and annotations
 	configs, err := getConfigs(pod.ObjectMeta.Annotations, tailingSidecarConfigs)
@@ -156,6 +197,7 @@ func (e PodExtender) extendPod(ctx context.Context, pod *corev1.Pod, tailingSide
 	)
 
 	containers := make([]corev1.Container, 0)
+	injected := make([]SidecarProvenance, 0)
 	for _, config := range configs {
 
 		err := prepareVolume(pod.Spec.Containers, &config.spec.VolumeMount)
@@ -178,45 +220,58 @@ func (e PodExtender) extendPod(ctx context.Context, pod *corev1.Pod, tailingSide
 			continue
 		}
 
-		volumeName := fmt.Sprintf(sidecarVolumeName, sidecarsCount)
+		suffix, nextIndex := getSidecarSuffix(e.TailingSidecarNaming, pod, config, sidecarIndex)
+		volumeName := fmt.Sprintf(sidecarVolumeName, suffix)
 		if config.name == "" {
-			config.name = fmt.Sprintf(sidecarContainerName, sidecarsCount)
+			config.name = fmt.Sprintf(sidecarContainerName, suffix)
 		}
 
-		pod.Spec.Volumes = append(pod.Spec.Volumes,
-			corev1.Volume{
-				Name: volumeName,
-				VolumeSource: corev1.VolumeSource{
-					EmptyDir: &corev1.EmptyDirVolumeSource{}},
-			})
+		volumes := getSidecarVolumes(config.spec.Volumes, e.TailingSidecarVolumes)
+		config.spec.Volumes = &volumes
 
-		otelLogsVolumeName := fmt.Sprintf(sidecarOtelLogsVolumeName, sidecarsCount)
-		otelCollectorLogsPath := fmt.Sprintf(sidecarOtelLogsPath, sidecarsCount)
+		otelFileStorageVolumeName := fmt.Sprintf(sidecarOtelFileStorageVolumeName, suffix)
+		otelFileStoragePath := fmt.Sprintf(sidecarOtelFileStoragePath, suffix)
 
-		otelFileStorageVolumeName := fmt.Sprintf(sidecarOtelFileStorageVolumeName, sidecarsCount)
-		otelFileStoragePath := fmt.Sprintf(sidecarOtelFileStoragePath, sidecarsCount)
+		otelFileStorageVolume, otelFileStorageVolumeMount, err := getFileStorage(pod, config, otelFileStorageVolumeName, otelFileStoragePath)
+		if err != nil {
+			handlerLog.Error(err,
+				"Failed to prepare file storage",
+				"Name", req.Name,
+				"Namespace", namespace,
+				"Kind", req.Kind,
+				"GenerateName", pod.ObjectMeta.GenerateName,
+			)
+			continue
+		}
 
 		pod.Spec.Volumes = append(pod.Spec.Volumes,
 			corev1.Volume{
-				Name: otelLogsVolumeName,
+				Name: volumeName,
 				VolumeSource: corev1.VolumeSource{
-					EmptyDir: &corev1.EmptyDirVolumeSource{}},
+					EmptyDir: volumes.Sidecar},
 			})
 
+		otelLogsVolumeName := fmt.Sprintf(sidecarOtelLogsVolumeName, suffix)
+		otelCollectorLogsPath := fmt.Sprintf(sidecarOtelLogsPath, suffix)
+
 		pod.Spec.Volumes = append(pod.Spec.Volumes,
 			corev1.Volume{
-				Name: otelFileStorageVolumeName,
+				Name: otelLogsVolumeName,
 				VolumeSource: corev1.VolumeSource{
-					EmptyDir: &corev1.EmptyDirVolumeSource{}},
+					EmptyDir: volumes.OtelLogs},
 			})
 
-		// check if sidecar need add default resources
-		if config.spec.Resources.Requests == nil {
-			config.spec.Resources.Requests = e.TailingSidecarResources.Requests
+		if otelFileStorageVolume != nil {
+			pod.Spec.Volumes = append(pod.Spec.Volumes, *otelFileStorageVolume)
 		}
-		if config.spec.Resources.Limits == nil {
-			config.spec.Resources.Limits = e.TailingSidecarResources.Limits
+
+		config.spec.Resources = e.getSidecarResources(config)
+
+		emptyDirs := []*corev1.EmptyDirVolumeSource{volumes.Sidecar, volumes.OtelLogs}
+		if config.spec.FileStorage == nil {
+			emptyDirs = append(emptyDirs, volumes.OtelFileStorage)
 		}
+		config.spec.Resources = setEphemeralStorageRequest(config.spec.Resources, emptyDirs...)
 
 		volumeMounts := []corev1.VolumeMount{
 			config.spec.VolumeMount,
@@ -224,11 +279,7 @@ func (e PodExtender) extendPod(ctx context.Context, pod *corev1.Pod, tailingSide
 				Name:      volumeName,
 				MountPath: sidecarMountPath,
 			},
-			{
-				Name:      otelFileStorageVolumeName,
-				MountPath: otelFileStoragePath,
-			},
-
+			otelFileStorageVolumeMount,
 			{
 				Name:      otelLogsVolumeName,
 				MountPath: otelCollectorLogsPath,
@@ -270,32 +321,43 @@ func (e PodExtender) extendPod(ctx context.Context, pod *corev1.Pod, tailingSide
 			},
 			VolumeMounts: volumeMounts,
 			Resources:    config.spec.Resources,
+			ResizePolicy: slices.Clone(sidecarResizePolicy),
 		}
+		container.Env = append(container.Env, getPodNameEnv(otelFileStorageVolumeMount)...)
+		// runtime settings are derived from final resources, so they follow configuration and operator defaults
+		container.Env = append(container.Env, getRuntimeEnv(config.spec.Resources, emptyDirs...)...)
 		containers = append(containers, container)
+		injected = append(injected, newSidecarProvenance(config, e.TailingSidecarImage, e.OperatorVersion))
 		pod.ObjectMeta.Annotations = addAnnotations(pod.ObjectMeta.Annotations, config)
-		sidecarsCount++
+		sidecarIndex = nextIndex
 	}
 	podContainers := removeDeletedSidecars(pod.Spec.Containers, configs)
 
 	pod.Spec.Containers = append(podContainers, containers...)
+	pod.ObjectMeta.Annotations = setProvenance(pod.ObjectMeta.Annotations, injected, pod.Spec.Containers)
 
 	if e.ConfigMapName != "" && e.ConfigMountPath != "" && e.ConfigMapNamespace != "" {
-		err = e.createSidecarConfigMap(ctx, namespace)
-		if err != nil {
-			return err
+		// configuration is not created for dry-run requests, because they cannot have side effects
+		if !isDryRun(req) {
+			err = e.createSidecarConfigMap(ctx, namespace)
+			if err != nil {
+				return err
+			}
 		}
 
-		pod.Spec.Volumes = append(pod.Spec.Volumes,
-			corev1.Volume{
-				Name: sidecarConfigurationName,
-				VolumeSource: corev1.VolumeSource{
-					ConfigMap: &corev1.ConfigMapVolumeSource{
-						LocalObjectReference: corev1.LocalObjectReference{
-							Name: e.ConfigMapName,
+		if !isVolumeAvailable(pod.Spec.Volumes, sidecarConfigurationName) {
+			pod.Spec.Volumes = append(pod.Spec.Volumes,
+				corev1.Volume{
+					Name: sidecarConfigurationName,
+					VolumeSource: corev1.VolumeSource{
+						ConfigMap: &corev1.ConfigMapVolumeSource{
+							LocalObjectReference: corev1.LocalObjectReference{
+								Name: e.ConfigMapName,
+							},
 						},
 					},
-				},
-			})
+				})
+		}
 	}
 
 	pod.Spec.Volumes = filterUnusedVolumes(pod.Spec.Volumes, pod.Spec.Containers)
@@ -304,26 +366,26 @@ func (e PodExtender) extendPod(ctx context.Context, pod *corev1.Pod, tailingSide
 
 func (e PodExtender) getTailingSidecarConfigs(ctx context.Context, podLabels map[string]string) ([]tailingsidecarv1.TailingSidecarConfig, error) {
 	tailingSidecarConfigList := &tailingsidecarv1.TailingSidecarConfigList{}
-	tailingSidecarConfigListOpts := []client.ListOption{}
+	// TailingSidecarConfigs are not modified by webhook, so they are not copied when they are listed from cache
+	tailingSidecarConfigListOpts := []client.ListOption{client.UnsafeDisableDeepCopy}
 
 	if err := e.Client.List(ctx, tailingSidecarConfigList, tailingSidecarConfigListOpts...); err != nil {
 		handlerLog.Error(err, "Failed to get list of TailingSidecarConfigs")
 		return nil, err
 	}
 
-	tailingSidcarConfigs := make([]tailingsidecarv1.TailingSidecarConfig, 0)
-	for _, tailingSidcarConfig := range tailingSidecarConfigList.Items {
-		selector, err := metav1.LabelSelectorAsSelector(tailingSidcarConfig.Spec.PodSelector)
-		if err != nil {
-			return nil, fmt.Errorf("invalid label selector in TailingSidecarConfig: %v", err)
-		}
-		// TailingSidecarConfig with a nil or empty selector should match nothing
-		if selector.Empty() || !selector.Matches(labels.Set(podLabels)) {
-			continue
-		}
-		tailingSidcarConfigs = append(tailingSidcarConfigs, tailingSidcarConfig)
-	}
-	return tailingSidcarConfigs, nil
+	selectors.prune(tailingSidecarConfigList.Items)
+	return matchActiveTailingSidecarConfigs(tailingSidecarConfigList.Items, podLabels)
+}
+
+// matchActiveTailingSidecarConfigs returns TailingSidecarConfigs matching Pod labels, paused and expired TailingSidecarConfigs
+// are ignored, elements of the given slice are modified
+func matchActiveTailingSidecarConfigs(tailingSidecarConfigs []tailingsidecarv1.TailingSidecarConfig, podLabels map[string]string) ([]tailingsidecarv1.TailingSidecarConfig, error) {
+	now := time.Now()
+	tailingSidecarConfigs = slices.DeleteFunc(tailingSidecarConfigs, func(tailingSidecarConfig tailingsidecarv1.TailingSidecarConfig) bool {
+		return isPaused(tailingSidecarConfig) || IsExpired(tailingSidecarConfig, now)
+	})
+	return MatchTailingSidecarConfigs(tailingSidecarConfigs, podLabels)
 }
 
 func (e PodExtender) createSidecarConfigMap(ctx context.Context, namespace string) error {
@@ -433,17 +495,35 @@ func filterUnusedVolumes(volumes []corev1.Volume, containers []corev1.Container)
 	return podVolumes
 }
 
+// getSidecarResources returns resources of tailing sidecar, requests and limits which are not configured are taken from defaults
+func (e PodExtender) getSidecarResources(config sidecarConfig) corev1.ResourceRequirements {
+	resources := config.spec.Resources
+	if resources.Requests == nil {
+		resources.Requests = e.TailingSidecarResources.Requests
+	}
+	if resources.Limits == nil {
+		resources.Limits = e.TailingSidecarResources.Limits
+	}
+	return resources
+}
+
 // isSidecarAvailable checks if tailing sidecar container with given configuration exists in Pod specification
 func isSidecarAvailable(containers []corev1.Container, config sidecarConfig) bool {
-	for _, container := range containers {
+	return getSidecarIndex(containers, config) >= 0
+}
+
+// getSidecarIndex returns index of tailing sidecar container with given configuration in Pod specification,
+// it returns -1 when such container does not exist
+func getSidecarIndex(containers []corev1.Container, config sidecarConfig) int {
+	for i, container := range containers {
 		if ((config.name == "" && strings.HasPrefix(container.Name, sidecarContainerPrefix)) || config.name == container.Name) &&
 			isSidecarEnvAvailable(container.Env, sidecarEnvPath, config.spec.Path) &&
 			isSidecarEnvAvailable(container.Env, sidecarEnvMarker, sidecarEnvMarkerVal) &&
 			isVolumeMountAvailable(container.VolumeMounts, config.spec.VolumeMount) {
-			return true
+			return i
 		}
 	}
-	return false
+	return -1
 }
 
 // isSidecarEnvAvailable checks if env is defined and has specific value
@@ -459,7 +539,29 @@ func isSidecarEnvAvailable(envs []corev1.EnvVar, envName string, envValue string
 // isVolumeMountAvailable checks if volume is available as volume mounted to the container
 func isVolumeMountAvailable(volumeMounts []corev1.VolumeMount, volume corev1.VolumeMount) bool {
 	for _, volumeMount := range volumeMounts {
-		if reflect.DeepEqual(volumeMount, volume) {
+		if isSameVolumeMount(volumeMount, volume) {
+			return true
+		}
+	}
+	return false
+}
+
+// isSameVolumeMount compares all fields of volume mounts, it is called for each container
+// and each configuration on every admission, so reflection is not used
+func isSameVolumeMount(a corev1.VolumeMount, b corev1.VolumeMount) bool {
+	return a.Name == b.Name &&
+		a.MountPath == b.MountPath &&
+		a.ReadOnly == b.ReadOnly &&
+		a.SubPath == b.SubPath &&
+		a.SubPathExpr == b.SubPathExpr &&
+		ptr.Equal(a.MountPropagation, b.MountPropagation) &&
+		ptr.Equal(a.RecursiveReadOnly, b.RecursiveReadOnly)
+}
+
+// isVolumeAvailable checks if volume with given name exists in Pod specification
+func isVolumeAvailable(volumes []corev1.Volume, name string) bool {
+	for _, volume := range volumes {
+		if volume.Name == name {
 			return true
 		}
 	}
@@ -542,11 +644,12 @@ func (e *PodExtender) handleDelete(ctx context.Context, req admission.Request) a
 		return admission.Allowed(fmt.Sprintf("Error while getting configMap to clean up (%v); %s", err, deletionMessage))
 	}
 
-	// check if the configMap is used by any pod in the namespace
+	// check if the configMap is used by any pod in the namespace, pods are looked up in index of mounted configMaps
 	podList := &corev1.PodList{}
 
 	listOptions := []client.ListOption{
 		client.InNamespace(req.Namespace),
+		client.MatchingFields{PodConfigMapsIndex: e.ConfigMapName},
 	}
 	err = e.Client.List(ctx, podList, listOptions...)
 	if err != nil {
@@ -558,14 +661,10 @@ func (e *PodExtender) handleDelete(ctx context.Context, req admission.Request) a
 		if p.Name == pod.Name && p.Namespace == pod.Namespace {
 			continue
 		}
-
-		// check if sidecar configuration is attached to the p pod
-		for _, volume := range p.Spec.Volumes {
-			if volume.ConfigMap != nil && volume.ConfigMap.Name == e.ConfigMapName {
-				// do not anything in case volume is used
-				return admission.Allowed(deletionMessage)
-			}
-		}
+		// pods which are being deleted still run tailing sidecars until they terminate, so they use configMap,
+		// it is removed when the last of them is deleted, as deletion of terminated pod is also sent to webhook
+		// do not anything in case configMap is used
+		return admission.Allowed(deletionMessage)
 	}
 
 	// delete configMap as it is not used by any pod
@@ -23,6 +23,7 @@ import (
 	"io/ioutil"
 	"net/http"
 	"path/filepath"
+	"strings"
 	"testing"
 
 	"github.com/nsf/jsondiff"
@@ -518,8 +519,10 @@ var _ = Describe("handler", func() {
 				Expect(resp.Allowed).To(BeTrue())
 				Expect(resp.Patches).NotTo(BeEmpty())
 
-				expectedPatches := loadJSONPatches("testdata/patch_with_2_tailing_sidecars.json")
-
+				expectedPatches := append(loadJSONPatches("testdata/patch_with_2_tailing_sidecars.json"), provenancePatch(
+					annotationProvenance("tailing-sidecar-0"),
+					annotationProvenance("tailing-sidecar-1"),
+				))
 				Expect(len(resp.Patches)).Should(Equal(len(expectedPatches)))
 
 				for _, patch := range resp.Patches {
@@ -626,8 +629,10 @@ var _ = Describe("handler", func() {
 				Expect(resp.Allowed).To(BeTrue())
 				Expect(resp.Patches).NotTo(BeEmpty())
 
-				expectedPatches := loadJSONPatches("testdata/patch_with_2_tailing_sidecars_with_configuration.json")
-
+				expectedPatches := append(loadJSONPatches("testdata/patch_with_2_tailing_sidecars_with_configuration.json"), provenancePatch(
+					annotationProvenance("tailing-sidecar-0"),
+					annotationProvenance("tailing-sidecar-1"),
+				))
 				Expect(len(resp.Patches)).Should(Equal(len(expectedPatches)))
 
 				for _, patch := range resp.Patches {
@@ -739,8 +744,10 @@ var _ = Describe("handler", func() {
 				Expect(resp.Allowed).To(BeTrue())
 				Expect(resp.Patches).NotTo(BeEmpty())
 
-				expectedPatches := loadJSONPatches("testdata/patch_with_2_tailing_sidecars_with_configuration.json")
-
+				expectedPatches := append(loadJSONPatches("testdata/patch_with_2_tailing_sidecars_with_configuration.json"), provenancePatch(
+					annotationProvenance("tailing-sidecar-0"),
+					annotationProvenance("tailing-sidecar-1"),
+				))
 				Expect(len(resp.Patches)).Should(Equal(len(expectedPatches)))
 
 				for _, patch := range resp.Patches {
@@ -973,8 +980,10 @@ var _ = Describe("handler", func() {
 				Expect(resp.Allowed).To(BeTrue())
 				Expect(resp.Patches).NotTo(BeEmpty())
 
-				expectedPatches := loadJSONPatches("testdata/patch_with_2_tailing_sidecars.json")
-
+				expectedPatches := append(loadJSONPatches("testdata/patch_with_2_tailing_sidecars.json"), provenancePatch(
+					annotationProvenance("tailing-sidecar-0"),
+					annotationProvenance("tailing-sidecar-1"),
+				))
 				Expect(len(resp.Patches)).Should(Equal(len(expectedPatches)))
 
 				for _, patch := range resp.Patches {
@@ -1102,8 +1111,10 @@ var _ = Describe("handler", func() {
 				Expect(resp.Allowed).To(BeTrue())
 				Expect(resp.Patches).NotTo(BeEmpty())
 
-				expectedPatches := loadJSONPatches("testdata/patch_with_2_tailing_sidecars_different_namespace.json")
-
+				expectedPatches := append(loadJSONPatches("testdata/patch_with_2_tailing_sidecars_different_namespace.json"), provenanceAnnotationsPatch(
+					tailingSidecarConfigProvenance("sidecar-1", tailingSidecar1),
+					tailingSidecarConfigProvenance("sidecar-2", tailingSidecar2),
+				))
 				Expect(len(resp.Patches)).Should(Equal(len(expectedPatches)))
 
 				for _, patch := range resp.Patches {
@@ -1210,8 +1221,11 @@ var _ = Describe("handler", func() {
 				Expect(resp.Allowed).To(BeTrue())
 				Expect(resp.Patches).NotTo(BeEmpty())
 
-				expectedPatches := loadJSONPatches("testdata/patch_with_3_tailing_sidecars_raw_and_predefined.json")
-
+				expectedPatches := append(loadJSONPatches("testdata/patch_with_3_tailing_sidecars_raw_and_predefined.json"), provenancePatch(
+					tailingSidecarConfigProvenance("sidecar-0", tailingSidecar),
+					annotationProvenance("tailing-sidecar-0"),
+					annotationProvenance("tailing-sidecar-1"),
+				))
 				Expect(len(resp.Patches)).Should(Equal(len(expectedPatches)))
 
 				for _, patch := range resp.Patches {
@@ -1317,8 +1331,11 @@ var _ = Describe("handler", func() {
 				Expect(resp.Allowed).To(BeTrue())
 				Expect(resp.Patches).NotTo(BeEmpty())
 
-				expectedPatches := loadJSONPatches("testdata/patch_with_3_named_tailing_sidecars.json")
-
+				expectedPatches := append(loadJSONPatches("testdata/patch_with_3_named_tailing_sidecars.json"), provenancePatch(
+					annotationProvenance("test-container-1"),
+					tailingSidecarConfigProvenance("test-container-2", tailingSidecar),
+					annotationProvenance("test-container-3"),
+				))
 				Expect(len(resp.Patches)).Should(Equal(len(expectedPatches)))
 
 				for _, patch := range resp.Patches {
@@ -1419,8 +1436,11 @@ var _ = Describe("handler", func() {
 				Expect(resp.Allowed).To(BeTrue())
 				Expect(resp.Patches).NotTo(BeEmpty())
 
-				expectedPatches := loadJSONPatches("testdata/patch_with_3_named_not_named_tailing_sidecars.json")
-
+				expectedPatches := append(loadJSONPatches("testdata/patch_with_3_named_not_named_tailing_sidecars.json"), provenancePatch(
+					annotationProvenance("tailing-sidecar-1"),
+					annotationProvenance("test-container-0"),
+					tailingSidecarConfigProvenance("test-container-2", tailingSidecar),
+				))
 				Expect(len(resp.Patches)).Should(Equal(len(expectedPatches)))
 
 				for _, patch := range resp.Patches {
@@ -1434,7 +1454,7 @@ var _ = Describe("handler", func() {
 			})
 		})
 
-		When("Update Pod with one named sidecars and add not named", func() {
+		When("Create Pod with one named sidecar and add not named", func() {
 			tailingSidecar := &tailingsidecarv1.TailingSidecarConfig{
 				ObjectMeta: metav1.ObjectMeta{
 					Name:      "tailing-sidecar-in-pod-namespace",
@@ -1465,7 +1485,7 @@ var _ = Describe("handler", func() {
 
 			request := admission.Request{
 				AdmissionRequest: admv1.AdmissionRequest{
-					Operation: admv1.Update,
+					Operation: admv1.Create,
 					Object: runtime.RawExtension{
 						Raw: []byte(`{
 							"apiVersion": "v1",
@@ -1550,8 +1570,7 @@ var _ = Describe("handler", func() {
 				Expect(resp.Allowed).To(BeTrue())
 				Expect(resp.Patches).NotTo(BeEmpty())
 
-				expectedPatches := loadJSONPatches("testdata/patch_update_1_tailing_sidecar.json")
-
+				expectedPatches := append(loadJSONPatches("testdata/patch_update_1_tailing_sidecar.json"), provenancePatch(annotationProvenance("tailing-sidecar-1")))
 				Expect(len(resp.Patches)).Should(Equal(len(expectedPatches)))
 
 				for _, patch := range resp.Patches {
@@ -1648,9 +1667,19 @@ var _ = Describe("handler", func() {
 			}
 
 			resp := podExtender.Handle(ctx, request)
-			It("returns empty patch", func() {
-				Expect(resp.Allowed).To(BeFalse())
-				Expect(resp.Patches).To(BeEmpty())
+			It("returns patch with tailing sidecar container from annotation", func() {
+				Expect(resp.Allowed).To(BeTrue())
+
+				containers := make([]string, 0)
+				for _, patch := range resp.Patches {
+					if strings.HasPrefix(patch.Path, "/spec/containers/") {
+						container := patch.Value.(corev1.Container)
+						containers = append(containers, container.Name)
+						Expect(container.Env).To(ContainElement(HaveField("Value", "/varconfig/log/example2.log")))
+					}
+				}
+				Expect(containers).To(Equal([]string{"test-container"}))
+				Expect(resp.AuditAnnotations[provenanceAuditAnnotation]).To(ContainSubstring(`"source":"annotation"`))
 			})
 
 			err = k8sClient.Delete(ctx, tailingSidecar)
@@ -1750,10 +1779,10 @@ var _ = Describe("handler", func() {
 			})
 		})
 
-		When("Remove all tailing sidecars", func() {
+		When("Create Pod with tailing sidecars and remove all of them", func() {
 			request := admission.Request{
 				AdmissionRequest: admv1.AdmissionRequest{
-					Operation: admv1.Update,
+					Operation: admv1.Create,
 					Object: runtime.RawExtension{
 						Raw: []byte(`{
 							"apiVersion": "v1",
@@ -1836,7 +1865,6 @@ var _ = Describe("handler", func() {
 				Expect(resp.Patches).NotTo(BeEmpty())
 
 				expectedPatches := loadJSONPatches("testdata/patch_remove_tailing_sidecar.json")
-
 				Expect(len(resp.Patches)).Should(Equal(len(expectedPatches)))
 
 				for _, patch := range resp.Patches {
@@ -1845,7 +1873,7 @@ var _ = Describe("handler", func() {
 			})
 		})
 
-		When("Update Pod and change volumeMount configuration", func() {
+		When("Create Pod with tailing sidecar and change volumeMount configuration", func() {
 			tailingSidecar := &tailingsidecarv1.TailingSidecarConfig{
 				ObjectMeta: metav1.ObjectMeta{
 					Name:      "tailing-sidecar-in-pod-namespace",
@@ -1878,7 +1906,7 @@ var _ = Describe("handler", func() {
 
 			request := admission.Request{
 				AdmissionRequest: admv1.AdmissionRequest{
-					Operation: admv1.Update,
+					Operation: admv1.Create,
 					Object: runtime.RawExtension{
 						Raw: []byte(`{
 							"apiVersion": "v1",
@@ -1960,8 +1988,7 @@ var _ = Describe("handler", func() {
 				Expect(resp.Allowed).To(BeTrue())
 				Expect(resp.Patches).NotTo(BeEmpty())
 
-				expectedPatches := loadJSONPatches("testdata/patch_update_volume.json")
-
+				expectedPatches := append(loadJSONPatches("testdata/patch_update_volume.json"), provenanceAnnotationsPatch(tailingSidecarConfigProvenance("test-container", tailingSidecar)))
 				Expect(len(resp.Patches)).Should(Equal(len(expectedPatches)))
 
 				for _, patch := range resp.Patches {
@@ -2003,6 +2030,39 @@ func isExpectedPatch(expectedPatches []jsonpatch.JsonPatchOperation, patch jsonp
 	return false
 }
 
+// provenancePatch returns patch adding provenance annotation with given tailing sidecars to annotations of Pod,
+// tailing sidecars have to be sorted by container name as in provenance set by webhook
+func provenancePatch(provenance ...SidecarProvenance) jsonpatch.JsonPatchOperation {
+	value, err := json.Marshal(provenance)
+	Expect(err).ToNot(HaveOccurred())
+	return jsonpatch.NewOperation("add", "/metadata/annotations/tailing-sidecar.sumologic.com~1provenance", string(value))
+}
+
+// provenanceAnnotationsPatch returns patch adding annotations with provenance of given tailing sidecars to Pod without annotations
+func provenanceAnnotationsPatch(provenance ...SidecarProvenance) jsonpatch.JsonPatchOperation {
+	value, err := json.Marshal(provenance)
+	Expect(err).ToNot(HaveOccurred())
+	return jsonpatch.NewOperation("add", "/metadata/annotations", map[string]string{provenanceAnnotation: string(value)})
+}
+
+// annotationProvenance returns provenance of tailing sidecar configured in annotation
+func annotationProvenance(container string) SidecarProvenance {
+	return SidecarProvenance{Container: container, Source: SourceAnnotation, Image: "tailing-sidecar-image:test"}
+}
+
+// tailingSidecarConfigProvenance returns provenance of tailing sidecar configured in created TailingSidecarConfig,
+// resourceVersion of TailingSidecarConfig is set by API server
+func tailingSidecarConfigProvenance(container string, tailingSidecarConfig *tailingsidecarv1.TailingSidecarConfig) SidecarProvenance {
+	return SidecarProvenance{
+		Container:       container,
+		Source:          SourceTailingSidecarConfig,
+		Namespace:       tailingSidecarConfig.Namespace,
+		Name:            tailingSidecarConfig.Name,
+		ResourceVersion: tailingSidecarConfig.ResourceVersion,
+		Image:           "tailing-sidecar-image:test",
+	}
+}
+
 func loadJSONPatches(filePath string) []jsonpatch.JsonPatchOperation {
 	jsonFromFile, err := ioutil.ReadFile(filePath)
 	Expect(err).To(BeNil(), "error loading patches, file path: %s", filePath)
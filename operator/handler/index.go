@@ -0,0 +1,47 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package handler
+
+import (
+	"context"
+
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// PodConfigMapsIndex is the name of field index of Pods by names of ConfigMaps mounted as volumes
+const PodConfigMapsIndex = "spec.volumes.configMap.name"
+
+// IndexPodConfigMaps returns names of ConfigMaps mounted as volumes in Pod
+func IndexPodConfigMaps(obj client.Object) []string {
+	pod, ok := obj.(*corev1.Pod)
+	if !ok {
+		return nil
+	}
+	configMaps := make([]string, 0)
+	for _, volume := range pod.Spec.Volumes {
+		if volume.ConfigMap != nil {
+			configMaps = append(configMaps, volume.ConfigMap.Name)
+		}
+	}
+	return configMaps
+}
+
+// SetupIndexes registers field indexes used by PodExtender in cache of client
+func SetupIndexes(ctx context.Context, indexer client.FieldIndexer) error {
+	return indexer.IndexField(ctx, &corev1.Pod{}, PodConfigMapsIndex, IndexPodConfigMaps)
+}
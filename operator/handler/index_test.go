@@ -0,0 +1,134 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package handler
+
+import (
+	"context"
+	"encoding/json"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	admv1 "k8s.io/api/admission/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+)
+
+var _ = Describe("sidecar ConfigMap cleanup", func() {
+	ctx := context.Background()
+	indexScheme := runtime.NewScheme()
+	Expect(clientgoscheme.AddToScheme(indexScheme)).To(Succeed())
+
+	newPod := func(name string, configMap string) *corev1.Pod {
+		pod := &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "app", Name: name},
+			Spec: corev1.PodSpec{
+				Containers: []corev1.Container{{Name: "app", Image: "busybox"}},
+			},
+		}
+		if configMap != "" {
+			pod.Spec.Volumes = []corev1.Volume{{
+				Name: sidecarConfigurationName,
+				VolumeSource: corev1.VolumeSource{
+					ConfigMap: &corev1.ConfigMapVolumeSource{
+						LocalObjectReference: corev1.LocalObjectReference{Name: configMap},
+					},
+				},
+			}}
+		}
+		return pod
+	}
+	newDeletingPod := func(name string, configMap string) *corev1.Pod {
+		pod := newPod(name, configMap)
+		pod.DeletionTimestamp = &metav1.Time{Time: metav1.Now().Time}
+		pod.Finalizers = []string{"test"}
+		return pod
+	}
+	deletePod := func(objects ...client.Object) bool {
+		configMap := &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Namespace: "app", Name: "sidecar-config"}}
+		fakeClient := fake.NewClientBuilder().
+			WithScheme(indexScheme).
+			WithObjects(append(objects, configMap)...).
+			WithIndex(&corev1.Pod{}, PodConfigMapsIndex, IndexPodConfigMaps).
+			Build()
+		podExtender := &PodExtender{
+			Client:             fakeClient,
+			Decoder:            admission.NewDecoder(indexScheme),
+			ConfigMapName:      "sidecar-config",
+			ConfigMapNamespace: "tailing-sidecar-system",
+			ConfigMountPath:    "/etc/otel",
+		}
+
+		raw, err := json.Marshal(objects[0])
+		Expect(err).ToNot(HaveOccurred())
+		resp := podExtender.Handle(ctx, admission.Request{AdmissionRequest: admv1.AdmissionRequest{
+			Operation: admv1.Delete,
+			Namespace: "app",
+			Name:      objects[0].GetName(),
+			OldObject: runtime.RawExtension{Raw: raw},
+		}})
+		Expect(resp.Allowed).To(BeTrue())
+
+		err = fakeClient.Get(ctx, types.NamespacedName{Namespace: "app", Name: "sidecar-config"}, &corev1.ConfigMap{})
+		if apierrors.IsNotFound(err) {
+			return true
+		}
+		Expect(err).ToNot(HaveOccurred())
+		return false
+	}
+
+	It("indexes Pods by mounted ConfigMaps", func() {
+		Expect(IndexPodConfigMaps(newPod("pod", "sidecar-config"))).To(Equal([]string{"sidecar-config"}))
+		Expect(IndexPodConfigMaps(newPod("pod", ""))).To(BeEmpty())
+		Expect(IndexPodConfigMaps(&corev1.ConfigMap{})).To(BeNil())
+	})
+
+	It("deletes ConfigMap which is not used by other Pods", func() {
+		Expect(deletePod(
+			newPod("deleted", "sidecar-config"),
+			newPod("without-sidecar", ""),
+			newPod("other-config", "other-config"),
+		)).To(BeTrue())
+	})
+
+	It("keeps ConfigMap used by other Pod", func() {
+		Expect(deletePod(
+			newPod("deleted", "sidecar-config"),
+			newPod("running", "sidecar-config"),
+		)).To(BeFalse())
+	})
+
+	It("keeps ConfigMap used by other Pod which is being deleted", func() {
+		Expect(deletePod(
+			newDeletingPod("deleted", "sidecar-config"),
+			newDeletingPod("deleted-concurrently", "sidecar-config"),
+		)).To(BeFalse())
+	})
+
+	It("deletes ConfigMap when the last Pod using it is deleted", func() {
+		Expect(deletePod(
+			newDeletingPod("deleted", "sidecar-config"),
+			newPod("other-config", "other-config"),
+		)).To(BeTrue())
+	})
+})
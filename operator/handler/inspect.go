@@ -0,0 +1,208 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package handler
+
+import (
+	"fmt"
+	"slices"
+	"time"
+
+	tailingsidecarv1 "github.com/SumoLogic/tailing-sidecar/operator/api/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+)
+
+// SourceAnnotation is a source of configuration provided in tailing-sidecar annotation
+const SourceAnnotation = "annotation"
+
+// SidecarDescription describes tailing sidecar container available in Pod
+type SidecarDescription struct {
+	Container string
+	Path      string
+	Volume    string
+	// Source is SourceAnnotation, <namespace>/<name> of TailingSidecarConfig
+	// or empty when configuration of tailing sidecar is no longer available
+	Source string
+}
+
+// TailingSidecarConfigMatch describes if TailingSidecarConfig matches Pod and why
+type TailingSidecarConfigMatch struct {
+	Namespace string
+	Name      string
+	// Matches is true when TailingSidecarConfig adds tailing sidecars to Pod
+	Matches bool
+	Reason  string
+}
+
+// MatchTailingSidecarConfigs returns TailingSidecarConfigs with podSelector matching Pod labels,
+// it is used by webhook to get TailingSidecarConfigs for Pod
+func MatchTailingSidecarConfigs(tailingSidecarConfigs []tailingsidecarv1.TailingSidecarConfig, podLabels map[string]string) ([]tailingsidecarv1.TailingSidecarConfig, error) {
+	matched := make([]tailingsidecarv1.TailingSidecarConfig, 0)
+	for _, tailingSidecarConfig := range tailingSidecarConfigs {
+		matches, err := matchesTailingSidecarConfig(tailingSidecarConfig, podLabels)
+		if err != nil {
+			return nil, err
+		}
+		if matches {
+			matched = append(matched, tailingSidecarConfig)
+		}
+	}
+	return matched, nil
+}
+
+// ExplainTailingSidecarConfigs returns for each TailingSidecarConfig if it matches Pod labels and why,
+// TailingSidecarConfigs matching Pod labels which are not applied by webhook, e.g. expired, in Paused mode
+// or with canary which did not select Pod, do not match Pod
+func ExplainTailingSidecarConfigs(tailingSidecarConfigs []tailingsidecarv1.TailingSidecarConfig, pod *corev1.Pod) []TailingSidecarConfigMatch {
+	now := time.Now()
+	matches := make([]TailingSidecarConfigMatch, 0, len(tailingSidecarConfigs))
+	for _, tailingSidecarConfig := range tailingSidecarConfigs {
+		matched, reason, err := matchTailingSidecarConfig(tailingSidecarConfig, pod.ObjectMeta.Labels)
+		if err != nil {
+			reason = err.Error()
+		}
+		if notApplied := getNotAppliedReason(tailingSidecarConfig, pod, now); matched && notApplied != "" {
+			matched = false
+			reason = fmt.Sprintf("%s, but %s", reason, notApplied)
+		}
+		matches = append(matches, TailingSidecarConfigMatch{
+			Namespace: tailingSidecarConfig.Namespace,
+			Name:      tailingSidecarConfig.Name,
+			Matches:   matched,
+			Reason:    reason,
+		})
+	}
+	return matches
+}
+
+// DescribeSidecars describes tailing sidecar containers in Pod, sources of configurations are found
+// in the same way as webhook finds existing tailing sidecars for configurations, so tailing sidecars
+// from configurations which are not applied, e.g. expired or in Paused or DryRun mode, do not have source,
+// existing Pods are selected by TailingSidecarConfigs with canary only when they have tailing sidecars from them
+func DescribeSidecars(pod *corev1.Pod, tailingSidecarConfigs []tailingsidecarv1.TailingSidecarConfig) ([]SidecarDescription, error) {
+	tailingSidecars := getTailingSidecars(pod.Spec.Containers)
+	if len(tailingSidecars) == 0 {
+		return nil, nil
+	}
+
+	matched, err := matchActiveTailingSidecarConfigs(slices.Clone(tailingSidecarConfigs), pod.ObjectMeta.Labels)
+	if err != nil {
+		return nil, err
+	}
+	matched = filterCanary(matched, pod, admission.Request{})
+	matched, _ = splitDryRun(matched)
+
+	configs, err := getConfigs(pod.ObjectMeta.Annotations, matched)
+	if err != nil {
+		return nil, err
+	}
+
+	descriptions := make([]SidecarDescription, 0)
+	for _, container := range tailingSidecars {
+		description := SidecarDescription{
+			Container: container.Name,
+		}
+		for _, env := range container.Env {
+			if env.Name == sidecarEnvPath {
+				description.Path = env.Value
+			}
+		}
+		if len(container.VolumeMounts) > 0 {
+			description.Volume = container.VolumeMounts[0].Name
+		}
+
+		for _, config := range configs {
+			if err := prepareVolume(pod.Spec.Containers, &config.spec.VolumeMount); err != nil {
+				continue
+			}
+			if isSidecarAvailable([]corev1.Container{container}, config) {
+				description.Source = getSource(config)
+				break
+			}
+		}
+		descriptions = append(descriptions, description)
+	}
+	return descriptions, nil
+}
+
+// matchesTailingSidecarConfig checks if podSelector of TailingSidecarConfig matches Pod labels,
+// unlike matchTailingSidecarConfig it does not describe the reason, as it is called for all TailingSidecarConfigs on every admission
+func matchesTailingSidecarConfig(tailingSidecarConfig tailingsidecarv1.TailingSidecarConfig, podLabels map[string]string) (bool, error) {
+	selector, err := selectors.get(tailingSidecarConfig)
+	if err != nil {
+		return false, fmt.Errorf("invalid label selector in TailingSidecarConfig: %v", err)
+	}
+	// TailingSidecarConfig with a nil or empty selector should match nothing
+	return tailingSidecarConfig.Spec.PodSelector != nil && !selector.Empty() && selector.Matches(labels.Set(podLabels)), nil
+}
+
+// matchTailingSidecarConfig checks if podSelector of TailingSidecarConfig matches Pod labels and returns the reason
+func matchTailingSidecarConfig(tailingSidecarConfig tailingsidecarv1.TailingSidecarConfig, podLabels map[string]string) (bool, string, error) {
+	selector, err := selectors.get(tailingSidecarConfig)
+	if err != nil {
+		return false, "", fmt.Errorf("invalid label selector in TailingSidecarConfig: %v", err)
+	}
+
+	// TailingSidecarConfig with a nil or empty selector should match nothing
+	switch {
+	case tailingSidecarConfig.Spec.PodSelector == nil:
+		return false, "podSelector is not set, TailingSidecarConfig without podSelector matches nothing", nil
+	case selector.Empty():
+		return false, "podSelector is empty, TailingSidecarConfig with empty podSelector matches nothing", nil
+	case !selector.Matches(labels.Set(podLabels)):
+		return false, fmt.Sprintf("podSelector %q does not match Pod labels", selector.String()), nil
+	default:
+		return true, fmt.Sprintf("podSelector %q matches Pod labels", selector.String()), nil
+	}
+}
+
+// getNotAppliedReason returns the reason why webhook does not add tailing sidecars from TailingSidecarConfig
+// matching labels of existing Pod at given time, it is empty when tailing sidecars are added
+func getNotAppliedReason(tailingSidecarConfig tailingsidecarv1.TailingSidecarConfig, pod *corev1.Pod, now time.Time) string {
+	if isPaused(tailingSidecarConfig) {
+		return "TailingSidecarConfig is in Paused mode"
+	}
+	if IsExpired(tailingSidecarConfig, now) {
+		expiresAt, _ := GetExpirationTime(tailingSidecarConfig)
+		return fmt.Sprintf("TailingSidecarConfig expired at %s", expiresAt.Format(time.RFC3339))
+	}
+	if !isCanary(tailingSidecarConfig, pod, "") {
+		return fmt.Sprintf("Pod is not selected by canary (%d%%)", tailingSidecarConfig.Spec.Canary.Percent)
+	}
+	if tailingSidecarConfig.Spec.Mode == tailingsidecarv1.ModeDryRun {
+		return "TailingSidecarConfig is in DryRun mode, tailing sidecars are only reported in dry-run annotation"
+	}
+	return ""
+}
+
+// ExplainAnnotation returns the reason why webhook does not add tailing sidecars from tailing-sidecar annotation,
+// it is empty when tailing sidecars are added
+func ExplainAnnotation(annotations map[string]string) string {
+	if !isAnnotationExpired(annotations, time.Now()) {
+		return ""
+	}
+	return fmt.Sprintf("expired at %s", annotations[expiresAtAnnotation])
+}
+
+// getSource returns source of configuration
+func getSource(config sidecarConfig) string {
+	if config.source == "" {
+		return SourceAnnotation
+	}
+	return config.source
+}
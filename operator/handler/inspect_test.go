@@ -0,0 +1,235 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package handler
+
+import (
+	"slices"
+	"time"
+
+	tailingsidecarv1 "github.com/SumoLogic/tailing-sidecar/operator/api/v1"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+)
+
+var _ = Describe("inspect", func() {
+	tailingSidecarConfigs := []tailingsidecarv1.TailingSidecarConfig{
+		{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "matching"},
+			Spec: tailingsidecarv1.TailingSidecarConfigSpec{
+				PodSelector: &metav1.LabelSelector{
+					MatchLabels: map[string]string{"app": "example"},
+				},
+				SidecarSpecs: map[string]tailingsidecarv1.SidecarSpec{
+					"sidecar-cr": {
+						Path: "/var/log/example1.log",
+						VolumeMount: corev1.VolumeMount{
+							Name:      "varlog",
+							MountPath: "/var/log",
+						},
+					},
+				},
+			},
+		},
+		{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "not-matching"},
+			Spec: tailingsidecarv1.TailingSidecarConfigSpec{
+				PodSelector: &metav1.LabelSelector{
+					MatchLabels: map[string]string{"app": "other"},
+				},
+			},
+		},
+		{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "without-selector"},
+		},
+		{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "paused"},
+			Spec: tailingsidecarv1.TailingSidecarConfigSpec{
+				Mode: tailingsidecarv1.ModePaused,
+				PodSelector: &metav1.LabelSelector{
+					MatchLabels: map[string]string{"app": "example"},
+				},
+				SidecarSpecs: map[string]tailingsidecarv1.SidecarSpec{
+					"sidecar-paused": {
+						Path:        "/var/log/example3.log",
+						VolumeMount: corev1.VolumeMount{Name: "varlog", MountPath: "/var/log"},
+					},
+				},
+			},
+		},
+		{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "expired"},
+			Spec: tailingsidecarv1.TailingSidecarConfigSpec{
+				ExpiresAt: &metav1.Time{Time: time.Date(2021, time.January, 1, 0, 0, 0, 0, time.UTC)},
+				PodSelector: &metav1.LabelSelector{
+					MatchLabels: map[string]string{"app": "example"},
+				},
+				SidecarSpecs: map[string]tailingsidecarv1.SidecarSpec{
+					"sidecar-expired": {
+						Path:        "/var/log/example4.log",
+						VolumeMount: corev1.VolumeMount{Name: "varlog", MountPath: "/var/log"},
+					},
+				},
+			},
+		},
+		{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "dry-run"},
+			Spec: tailingsidecarv1.TailingSidecarConfigSpec{
+				Mode: tailingsidecarv1.ModeDryRun,
+				PodSelector: &metav1.LabelSelector{
+					MatchLabels: map[string]string{"app": "example"},
+				},
+			},
+		},
+		{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "canary"},
+			Spec: tailingsidecarv1.TailingSidecarConfigSpec{
+				Canary: &tailingsidecarv1.CanarySpec{Percent: 10},
+				PodSelector: &metav1.LabelSelector{
+					MatchLabels: map[string]string{"app": "example"},
+				},
+				SidecarSpecs: map[string]tailingsidecarv1.SidecarSpec{
+					"sidecar-canary": {
+						Path:        "/var/log/example5.log",
+						VolumeMount: corev1.VolumeMount{Name: "varlog", MountPath: "/var/log"},
+					},
+				},
+			},
+		},
+	}
+
+	podLabels := map[string]string{"app": "example"}
+
+	Context("ExplainTailingSidecarConfigs", func() {
+		pod := &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Labels: podLabels}}
+		matches := ExplainTailingSidecarConfigs(tailingSidecarConfigs, pod)
+
+		It("returns the same result as matching in webhook", func() {
+			matched, err := matchActiveTailingSidecarConfigs(slices.Clone(tailingSidecarConfigs), podLabels)
+			Expect(err).NotTo(HaveOccurred())
+			matched = filterCanary(matched, pod, admission.Request{})
+			matched, _ = splitDryRun(matched)
+			Expect(matched).To(HaveLen(1))
+			Expect(matched[0].Name).To(Equal("matching"))
+
+			Expect(matches).To(HaveLen(7))
+			Expect(matches[0].Matches).To(BeTrue())
+			Expect(matches[1].Matches).To(BeFalse())
+			Expect(matches[2].Matches).To(BeFalse())
+		})
+
+		It("returns reasons", func() {
+			Expect(matches[0].Reason).To(Equal(`podSelector "app=example" matches Pod labels`))
+			Expect(matches[1].Reason).To(Equal(`podSelector "app=other" does not match Pod labels`))
+			Expect(matches[2].Reason).To(ContainSubstring("podSelector is not set"))
+		})
+
+		It("does not match Pod with TailingSidecarConfigs which are not applied by webhook", func() {
+			Expect(matches[3].Matches).To(BeFalse())
+			Expect(matches[3].Reason).To(Equal(`podSelector "app=example" matches Pod labels, but TailingSidecarConfig is in Paused mode`))
+			Expect(matches[4].Matches).To(BeFalse())
+			Expect(matches[4].Reason).To(Equal(`podSelector "app=example" matches Pod labels, but TailingSidecarConfig expired at 2021-01-01T00:00:00Z`))
+			Expect(matches[5].Matches).To(BeFalse())
+			Expect(matches[5].Reason).To(ContainSubstring("TailingSidecarConfig is in DryRun mode"))
+			Expect(matches[6].Matches).To(BeFalse())
+			Expect(matches[6].Reason).To(Equal(`podSelector "app=example" matches Pod labels, but Pod is not selected by canary (10%)`))
+		})
+
+		It("matches Pod with tailing sidecars from TailingSidecarConfig with canary", func() {
+			selected := pod.DeepCopy()
+			selected.ObjectMeta.Annotations = map[string]string{
+				provenanceAnnotation: `[{"container":"sidecar-canary","source":"TailingSidecarConfig","namespace":"default","name":"canary"}]`,
+			}
+			matches := ExplainTailingSidecarConfigs(tailingSidecarConfigs, selected)
+			Expect(matches[6].Matches).To(BeTrue())
+			Expect(matches[6].Reason).To(Equal(`podSelector "app=example" matches Pod labels`))
+		})
+	})
+
+	Context("DescribeSidecars", func() {
+		pod := &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{
+				Labels: podLabels,
+				Annotations: map[string]string{
+					SidecarAnnotation: "varlog:/var/log/example0.log",
+				},
+			},
+			Spec: corev1.PodSpec{
+				Containers: []corev1.Container{
+					{
+						Name: "count",
+						VolumeMounts: []corev1.VolumeMount{
+							{Name: "varlog", MountPath: "/var/log"},
+						},
+					},
+					newTailingSidecar("tailing-sidecar-0", "/var/log/example0.log"),
+					newTailingSidecar("sidecar-cr", "/var/log/example1.log"),
+					newTailingSidecar("sidecar-removed", "/var/log/example2.log"),
+					newTailingSidecar("sidecar-paused", "/var/log/example3.log"),
+					newTailingSidecar("sidecar-expired", "/var/log/example4.log"),
+					newTailingSidecar("sidecar-canary", "/var/log/example5.log"),
+				},
+			},
+		}
+
+		It("returns tailing sidecars with sources of configuration", func() {
+			descriptions, err := DescribeSidecars(pod, tailingSidecarConfigs)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(descriptions).To(Equal([]SidecarDescription{
+				{Container: "tailing-sidecar-0", Path: "/var/log/example0.log", Volume: "varlog", Source: SourceAnnotation},
+				{Container: "sidecar-cr", Path: "/var/log/example1.log", Volume: "varlog", Source: "default/matching"},
+				{Container: "sidecar-removed", Path: "/var/log/example2.log", Volume: "varlog", Source: ""},
+				{Container: "sidecar-paused", Path: "/var/log/example3.log", Volume: "varlog", Source: ""},
+				{Container: "sidecar-expired", Path: "/var/log/example4.log", Volume: "varlog", Source: ""},
+				{Container: "sidecar-canary", Path: "/var/log/example5.log", Volume: "varlog", Source: ""},
+			}))
+		})
+
+		It("returns source of tailing sidecars from TailingSidecarConfig with canary which selected Pod", func() {
+			selected := pod.DeepCopy()
+			selected.ObjectMeta.Annotations[provenanceAnnotation] = `[{"container":"sidecar-canary","source":"TailingSidecarConfig","namespace":"default","name":"canary"}]`
+			descriptions, err := DescribeSidecars(selected, tailingSidecarConfigs)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(descriptions[5]).To(Equal(SidecarDescription{Container: "sidecar-canary", Path: "/var/log/example5.log", Volume: "varlog", Source: "default/canary"}))
+		})
+
+		It("does not return source for expired annotation", func() {
+			expired := pod.DeepCopy()
+			expired.ObjectMeta.Annotations[expiresAtAnnotation] = "2021-01-01T00:00:00Z"
+			descriptions, err := DescribeSidecars(expired, tailingSidecarConfigs)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(descriptions[0]).To(Equal(SidecarDescription{Container: "tailing-sidecar-0", Path: "/var/log/example0.log", Volume: "varlog", Source: ""}))
+			Expect(ExplainAnnotation(expired.ObjectMeta.Annotations)).To(Equal("expired at 2021-01-01T00:00:00Z"))
+			Expect(ExplainAnnotation(pod.ObjectMeta.Annotations)).To(BeEmpty())
+		})
+	})
+})
+
+func newTailingSidecar(name string, path string) corev1.Container {
+	return corev1.Container{
+		Name: name,
+		Env: []corev1.EnvVar{
+			{Name: sidecarEnvPath, Value: path},
+			{Name: sidecarEnvMarker, Value: sidecarEnvMarkerVal},
+		},
+		VolumeMounts: []corev1.VolumeMount{
+			{Name: "varlog", MountPath: "/var/log"},
+		},
+	}
+}
@@ -0,0 +1,61 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package handler
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+)
+
+const (
+	workloadResultInjected = "injected"
+	workloadResultSkipped  = "skipped"
+	workloadResultError    = "error"
+)
+
+// workloadInjectionsTotal counts admission requests for workloads by kind of workload and result
+var workloadInjectionsTotal = prometheus.NewCounterVec(
+	prometheus.CounterOpts{
+		Name: "tailing_sidecar_workload_injections_total",
+		Help: "Number of admission requests for workloads handled by tailing sidecar operator by kind and result",
+	},
+	[]string{"group", "version", "kind", "result"},
+)
+
+// dryRunSidecarsTotal counts tailing sidecars which would be added to Pods by TailingSidecarConfigs in DryRun mode
+var dryRunSidecarsTotal = prometheus.NewCounterVec(
+	prometheus.CounterOpts{
+		Name: "tailing_sidecar_dry_run_sidecars_total",
+		Help: "Number of tailing sidecars which would be added to Pods by TailingSidecarConfigs in DryRun mode",
+	},
+	[]string{"namespace", "name"},
+)
+
+func init() {
+	metrics.Registry.MustRegister(workloadInjectionsTotal, dryRunSidecarsTotal)
+}
+
+// recordWorkloadInjection records result of handling admission request for workload
+func recordWorkloadInjection(gvk schema.GroupVersionKind, result string) {
+	workloadInjectionsTotal.WithLabelValues(gvk.Group, gvk.Version, gvk.Kind, result).Inc()
+}
+
+// recordDryRunSidecar records tailing sidecar which would be added to Pod by TailingSidecarConfig in DryRun mode
+func recordDryRunSidecar(namespace, name string) {
+	dryRunSidecarsTotal.WithLabelValues(namespace, name).Inc()
+}
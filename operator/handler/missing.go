@@ -0,0 +1,69 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package handler
+
+import (
+	"slices"
+
+	tailingsidecarv1 "github.com/SumoLogic/tailing-sidecar/operator/api/v1"
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+)
+
+// FindMissingSidecars describes tailing sidecars which webhook would add to Pod but which are not available in Pod,
+// e.g. because Pod was created when webhook was not available. Configurations are found in the same way as by webhook,
+// TailingSidecarConfigs with canary are expected only in Pods which already have their tailing sidecars,
+// as selection of Pods for canary cannot be repeated for existing Pods.
+func FindMissingSidecars(pod *corev1.Pod, tailingSidecarConfigs []tailingsidecarv1.TailingSidecarConfig) ([]SidecarDescription, error) {
+	if isInjectedInTemplate(pod) {
+		return nil, nil
+	}
+
+	matched, err := matchActiveTailingSidecarConfigs(slices.Clone(tailingSidecarConfigs), pod.ObjectMeta.Labels)
+	if err != nil {
+		return nil, err
+	}
+	matched = filterCanary(matched, pod, admission.Request{})
+	matched, _ = splitDryRun(matched)
+
+	// conflicts are not logged as by getConfigs, they are reported in status of TailingSidecarConfigs
+	configs := parseAnnotation(pod.ObjectMeta.Annotations)
+	configs = append(configs, convertTailingSidecarConfigs(matched)...)
+	configs, _ = resolveConfigs(configs)
+	if err := validateConfigs(configs); err != nil {
+		return nil, err
+	}
+
+	tailingSidecars := getTailingSidecars(pod.Spec.Containers)
+	missing := make([]SidecarDescription, 0)
+	for _, config := range configs {
+		// webhook skips configurations with volumes which are not mounted to any container
+		if err := prepareVolume(pod.Spec.Containers, &config.spec.VolumeMount); err != nil {
+			continue
+		}
+		if isSidecarAvailable(tailingSidecars, config) {
+			continue
+		}
+		missing = append(missing, SidecarDescription{
+			Container: config.name,
+			Path:      config.spec.Path,
+			Volume:    config.spec.VolumeMount.Name,
+			Source:    getSource(config),
+		})
+	}
+	return missing, nil
+}
@@ -0,0 +1,109 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package handler
+
+import (
+	tailingsidecarv1 "github.com/SumoLogic/tailing-sidecar/operator/api/v1"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+var _ = Describe("FindMissingSidecars", func() {
+	newTailingSidecarConfig := func(name string, path string) tailingsidecarv1.TailingSidecarConfig {
+		return tailingsidecarv1.TailingSidecarConfig{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: name},
+			Spec: tailingsidecarv1.TailingSidecarConfigSpec{
+				PodSelector: &metav1.LabelSelector{
+					MatchLabels: map[string]string{"app": "example"},
+				},
+				SidecarSpecs: map[string]tailingsidecarv1.SidecarSpec{
+					"sidecar-" + name: {
+						Path:        path,
+						VolumeMount: corev1.VolumeMount{Name: "varlog"},
+					},
+				},
+			},
+		}
+	}
+
+	injected := newTailingSidecarConfig("injected", "/var/log/example1.log")
+	missing := newTailingSidecarConfig("missing", "/var/log/example2.log")
+	paused := newTailingSidecarConfig("paused", "/var/log/example3.log")
+	paused.Spec.Mode = tailingsidecarv1.ModePaused
+	dryRun := newTailingSidecarConfig("dry-run", "/var/log/example4.log")
+	dryRun.Spec.Mode = tailingsidecarv1.ModeDryRun
+	canary := newTailingSidecarConfig("canary", "/var/log/example5.log")
+	canary.Spec.Canary = &tailingsidecarv1.CanarySpec{Percent: 50}
+	unmounted := newTailingSidecarConfig("unmounted", "/var/log/example6.log")
+	unmounted.Spec.SidecarSpecs["sidecar-unmounted"] = tailingsidecarv1.SidecarSpec{
+		Path:        "/var/log/example6.log",
+		VolumeMount: corev1.VolumeMount{Name: "other"},
+	}
+	tailingSidecarConfigs := []tailingsidecarv1.TailingSidecarConfig{injected, missing, paused, dryRun, canary, unmounted}
+
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Labels: map[string]string{"app": "example"},
+			Annotations: map[string]string{
+				SidecarAnnotation: "varlog:/var/log/example0.log",
+			},
+		},
+		Spec: corev1.PodSpec{
+			Containers: []corev1.Container{
+				{
+					Name: "count",
+					VolumeMounts: []corev1.VolumeMount{
+						{Name: "varlog", MountPath: "/var/log"},
+					},
+				},
+				newTailingSidecar("sidecar-injected", "/var/log/example1.log"),
+			},
+		},
+	}
+
+	It("returns tailing sidecars which webhook would add", func() {
+		descriptions, err := FindMissingSidecars(pod, tailingSidecarConfigs)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(descriptions).To(Equal([]SidecarDescription{
+			{Path: "/var/log/example0.log", Volume: "varlog", Source: SourceAnnotation},
+			{Container: "sidecar-missing", Path: "/var/log/example2.log", Volume: "varlog", Source: "default/missing"},
+		}))
+	})
+
+	It("does not return tailing sidecars available in Pod", func() {
+		complete := pod.DeepCopy()
+		complete.Spec.Containers = append(complete.Spec.Containers,
+			newTailingSidecar("tailing-sidecar-0", "/var/log/example0.log"),
+			newTailingSidecar("sidecar-missing", "/var/log/example2.log"),
+		)
+		descriptions, err := FindMissingSidecars(complete, tailingSidecarConfigs)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(descriptions).To(BeEmpty())
+	})
+
+	It("returns tailing sidecars from TailingSidecarConfig with canary which were added to Pod", func() {
+		withCanary := pod.DeepCopy()
+		withCanary.ObjectMeta.Annotations[provenanceAnnotation] =
+			`[{"container":"sidecar-canary","source":"TailingSidecarConfig","namespace":"default","name":"canary","image":""}]`
+		descriptions, err := FindMissingSidecars(withCanary, []tailingsidecarv1.TailingSidecarConfig{canary})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(descriptions).To(HaveLen(2))
+		Expect(descriptions[1].Source).To(Equal("default/canary"))
+	})
+})
@@ -0,0 +1,83 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package handler
+
+import (
+	"fmt"
+	"hash/fnv"
+	"strconv"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/rand"
+)
+
+const (
+	// NamingIndex names tailing sidecar containers and volumes using consecutive numbers e.g. tailing-sidecar-0
+	NamingIndex = "index"
+	// NamingHash names tailing sidecar containers and volumes using hash of tailing sidecar identity
+	// (source of configuration, container name, volume and path), e.g. tailing-sidecar-5d8b9c7f4
+	NamingHash = "hash"
+	// DefaultNaming is the naming used when it is not set in configuration of the operator, names do not depend
+	// on order of configurations, so adding, removing or reordering them does not rename other tailing sidecars
+	DefaultNaming = NamingHash
+)
+
+// getSidecarSuffix returns suffix used in names of tailing sidecar container and its volumes,
+// for index naming the returned index is the next one to use
+func getSidecarSuffix(naming string, pod *corev1.Pod, config sidecarConfig, index int) (string, int) {
+	if naming == NamingHash {
+		return getSidecarHash(config), index
+	}
+
+	index = nextSidecarIndex(pod, index)
+	return strconv.Itoa(index), index + 1
+}
+
+// getSidecarHash returns stable hash of tailing sidecar identity
+func getSidecarHash(config sidecarConfig) string {
+	hasher := fnv.New32a()
+	fmt.Fprintf(hasher, "%s\x00%s\x00%s\x00%s", config.source, config.name, config.spec.VolumeMount.Name, config.spec.Path)
+	return rand.SafeEncodeString(fmt.Sprint(hasher.Sum32()))
+}
+
+// nextSidecarIndex returns the first index, starting from the given one,
+// which is not used in names of containers and volumes in Pod specification
+// e.g. when tailing sidecar with lower index was removed
+func nextSidecarIndex(pod *corev1.Pod, index int) int {
+	names := make(map[string]struct{}, len(pod.Spec.Containers)+len(pod.Spec.Volumes))
+	for _, container := range pod.Spec.Containers {
+		names[container.Name] = struct{}{}
+	}
+	for _, volume := range pod.Spec.Volumes {
+		names[volume.Name] = struct{}{}
+	}
+
+	for {
+		suffix := strconv.Itoa(index)
+		used := false
+		for _, format := range []string{sidecarContainerName, sidecarVolumeName, sidecarOtelLogsVolumeName, sidecarOtelFileStorageVolumeName} {
+			if _, ok := names[fmt.Sprintf(format, suffix)]; ok {
+				used = true
+				break
+			}
+		}
+		if !used {
+			return index
+		}
+		index++
+	}
+}
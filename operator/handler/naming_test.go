@@ -0,0 +1,125 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package handler
+
+import (
+	"context"
+
+	tailingsidecarv1 "github.com/SumoLogic/tailing-sidecar/operator/api/v1"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+)
+
+var _ = Describe("naming", func() {
+	config := sidecarConfig{
+		spec: tailingsidecarv1.SidecarSpec{
+			Path: "/var/log/example0.log",
+			VolumeMount: corev1.VolumeMount{
+				Name: "varlog",
+			},
+		},
+	}
+
+	Context("getSidecarSuffix with hash naming", func() {
+		suffix, index := getSidecarSuffix(NamingHash, &corev1.Pod{}, config, 3)
+
+		It("returns the same suffix for the same configuration", func() {
+			repeatedSuffix, _ := getSidecarSuffix(NamingHash, &corev1.Pod{}, config, 0)
+			Expect(repeatedSuffix).To(Equal(suffix))
+			Expect(index).To(Equal(3))
+		})
+
+		It("returns different suffix for configuration from TailingSidecarConfig", func() {
+			crConfig := config
+			crConfig.source = "tailing-sidecar-system/tailing-sidecar-config"
+			crSuffix, _ := getSidecarSuffix(NamingHash, &corev1.Pod{}, crConfig, 0)
+			Expect(crSuffix).NotTo(Equal(suffix))
+		})
+
+		It("returns different suffix for different path", func() {
+			pathConfig := config
+			pathConfig.spec.Path = "/var/log/example1.log"
+			pathSuffix, _ := getSidecarSuffix(NamingHash, &corev1.Pod{}, pathConfig, 0)
+			Expect(pathSuffix).NotTo(Equal(suffix))
+		})
+	})
+
+	Context("extendPod with default naming", func() {
+		podExtender := &PodExtender{TailingSidecarImage: "tailing-sidecar-image:test", TailingSidecarNaming: DefaultNaming}
+		getSidecarNames := func(annotation string) map[string]string {
+			pod := &corev1.Pod{
+				ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "example", Annotations: map[string]string{SidecarAnnotation: annotation}},
+				Spec: corev1.PodSpec{
+					Containers: []corev1.Container{
+						{Name: "count", VolumeMounts: []corev1.VolumeMount{{Name: "varlog", MountPath: "/var/log"}}},
+					},
+				},
+			}
+			Expect(podExtender.extendPod(context.Background(), pod, nil, admission.Request{})).To(Succeed())
+
+			names := make(map[string]string)
+			for _, container := range getTailingSidecars(pod.Spec.Containers) {
+				for _, env := range container.Env {
+					if env.Name == sidecarEnvPath {
+						names[env.Value] = container.Name
+					}
+				}
+			}
+			return names
+		}
+
+		It("keeps names of tailing sidecars when configurations are reordered", func() {
+			names := getSidecarNames("varlog:/var/log/example0.log;varlog:/var/log/example1.log")
+			Expect(names).To(HaveLen(2))
+			Expect(getSidecarNames("varlog:/var/log/example1.log;varlog:/var/log/example0.log")).To(Equal(names))
+		})
+	})
+
+	Context("getSidecarSuffix with index naming", func() {
+		pod := &corev1.Pod{
+			Spec: corev1.PodSpec{
+				Containers: []corev1.Container{
+					{Name: "tailing-sidecar-1"},
+				},
+				Volumes: []corev1.Volume{
+					{Name: "tailing-sidecar-otel-logs-tailing-sidecar-2"},
+				},
+			},
+		}
+
+		When("index is not used in Pod", func() {
+			suffix, index := getSidecarSuffix(NamingIndex, pod, config, 0)
+
+			It("returns given index", func() {
+				Expect(suffix).To(Equal("0"))
+				Expect(index).To(Equal(1))
+			})
+		})
+
+		When("index is used by container or volume in Pod", func() {
+			suffix, index := getSidecarSuffix(NamingIndex, pod, config, 1)
+
+			It("returns the first index which is not used", func() {
+				Expect(suffix).To(Equal("3"))
+				Expect(index).To(Equal(4))
+			})
+		})
+	})
+})
@@ -0,0 +1,145 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package handler
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+
+	"gomodules.xyz/jsonpatch/v2"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+)
+
+var jsonPointerEscaper = strings.NewReplacer("~", "~0", "/", "~1")
+
+// podSnapshot keeps fields of Pod which can be changed by webhook, it is taken before Pod is extended
+// and used to build JSON patch operations instead of comparing whole serialized Pods
+type podSnapshot struct {
+	annotations map[string]string
+	containers  []corev1.Container
+	volumes     []corev1.Volume
+}
+
+// newPodSnapshot takes snapshot of Pod, containers and volumes are not copied
+// as webhook replaces these slices instead of modifying their elements
+func newPodSnapshot(pod *corev1.Pod) podSnapshot {
+	return podSnapshot{
+		annotations: maps.Clone(pod.ObjectMeta.Annotations),
+		containers:  pod.Spec.Containers,
+		volumes:     pod.Spec.Volumes,
+	}
+}
+
+// patches returns JSON patch operations transforming Pod from snapshot into the given Pod
+func (s podSnapshot) patches(pod *corev1.Pod) []jsonpatch.JsonPatchOperation {
+	patches := annotationPatches("/metadata/annotations", s.annotations, pod.ObjectMeta.Annotations)
+	patches = append(patches, listPatches("/spec/containers", s.containers, pod.Spec.Containers, isSameContainer)...)
+	patches = append(patches, listPatches("/spec/volumes", s.volumes, pod.Spec.Volumes, isSameVolume)...)
+	return patches
+}
+
+// annotationPatches returns patch operations for changed annotations,
+// operations are sorted by annotation name, so patches are the same for the same change
+func annotationPatches(path string, original map[string]string, annotations map[string]string) []jsonpatch.JsonPatchOperation {
+	if len(original) == 0 {
+		if len(annotations) == 0 {
+			return nil
+		}
+		return []jsonpatch.JsonPatchOperation{jsonpatch.NewOperation("add", path, annotations)}
+	}
+
+	patches := make([]jsonpatch.JsonPatchOperation, 0)
+	for _, name := range slices.Sorted(maps.Keys(original)) {
+		value, ok := annotations[name]
+		switch {
+		case !ok:
+			patches = append(patches, jsonpatch.NewOperation("remove", annotationPath(path, name), nil))
+		case value != original[name]:
+			patches = append(patches, jsonpatch.NewOperation("replace", annotationPath(path, name), value))
+		}
+	}
+	for _, name := range slices.Sorted(maps.Keys(annotations)) {
+		if _, ok := original[name]; !ok {
+			patches = append(patches, jsonpatch.NewOperation("add", annotationPath(path, name), annotations[name]))
+		}
+	}
+	return patches
+}
+
+// annotationPath returns JSON pointer to annotation, annotation names contain '/' which needs to be escaped
+func annotationPath(path string, name string) string {
+	return path + "/" + jsonPointerEscaper.Replace(name)
+}
+
+// listPatches returns patch operations transforming original list into the given one,
+// webhook keeps order of elements and only removes elements or appends new ones at the end,
+// so elements are matched in order and unmatched elements of original list are removed
+func listPatches[T any](path string, original []T, list []T, isSame func(T, T) bool) []jsonpatch.JsonPatchOperation {
+	if len(original) == 0 {
+		if len(list) == 0 {
+			return nil
+		}
+		return []jsonpatch.JsonPatchOperation{jsonpatch.NewOperation("add", path, list)}
+	}
+
+	kept := 0
+	removed := make([]int, 0)
+	for i := range original {
+		if kept < len(list) && isSame(original[i], list[kept]) {
+			kept++
+			continue
+		}
+		removed = append(removed, i)
+	}
+
+	patches := make([]jsonpatch.JsonPatchOperation, 0, len(removed)+len(list)-kept)
+	// elements are removed from the end, so indexes of remaining elements do not change
+	for _, i := range slices.Backward(removed) {
+		patches = append(patches, jsonpatch.NewOperation("remove", fmt.Sprintf("%s/%d", path, i), nil))
+	}
+	for i := kept; i < len(list); i++ {
+		patches = append(patches, jsonpatch.NewOperation("add", fmt.Sprintf("%s/%d", path, i), list[i]))
+	}
+	return patches
+}
+
+// isSameContainer checks if container was kept in Pod specification, only tailing sidecars
+// can be recreated by webhook with the same name, so other containers are compared by name
+func isSameContainer(original corev1.Container, container corev1.Container) bool {
+	if original.Name != container.Name {
+		return false
+	}
+	if !isSidecarEnvAvailable(container.Env, sidecarEnvMarker, sidecarEnvMarkerVal) {
+		return true
+	}
+	return equality.Semantic.DeepEqual(original, container)
+}
+
+// isSameVolume checks if volume was kept in Pod specification, only volumes of tailing sidecars
+// can be recreated by webhook with the same name, so other volumes are compared by name
+func isSameVolume(original corev1.Volume, volume corev1.Volume) bool {
+	if original.Name != volume.Name {
+		return false
+	}
+	if !strings.HasPrefix(volume.Name, sidecarVolumePrefix) && !strings.HasPrefix(volume.Name, sidecarContainerPrefix) {
+		return true
+	}
+	return equality.Semantic.DeepEqual(original.VolumeSource, volume.VolumeSource)
+}
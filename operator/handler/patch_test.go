@@ -0,0 +1,162 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package handler
+
+import (
+	"encoding/json"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+)
+
+var _ = Describe("patch", func() {
+	container := func(name string, path string) corev1.Container {
+		container := corev1.Container{Name: name, Image: "busybox"}
+		if path != "" {
+			container.Env = []corev1.EnvVar{
+				{Name: sidecarEnvPath, Value: path},
+				{Name: sidecarEnvMarker, Value: sidecarEnvMarkerVal},
+			}
+		}
+		return container
+	}
+	volume := func(name string) corev1.Volume {
+		return corev1.Volume{Name: name, VolumeSource: corev1.VolumeSource{EmptyDir: &corev1.EmptyDirVolumeSource{}}}
+	}
+
+	// patch applies patches built for extended Pod to the original one
+	patch := func(original *corev1.Pod, extend func(pod *corev1.Pod)) *corev1.Pod {
+		raw, err := json.Marshal(original)
+		Expect(err).ToNot(HaveOccurred())
+		pod := original.DeepCopy()
+		snapshot := newPodSnapshot(pod)
+		extend(pod)
+
+		patched, err := applyPatches(raw, admission.Patched("", snapshot.patches(pod)...))
+		Expect(err).ToNot(HaveOccurred())
+		patchedPod := &corev1.Pod{}
+		Expect(json.Unmarshal(patched, patchedPod)).To(Succeed())
+		return patchedPod
+	}
+
+	When("tailing sidecars are added to Pod without volumes and annotations", func() {
+		pod := &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Name: "pod"},
+			Spec:       corev1.PodSpec{Containers: []corev1.Container{container("app", "")}},
+		}
+		patched := patch(pod, func(pod *corev1.Pod) {
+			pod.ObjectMeta.Annotations = map[string]string{provenanceAnnotation: "[]"}
+			pod.Spec.Containers = append(pod.Spec.Containers, container("tailing-sidecar-0", "/var/log/example.log"))
+			pod.Spec.Volumes = append(pod.Spec.Volumes, volume("volume-sidecar-0"))
+		})
+
+		It("adds annotations, tailing sidecars and volumes", func() {
+			Expect(patched.ObjectMeta.Annotations).To(Equal(map[string]string{provenanceAnnotation: "[]"}))
+			Expect(patched.Spec.Containers).To(Equal([]corev1.Container{container("app", ""), container("tailing-sidecar-0", "/var/log/example.log")}))
+			Expect(patched.Spec.Volumes).To(Equal([]corev1.Volume{volume("volume-sidecar-0")}))
+		})
+	})
+
+	When("tailing sidecars are removed, recreated and added", func() {
+		pod := &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{
+				Name: "pod",
+				Annotations: map[string]string{
+					SidecarAnnotation:    "tailing-sidecar-0:varlog:/var/log/example0.log",
+					provenanceAnnotation: "[]",
+					"removed":            "true",
+				},
+			},
+			Spec: corev1.PodSpec{
+				Containers: []corev1.Container{
+					container("app", ""),
+					container("tailing-sidecar-0", "/var/log/example0.log"),
+					container("tailing-sidecar-1", "/var/log/example1.log"),
+					container("sidecar", ""),
+					container("tailing-sidecar-2", "/var/log/example2.log"),
+				},
+				Volumes: []corev1.Volume{volume("varlog"), volume("volume-sidecar-1"), volume("volume-sidecar-2")},
+			},
+		}
+		patched := patch(pod, func(pod *corev1.Pod) {
+			pod.ObjectMeta.Annotations[provenanceAnnotation] = `[{"container":"tailing-sidecar-2"}]`
+			pod.ObjectMeta.Annotations["tailing-sidecar.sumologic.com/added"] = "~"
+			delete(pod.ObjectMeta.Annotations, "removed")
+			pod.Spec.Containers = []corev1.Container{
+				container("app", ""),
+				container("tailing-sidecar-0", "/var/log/example0.log"),
+				container("sidecar", ""),
+				container("tailing-sidecar-2", "/var/log/changed.log"),
+				container("tailing-sidecar-3", "/var/log/example3.log"),
+			}
+			pod.Spec.Volumes = []corev1.Volume{volume("varlog"), volume("volume-sidecar-2"), volume("volume-sidecar-3")}
+		})
+
+		It("updates annotations", func() {
+			Expect(patched.ObjectMeta.Annotations).To(Equal(map[string]string{
+				SidecarAnnotation:                     "tailing-sidecar-0:varlog:/var/log/example0.log",
+				provenanceAnnotation:                  `[{"container":"tailing-sidecar-2"}]`,
+				"tailing-sidecar.sumologic.com/added": "~",
+			}))
+		})
+
+		It("keeps order of containers and volumes", func() {
+			Expect(patched.Spec.Containers).To(Equal([]corev1.Container{
+				container("app", ""),
+				container("tailing-sidecar-0", "/var/log/example0.log"),
+				container("sidecar", ""),
+				container("tailing-sidecar-2", "/var/log/changed.log"),
+				container("tailing-sidecar-3", "/var/log/example3.log"),
+			}))
+			Expect(patched.Spec.Volumes).To(Equal([]corev1.Volume{volume("varlog"), volume("volume-sidecar-2"), volume("volume-sidecar-3")}))
+		})
+	})
+
+	When("Pod is not changed", func() {
+		pod := &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Name: "pod", Annotations: map[string]string{provenanceAnnotation: "[]"}},
+			Spec: corev1.PodSpec{
+				Containers: []corev1.Container{container("app", ""), container("tailing-sidecar-0", "/var/log/example0.log")},
+				Volumes:    []corev1.Volume{volume("varlog")},
+			},
+		}
+		snapshot := newPodSnapshot(pod)
+
+		It("returns no patches", func() {
+			Expect(snapshot.patches(pod.DeepCopy())).To(BeEmpty())
+		})
+	})
+
+	Context("isVolumeMountAvailable", func() {
+		propagation := corev1.MountPropagationBidirectional
+		volumeMount := corev1.VolumeMount{Name: "varlog", MountPath: "/var/log", MountPropagation: &propagation}
+		otherPropagation := corev1.MountPropagationBidirectional
+
+		It("compares all fields of volume mounts", func() {
+			Expect(isVolumeMountAvailable([]corev1.VolumeMount{
+				{Name: "varlog", MountPath: "/var/log", MountPropagation: &otherPropagation},
+			}, volumeMount)).To(BeTrue())
+			Expect(isVolumeMountAvailable([]corev1.VolumeMount{
+				{Name: "varlog", MountPath: "/var/log"},
+				{Name: "varlog", MountPath: "/var/log", MountPropagation: &propagation, ReadOnly: true},
+			}, volumeMount)).To(BeFalse())
+		})
+	})
+})
@@ -0,0 +1,129 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package handler
+
+import (
+	"cmp"
+	"encoding/json"
+	"slices"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+const (
+	// provenanceAnnotation contains JSON list of tailing sidecar containers with sources of their configurations
+	provenanceAnnotation = "tailing-sidecar.sumologic.com/provenance"
+	// provenanceAuditAnnotation is a key of audit annotation returned in admission response,
+	// it has the same value as provenance annotation
+	provenanceAuditAnnotation = "provenance"
+
+	// SourceTailingSidecarConfig is a source of configuration provided in TailingSidecarConfig
+	SourceTailingSidecarConfig = "TailingSidecarConfig"
+)
+
+// SidecarProvenance describes origin of tailing sidecar container injected by tailing sidecar operator
+type SidecarProvenance struct {
+	Container string `json:"container"`
+	// Source is "annotation" for configuration from tailing-sidecar annotation
+	// or "TailingSidecarConfig" for configuration from TailingSidecarConfig
+	Source          string `json:"source"`
+	Namespace       string `json:"namespace,omitempty"`
+	Name            string `json:"name,omitempty"`
+	ResourceVersion string `json:"resourceVersion,omitempty"`
+	Image           string `json:"image"`
+	OperatorVersion string `json:"operatorVersion,omitempty"`
+}
+
+// GetProvenance returns provenance of tailing sidecar containers from Pod annotations,
+// returns nil when annotation is not available or it is not valid
+func GetProvenance(annotations map[string]string) []SidecarProvenance {
+	value, ok := annotations[provenanceAnnotation]
+	if !ok {
+		return nil
+	}
+
+	provenance := make([]SidecarProvenance, 0)
+	if err := json.Unmarshal([]byte(value), &provenance); err != nil {
+		handlerLog.Info("Incorrect provenance annotation", "annotation", value, "error", err.Error())
+		return nil
+	}
+	return provenance
+}
+
+// newSidecarProvenance returns provenance of tailing sidecar container injected for given configuration
+func newSidecarProvenance(config sidecarConfig, image string, operatorVersion string) SidecarProvenance {
+	provenance := SidecarProvenance{
+		Container:       config.name,
+		Source:          SourceAnnotation,
+		Image:           image,
+		OperatorVersion: operatorVersion,
+	}
+	if config.source != "" {
+		provenance.Source = SourceTailingSidecarConfig
+		provenance.Namespace, provenance.Name, _ = strings.Cut(config.source, "/")
+		provenance.ResourceVersion = config.resourceVersion
+	}
+	return provenance
+}
+
+// setProvenance sets provenance annotation for tailing sidecar containers available in Pod,
+// provenance of previously injected containers is kept unless they were injected again
+func setProvenance(annotations map[string]string, injected []SidecarProvenance, containers []corev1.Container) map[string]string {
+	provenance := slices.Clone(injected)
+	for _, previous := range GetProvenance(annotations) {
+		if slices.ContainsFunc(injected, func(p SidecarProvenance) bool { return p.Container == previous.Container }) {
+			continue
+		}
+		if !slices.ContainsFunc(getTailingSidecars(containers), func(c corev1.Container) bool { return c.Name == previous.Container }) {
+			continue
+		}
+		provenance = append(provenance, previous)
+	}
+
+	if len(provenance) == 0 {
+		delete(annotations, provenanceAnnotation)
+		return annotations
+	}
+
+	slices.SortFunc(provenance, func(a, b SidecarProvenance) int {
+		return cmp.Compare(a.Container, b.Container)
+	})
+
+	value, err := json.Marshal(provenance)
+	if err != nil {
+		handlerLog.Error(err, "Failed to marshal provenance", "provenance", provenance)
+		return annotations
+	}
+
+	if annotations == nil {
+		annotations = make(map[string]string, 1)
+	}
+	annotations[provenanceAnnotation] = string(value)
+	return annotations
+}
+
+// getProvenanceAuditAnnotations returns audit annotations for admission response with provenance of tailing sidecars
+func getProvenanceAuditAnnotations(annotations map[string]string) map[string]string {
+	value, ok := annotations[provenanceAnnotation]
+	if !ok {
+		return nil
+	}
+	return map[string]string{
+		provenanceAuditAnnotation: value,
+	}
+}
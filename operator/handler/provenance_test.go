@@ -0,0 +1,179 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package handler
+
+import (
+	"context"
+	"encoding/json"
+
+	tailingsidecarv1 "github.com/SumoLogic/tailing-sidecar/operator/api/v1"
+	jsonpatch "github.com/evanphx/json-patch/v5"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	admv1 "k8s.io/api/admission/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+)
+
+var _ = Describe("provenance", func() {
+	When("sidecars are injected from annotation and TailingSidecarConfig", func() {
+		provenanceScheme := runtime.NewScheme()
+		Expect(clientgoscheme.AddToScheme(provenanceScheme)).To(Succeed())
+		Expect(tailingsidecarv1.AddToScheme(provenanceScheme)).To(Succeed())
+
+		tailingSidecarConfig := &tailingsidecarv1.TailingSidecarConfig{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "provenance"},
+			Spec: tailingsidecarv1.TailingSidecarConfigSpec{
+				PodSelector: &metav1.LabelSelector{
+					MatchLabels: map[string]string{"app": "provenance"},
+				},
+				SidecarSpecs: map[string]tailingsidecarv1.SidecarSpec{
+					"sidecar-cr": {
+						Path:        "/var/log/example1.log",
+						VolumeMount: corev1.VolumeMount{Name: "varlog", MountPath: "/var/log"},
+					},
+				},
+			},
+		}
+		podExtender := &PodExtender{
+			Client: fake.NewClientBuilder().
+				WithScheme(provenanceScheme).
+				WithObjects(tailingSidecarConfig).
+				Build(),
+			Decoder:              admission.NewDecoder(provenanceScheme),
+			TailingSidecarImage:  "sumologic/tailing-sidecar:latest",
+			TailingSidecarNaming: NamingIndex,
+			OperatorVersion:      "1.2.3",
+		}
+
+		pod := corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "pod",
+				Namespace: "default",
+				Labels:    map[string]string{"app": "provenance"},
+				Annotations: map[string]string{
+					SidecarAnnotation: "varlog:/var/log/example0.log",
+				},
+			},
+			Spec: corev1.PodSpec{
+				Containers: []corev1.Container{
+					{
+						Name:         "count",
+						Image:        "busybox",
+						VolumeMounts: []corev1.VolumeMount{{Name: "varlog", MountPath: "/var/log"}},
+					},
+				},
+				Volumes: []corev1.Volume{
+					{Name: "varlog", VolumeSource: corev1.VolumeSource{EmptyDir: &corev1.EmptyDirVolumeSource{}}},
+				},
+			},
+		}
+		raw, err := json.Marshal(pod)
+		Expect(err).ToNot(HaveOccurred())
+
+		resp := podExtender.Handle(context.Background(), admission.Request{
+			AdmissionRequest: admv1.AdmissionRequest{
+				Operation: admv1.Create,
+				Namespace: "default",
+				Object:    runtime.RawExtension{Raw: raw},
+			},
+		})
+
+		It("writes provenance annotation and returns audit annotation", func() {
+			Expect(resp.Allowed).To(BeTrue())
+
+			rawPatch, err := json.Marshal(resp.Patches)
+			Expect(err).ToNot(HaveOccurred())
+			patch, err := jsonpatch.DecodePatch(rawPatch)
+			Expect(err).ToNot(HaveOccurred())
+			patched, err := patch.Apply(raw)
+			Expect(err).ToNot(HaveOccurred())
+
+			patchedPod := corev1.Pod{}
+			Expect(json.Unmarshal(patched, &patchedPod)).To(Succeed())
+
+			Expect(GetProvenance(patchedPod.Annotations)).To(Equal([]SidecarProvenance{
+				{
+					Container:       "sidecar-cr",
+					Source:          SourceTailingSidecarConfig,
+					Namespace:       "default",
+					Name:            "provenance",
+					ResourceVersion: "999",
+					Image:           "sumologic/tailing-sidecar:latest",
+					OperatorVersion: "1.2.3",
+				},
+				{
+					Container:       "tailing-sidecar-0",
+					Source:          SourceAnnotation,
+					Image:           "sumologic/tailing-sidecar:latest",
+					OperatorVersion: "1.2.3",
+				},
+			}))
+			Expect(resp.AuditAnnotations).To(Equal(map[string]string{
+				provenanceAuditAnnotation: patchedPod.Annotations[provenanceAnnotation],
+			}))
+		})
+	})
+
+	When("provenance is set for Pod with previously injected sidecars", func() {
+		previous := []SidecarProvenance{
+			{Container: "tailing-sidecar-0", Source: SourceAnnotation, Image: "old-image"},
+			{Container: "tailing-sidecar-1", Source: SourceAnnotation, Image: "old-image"},
+			{Container: "removed", Source: SourceAnnotation, Image: "old-image"},
+		}
+		value, err := json.Marshal(previous)
+		Expect(err).ToNot(HaveOccurred())
+
+		containers := []corev1.Container{
+			{Name: "count"},
+			{Name: "tailing-sidecar-0", Env: []corev1.EnvVar{{Name: sidecarEnvMarker, Value: sidecarEnvMarkerVal}}},
+			{Name: "tailing-sidecar-1", Env: []corev1.EnvVar{{Name: sidecarEnvMarker, Value: sidecarEnvMarkerVal}}},
+		}
+		injected := []SidecarProvenance{
+			{Container: "tailing-sidecar-1", Source: SourceAnnotation, Image: "new-image"},
+		}
+		annotations := setProvenance(map[string]string{provenanceAnnotation: string(value)}, injected, containers)
+
+		It("keeps provenance of containers which are still available", func() {
+			Expect(GetProvenance(annotations)).To(Equal([]SidecarProvenance{
+				{Container: "tailing-sidecar-0", Source: SourceAnnotation, Image: "old-image"},
+				{Container: "tailing-sidecar-1", Source: SourceAnnotation, Image: "new-image"},
+			}))
+		})
+	})
+
+	When("all tailing sidecars are removed from Pod", func() {
+		annotations := setProvenance(map[string]string{
+			provenanceAnnotation: `[{"container":"tailing-sidecar-0","source":"annotation","image":"image"}]`,
+		}, nil, []corev1.Container{{Name: "count"}})
+
+		It("removes provenance annotation", func() {
+			Expect(annotations).ToNot(HaveKey(provenanceAnnotation))
+			Expect(getProvenanceAuditAnnotations(annotations)).To(BeNil())
+		})
+	})
+
+	When("provenance annotation is not valid", func() {
+		It("returns no provenance", func() {
+			Expect(GetProvenance(map[string]string{provenanceAnnotation: "not-json"})).To(BeNil())
+		})
+	})
+})
@@ -0,0 +1,86 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package handler
+
+import (
+	"fmt"
+	"strconv"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+const (
+	sidecarGoMemLimitEnv       = "GOMEMLIMIT"
+	sidecarGoMaxProcsEnv       = "GOMAXPROCS"
+	sidecarMemoryLimitEnv      = "SIDECAR_MEMORY_LIMIT_MIB"
+	sidecarMemorySpikeLimitEnv = "SIDECAR_MEMORY_SPIKE_LIMIT_MIB"
+
+	// sidecarMemoryLimitPercentage is the percentage of memory limit of tailing sidecar used by memory limiter
+	// and Go runtime, the rest is left for memory which is not managed by Go runtime
+	sidecarMemoryLimitPercentage = 80
+	// sidecarMemorySpikeLimitPercentage is the percentage of memory limiter limit reserved for spikes between checks
+	sidecarMemorySpikeLimitPercentage = 20
+
+	mebibyte = 1024 * 1024
+)
+
+// getRuntimeEnv returns environment variables of tailing sidecar container derived from its CPU and memory limits:
+// GOMEMLIMIT and limits of memory limiter in MiB are set to a part of memory limit and GOMAXPROCS to CPU limit rounded up.
+// Memory backed emptyDir volumes are accounted as container memory, so their size limits are not available for Go runtime.
+// Variables are not set when limits are not provided, so defaults from configuration of tailing sidecar are used.
+func getRuntimeEnv(resources corev1.ResourceRequirements, emptyDirs ...*corev1.EmptyDirVolumeSource) []corev1.EnvVar {
+	env := make([]corev1.EnvVar, 0)
+
+	if memory, ok := resources.Limits[corev1.ResourceMemory]; ok {
+		available := memory.Value()
+		for _, emptyDir := range emptyDirs {
+			if emptyDir != nil && emptyDir.Medium == corev1.StorageMediumMemory && emptyDir.SizeLimit != nil {
+				available -= emptyDir.SizeLimit.Value()
+			}
+		}
+
+		limit := available * sidecarMemoryLimitPercentage / 100 / mebibyte
+		if limit > 0 {
+			env = append(env,
+				corev1.EnvVar{Name: sidecarGoMemLimitEnv, Value: fmt.Sprintf("%dMiB", limit)},
+				corev1.EnvVar{Name: sidecarMemoryLimitEnv, Value: strconv.FormatInt(limit, 10)},
+				corev1.EnvVar{Name: sidecarMemorySpikeLimitEnv, Value: strconv.FormatInt(limit*sidecarMemorySpikeLimitPercentage/100, 10)},
+			)
+		}
+	}
+
+	if cpu, ok := resources.Limits[corev1.ResourceCPU]; ok && cpu.MilliValue() > 0 {
+		procs := (cpu.MilliValue() + 999) / 1000
+		env = append(env, corev1.EnvVar{Name: sidecarGoMaxProcsEnv, Value: strconv.FormatInt(procs, 10)})
+	}
+	return env
+}
+
+// getRuntimeLimits returns resources whose limits were used to derive environment variables of tailing sidecar container,
+// environment variables cannot be changed in running container, so these limits cannot be changed in place
+func getRuntimeLimits(container corev1.Container) []corev1.ResourceName {
+	names := make([]corev1.ResourceName, 0)
+	for _, env := range container.Env {
+		switch env.Name {
+		case sidecarGoMemLimitEnv:
+			names = append(names, corev1.ResourceMemory)
+		case sidecarGoMaxProcsEnv:
+			names = append(names, corev1.ResourceCPU)
+		}
+	}
+	return names
+}
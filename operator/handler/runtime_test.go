@@ -0,0 +1,138 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package handler
+
+import (
+	"context"
+
+	tailingsidecarv1 "github.com/SumoLogic/tailing-sidecar/operator/api/v1"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+)
+
+var _ = Describe("runtime", func() {
+	sizeLimit := func(value string) *resource.Quantity {
+		quantity := resource.MustParse(value)
+		return &quantity
+	}
+
+	Context("getRuntimeEnv", func() {
+		When("CPU and memory limits are set", func() {
+			env := getRuntimeEnv(corev1.ResourceRequirements{
+				Limits: corev1.ResourceList{
+					corev1.ResourceCPU:    resource.MustParse("1500m"),
+					corev1.ResourceMemory: resource.MustParse("500Mi"),
+				},
+			})
+
+			It("derives Go runtime settings and memory limiter limits from them", func() {
+				Expect(env).To(Equal([]corev1.EnvVar{
+					{Name: sidecarGoMemLimitEnv, Value: "400MiB"},
+					{Name: sidecarMemoryLimitEnv, Value: "400"},
+					{Name: sidecarMemorySpikeLimitEnv, Value: "80"},
+					{Name: sidecarGoMaxProcsEnv, Value: "2"},
+				}))
+			})
+		})
+
+		When("memory backed volumes have size limits", func() {
+			env := getRuntimeEnv(corev1.ResourceRequirements{
+				Limits: corev1.ResourceList{corev1.ResourceMemory: resource.MustParse("500Mi")},
+			},
+				&corev1.EmptyDirVolumeSource{Medium: corev1.StorageMediumMemory, SizeLimit: sizeLimit("100Mi")},
+				&corev1.EmptyDirVolumeSource{SizeLimit: sizeLimit("100Mi")},
+				nil,
+			)
+
+			It("does not use their size limits for Go runtime", func() {
+				Expect(env).To(Equal([]corev1.EnvVar{
+					{Name: sidecarGoMemLimitEnv, Value: "320MiB"},
+					{Name: sidecarMemoryLimitEnv, Value: "320"},
+					{Name: sidecarMemorySpikeLimitEnv, Value: "64"},
+				}))
+			})
+		})
+
+		When("limits are not set or are zero", func() {
+			env := getRuntimeEnv(corev1.ResourceRequirements{
+				Requests: corev1.ResourceList{corev1.ResourceMemory: resource.MustParse("500Mi")},
+				Limits: corev1.ResourceList{
+					corev1.ResourceCPU:    resource.MustParse("0"),
+					corev1.ResourceMemory: resource.MustParse("0"),
+				},
+			})
+
+			It("does not set environment variables", func() {
+				Expect(env).To(BeEmpty())
+			})
+		})
+	})
+
+	Context("extendPod", func() {
+		podExtender := &PodExtender{
+			TailingSidecarImage: "tailing-sidecar-image:test",
+			TailingSidecarResources: corev1.ResourceRequirements{
+				Limits: corev1.ResourceList{
+					corev1.ResourceCPU:    resource.MustParse("500m"),
+					corev1.ResourceMemory: resource.MustParse("500Mi"),
+				},
+			},
+		}
+		tailingSidecarConfig := tailingsidecarv1.TailingSidecarConfig{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "example"},
+			Spec: tailingsidecarv1.TailingSidecarConfigSpec{
+				PodSelector: &metav1.LabelSelector{MatchLabels: map[string]string{"app": "example"}},
+				SidecarSpecs: map[string]tailingsidecarv1.SidecarSpec{
+					"sidecar": {
+						Path:        "/var/log/example.log",
+						VolumeMount: corev1.VolumeMount{Name: "varlog", MountPath: "/var/log"},
+						Resources: corev1.ResourceRequirements{
+							Limits: corev1.ResourceList{corev1.ResourceMemory: resource.MustParse("1Gi")},
+						},
+					},
+				},
+			},
+		}
+		pod := &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "example", Labels: map[string]string{"app": "example"}},
+			Spec: corev1.PodSpec{
+				Containers: []corev1.Container{
+					{Name: "count", VolumeMounts: []corev1.VolumeMount{{Name: "varlog", MountPath: "/var/log"}}},
+				},
+			},
+		}
+		err := podExtender.extendPod(context.Background(), pod, []tailingsidecarv1.TailingSidecarConfig{tailingSidecarConfig}, admission.Request{})
+
+		It("sets runtime settings from resolved resources of tailing sidecar", func() {
+			Expect(err).ToNot(HaveOccurred())
+			Expect(pod.Spec.Containers).To(HaveLen(2))
+			Expect(pod.Spec.Containers[1].Env).To(ContainElements(
+				corev1.EnvVar{Name: sidecarGoMemLimitEnv, Value: "819MiB"},
+				corev1.EnvVar{Name: sidecarMemoryLimitEnv, Value: "819"},
+				corev1.EnvVar{Name: sidecarMemorySpikeLimitEnv, Value: "163"},
+			))
+		})
+
+		It("does not take CPU limit from defaults when limits are configured for tailing sidecar", func() {
+			Expect(pod.Spec.Containers[1].Env).ToNot(ContainElement(HaveField("Name", sidecarGoMaxProcsEnv)))
+		})
+	})
+})
@@ -0,0 +1,98 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package handler
+
+import (
+	"sync"
+
+	tailingsidecarv1 "github.com/SumoLogic/tailing-sidecar/operator/api/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// selectors caches selectors compiled from podSelectors of TailingSidecarConfigs,
+// all TailingSidecarConfigs are matched against labels of every admitted Pod
+var selectors = &selectorCache{}
+
+// compiledSelector is a selector compiled from podSelector of TailingSidecarConfig with given UID and resourceVersion
+type compiledSelector struct {
+	uid             types.UID
+	resourceVersion string
+	selector        labels.Selector
+	err             error
+}
+
+// selectorCache caches compiled selectors by name of TailingSidecarConfig,
+// selector is compiled again when UID or resourceVersion of TailingSidecarConfig changes
+type selectorCache struct {
+	mu        sync.RWMutex
+	selectors map[types.NamespacedName]compiledSelector
+}
+
+// get returns selector compiled from podSelector of TailingSidecarConfig,
+// TailingSidecarConfigs without resourceVersion e.g. read from files are not cached
+func (c *selectorCache) get(tailingSidecarConfig tailingsidecarv1.TailingSidecarConfig) (labels.Selector, error) {
+	if tailingSidecarConfig.ResourceVersion == "" {
+		return metav1.LabelSelectorAsSelector(tailingSidecarConfig.Spec.PodSelector)
+	}
+
+	key := types.NamespacedName{Namespace: tailingSidecarConfig.Namespace, Name: tailingSidecarConfig.Name}
+	c.mu.RLock()
+	cached, ok := c.selectors[key]
+	c.mu.RUnlock()
+	if ok && cached.uid == tailingSidecarConfig.UID && cached.resourceVersion == tailingSidecarConfig.ResourceVersion {
+		return cached.selector, cached.err
+	}
+
+	selector, err := metav1.LabelSelectorAsSelector(tailingSidecarConfig.Spec.PodSelector)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.selectors == nil {
+		c.selectors = make(map[types.NamespacedName]compiledSelector)
+	}
+	c.selectors[key] = compiledSelector{
+		uid:             tailingSidecarConfig.UID,
+		resourceVersion: tailingSidecarConfig.ResourceVersion,
+		selector:        selector,
+		err:             err,
+	}
+	return selector, err
+}
+
+// prune removes selectors of deleted TailingSidecarConfigs, it is cheap when nothing was deleted
+// because the cache cannot be larger than list of existing TailingSidecarConfigs
+func (c *selectorCache) prune(tailingSidecarConfigs []tailingsidecarv1.TailingSidecarConfig) {
+	c.mu.RLock()
+	size := len(c.selectors)
+	c.mu.RUnlock()
+	if size <= len(tailingSidecarConfigs) {
+		return
+	}
+
+	existing := make(map[types.NamespacedName]struct{}, len(tailingSidecarConfigs))
+	for _, tailingSidecarConfig := range tailingSidecarConfigs {
+		existing[types.NamespacedName{Namespace: tailingSidecarConfig.Namespace, Name: tailingSidecarConfig.Name}] = struct{}{}
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for key := range c.selectors {
+		if _, ok := existing[key]; !ok {
+			delete(c.selectors, key)
+		}
+	}
+}
@@ -0,0 +1,69 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package handler
+
+import (
+	tailingsidecarv1 "github.com/SumoLogic/tailing-sidecar/operator/api/v1"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+var _ = Describe("selectorCache", func() {
+	newTailingSidecarConfig := func(name string, resourceVersion string, app string) tailingsidecarv1.TailingSidecarConfig {
+		return tailingsidecarv1.TailingSidecarConfig{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: name, UID: types.UID("uid-" + name), ResourceVersion: resourceVersion},
+			Spec: tailingsidecarv1.TailingSidecarConfigSpec{
+				PodSelector: &metav1.LabelSelector{MatchLabels: map[string]string{"app": app}},
+			},
+		}
+	}
+	matches := func(selector labels.Selector, err error) bool {
+		Expect(err).ToNot(HaveOccurred())
+		return selector.Matches(labels.Set{"app": "example"})
+	}
+
+	cache := &selectorCache{}
+	cached := matches(cache.get(newTailingSidecarConfig("config", "1", "example")))
+	// selector is not compiled again for the same resourceVersion
+	stale := matches(cache.get(newTailingSidecarConfig("config", "1", "other")))
+	updated := matches(cache.get(newTailingSidecarConfig("config", "2", "other")))
+	withoutResourceVersion := matches(cache.get(newTailingSidecarConfig("file", "", "example")))
+
+	It("compiles selector again when resourceVersion changes", func() {
+		Expect(cached).To(BeTrue())
+		Expect(stale).To(BeTrue())
+		Expect(updated).To(BeFalse())
+	})
+
+	It("does not cache TailingSidecarConfigs without resourceVersion", func() {
+		Expect(withoutResourceVersion).To(BeTrue())
+		Expect(cache.selectors).To(HaveLen(1))
+	})
+
+	It("prunes selectors of deleted TailingSidecarConfigs", func() {
+		_, err := cache.get(newTailingSidecarConfig("other", "3", "example"))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(cache.selectors).To(HaveLen(2))
+
+		cache.prune([]tailingsidecarv1.TailingSidecarConfig{newTailingSidecarConfig("other", "3", "example")})
+		Expect(cache.selectors).To(HaveLen(1))
+		Expect(cache.selectors).To(HaveKey(HaveField("Name", "other")))
+	})
+})
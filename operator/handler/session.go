@@ -0,0 +1,112 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package handler
+
+import (
+	"strconv"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+const (
+	// SessionAnnotation contains configuration of tailing sessions for running Pod
+	// in the same format as tailing-sidecar annotation
+	SessionAnnotation = "tailing-sidecar.sumologic.com/session"
+	// SessionDurationAnnotation contains duration of tailing sessions created from session annotation
+	SessionDurationAnnotation = "tailing-sidecar.sumologic.com/session-duration"
+
+	// ephemeral containers cannot have own volumes, so directories from tailing sidecar image are used
+	sessionOtelFileStoragePath = "/var/lib/otc"
+	sessionOtelLogsPath        = "/var/log"
+)
+
+// sessionCommand runs OpenTelemetry Collector in the same way as entrypoint of tailing sidecar image
+var sessionCommand = []string{"/otelcol-sumo", "--config", "/etc/otel/config.yaml"}
+
+// SessionConfig describes file tailed in tailing session
+type SessionConfig struct {
+	ContainerName string
+	Volume        string
+	Path          string
+}
+
+// GetSessionConfigs returns configurations of tailing sessions from session annotation of Pod
+func GetSessionConfigs(annotations map[string]string) []SessionConfig {
+	value, ok := annotations[SessionAnnotation]
+	if !ok {
+		return nil
+	}
+
+	configs := make([]SessionConfig, 0)
+	for _, config := range parseAnnotation(map[string]string{SidecarAnnotation: value}) {
+		configs = append(configs, SessionConfig{
+			ContainerName: config.name,
+			Volume:        config.spec.VolumeMount.Name,
+			Path:          config.spec.Path,
+		})
+	}
+	return configs
+}
+
+// NewEphemeralContainer returns ephemeral container tailing file from volume of running Pod,
+// it uses the same image and environment variables as tailing sidecar container.
+// Ephemeral containers cannot be removed from Pod, so the container stops itself after given duration.
+func (e PodExtender) NewEphemeralContainer(pod *corev1.Pod, name string, volumeMount corev1.VolumeMount, path string, duration time.Duration) (corev1.EphemeralContainer, error) {
+	if err := prepareVolume(pod.Spec.Containers, &volumeMount); err != nil {
+		return corev1.EphemeralContainer{}, err
+	}
+
+	volumeMounts := []corev1.VolumeMount{volumeMount}
+	if e.ConfigMapName != "" && e.ConfigMountPath != "" && isVolumeAvailable(pod.Spec.Volumes, sidecarConfigurationName) {
+		volumeMounts = append(volumeMounts, corev1.VolumeMount{
+			Name:      sidecarConfigurationName,
+			MountPath: e.ConfigMountPath,
+		})
+	}
+
+	return corev1.EphemeralContainer{
+		EphemeralContainerCommon: corev1.EphemeralContainerCommon{
+			Image:   e.TailingSidecarImage,
+			Name:    name,
+			Command: append([]string{"timeout", strconv.Itoa(int(duration.Seconds()))}, sessionCommand...),
+			Env: []corev1.EnvVar{
+				{
+					Name:  sidecarEnvPath,
+					Value: path,
+				},
+				{
+					Name:  sidecarEnvMarker,
+					Value: sidecarEnvMarkerVal,
+				},
+				{
+					Name:  sidecarOtelFileStoragePathEnv,
+					Value: sessionOtelFileStoragePath,
+				},
+				{
+					Name:  sidecarOtelLogsPathEnv,
+					Value: sessionOtelLogsPath,
+				},
+				{
+					Name:  sidecarContainerNameEnv,
+					Value: name,
+				},
+			},
+			VolumeMounts: volumeMounts,
+		},
+	}, nil
+}
@@ -0,0 +1,208 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package handler
+
+import (
+	"fmt"
+	"path"
+
+	tailingsidecarv1 "github.com/SumoLogic/tailing-sidecar/operator/api/v1"
+	corev1 "k8s.io/api/core/v1"
+)
+
+const (
+	fileStorageVolumeSubPathPrefix = ".tailing-sidecar"
+	// sidecarPodNameEnv is set from downward API and used in subPathExpr of volumes shared by Pods
+	sidecarPodNameEnv = "POD_NAME"
+)
+
+// getFileStorage returns volume and volume mount used by tailing sidecar to store offsets of tailed files,
+// returned volume is nil when tailing sidecar uses volume already defined in Pod specification
+func getFileStorage(pod *corev1.Pod, config sidecarConfig, volumeName string, mountPath string) (*corev1.Volume, corev1.VolumeMount, error) {
+	storage := config.spec.FileStorage
+	if err := validateFileStorage(storage); err != nil {
+		return nil, corev1.VolumeMount{}, err
+	}
+
+	switch {
+	case storage == nil:
+		emptyDir := &corev1.EmptyDirVolumeSource{}
+		if config.spec.Volumes != nil && config.spec.Volumes.OtelFileStorage != nil {
+			emptyDir = config.spec.Volumes.OtelFileStorage
+		}
+		return &corev1.Volume{
+			Name: volumeName,
+			VolumeSource: corev1.VolumeSource{
+				EmptyDir: emptyDir},
+		}, corev1.VolumeMount{
+			Name:      volumeName,
+			MountPath: mountPath,
+		}, nil
+	case storage.PersistentVolumeClaim != nil:
+		return getPersistentVolumeClaimFileStorage(pod, config, storage.PersistentVolumeClaim, volumeName, mountPath)
+	case storage.Volume != nil:
+		return getVolumeFileStorage(pod, config, storage.Volume, mountPath)
+	case storage.HostPath != nil:
+		// directory on host is shared by all Pods on the node
+		hostPathType := corev1.HostPathDirectoryOrCreate
+		return &corev1.Volume{
+			Name: volumeName,
+			VolumeSource: corev1.VolumeSource{
+				HostPath: &corev1.HostPathVolumeSource{
+					Path: storage.HostPath.Path,
+					Type: &hostPathType,
+				}},
+		}, getSharedVolumeMount(volumeName, mountPath, storage.HostPath.SubPath, config.name), nil
+	default:
+		return nil, corev1.VolumeMount{}, fmt.Errorf("storage is not provided in fileStorage configuration")
+	}
+}
+
+// getSharedVolumeMount returns volume mount for volume shared by Pods, when subPath is not provided
+// offsets are stored in directory named after Pod and tailing sidecar container, so Pods do not overwrite offsets of each other
+func getSharedVolumeMount(volumeName string, mountPath string, subPath string, containerName string) corev1.VolumeMount {
+	if subPath != "" {
+		return corev1.VolumeMount{
+			Name:      volumeName,
+			MountPath: mountPath,
+			SubPath:   subPath,
+		}
+	}
+	return corev1.VolumeMount{
+		Name:        volumeName,
+		MountPath:   mountPath,
+		SubPathExpr: fmt.Sprintf("$(%s)/%s", sidecarPodNameEnv, containerName),
+	}
+}
+
+// getPodNameEnv returns environment variables with Pod name required by subPathExpr of volume mount
+func getPodNameEnv(volumeMount corev1.VolumeMount) []corev1.EnvVar {
+	if volumeMount.SubPathExpr == "" {
+		return nil
+	}
+	return []corev1.EnvVar{
+		{
+			Name: sidecarPodNameEnv,
+			ValueFrom: &corev1.EnvVarSource{
+				FieldRef: &corev1.ObjectFieldSelector{FieldPath: "metadata.name"},
+			},
+		},
+	}
+}
+
+// getPersistentVolumeClaimFileStorage returns volume and volume mount for offsets stored on PersistentVolumeClaim,
+// volume referencing the claim is reused when it is already defined in Pod specification e.g. by StatefulSet controller.
+// Claim created from volumeClaimTemplate is used by single Pod, other claims can be shared by Pods.
+func getPersistentVolumeClaimFileStorage(pod *corev1.Pod, config sidecarConfig, storage *tailingsidecarv1.PersistentVolumeClaimFileStorage, volumeName string, mountPath string) (*corev1.Volume, corev1.VolumeMount, error) {
+	getVolumeMount := func(name string) corev1.VolumeMount {
+		return getSharedVolumeMount(name, mountPath, storage.SubPath, config.name)
+	}
+
+	claimName := storage.ClaimName
+	if storage.VolumeClaimTemplate != "" {
+		subPath := storage.SubPath
+		if subPath == "" {
+			subPath = config.name
+		}
+		getVolumeMount = func(name string) corev1.VolumeMount {
+			return corev1.VolumeMount{
+				Name:      name,
+				MountPath: mountPath,
+				SubPath:   subPath,
+			}
+		}
+
+		if pod.ObjectMeta.Name == "" && pod.ObjectMeta.GenerateName == "" {
+			// Pod template of StatefulSet, volume named after volumeClaimTemplate is added by StatefulSet controller
+			return nil, getVolumeMount(storage.VolumeClaimTemplate), nil
+		}
+		if pod.ObjectMeta.Name == "" {
+			return nil, corev1.VolumeMount{}, fmt.Errorf("cannot get claim name for volumeClaimTemplate %s, Pod name is not set", storage.VolumeClaimTemplate)
+		}
+		claimName = fmt.Sprintf("%s-%s", storage.VolumeClaimTemplate, pod.ObjectMeta.Name)
+	}
+
+	for _, volume := range pod.Spec.Volumes {
+		if volume.PersistentVolumeClaim != nil && volume.PersistentVolumeClaim.ClaimName == claimName {
+			return nil, getVolumeMount(volume.Name), nil
+		}
+	}
+
+	return &corev1.Volume{
+		Name: volumeName,
+		VolumeSource: corev1.VolumeSource{
+			PersistentVolumeClaim: &corev1.PersistentVolumeClaimVolumeSource{
+				ClaimName: claimName,
+			}},
+	}, getVolumeMount(volumeName), nil
+}
+
+// getVolumeFileStorage returns volume mount for offsets stored in a subPath of volume defined in Pod specification
+func getVolumeFileStorage(pod *corev1.Pod, config sidecarConfig, storage *tailingsidecarv1.VolumeFileStorage, mountPath string) (*corev1.Volume, corev1.VolumeMount, error) {
+	name := storage.Name
+	if name == "" {
+		name = config.spec.VolumeMount.Name
+	}
+
+	subPath := storage.SubPath
+	if subPath == "" {
+		subPath = path.Join(fileStorageVolumeSubPathPrefix, config.name)
+	}
+
+	for _, volume := range pod.Spec.Volumes {
+		if volume.Name == name {
+			return nil, corev1.VolumeMount{
+				Name:      name,
+				MountPath: mountPath,
+				SubPath:   subPath,
+			}, nil
+		}
+	}
+	return nil, corev1.VolumeMount{}, fmt.Errorf("volume provided in fileStorage configuration is not defined in Pod, volume name: %s", name)
+}
+
+// validateFileStorage checks if exactly one storage is set in file storage configuration
+func validateFileStorage(storage *tailingsidecarv1.FileStorageSpec) error {
+	if storage == nil {
+		return nil
+	}
+
+	storagesCount := 0
+	if storage.PersistentVolumeClaim != nil {
+		if storage.PersistentVolumeClaim.ClaimName == "" && storage.PersistentVolumeClaim.VolumeClaimTemplate == "" {
+			return fmt.Errorf("claimName or volumeClaimTemplate needs to be provided in persistentVolumeClaim fileStorage configuration")
+		}
+		if storage.PersistentVolumeClaim.ClaimName != "" && storage.PersistentVolumeClaim.VolumeClaimTemplate != "" {
+			return fmt.Errorf("claimName and volumeClaimTemplate cannot be provided together in persistentVolumeClaim fileStorage configuration")
+		}
+		storagesCount++
+	}
+	if storage.Volume != nil {
+		storagesCount++
+	}
+	if storage.HostPath != nil {
+		if storage.HostPath.Path == "" {
+			return fmt.Errorf("path needs to be provided in hostPath fileStorage configuration")
+		}
+		storagesCount++
+	}
+
+	if storagesCount != 1 {
+		return fmt.Errorf("exactly one of persistentVolumeClaim, volume and hostPath needs to be provided in fileStorage configuration")
+	}
+	return nil
+}
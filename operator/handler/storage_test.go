@@ -0,0 +1,366 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package handler
+
+import (
+	"context"
+	"encoding/json"
+
+	tailingsidecarv1 "github.com/SumoLogic/tailing-sidecar/operator/api/v1"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/ginkgo/extensions/table"
+	. "github.com/onsi/gomega"
+	admv1 "k8s.io/api/admission/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+)
+
+var _ = Describe("storage", func() {
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: "statefulset-0",
+		},
+		Spec: corev1.PodSpec{
+			Volumes: []corev1.Volume{
+				{
+					Name: "varlog",
+					VolumeSource: corev1.VolumeSource{
+						PersistentVolumeClaim: &corev1.PersistentVolumeClaimVolumeSource{
+							ClaimName: "varlog-statefulset-0",
+						},
+					},
+				},
+			},
+		},
+	}
+	hostPathType := corev1.HostPathDirectoryOrCreate
+
+	DescribeTable("getFileStorage",
+		func(
+			storage *tailingsidecarv1.FileStorageSpec,
+			expectedVolume *corev1.Volume,
+			expectedVolumeMount corev1.VolumeMount,
+		) {
+			config := sidecarConfig{
+				name: "sidecar-0",
+				spec: tailingsidecarv1.SidecarSpec{
+					Path: "/var/log/example.log",
+					VolumeMount: corev1.VolumeMount{
+						Name:      "varlog",
+						MountPath: "/var/log",
+					},
+					FileStorage: storage,
+				},
+			}
+
+			volume, volumeMount, err := getFileStorage(pod, config, "storage-volume", "/var/lib/otc")
+
+			Expect(err).NotTo(HaveOccurred())
+			Expect(volume).To(Equal(expectedVolume))
+			Expect(volumeMount).To(Equal(expectedVolumeMount))
+		},
+
+		Entry(
+			"When file storage is not configured",
+			nil,
+			&corev1.Volume{
+				Name: "storage-volume",
+				VolumeSource: corev1.VolumeSource{
+					EmptyDir: &corev1.EmptyDirVolumeSource{},
+				},
+			},
+			corev1.VolumeMount{Name: "storage-volume", MountPath: "/var/lib/otc"},
+		),
+		Entry(
+			"When PersistentVolumeClaim is not defined in Pod",
+			&tailingsidecarv1.FileStorageSpec{
+				PersistentVolumeClaim: &tailingsidecarv1.PersistentVolumeClaimFileStorage{
+					ClaimName: "offsets",
+				},
+			},
+			&corev1.Volume{
+				Name: "storage-volume",
+				VolumeSource: corev1.VolumeSource{
+					PersistentVolumeClaim: &corev1.PersistentVolumeClaimVolumeSource{
+						ClaimName: "offsets",
+					},
+				},
+			},
+			corev1.VolumeMount{Name: "storage-volume", MountPath: "/var/lib/otc", SubPathExpr: "$(POD_NAME)/sidecar-0"},
+		),
+		Entry(
+			"When PersistentVolumeClaim is defined in Pod",
+			&tailingsidecarv1.FileStorageSpec{
+				PersistentVolumeClaim: &tailingsidecarv1.PersistentVolumeClaimFileStorage{
+					ClaimName: "varlog-statefulset-0",
+					SubPath:   "offsets",
+				},
+			},
+			nil,
+			corev1.VolumeMount{Name: "varlog", MountPath: "/var/lib/otc", SubPath: "offsets"},
+		),
+		Entry(
+			"When volumeClaimTemplate is used",
+			&tailingsidecarv1.FileStorageSpec{
+				PersistentVolumeClaim: &tailingsidecarv1.PersistentVolumeClaimFileStorage{
+					VolumeClaimTemplate: "varlog",
+					SubPath:             "offsets",
+				},
+			},
+			nil,
+			corev1.VolumeMount{Name: "varlog", MountPath: "/var/lib/otc", SubPath: "offsets"},
+		),
+		Entry(
+			"When volume defined in Pod is used",
+			&tailingsidecarv1.FileStorageSpec{
+				Volume: &tailingsidecarv1.VolumeFileStorage{},
+			},
+			nil,
+			corev1.VolumeMount{Name: "varlog", MountPath: "/var/lib/otc", SubPath: ".tailing-sidecar/sidecar-0"},
+		),
+		Entry(
+			"When hostPath is used",
+			&tailingsidecarv1.FileStorageSpec{
+				HostPath: &tailingsidecarv1.HostPathFileStorage{
+					Path: "/var/lib/tailing-sidecar",
+				},
+			},
+			&corev1.Volume{
+				Name: "storage-volume",
+				VolumeSource: corev1.VolumeSource{
+					HostPath: &corev1.HostPathVolumeSource{
+						Path: "/var/lib/tailing-sidecar",
+						Type: &hostPathType,
+					},
+				},
+			},
+			corev1.VolumeMount{Name: "storage-volume", MountPath: "/var/lib/otc", SubPathExpr: "$(POD_NAME)/sidecar-0"},
+		),
+		Entry(
+			"When hostPath with subPath is used",
+			&tailingsidecarv1.FileStorageSpec{
+				HostPath: &tailingsidecarv1.HostPathFileStorage{
+					Path:    "/var/lib/tailing-sidecar",
+					SubPath: "offsets",
+				},
+			},
+			&corev1.Volume{
+				Name: "storage-volume",
+				VolumeSource: corev1.VolumeSource{
+					HostPath: &corev1.HostPathVolumeSource{
+						Path: "/var/lib/tailing-sidecar",
+						Type: &hostPathType,
+					},
+				},
+			},
+			corev1.VolumeMount{Name: "storage-volume", MountPath: "/var/lib/otc", SubPath: "offsets"},
+		),
+	)
+
+	DescribeTable("getFileStorage with incorrect configuration",
+		func(storage *tailingsidecarv1.FileStorageSpec) {
+			config := sidecarConfig{
+				name: "sidecar-0",
+				spec: tailingsidecarv1.SidecarSpec{
+					VolumeMount: corev1.VolumeMount{
+						Name: "varlog",
+					},
+					FileStorage: storage,
+				},
+			}
+
+			_, _, err := getFileStorage(pod, config, "storage-volume", "/var/lib/otc")
+			Expect(err).To(HaveOccurred())
+		},
+
+		Entry(
+			"When more than one storage is provided",
+			&tailingsidecarv1.FileStorageSpec{
+				Volume:   &tailingsidecarv1.VolumeFileStorage{},
+				HostPath: &tailingsidecarv1.HostPathFileStorage{Path: "/var/lib/tailing-sidecar"},
+			},
+		),
+		Entry(
+			"When no storage is provided",
+			&tailingsidecarv1.FileStorageSpec{},
+		),
+		Entry(
+			"When claim name is missing",
+			&tailingsidecarv1.FileStorageSpec{
+				PersistentVolumeClaim: &tailingsidecarv1.PersistentVolumeClaimFileStorage{},
+			},
+		),
+		Entry(
+			"When volume is not defined in Pod",
+			&tailingsidecarv1.FileStorageSpec{
+				Volume: &tailingsidecarv1.VolumeFileStorage{Name: "missing"},
+			},
+		),
+		Entry(
+			"When hostPath path is missing",
+			&tailingsidecarv1.FileStorageSpec{
+				HostPath: &tailingsidecarv1.HostPathFileStorage{},
+			},
+		),
+	)
+
+	When("Pods on the same node store offsets in hostPath", func() {
+		podExtender := &PodExtender{TailingSidecarImage: "tailing-sidecar-image:test"}
+		newPod := func(name string) *corev1.Pod {
+			return &corev1.Pod{
+				ObjectMeta: metav1.ObjectMeta{
+					Namespace: "default",
+					Name:      name,
+					Labels:    map[string]string{"app": "example"},
+				},
+				Spec: corev1.PodSpec{
+					Containers: []corev1.Container{
+						{Name: "count", VolumeMounts: []corev1.VolumeMount{{Name: "varlog", MountPath: "/var/log"}}},
+					},
+				},
+			}
+		}
+		tailingSidecarConfig := tailingsidecarv1.TailingSidecarConfig{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "host-path"},
+			Spec: tailingsidecarv1.TailingSidecarConfigSpec{
+				PodSelector: &metav1.LabelSelector{MatchLabels: map[string]string{"app": "example"}},
+				SidecarSpecs: map[string]tailingsidecarv1.SidecarSpec{
+					"sidecar": {
+						Path:        "/var/log/example.log",
+						VolumeMount: corev1.VolumeMount{Name: "varlog", MountPath: "/var/log"},
+						FileStorage: &tailingsidecarv1.FileStorageSpec{
+							HostPath: &tailingsidecarv1.HostPathFileStorage{Path: "/var/lib/tailing-sidecar"},
+						},
+					},
+				},
+			},
+		}
+		first, second := newPod("first"), newPod("second")
+		for _, pod := range []*corev1.Pod{first, second} {
+			Expect(podExtender.extendPod(context.Background(), pod, []tailingsidecarv1.TailingSidecarConfig{tailingSidecarConfig}, admission.Request{})).To(Succeed())
+		}
+		// returns mount of hostPath volume in tailing sidecar
+		getHostPathMount := func(pod *corev1.Pod) corev1.VolumeMount {
+			for _, volume := range pod.Spec.Volumes {
+				if volume.HostPath == nil {
+					continue
+				}
+				for _, volumeMount := range pod.Spec.Containers[1].VolumeMounts {
+					if volumeMount.Name == volume.Name {
+						return volumeMount
+					}
+				}
+			}
+			return corev1.VolumeMount{}
+		}
+
+		It("stores offsets of each Pod in its own directory", func() {
+			for _, pod := range []*corev1.Pod{first, second} {
+				Expect(getHostPathMount(pod).SubPathExpr).To(Equal("$(POD_NAME)/sidecar"))
+				Expect(pod.Spec.Containers[1].Env).To(ContainElement(corev1.EnvVar{
+					Name: sidecarPodNameEnv,
+					ValueFrom: &corev1.EnvVarSource{
+						FieldRef: &corev1.ObjectFieldSelector{FieldPath: "metadata.name"},
+					},
+				}))
+			}
+		})
+	})
+
+	When("TailingSidecarConfig with empty fileStorage is applied to Pod", func() {
+		storageScheme := runtime.NewScheme()
+		Expect(clientgoscheme.AddToScheme(storageScheme)).To(Succeed())
+		Expect(tailingsidecarv1.AddToScheme(storageScheme)).To(Succeed())
+
+		tailingSidecarConfig := &tailingsidecarv1.TailingSidecarConfig{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "empty-file-storage"},
+			Spec: tailingsidecarv1.TailingSidecarConfigSpec{
+				PodSelector: &metav1.LabelSelector{MatchLabels: map[string]string{"app": "example"}},
+				SidecarSpecs: map[string]tailingsidecarv1.SidecarSpec{
+					"sidecar": {
+						Path:        "/var/log/example.log",
+						VolumeMount: corev1.VolumeMount{Name: "varlog", MountPath: "/var/log"},
+						FileStorage: &tailingsidecarv1.FileStorageSpec{},
+					},
+				},
+			},
+		}
+		podExtender := &PodExtender{
+			Client:              fake.NewClientBuilder().WithScheme(storageScheme).WithObjects(tailingSidecarConfig).Build(),
+			Decoder:             admission.NewDecoder(storageScheme),
+			TailingSidecarImage: "tailing-sidecar-image:test",
+		}
+		raw, err := json.Marshal(&corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "example", Labels: map[string]string{"app": "example"}},
+			Spec: corev1.PodSpec{
+				Containers: []corev1.Container{
+					{Name: "count", VolumeMounts: []corev1.VolumeMount{{Name: "varlog", MountPath: "/var/log"}}},
+				},
+			},
+		})
+		Expect(err).NotTo(HaveOccurred())
+
+		resp := podExtender.Handle(context.Background(), admission.Request{
+			AdmissionRequest: admv1.AdmissionRequest{
+				Operation: admv1.Create,
+				Namespace: "default",
+				Name:      "example",
+				Object:    runtime.RawExtension{Raw: raw},
+			},
+		})
+
+		It("admits Pod without tailing sidecar as storage needs to be provided", func() {
+			Expect(resp.Allowed).To(BeTrue())
+			for _, patch := range resp.Patches {
+				Expect(patch.Path).NotTo(HavePrefix("/spec/containers"))
+			}
+		})
+	})
+
+	When("volumeClaimTemplate is used in Pod template", func() {
+		config := sidecarConfig{
+			name: "sidecar-0",
+			spec: tailingsidecarv1.SidecarSpec{
+				FileStorage: &tailingsidecarv1.FileStorageSpec{
+					PersistentVolumeClaim: &tailingsidecarv1.PersistentVolumeClaimFileStorage{
+						VolumeClaimTemplate: "varlog",
+					},
+				},
+			},
+		}
+
+		It("mounts volume named after volumeClaimTemplate", func() {
+			volume, volumeMount, err := getFileStorage(&corev1.Pod{}, config, "storage-volume", "/var/lib/otc")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(volume).To(BeNil())
+			Expect(volumeMount).To(Equal(corev1.VolumeMount{
+				Name:      "varlog",
+				MountPath: "/var/lib/otc",
+				SubPath:   "sidecar-0",
+			}))
+		})
+
+		It("returns error for Pod with generated name", func() {
+			_, _, err := getFileStorage(&corev1.Pod{ObjectMeta: metav1.ObjectMeta{GenerateName: "deployment-"}}, config, "storage-volume", "/var/lib/otc")
+			Expect(err).To(HaveOccurred())
+		})
+	})
+})
@@ -0,0 +1,246 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package handler
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+
+	tailingsidecarv1 "github.com/SumoLogic/tailing-sidecar/operator/api/v1"
+	"gomodules.xyz/jsonpatch/v2"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/utils/ptr"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+)
+
+const (
+	// resizeSubResource is the subresource of Pod used to change resources of containers in place
+	resizeSubResource = "resize"
+
+	updateMessage = "Tailing sidecars are not changed in existing Pod"
+	resizeMessage = "Resources of tailing sidecars are set according to configuration"
+	// resizeOverrideMessage is returned when resources of tailing sidecars are changed by user other than the operator
+	resizeOverrideMessage = "Resources of tailing sidecars are not changed in resize requests of other users"
+)
+
+// resizableResources are resources of containers which can be changed in place
+var resizableResources = []corev1.ResourceName{corev1.ResourceCPU, corev1.ResourceMemory}
+
+// handleUpdate handles update of existing Pod, containers and volumes cannot be added to or removed from existing Pod,
+// so Pod is not changed and warnings describe changes of tailing sidecars which require Pod to be recreated,
+// resources of tailing sidecars are changed only in requests to resize subresource
+func (e *PodExtender) handleUpdate(ctx context.Context, pod *corev1.Pod, tailingSidecarConfigs []tailingsidecarv1.TailingSidecarConfig, req admission.Request) admission.Response {
+	switch req.SubResource {
+	case "":
+	case resizeSubResource:
+		return e.handleResize(pod, tailingSidecarConfigs, req)
+	default:
+		return admission.Allowed(updateMessage)
+	}
+
+	warnings := make([]string, 0)
+
+	// Pod is extended as for dry-run request, so configuration is compared with tailing sidecars in Pod
+	// without side effects like creating ConfigMap with configuration of tailing sidecars
+	extended := pod.DeepCopy()
+	snapshot := newPodSnapshot(extended)
+	if err := e.extendPod(ctx, extended, tailingSidecarConfigs, asDryRun(req)); err != nil {
+		warnings = append(warnings, fmt.Sprintf("Incorrect configuration of tailing sidecars: %v", err))
+	} else if hasSpecPatches(snapshot.patches(extended)) {
+		warnings = append(warnings, getRestartWarning(pod.Spec.Containers, extended.Spec.Containers))
+	}
+
+	resized, recreated, err := e.resizeSidecars(pod.DeepCopy(), tailingSidecarConfigs, req)
+	if err == nil && len(resized) > 0 {
+		warnings = append(warnings, fmt.Sprintf("Resources of tailing sidecars %s differ from configuration, "+
+			"they are changed in place when tailing sidecars are resized by the operator", strings.Join(resized, ", ")))
+	}
+	if err == nil && len(recreated) > 0 {
+		warnings = append(warnings, getRecreateWarning(recreated))
+	}
+
+	if len(warnings) > 0 {
+		handlerLog.Info("Pod has to be recreated or resized to apply configuration of tailing sidecars",
+			"Name", req.Name,
+			"Namespace", req.Namespace,
+			"warnings", warnings,
+		)
+	}
+	return admission.Allowed(updateMessage).WithWarnings(warnings...)
+}
+
+// handleResize sets CPU and memory of tailing sidecars according to configuration in request to resize subresource of Pod
+// sent by the operator, other users and controllers, e.g. VerticalPodAutoscaler, can set resources of tailing sidecars,
+// so their requests are not changed and only warning is returned. Containers are not added or removed,
+// so only tailing sidecars available in Pod are resized.
+func (e *PodExtender) handleResize(pod *corev1.Pod, tailingSidecarConfigs []tailingsidecarv1.TailingSidecarConfig, req admission.Request) admission.Response {
+	resized, _, err := e.resizeSidecars(pod, tailingSidecarConfigs, req)
+	if err != nil {
+		return admission.Allowed(resizeMessage).WithWarnings(fmt.Sprintf("Incorrect configuration of tailing sidecars: %v", err))
+	}
+	if len(resized) == 0 {
+		return admission.Allowed(resizeMessage)
+	}
+	if e.OperatorUsername == "" || req.UserInfo.Username != e.OperatorUsername {
+		return admission.Allowed(resizeOverrideMessage).WithWarnings(fmt.Sprintf("Resources of tailing sidecars %s differ from configuration, "+
+			"they are set to configuration when tailing sidecars are resized by the operator", strings.Join(resized, ", ")))
+	}
+
+	// only resources of resized containers are replaced, as other fields cannot be changed by resize
+	patches := make([]jsonpatch.JsonPatchOperation, 0, len(resized))
+	for i, container := range pod.Spec.Containers {
+		if slices.Contains(resized, container.Name) {
+			patches = append(patches, jsonpatch.NewOperation("replace", fmt.Sprintf("/spec/containers/%d/resources", i), container.Resources))
+		}
+	}
+	handlerLog.Info("Resizing tailing sidecars",
+		"Name", req.Name,
+		"Namespace", req.Namespace,
+		"containers", resized,
+	)
+	return admission.Patched(resizeMessage, patches...)
+}
+
+// ResizeSidecars sets CPU and memory of tailing sidecars in Pod to values from configuration or operator defaults
+// and returns names of changed containers and of containers which have to be recreated to change their limits,
+// configurations are found in the same way as by webhook for existing Pods
+func (e *PodExtender) ResizeSidecars(pod *corev1.Pod, tailingSidecarConfigs []tailingsidecarv1.TailingSidecarConfig) ([]string, []string, error) {
+	if isInjectedInTemplate(pod) || len(getTailingSidecars(pod.Spec.Containers)) == 0 {
+		return nil, nil, nil
+	}
+	matched, err := matchActiveTailingSidecarConfigs(slices.Clone(tailingSidecarConfigs), pod.ObjectMeta.Labels)
+	if err != nil {
+		return nil, nil, err
+	}
+	return e.resizeSidecars(pod, matched, admission.Request{})
+}
+
+// resizeSidecars sets CPU and memory of tailing sidecars in Pod according to configuration, it returns names of changed containers
+// and names of containers with limits used by Go runtime which differ from configuration, these limits are not changed in place,
+// as Go runtime of tailing sidecar would keep them, e.g. GOMEMLIMIT above lowered memory limit, until container is recreated.
+// TailingSidecarConfigs with canary and in DryRun mode are omitted in the same way as when Pod is extended
+func (e PodExtender) resizeSidecars(pod *corev1.Pod, tailingSidecarConfigs []tailingsidecarv1.TailingSidecarConfig, req admission.Request) ([]string, []string, error) {
+	tailingSidecarConfigs, _ = splitDryRun(filterCanary(tailingSidecarConfigs, pod, req))
+	configs, err := getConfigs(pod.ObjectMeta.Annotations, tailingSidecarConfigs)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	resized := make([]string, 0)
+	recreated := make([]string, 0)
+	for _, config := range configs {
+		if err := prepareVolume(pod.Spec.Containers, &config.spec.VolumeMount); err != nil {
+			continue
+		}
+		index := getSidecarIndex(pod.Spec.Containers, config)
+		if index < 0 {
+			continue
+		}
+		container := &pod.Spec.Containers[index]
+		configured := e.getSidecarResources(config)
+		if keepRuntimeLimits(*container, &configured) && !slices.Contains(recreated, container.Name) {
+			recreated = append(recreated, container.Name)
+		}
+		if resizeResources(&container.Resources, configured) && !slices.Contains(resized, container.Name) {
+			resized = append(resized, container.Name)
+		}
+	}
+	return resized, recreated, nil
+}
+
+// keepRuntimeLimits sets configured limits used by Go runtime of tailing sidecar to current limits of container
+// and returns true when they differ
+func keepRuntimeLimits(container corev1.Container, configured *corev1.ResourceRequirements) bool {
+	kept := false
+	for _, name := range getRuntimeLimits(container) {
+		current, ok := container.Resources.Limits[name]
+		if !ok {
+			continue
+		}
+		quantity, ok := configured.Limits[name]
+		if !ok || current.Cmp(quantity) == 0 {
+			continue
+		}
+		// limits may be shared with operator defaults, so they are copied before change
+		if !kept {
+			configured.Limits = configured.Limits.DeepCopy()
+		}
+		configured.Limits[name] = current.DeepCopy()
+		kept = true
+	}
+	return kept
+}
+
+// resizeResources sets CPU and memory to configured values and returns true when they are changed,
+// resources added or removed in place could change QoS class of Pod, so only CPU and memory set in container are changed
+func resizeResources(resources *corev1.ResourceRequirements, configured corev1.ResourceRequirements) bool {
+	requests := resizeResourceList(resources.Requests, configured.Requests)
+	limits := resizeResourceList(resources.Limits, configured.Limits)
+	return requests || limits
+}
+
+// resizeResourceList sets CPU and memory available in resources to configured values and returns true when they are changed
+func resizeResourceList(resources corev1.ResourceList, configured corev1.ResourceList) bool {
+	resized := false
+	for _, name := range resizableResources {
+		current, ok := resources[name]
+		if !ok {
+			continue
+		}
+		quantity, ok := configured[name]
+		if !ok || current.Cmp(quantity) == 0 {
+			continue
+		}
+		resources[name] = quantity.DeepCopy()
+		resized = true
+	}
+	return resized
+}
+
+// getRestartWarning returns warning describing tailing sidecars which are added or removed when Pod is recreated
+func getRestartWarning(containers []corev1.Container, extended []corev1.Container) string {
+	warning := "Pod has to be recreated to apply configuration of tailing sidecars, containers cannot be changed in existing Pod"
+	added, removed := diffTailingSidecars(containers, extended)
+	if len(added) > 0 {
+		warning += fmt.Sprintf(", added: %s", strings.Join(added, ", "))
+	}
+	if len(removed) > 0 {
+		warning += fmt.Sprintf(", removed: %s", strings.Join(removed, ", "))
+	}
+	return warning
+}
+
+// getRecreateWarning returns warning describing tailing sidecars with limits used by Go runtime which differ from configuration
+func getRecreateWarning(containers []string) string {
+	return fmt.Sprintf("Limits of tailing sidecars %s differ from configuration, Pod has to be recreated to change them, "+
+		"as environment variables of Go runtime derived from them cannot be changed in place", strings.Join(containers, ", "))
+}
+
+// hasSpecPatches checks if patches change specification of Pod
+func hasSpecPatches(patches []jsonpatch.JsonPatchOperation) bool {
+	return slices.ContainsFunc(patches, func(patch jsonpatch.JsonPatchOperation) bool {
+		return strings.HasPrefix(patch.Path, "/spec/")
+	})
+}
+
+// asDryRun returns copy of admission request marked as dry-run, handling it does not have side effects
+func asDryRun(req admission.Request) admission.Request {
+	req.DryRun = ptr.To(true)
+	return req
+}
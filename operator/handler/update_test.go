@@ -0,0 +1,223 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package handler
+
+import (
+	"context"
+
+	tailingsidecarv1 "github.com/SumoLogic/tailing-sidecar/operator/api/v1"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"gomodules.xyz/jsonpatch/v2"
+	admv1 "k8s.io/api/admission/v1"
+	authenticationv1 "k8s.io/api/authentication/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+)
+
+var _ = Describe("handleUpdate", func() {
+	ctx := context.Background()
+
+	podExtender := &PodExtender{
+		TailingSidecarImage: "tailing-sidecar-image:test",
+		OperatorUsername:    "system:serviceaccount:tailing-sidecar-system:tailing-sidecar-operator",
+		TailingSidecarResources: corev1.ResourceRequirements{
+			Requests: corev1.ResourceList{
+				corev1.ResourceCPU:    resource.MustParse("100m"),
+				corev1.ResourceMemory: resource.MustParse("200Mi"),
+			},
+			Limits: corev1.ResourceList{
+				corev1.ResourceMemory: resource.MustParse("500Mi"),
+			},
+		},
+	}
+
+	tailingSidecarConfig := tailingsidecarv1.TailingSidecarConfig{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "example"},
+		Spec: tailingsidecarv1.TailingSidecarConfigSpec{
+			PodSelector: &metav1.LabelSelector{MatchLabels: map[string]string{"app": "example"}},
+			SidecarSpecs: map[string]tailingsidecarv1.SidecarSpec{
+				"sidecar": {
+					Path:        "/var/log/example1.log",
+					VolumeMount: corev1.VolumeMount{Name: "varlog", MountPath: "/var/log"},
+					Resources: corev1.ResourceRequirements{
+						Requests: corev1.ResourceList{corev1.ResourceCPU: resource.MustParse("200m")},
+					},
+				},
+			},
+		},
+	}
+
+	sidecar := newTailingSidecar("sidecar", "/var/log/example1.log")
+	sidecar.Resources = corev1.ResourceRequirements{
+		Requests: corev1.ResourceList{
+			corev1.ResourceCPU:              resource.MustParse("100m"),
+			corev1.ResourceEphemeralStorage: resource.MustParse("1Gi"),
+		},
+		Limits: corev1.ResourceList{
+			corev1.ResourceMemory: resource.MustParse("200Mi"),
+		},
+	}
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: "default",
+			Name:      "example",
+			Labels:    map[string]string{"app": "example"},
+			Annotations: map[string]string{
+				SidecarAnnotation: "varlog:/var/log/example0.log",
+			},
+		},
+		Spec: corev1.PodSpec{
+			Containers: []corev1.Container{
+				{
+					Name:         "count",
+					VolumeMounts: []corev1.VolumeMount{{Name: "varlog", MountPath: "/var/log"}},
+				},
+				sidecar,
+			},
+		},
+	}
+	newRequest := func(subResource string) admission.Request {
+		return admission.Request{AdmissionRequest: admv1.AdmissionRequest{
+			Operation:   admv1.Update,
+			SubResource: subResource,
+			Namespace:   "default",
+			Name:        "example",
+			UserInfo:    authenticationv1.UserInfo{Username: "system:serviceaccount:tailing-sidecar-system:tailing-sidecar-operator"},
+		}}
+	}
+
+	When("Pod is updated", func() {
+		resp := podExtender.handleUpdate(ctx, pod.DeepCopy(), []tailingsidecarv1.TailingSidecarConfig{tailingSidecarConfig}, newRequest(""))
+
+		It("does not change Pod", func() {
+			Expect(resp.Allowed).To(BeTrue())
+			Expect(resp.Patches).To(BeEmpty())
+		})
+
+		It("warns that Pod has to be recreated or resized", func() {
+			Expect(resp.Warnings).To(Equal([]string{
+				"Pod has to be recreated to apply configuration of tailing sidecars, containers cannot be changed in existing Pod, added: tailing-sidecar-1",
+				"Resources of tailing sidecars sidecar differ from configuration, they are changed in place when tailing sidecars are resized by the operator",
+			}))
+		})
+	})
+
+	When("Pod with tailing sidecars matching configuration is updated", func() {
+		updated := pod.DeepCopy()
+		delete(updated.ObjectMeta.Annotations, SidecarAnnotation)
+		updated.Spec.Containers[1].Resources.Requests[corev1.ResourceCPU] = resource.MustParse("0.2")
+		updated.Spec.Containers[1].Resources.Limits[corev1.ResourceMemory] = resource.MustParse("500Mi")
+		resp := podExtender.handleUpdate(ctx, updated, []tailingsidecarv1.TailingSidecarConfig{tailingSidecarConfig}, newRequest(""))
+
+		It("does not return warnings", func() {
+			Expect(resp.Allowed).To(BeTrue())
+			Expect(resp.Patches).To(BeEmpty())
+			Expect(resp.Warnings).To(BeEmpty())
+		})
+	})
+
+	When("Pod is resized by the operator", func() {
+		resp := podExtender.handleUpdate(ctx, pod.DeepCopy(), []tailingsidecarv1.TailingSidecarConfig{tailingSidecarConfig}, newRequest(resizeSubResource))
+
+		It("sets CPU and memory of tailing sidecars available in Pod", func() {
+			Expect(resp.Allowed).To(BeTrue())
+			Expect(resp.Patches).To(Equal([]jsonpatch.JsonPatchOperation{
+				jsonpatch.NewOperation("replace", "/spec/containers/1/resources", corev1.ResourceRequirements{
+					Requests: corev1.ResourceList{
+						corev1.ResourceCPU:              resource.MustParse("200m"),
+						corev1.ResourceEphemeralStorage: resource.MustParse("1Gi"),
+					},
+					Limits: corev1.ResourceList{
+						corev1.ResourceMemory: resource.MustParse("500Mi"),
+					},
+				}),
+			}))
+		})
+	})
+
+	When("Pod with memory limit used by Go runtime is resized by the operator", func() {
+		resized := pod.DeepCopy()
+		resized.Spec.Containers[1].Env = append(resized.Spec.Containers[1].Env, getRuntimeEnv(resized.Spec.Containers[1].Resources)...)
+		resp := podExtender.handleUpdate(ctx, resized, []tailingsidecarv1.TailingSidecarConfig{tailingSidecarConfig}, newRequest(resizeSubResource))
+
+		It("does not change memory limit of tailing sidecar", func() {
+			Expect(resp.Allowed).To(BeTrue())
+			Expect(resp.Patches).To(Equal([]jsonpatch.JsonPatchOperation{
+				jsonpatch.NewOperation("replace", "/spec/containers/1/resources", corev1.ResourceRequirements{
+					Requests: corev1.ResourceList{
+						corev1.ResourceCPU:              resource.MustParse("200m"),
+						corev1.ResourceEphemeralStorage: resource.MustParse("1Gi"),
+					},
+					Limits: corev1.ResourceList{
+						corev1.ResourceMemory: resource.MustParse("200Mi"),
+					},
+				}),
+			}))
+		})
+
+		It("does not change operator defaults", func() {
+			Expect(podExtender.TailingSidecarResources.Limits.Memory().String()).To(Equal("500Mi"))
+		})
+	})
+
+	When("Pod with memory limit used by Go runtime is updated", func() {
+		updated := pod.DeepCopy()
+		delete(updated.ObjectMeta.Annotations, SidecarAnnotation)
+		updated.Spec.Containers[1].Resources.Requests[corev1.ResourceCPU] = resource.MustParse("0.2")
+		updated.Spec.Containers[1].Env = append(updated.Spec.Containers[1].Env, getRuntimeEnv(updated.Spec.Containers[1].Resources)...)
+		resp := podExtender.handleUpdate(ctx, updated, []tailingsidecarv1.TailingSidecarConfig{tailingSidecarConfig}, newRequest(""))
+
+		It("warns that Pod has to be recreated", func() {
+			Expect(resp.Allowed).To(BeTrue())
+			Expect(resp.Patches).To(BeEmpty())
+			Expect(resp.Warnings).To(Equal([]string{
+				"Limits of tailing sidecars sidecar differ from configuration, Pod has to be recreated to change them, " +
+					"as environment variables of Go runtime derived from them cannot be changed in place",
+			}))
+		})
+	})
+
+	When("Pod is resized by other user", func() {
+		req := newRequest(resizeSubResource)
+		req.UserInfo.Username = "system:serviceaccount:kube-system:vpa-updater"
+		resp := podExtender.handleUpdate(ctx, pod.DeepCopy(), []tailingsidecarv1.TailingSidecarConfig{tailingSidecarConfig}, req)
+
+		It("does not change resources of tailing sidecars", func() {
+			Expect(resp.Allowed).To(BeTrue())
+			Expect(resp.Patches).To(BeEmpty())
+		})
+
+		It("warns that resources differ from configuration", func() {
+			Expect(resp.Warnings).To(Equal([]string{
+				"Resources of tailing sidecars sidecar differ from configuration, they are set to configuration when tailing sidecars are resized by the operator",
+			}))
+		})
+	})
+
+	When("status of Pod is updated", func() {
+		resp := podExtender.handleUpdate(ctx, pod.DeepCopy(), []tailingsidecarv1.TailingSidecarConfig{tailingSidecarConfig}, newRequest("status"))
+
+		It("does not change Pod", func() {
+			Expect(resp.Allowed).To(BeTrue())
+			Expect(resp.Patches).To(BeEmpty())
+			Expect(resp.Warnings).To(BeEmpty())
+		})
+	})
+})
@@ -0,0 +1,89 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package handler
+
+import (
+	tailingsidecarv1 "github.com/SumoLogic/tailing-sidecar/operator/api/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+)
+
+// getSidecarVolumes returns settings for emptyDir volumes created for tailing sidecar container,
+// settings which are not provided for tailing sidecar are taken from defaults
+func getSidecarVolumes(volumes *tailingsidecarv1.SidecarVolumesSpec, defaults tailingsidecarv1.SidecarVolumesSpec) tailingsidecarv1.SidecarVolumesSpec {
+	if volumes == nil {
+		volumes = &tailingsidecarv1.SidecarVolumesSpec{}
+	}
+	return tailingsidecarv1.SidecarVolumesSpec{
+		Sidecar:         mergeEmptyDir(volumes.Sidecar, defaults.Sidecar),
+		OtelLogs:        mergeEmptyDir(volumes.OtelLogs, defaults.OtelLogs),
+		OtelFileStorage: mergeEmptyDir(volumes.OtelFileStorage, defaults.OtelFileStorage),
+	}
+}
+
+// mergeEmptyDir returns copy of emptyDir with medium and sizeLimit taken from defaults when they are not set
+func mergeEmptyDir(emptyDir *corev1.EmptyDirVolumeSource, defaults *corev1.EmptyDirVolumeSource) *corev1.EmptyDirVolumeSource {
+	merged := &corev1.EmptyDirVolumeSource{}
+	if defaults != nil {
+		defaults.DeepCopyInto(merged)
+	}
+	if emptyDir == nil {
+		return merged
+	}
+
+	if emptyDir.Medium != corev1.StorageMediumDefault {
+		merged.Medium = emptyDir.Medium
+	}
+	if emptyDir.SizeLimit != nil {
+		sizeLimit := emptyDir.SizeLimit.DeepCopy()
+		merged.SizeLimit = &sizeLimit
+	}
+	return merged
+}
+
+// setEphemeralStorageRequest sets ephemeral-storage request of tailing sidecar container
+// to the sum of size limits of disk backed emptyDir volumes, memory backed volumes are accounted as container memory.
+// Request is not changed when it is already provided in configuration or none of the volumes has size limit.
+func setEphemeralStorageRequest(resources corev1.ResourceRequirements, emptyDirs ...*corev1.EmptyDirVolumeSource) corev1.ResourceRequirements {
+	if _, ok := resources.Requests[corev1.ResourceEphemeralStorage]; ok {
+		return resources
+	}
+
+	var ephemeralStorage *resource.Quantity
+	for _, emptyDir := range emptyDirs {
+		if emptyDir == nil || emptyDir.SizeLimit == nil || emptyDir.Medium == corev1.StorageMediumMemory {
+			continue
+		}
+		if ephemeralStorage == nil {
+			ephemeralStorage = resource.NewQuantity(0, resource.BinarySI)
+		}
+		ephemeralStorage.Add(*emptyDir.SizeLimit)
+	}
+
+	if ephemeralStorage == nil {
+		return resources
+	}
+
+	// copy requests as they can be shared with default resources
+	requests := make(corev1.ResourceList, len(resources.Requests)+1)
+	for name, quantity := range resources.Requests {
+		requests[name] = quantity.DeepCopy()
+	}
+	requests[corev1.ResourceEphemeralStorage] = *ephemeralStorage
+	resources.Requests = requests
+	return resources
+}
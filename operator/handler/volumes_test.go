@@ -0,0 +1,119 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package handler
+
+import (
+	tailingsidecarv1 "github.com/SumoLogic/tailing-sidecar/operator/api/v1"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+)
+
+var _ = Describe("volumes", func() {
+	sizeLimit := func(value string) *resource.Quantity {
+		quantity := resource.MustParse(value)
+		return &quantity
+	}
+
+	Context("getSidecarVolumes", func() {
+		defaults := tailingsidecarv1.SidecarVolumesSpec{
+			Sidecar: &corev1.EmptyDirVolumeSource{
+				SizeLimit: sizeLimit("10Mi"),
+			},
+			OtelLogs: &corev1.EmptyDirVolumeSource{
+				Medium:    corev1.StorageMediumMemory,
+				SizeLimit: sizeLimit("5Mi"),
+			},
+		}
+
+		When("volumes are not configured for tailing sidecar", func() {
+			volumes := getSidecarVolumes(nil, defaults)
+
+			It("returns defaults", func() {
+				Expect(volumes.Sidecar).To(Equal(defaults.Sidecar))
+				Expect(volumes.OtelLogs).To(Equal(defaults.OtelLogs))
+				Expect(volumes.OtelFileStorage).To(Equal(&corev1.EmptyDirVolumeSource{}))
+			})
+		})
+
+		When("volumes are configured for tailing sidecar", func() {
+			volumes := getSidecarVolumes(&tailingsidecarv1.SidecarVolumesSpec{
+				OtelLogs: &corev1.EmptyDirVolumeSource{
+					Medium: corev1.StorageMediumDefault,
+				},
+				OtelFileStorage: &corev1.EmptyDirVolumeSource{
+					SizeLimit: sizeLimit("1Mi"),
+				},
+			}, defaults)
+
+			It("overrides defaults with configured fields", func() {
+				Expect(volumes.Sidecar).To(Equal(defaults.Sidecar))
+				Expect(volumes.OtelLogs).To(Equal(defaults.OtelLogs))
+				Expect(volumes.OtelFileStorage).To(Equal(&corev1.EmptyDirVolumeSource{SizeLimit: sizeLimit("1Mi")}))
+			})
+		})
+	})
+
+	Context("setEphemeralStorageRequest", func() {
+		defaultRequests := corev1.ResourceList{
+			corev1.ResourceCPU: resource.MustParse("100m"),
+		}
+
+		When("volumes have size limits", func() {
+			resources := setEphemeralStorageRequest(corev1.ResourceRequirements{Requests: defaultRequests},
+				&corev1.EmptyDirVolumeSource{SizeLimit: sizeLimit("10Mi")},
+				&corev1.EmptyDirVolumeSource{SizeLimit: sizeLimit("5Mi")},
+				&corev1.EmptyDirVolumeSource{Medium: corev1.StorageMediumMemory, SizeLimit: sizeLimit("1Mi")},
+				&corev1.EmptyDirVolumeSource{},
+			)
+
+			It("sets ephemeral-storage request to the sum of disk backed volumes size limits", func() {
+				ephemeralStorage := resources.Requests[corev1.ResourceEphemeralStorage]
+				Expect(ephemeralStorage.Cmp(resource.MustParse("15Mi"))).To(Equal(0))
+				Expect(resources.Requests).To(HaveKey(corev1.ResourceCPU))
+			})
+
+			It("does not modify default requests", func() {
+				Expect(defaultRequests).NotTo(HaveKey(corev1.ResourceEphemeralStorage))
+			})
+		})
+
+		When("ephemeral-storage request is provided", func() {
+			resources := setEphemeralStorageRequest(corev1.ResourceRequirements{
+				Requests: corev1.ResourceList{
+					corev1.ResourceEphemeralStorage: resource.MustParse("1Gi"),
+				},
+			}, &corev1.EmptyDirVolumeSource{SizeLimit: sizeLimit("10Mi")})
+
+			It("does not change the request", func() {
+				ephemeralStorage := resources.Requests[corev1.ResourceEphemeralStorage]
+				Expect(ephemeralStorage.Cmp(resource.MustParse("1Gi"))).To(Equal(0))
+			})
+		})
+
+		When("volumes do not have size limits", func() {
+			resources := setEphemeralStorageRequest(corev1.ResourceRequirements{Requests: defaultRequests},
+				&corev1.EmptyDirVolumeSource{},
+			)
+
+			It("does not set ephemeral-storage request", func() {
+				Expect(resources.Requests).NotTo(HaveKey(corev1.ResourceEphemeralStorage))
+			})
+		})
+	})
+})
@@ -0,0 +1,307 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package handler
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+
+	admv1 "k8s.io/api/admission/v1"
+	appsv1 "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+)
+
+const (
+	// injectedSidecarsAnnotation lists tailing sidecar containers injected in Pod template of workload,
+	// it is added to workload and to its Pod template so Pods created from the template can be recognized
+	injectedSidecarsAnnotation = "tailing-sidecar.sumologic.com/injected-sidecars"
+	injectedSidecarsSeparator  = ","
+
+	templateInjectedMessage = "Tailing sidecars are already injected in workload template"
+)
+
+var workloadHandlerLog = ctrl.Log.WithName("tailing-sidecar.operator.handler.WorkloadExtender")
+
+// WorkloadTemplate describes kind of workload and path to Pod template embedded in it
+type WorkloadTemplate struct {
+	Group   string `json:"group,omitempty"`
+	Version string `json:"version"`
+	Kind    string `json:"kind"`
+	// TemplatePath is a path to Pod template in workload with fields separated by dots, e.g. spec.template
+	TemplatePath string `json:"templatePath"`
+}
+
+// GroupVersionKind returns GroupVersionKind of workload
+func (w WorkloadTemplate) GroupVersionKind() schema.GroupVersionKind {
+	return schema.GroupVersionKind{Group: w.Group, Version: w.Version, Kind: w.Kind}
+}
+
+// Validate checks if workload template contains all required fields
+func (w WorkloadTemplate) Validate() error {
+	if w.Version == "" || w.Kind == "" || w.TemplatePath == "" {
+		return fmt.Errorf("version, kind and templatePath need to be provided for workload template, group: %s, version: %s, kind: %s, templatePath: %s",
+			w.Group, w.Version, w.Kind, w.TemplatePath)
+	}
+	return nil
+}
+
+// fields returns fields of path to Pod template
+func (w WorkloadTemplate) fields() []string {
+	return strings.Split(strings.TrimPrefix(w.TemplatePath, "."), ".")
+}
+
+// containers returns containers from Pod template of serialized workload
+func (w WorkloadTemplate) containers(raw []byte) ([]corev1.Container, error) {
+	workload := &unstructured.Unstructured{}
+	if err := workload.UnmarshalJSON(raw); err != nil {
+		return nil, err
+	}
+	rawContainers, _, err := unstructured.NestedSlice(workload.Object, append(w.fields(), "spec", "containers")...)
+	if err != nil {
+		return nil, err
+	}
+	containers := make([]corev1.Container, 0, len(rawContainers))
+	for _, rawContainer := range rawContainers {
+		rawContainerMap, ok := rawContainer.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("incorrect container in Pod template of %s", w.GroupVersionKind())
+		}
+		container := corev1.Container{}
+		if err := runtime.DefaultUnstructuredConverter.FromUnstructured(rawContainerMap, &container); err != nil {
+			return nil, err
+		}
+		containers = append(containers, container)
+	}
+	return containers, nil
+}
+
+// builtinWorkloadTemplates lists workloads supported without additional configuration
+var builtinWorkloadTemplates = []WorkloadTemplate{
+	{Group: appsv1.GroupName, Version: "v1", Kind: "Deployment", TemplatePath: "spec.template"},
+	{Group: appsv1.GroupName, Version: "v1", Kind: "StatefulSet", TemplatePath: "spec.template"},
+	{Group: appsv1.GroupName, Version: "v1", Kind: "DaemonSet", TemplatePath: "spec.template"},
+	{Group: batchv1.GroupName, Version: "v1", Kind: "Job", TemplatePath: "spec.template"},
+	{Group: batchv1.GroupName, Version: "v1", Kind: "CronJob", TemplatePath: "spec.jobTemplate.spec.template"},
+}
+
+// WorkloadExtender extends Pod templates of workloads (Deployments, StatefulSets, DaemonSets, Jobs, CronJobs
+// and configured custom resources) by tailing sidecar containers, so tailing sidecars are visible in workload specification
+type WorkloadExtender struct {
+	PodExtender *PodExtender
+	// WorkloadTemplates lists additional kinds of workloads e.g. based on custom resources
+	WorkloadTemplates []WorkloadTemplate
+}
+
+// Handle handles requests to create/update workload and extends its Pod template by adding tailing sidecars,
+// decisions are recorded in decision log of PodExtender
+func (e *WorkloadExtender) Handle(ctx context.Context, req admission.Request) admission.Response {
+	gvk := schema.GroupVersionKind{Group: req.Kind.Group, Version: req.Kind.Version, Kind: req.Kind.Kind}
+
+	resp := e.handle(ctx, req, gvk)
+	if workloadTemplate, ok := e.getWorkloadTemplate(gvk); ok {
+		e.PodExtender.Decisions.record(req, resp, workloadTemplate.containers)
+	}
+	return resp
+}
+
+func (e *WorkloadExtender) handle(ctx context.Context, req admission.Request, gvk schema.GroupVersionKind) admission.Response {
+
+	if req.Operation != admv1.Create && req.Operation != admv1.Update {
+		return admission.Allowed(fmt.Sprintf("Operation %s is not supported for workloads", req.Operation))
+	}
+
+	if gvk.GroupKind() == batchv1.SchemeGroupVersion.WithKind("Job").GroupKind() && req.Operation == admv1.Update {
+		return admission.Allowed("Pod template of Job is immutable")
+	}
+
+	workloadTemplate, ok := e.getWorkloadTemplate(gvk)
+	if !ok {
+		return admission.Allowed(fmt.Sprintf("Kind %s is not supported", gvk))
+	}
+
+	workload := &unstructured.Unstructured{}
+	if err := workload.UnmarshalJSON(req.Object.Raw); err != nil {
+		recordWorkloadInjection(gvk, workloadResultError)
+		return admission.Errored(http.StatusBadRequest, err)
+	}
+
+	rawTemplate, found, err := unstructured.NestedMap(workload.Object, workloadTemplate.fields()...)
+	if err != nil || !found {
+		recordWorkloadInjection(gvk, workloadResultError)
+		return admission.Errored(http.StatusBadRequest, fmt.Errorf("cannot find Pod template in %s at %s: %v", gvk, workloadTemplate.TemplatePath, err))
+	}
+
+	template := &corev1.PodTemplateSpec{}
+	if err := runtime.DefaultUnstructuredConverter.FromUnstructured(rawTemplate, template); err != nil {
+		recordWorkloadInjection(gvk, workloadResultError)
+		return admission.Errored(http.StatusBadRequest, err)
+	}
+
+	extended, err := e.extendPodTemplate(ctx, template, req)
+	if err != nil {
+		recordWorkloadInjection(gvk, workloadResultError)
+		return admission.Errored(http.StatusInternalServerError, err)
+	}
+	if !extended {
+		recordWorkloadInjection(gvk, workloadResultSkipped)
+		return admission.Allowed("Configuration for Tailing Sidecar Operator is not provided")
+	}
+
+	if err := setPodTemplate(rawTemplate, template); err != nil {
+		recordWorkloadInjection(gvk, workloadResultError)
+		return admission.Errored(http.StatusInternalServerError, err)
+	}
+	if err := unstructured.SetNestedMap(workload.Object, rawTemplate, workloadTemplate.fields()...); err != nil {
+		recordWorkloadInjection(gvk, workloadResultError)
+		return admission.Errored(http.StatusInternalServerError, err)
+	}
+
+	workload.SetAnnotations(setInjectedSidecarsAnnotation(workload.GetAnnotations(), template.Annotations[injectedSidecarsAnnotation]))
+
+	marshaledWorkload, err := workload.MarshalJSON()
+	if err != nil {
+		recordWorkloadInjection(gvk, workloadResultError)
+		return admission.Errored(http.StatusInternalServerError, err)
+	}
+	recordWorkloadInjection(gvk, workloadResultInjected)
+	resp := admission.PatchResponseFromRaw(req.Object.Raw, marshaledWorkload)
+	resp.AuditAnnotations = getProvenanceAuditAnnotations(template.Annotations)
+	return resp
+}
+
+// getWorkloadTemplate returns workload template for given kind, configured workload templates take precedence over built-in ones
+func (e *WorkloadExtender) getWorkloadTemplate(gvk schema.GroupVersionKind) (WorkloadTemplate, bool) {
+	for _, workloadTemplate := range slices.Concat(e.WorkloadTemplates, builtinWorkloadTemplates) {
+		if workloadTemplate.GroupVersionKind() == gvk {
+			return workloadTemplate, true
+		}
+	}
+	return WorkloadTemplate{}, false
+}
+
+// extendPodTemplate extends Pod template by adding tailing sidecars using the same logic as for Pods,
+// returns false when Pod template does not need to be configured
+func (e *WorkloadExtender) extendPodTemplate(ctx context.Context, template *corev1.PodTemplateSpec, req admission.Request) (bool, error) {
+	pod := &corev1.Pod{
+		ObjectMeta: *template.ObjectMeta.DeepCopy(),
+		Spec:       *template.Spec.DeepCopy(),
+	}
+	pod.ObjectMeta.Namespace = req.Namespace
+
+	tailingSidecarConfigs, err := e.PodExtender.getTailingSidecarConfigs(ctx, pod.ObjectMeta.Labels)
+	if err != nil {
+		return false, err
+	}
+	// TailingSidecarConfigs with canary select Pods, so they are not applied to Pod templates
+	tailingSidecarConfigs = slices.DeleteFunc(tailingSidecarConfigs, hasCanary)
+
+	_, annotated := pod.ObjectMeta.Annotations[SidecarAnnotation]
+	_, injected := pod.ObjectMeta.Annotations[injectedSidecarsAnnotation]
+	if !annotated && !injected && len(tailingSidecarConfigs) == 0 {
+		return false, nil
+	}
+
+	workloadHandlerLog.Info("Handling request",
+		"Name", req.Name,
+		"Namespace", req.Namespace,
+		"Kind", req.Kind,
+		"Operation", req.Operation,
+	)
+
+	if err := e.PodExtender.extendPod(ctx, pod, tailingSidecarConfigs, req); err != nil {
+		return false, err
+	}
+
+	if err := validateContainers(pod.Spec.Containers); err != nil {
+		return false, err
+	}
+
+	sidecarNames := make([]string, 0)
+	for _, container := range getTailingSidecars(pod.Spec.Containers) {
+		sidecarNames = append(sidecarNames, container.Name)
+	}
+	slices.Sort(sidecarNames)
+
+	template.ObjectMeta.Annotations = setInjectedSidecarsAnnotation(pod.ObjectMeta.Annotations, strings.Join(sidecarNames, injectedSidecarsSeparator))
+	template.Spec = pod.Spec
+	return true, nil
+}
+
+// setPodTemplate sets containers, volumes and annotations of extended Pod template in serialized Pod template,
+// other fields are kept as they are, so fields unknown to the operator are not dropped from workload
+func setPodTemplate(rawTemplate map[string]interface{}, template *corev1.PodTemplateSpec) error {
+	extendedSpec, err := runtime.DefaultUnstructuredConverter.ToUnstructured(&template.Spec)
+	if err != nil {
+		return err
+	}
+	for _, field := range []string{"containers", "volumes"} {
+		if value, ok := extendedSpec[field]; ok {
+			if err := unstructured.SetNestedField(rawTemplate, value, "spec", field); err != nil {
+				return err
+			}
+		} else {
+			unstructured.RemoveNestedField(rawTemplate, "spec", field)
+		}
+	}
+
+	if len(template.ObjectMeta.Annotations) == 0 {
+		unstructured.RemoveNestedField(rawTemplate, "metadata", "annotations")
+		return nil
+	}
+	return unstructured.SetNestedStringMap(rawTemplate, template.ObjectMeta.Annotations, "metadata", "annotations")
+}
+
+// setInjectedSidecarsAnnotation sets annotation with names of injected tailing sidecars,
+// annotation is removed when there are no injected tailing sidecars
+func setInjectedSidecarsAnnotation(annotations map[string]string, sidecars string) map[string]string {
+	if sidecars == "" {
+		delete(annotations, injectedSidecarsAnnotation)
+		return annotations
+	}
+
+	if annotations == nil {
+		annotations = make(map[string]string, 1)
+	}
+	annotations[injectedSidecarsAnnotation] = sidecars
+	return annotations
+}
+
+// isInjectedInTemplate checks if Pod was created from workload template with injected tailing sidecars
+// and all of these tailing sidecars are present in Pod specification
+func isInjectedInTemplate(pod *corev1.Pod) bool {
+	sidecars, ok := pod.ObjectMeta.Annotations[injectedSidecarsAnnotation]
+	if !ok {
+		return false
+	}
+
+	tailingSidecars := getTailingSidecars(pod.Spec.Containers)
+	for _, name := range strings.Split(sidecars, injectedSidecarsSeparator) {
+		if !slices.ContainsFunc(tailingSidecars, func(container corev1.Container) bool { return container.Name == name }) {
+			return false
+		}
+	}
+	return true
+}
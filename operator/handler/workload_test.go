@@ -0,0 +1,282 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package handler
+
+import (
+	"context"
+	"encoding/json"
+
+	tailingsidecarv1 "github.com/SumoLogic/tailing-sidecar/operator/api/v1"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	admv1 "k8s.io/api/admission/v1"
+	appsv1 "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+)
+
+var _ = Describe("workload", func() {
+	workloadScheme := runtime.NewScheme()
+	Expect(clientgoscheme.AddToScheme(workloadScheme)).To(Succeed())
+	Expect(tailingsidecarv1.AddToScheme(workloadScheme)).To(Succeed())
+
+	podExtender := &PodExtender{
+		Client:               fake.NewClientBuilder().WithScheme(workloadScheme).Build(),
+		Decoder:              admission.NewDecoder(workloadScheme),
+		TailingSidecarImage:  "sumologic/tailing-sidecar:latest",
+		TailingSidecarNaming: NamingIndex,
+	}
+	workloadExtender := &WorkloadExtender{
+		PodExtender: podExtender,
+		WorkloadTemplates: []WorkloadTemplate{
+			{Group: "argoproj.io", Version: "v1alpha1", Kind: "Rollout", TemplatePath: "spec.template"},
+			{Group: "keda.sh", Version: "v1alpha1", Kind: "ScaledJob", TemplatePath: ".spec.jobTargetRef.template"},
+		},
+	}
+
+	template := corev1.PodTemplateSpec{
+		ObjectMeta: metav1.ObjectMeta{
+			Annotations: map[string]string{
+				SidecarAnnotation: "varlog:/var/log/example0.log",
+			},
+		},
+		Spec: corev1.PodSpec{
+			Containers: []corev1.Container{
+				{
+					Name:  "count",
+					Image: "busybox",
+					VolumeMounts: []corev1.VolumeMount{
+						{Name: "varlog", MountPath: "/var/log"},
+					},
+				},
+			},
+			Volumes: []corev1.Volume{
+				{Name: "varlog", VolumeSource: corev1.VolumeSource{EmptyDir: &corev1.EmptyDirVolumeSource{}}},
+			},
+		},
+	}
+
+	newRequest := func(operation admv1.Operation, gvk metav1.GroupVersionKind, workload interface{}) admission.Request {
+		raw, err := json.Marshal(workload)
+		Expect(err).NotTo(HaveOccurred())
+		return admission.Request{
+			AdmissionRequest: admv1.AdmissionRequest{
+				Operation: operation,
+				Namespace: "default",
+				Kind:      gvk,
+				Object:    runtime.RawExtension{Raw: raw},
+			},
+		}
+	}
+
+	getPatchPaths := func(resp admission.Response) []string {
+		paths := make([]string, 0, len(resp.Patches))
+		for _, patch := range resp.Patches {
+			paths = append(paths, patch.Path)
+		}
+		return paths
+	}
+
+	When("Deployment with tailing-sidecar annotation in Pod template is created", func() {
+		deployment := &appsv1.Deployment{
+			TypeMeta:   metav1.TypeMeta{APIVersion: "apps/v1", Kind: "Deployment"},
+			ObjectMeta: metav1.ObjectMeta{Name: "deployment", Namespace: "default"},
+			Spec:       appsv1.DeploymentSpec{Template: *template.DeepCopy()},
+		}
+
+		resp := workloadExtender.Handle(context.Background(), newRequest(admv1.Create, metav1.GroupVersionKind{Group: "apps", Version: "v1", Kind: "Deployment"}, deployment))
+
+		It("returns patch with tailing sidecar in Pod template and injected sidecars annotation", func() {
+			Expect(resp.Allowed).To(BeTrue())
+			Expect(getPatchPaths(resp)).To(ContainElement("/spec/template/spec/containers/1"))
+			Expect(getPatchPaths(resp)).To(ContainElement("/metadata/annotations"))
+		})
+	})
+
+	When("configured custom resource with tailing-sidecar annotation in Pod template is created", func() {
+		scaledJob := map[string]interface{}{
+			"apiVersion": "keda.sh/v1alpha1",
+			"kind":       "ScaledJob",
+			"metadata": map[string]interface{}{
+				"name":      "scaledjob",
+				"namespace": "default",
+			},
+			"spec": map[string]interface{}{
+				"jobTargetRef": map[string]interface{}{
+					"template": template.DeepCopy(),
+				},
+			},
+		}
+		gvk := metav1.GroupVersionKind{Group: "keda.sh", Version: "v1alpha1", Kind: "ScaledJob"}
+		injections := testutil.ToFloat64(workloadInjectionsTotal.WithLabelValues(gvk.Group, gvk.Version, gvk.Kind, workloadResultInjected))
+
+		resp := workloadExtender.Handle(context.Background(), newRequest(admv1.Create, gvk, scaledJob))
+
+		It("returns patch with tailing sidecar in Pod template at configured path", func() {
+			Expect(resp.Allowed).To(BeTrue())
+			Expect(getPatchPaths(resp)).To(ContainElement("/spec/jobTargetRef/template/spec/containers/1"))
+			Expect(getPatchPaths(resp)).To(ContainElement("/metadata/annotations"))
+		})
+
+		It("records injection in metrics", func() {
+			Expect(testutil.ToFloat64(workloadInjectionsTotal.WithLabelValues(gvk.Group, gvk.Version, gvk.Kind, workloadResultInjected))).To(Equal(injections + 1))
+		})
+	})
+
+	When("configured custom resource has fields in Pod template unknown to the operator", func() {
+		rawTemplate, err := runtime.DefaultUnstructuredConverter.ToUnstructured(template.DeepCopy())
+		Expect(err).NotTo(HaveOccurred())
+		rawTemplate["spec"].(map[string]interface{})["schedulingHint"] = "spread"
+		rawTemplate["metadata"].(map[string]interface{})["labels"] = map[string]interface{}{"app": "rollout"}
+		rollout := map[string]interface{}{
+			"apiVersion": "argoproj.io/v1alpha1",
+			"kind":       "Rollout",
+			"metadata": map[string]interface{}{
+				"name":      "rollout",
+				"namespace": "default",
+			},
+			"spec": map[string]interface{}{
+				"template": rawTemplate,
+			},
+		}
+
+		resp := workloadExtender.Handle(context.Background(), newRequest(admv1.Create, metav1.GroupVersionKind{Group: "argoproj.io", Version: "v1alpha1", Kind: "Rollout"}, rollout))
+
+		It("patches only containers, volumes and annotations of Pod template", func() {
+			Expect(resp.Allowed).To(BeTrue())
+			for _, path := range getPatchPaths(resp) {
+				Expect(path).To(Or(
+					HavePrefix("/spec/template/spec/containers"),
+					HavePrefix("/spec/template/spec/volumes"),
+					HavePrefix("/spec/template/metadata/annotations"),
+					Equal("/metadata/annotations"),
+				))
+			}
+			Expect(getPatchPaths(resp)).To(ContainElement("/spec/template/spec/containers/1"))
+		})
+	})
+
+	When("configured custom resource does not contain Pod template at configured path", func() {
+		rollout := map[string]interface{}{
+			"apiVersion": "argoproj.io/v1alpha1",
+			"kind":       "Rollout",
+			"metadata": map[string]interface{}{
+				"name":      "rollout",
+				"namespace": "default",
+			},
+			"spec": map[string]interface{}{
+				"workloadRef": map[string]interface{}{
+					"kind": "Deployment",
+					"name": "deployment",
+				},
+			},
+		}
+
+		resp := workloadExtender.Handle(context.Background(), newRequest(admv1.Create, metav1.GroupVersionKind{Group: "argoproj.io", Version: "v1alpha1", Kind: "Rollout"}, rollout))
+
+		It("rejects request", func() {
+			Expect(resp.Allowed).To(BeFalse())
+		})
+	})
+
+	When("not configured custom resource is created", func() {
+		resp := workloadExtender.Handle(context.Background(), newRequest(admv1.Create, metav1.GroupVersionKind{Group: "apps.kruise.io", Version: "v1alpha1", Kind: "CloneSet"}, map[string]interface{}{}))
+
+		It("returns empty patch", func() {
+			Expect(resp.Allowed).To(BeTrue())
+			Expect(resp.Patches).To(BeEmpty())
+		})
+	})
+
+	When("CronJob without tailing sidecar configuration is created", func() {
+		cronJob := &batchv1.CronJob{
+			TypeMeta:   metav1.TypeMeta{APIVersion: "batch/v1", Kind: "CronJob"},
+			ObjectMeta: metav1.ObjectMeta{Name: "cronjob", Namespace: "default"},
+			Spec: batchv1.CronJobSpec{
+				JobTemplate: batchv1.JobTemplateSpec{
+					Spec: batchv1.JobSpec{
+						Template: corev1.PodTemplateSpec{Spec: *template.Spec.DeepCopy()},
+					},
+				},
+			},
+		}
+
+		resp := workloadExtender.Handle(context.Background(), newRequest(admv1.Create, metav1.GroupVersionKind{Group: "batch", Version: "v1", Kind: "CronJob"}, cronJob))
+
+		It("returns empty patch", func() {
+			Expect(resp.Allowed).To(BeTrue())
+			Expect(resp.Patches).To(BeEmpty())
+		})
+	})
+
+	When("Job is updated", func() {
+		job := &batchv1.Job{
+			TypeMeta:   metav1.TypeMeta{APIVersion: "batch/v1", Kind: "Job"},
+			ObjectMeta: metav1.ObjectMeta{Name: "job", Namespace: "default"},
+			Spec:       batchv1.JobSpec{Template: *template.DeepCopy()},
+		}
+
+		resp := workloadExtender.Handle(context.Background(), newRequest(admv1.Update, metav1.GroupVersionKind{Group: "batch", Version: "v1", Kind: "Job"}, job))
+
+		It("returns empty patch as Pod template of Job is immutable", func() {
+			Expect(resp.Allowed).To(BeTrue())
+			Expect(resp.Patches).To(BeEmpty())
+		})
+	})
+
+	Context("isInjectedInTemplate", func() {
+		sidecar := corev1.Container{
+			Name: "tailing-sidecar-0",
+			Env: []corev1.EnvVar{
+				{Name: sidecarEnvMarker, Value: sidecarEnvMarkerVal},
+			},
+		}
+
+		It("returns true when all injected tailing sidecars are available", func() {
+			pod := &corev1.Pod{
+				ObjectMeta: metav1.ObjectMeta{
+					Annotations: map[string]string{injectedSidecarsAnnotation: "tailing-sidecar-0"},
+				},
+				Spec: corev1.PodSpec{Containers: []corev1.Container{sidecar}},
+			}
+			Expect(isInjectedInTemplate(pod)).To(BeTrue())
+		})
+
+		It("returns false when injected tailing sidecar is missing", func() {
+			pod := &corev1.Pod{
+				ObjectMeta: metav1.ObjectMeta{
+					Annotations: map[string]string{injectedSidecarsAnnotation: "tailing-sidecar-0,tailing-sidecar-1"},
+				},
+				Spec: corev1.PodSpec{Containers: []corev1.Container{sidecar}},
+			}
+			Expect(isInjectedInTemplate(pod)).To(BeFalse())
+		})
+
+		It("returns false when Pod does not have injected sidecars annotation", func() {
+			pod := &corev1.Pod{
+				Spec: corev1.PodSpec{Containers: []corev1.Container{sidecar}},
+			}
+			Expect(isInjectedInTemplate(pod)).To(BeFalse())
+		})
+	})
+})
@@ -0,0 +1,201 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package introspection provides read-only HTTP API describing state of tailing sidecar operator.
+// It is served by metrics server, so it is protected in the same way as metrics, e.g. by kube-rbac-proxy.
+package introspection
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+
+	tailingsidecarv1 "github.com/SumoLogic/tailing-sidecar/operator/api/v1"
+	"github.com/SumoLogic/tailing-sidecar/operator/handler"
+	"gomodules.xyz/jsonpatch/v2"
+	admv1 "k8s.io/api/admission/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/uuid"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+)
+
+const (
+	// PathPrefix is a prefix of paths of all endpoints of introspection API
+	PathPrefix = "/debug/tailing-sidecar/"
+
+	// maxPodSize limits size of Pod sent to dry-run endpoint
+	maxPodSize = 3 * 1024 * 1024
+)
+
+// Handler serves introspection API
+type Handler struct {
+	// Config is the effective configuration of operator
+	Config any
+	// Client reads TailingSidecarConfigs from cache of manager
+	Client client.Reader
+	// PodExtender is used to handle dry-run requests and provides decision log
+	PodExtender *handler.PodExtender
+}
+
+// TailingSidecarConfig describes TailingSidecarConfig known to operator with its compiled podSelector
+type TailingSidecarConfig struct {
+	Namespace       string                                    `json:"namespace"`
+	Name            string                                    `json:"name"`
+	ResourceVersion string                                    `json:"resourceVersion"`
+	Selector        string                                    `json:"selector"`
+	SelectorError   string                                    `json:"selectorError,omitempty"`
+	Spec            tailingsidecarv1.TailingSidecarConfigSpec `json:"spec"`
+}
+
+// DryRunResult describes response of webhook for Pod sent to dry-run endpoint
+type DryRunResult struct {
+	Allowed bool                           `json:"allowed"`
+	Message string                         `json:"message,omitempty"`
+	Patch   []jsonpatch.JsonPatchOperation `json:"patch"`
+}
+
+// ServeHTTP serves endpoints of introspection API
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch r.URL.Path {
+	case PathPrefix + "config":
+		h.serveRead(w, r, h.getConfig)
+	case PathPrefix + "tailingsidecarconfigs":
+		h.serveRead(w, r, h.getTailingSidecarConfigs)
+	case PathPrefix + "decisions":
+		h.serveRead(w, r, h.getDecisions)
+	case PathPrefix + "dry-run":
+		h.serveDryRun(w, r)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// serveRead serves read-only endpoint
+func (h *Handler) serveRead(w http.ResponseWriter, r *http.Request, get func(r *http.Request) (any, error)) {
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", http.MethodGet)
+		http.Error(w, fmt.Sprintf("method %s is not allowed", r.Method), http.StatusMethodNotAllowed)
+		return
+	}
+	result, err := get(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, result)
+}
+
+func (h *Handler) getConfig(_ *http.Request) (any, error) {
+	return h.Config, nil
+}
+
+func (h *Handler) getTailingSidecarConfigs(r *http.Request) (any, error) {
+	tailingSidecarConfigList := &tailingsidecarv1.TailingSidecarConfigList{}
+	if err := h.Client.List(r.Context(), tailingSidecarConfigList); err != nil {
+		return nil, err
+	}
+
+	tailingSidecarConfigs := make([]TailingSidecarConfig, 0, len(tailingSidecarConfigList.Items))
+	for _, tailingSidecarConfig := range tailingSidecarConfigList.Items {
+		result := TailingSidecarConfig{
+			Namespace:       tailingSidecarConfig.Namespace,
+			Name:            tailingSidecarConfig.Name,
+			ResourceVersion: tailingSidecarConfig.ResourceVersion,
+			Spec:            tailingSidecarConfig.Spec,
+		}
+		if tailingSidecarConfig.Spec.PodSelector != nil {
+			selector, err := metav1.LabelSelectorAsSelector(tailingSidecarConfig.Spec.PodSelector)
+			if err != nil {
+				result.SelectorError = err.Error()
+			} else {
+				result.Selector = selector.String()
+			}
+		}
+		tailingSidecarConfigs = append(tailingSidecarConfigs, result)
+	}
+	return tailingSidecarConfigs, nil
+}
+
+func (h *Handler) getDecisions(_ *http.Request) (any, error) {
+	decisions := h.PodExtender.Decisions.List()
+	if decisions == nil {
+		decisions = []handler.Decision{}
+	}
+	return decisions, nil
+}
+
+// serveDryRun returns JSON patch which webhook would return for Pod sent in request body,
+// webhook handles it as dry-run request, so it does not create any objects
+func (h *Handler) serveDryRun(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, fmt.Sprintf("method %s is not allowed", r.Method), http.StatusMethodNotAllowed)
+		return
+	}
+
+	raw, err := io.ReadAll(io.LimitReader(r.Body, maxPodSize))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	pod := &corev1.Pod{}
+	if err := json.Unmarshal(raw, pod); err != nil {
+		http.Error(w, fmt.Sprintf("cannot decode Pod: %v", err), http.StatusBadRequest)
+		return
+	}
+	if pod.Namespace == "" {
+		pod.Namespace = metav1.NamespaceDefault
+	}
+
+	dryRun := true
+	req := admission.Request{AdmissionRequest: admv1.AdmissionRequest{
+		UID:       uuid.NewUUID(),
+		Kind:      metav1.GroupVersionKind{Version: "v1", Kind: "Pod"},
+		Resource:  metav1.GroupVersionResource{Version: "v1", Resource: "pods"},
+		Name:      pod.Name,
+		Namespace: pod.Namespace,
+		Operation: admv1.Create,
+		Object:    runtime.RawExtension{Raw: raw},
+		DryRun:    &dryRun,
+	}}
+	resp := h.PodExtender.Handle(r.Context(), req)
+
+	result := DryRunResult{
+		Allowed: resp.Allowed,
+		Patch:   resp.Patches,
+	}
+	if result.Patch == nil {
+		result.Patch = []jsonpatch.JsonPatchOperation{}
+	}
+	if resp.Result != nil {
+		result.Message = resp.Result.Message
+	}
+	writeJSON(w, result)
+}
+
+func writeJSON(w http.ResponseWriter, value any) {
+	content, err := json.MarshalIndent(value, "", "  ")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_, _ = w.Write(content)
+}
@@ -0,0 +1,146 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package introspection
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	tailingsidecarv1 "github.com/SumoLogic/tailing-sidecar/operator/api/v1"
+	"github.com/SumoLogic/tailing-sidecar/operator/handler"
+	"github.com/stretchr/testify/require"
+	admv1 "k8s.io/api/admission/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+)
+
+func newHandler(t *testing.T) *Handler {
+	scheme := runtime.NewScheme()
+	require.NoError(t, clientgoscheme.AddToScheme(scheme))
+	require.NoError(t, tailingsidecarv1.AddToScheme(scheme))
+
+	tailingSidecarConfig := &tailingsidecarv1.TailingSidecarConfig{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "tsc"},
+		Spec: tailingsidecarv1.TailingSidecarConfigSpec{
+			PodSelector: &metav1.LabelSelector{MatchLabels: map[string]string{"app": "nginx"}},
+			SidecarSpecs: map[string]tailingsidecarv1.SidecarSpec{
+				"sidecar": {Path: "/var/log/nginx.log", VolumeMount: corev1.VolumeMount{Name: "varlog", MountPath: "/var/log"}},
+			},
+		},
+	}
+	fakeClient := fake.NewClientBuilder().WithScheme(scheme).WithObjects(tailingSidecarConfig).Build()
+
+	return &Handler{
+		Config: map[string]string{"naming": handler.NamingIndex},
+		Client: fakeClient,
+		PodExtender: &handler.PodExtender{
+			Client:              fakeClient,
+			Decoder:             admission.NewDecoder(scheme),
+			TailingSidecarImage: "sumologic/tailing-sidecar:latest",
+			Decisions:           handler.NewDecisionLog(10),
+		},
+	}
+}
+
+func serve(h *Handler, method string, path string, body string) *httptest.ResponseRecorder {
+	recorder := httptest.NewRecorder()
+	h.ServeHTTP(recorder, httptest.NewRequest(method, path, strings.NewReader(body)))
+	return recorder
+}
+
+func TestConfig(t *testing.T) {
+	h := newHandler(t)
+
+	recorder := serve(h, http.MethodGet, PathPrefix+"config", "")
+	require.Equal(t, http.StatusOK, recorder.Code)
+	require.JSONEq(t, `{"naming": "index"}`, recorder.Body.String())
+
+	recorder = serve(h, http.MethodPost, PathPrefix+"config", "")
+	require.Equal(t, http.StatusMethodNotAllowed, recorder.Code)
+}
+
+func TestTailingSidecarConfigs(t *testing.T) {
+	h := newHandler(t)
+
+	recorder := serve(h, http.MethodGet, PathPrefix+"tailingsidecarconfigs", "")
+	require.Equal(t, http.StatusOK, recorder.Code)
+
+	tailingSidecarConfigs := []TailingSidecarConfig{}
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &tailingSidecarConfigs))
+	require.Len(t, tailingSidecarConfigs, 1)
+	require.Equal(t, "tsc", tailingSidecarConfigs[0].Name)
+	require.Equal(t, "app=nginx", tailingSidecarConfigs[0].Selector)
+	require.NotEmpty(t, tailingSidecarConfigs[0].ResourceVersion)
+}
+
+func TestDryRunAndDecisions(t *testing.T) {
+	h := newHandler(t)
+
+	pod := `{
+		"metadata": {"name": "nginx", "labels": {"app": "nginx"}},
+		"spec": {"containers": [{"name": "nginx", "image": "nginx", "volumeMounts": [{"name": "varlog", "mountPath": "/var/log"}]}]}
+	}`
+	recorder := serve(h, http.MethodPost, PathPrefix+"dry-run", pod)
+	require.Equal(t, http.StatusOK, recorder.Code)
+
+	result := DryRunResult{}
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &result))
+	require.True(t, result.Allowed)
+	require.NotEmpty(t, result.Patch)
+
+	// dry-run requests are not recorded
+	recorder = serve(h, http.MethodGet, PathPrefix+"decisions", "")
+	require.Equal(t, http.StatusOK, recorder.Code)
+	require.JSONEq(t, `[]`, recorder.Body.String())
+
+	req := admission.Request{AdmissionRequest: admv1.AdmissionRequest{
+		Name:      "nginx",
+		Namespace: "default",
+		Kind:      metav1.GroupVersionKind{Version: "v1", Kind: "Pod"},
+		Operation: admv1.Create,
+		Object:    runtime.RawExtension{Raw: []byte(pod)},
+	}}
+	resp := h.PodExtender.Handle(context.Background(), req)
+	require.True(t, resp.Allowed)
+
+	recorder = serve(h, http.MethodGet, PathPrefix+"decisions", "")
+	require.Equal(t, http.StatusOK, recorder.Code)
+	decisions := []handler.Decision{}
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &decisions))
+	require.Len(t, decisions, 1)
+	require.Equal(t, "nginx", decisions[0].Name)
+	require.Equal(t, []string{"sidecar"}, decisions[0].Added)
+
+	recorder = serve(h, http.MethodGet, PathPrefix+"dry-run", "")
+	require.Equal(t, http.StatusMethodNotAllowed, recorder.Code)
+
+	recorder = serve(h, http.MethodPost, PathPrefix+"dry-run", "not a pod")
+	require.Equal(t, http.StatusBadRequest, recorder.Code)
+}
+
+func TestNotFound(t *testing.T) {
+	recorder := serve(newHandler(t), http.MethodGet, PathPrefix+"unknown", "")
+	require.Equal(t, http.StatusNotFound, recorder.Code)
+}
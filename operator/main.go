@@ -17,10 +17,16 @@ limitations under the License.
 package main
 
 import (
+	"context"
+	"crypto/tls"
 	"flag"
+	"fmt"
 	"os"
 	"time"
 
+	authenticationv1 "k8s.io/api/authentication/v1"
+	corev1 "k8s.io/api/core/v1"
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
 	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
@@ -31,28 +37,44 @@ import (
 	metricsserver "sigs.k8s.io/controller-runtime/pkg/metrics/server"
 	"sigs.k8s.io/controller-runtime/pkg/webhook"
 	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/conversion"
 
 	tailingsidecarv1 "github.com/SumoLogic/tailing-sidecar/operator/api/v1"
+	tailingsidecarv2 "github.com/SumoLogic/tailing-sidecar/operator/api/v2"
+	"github.com/SumoLogic/tailing-sidecar/operator/certs"
 	"github.com/SumoLogic/tailing-sidecar/operator/controllers"
 	"github.com/SumoLogic/tailing-sidecar/operator/handler"
+	"github.com/SumoLogic/tailing-sidecar/operator/introspection"
+	"github.com/SumoLogic/tailing-sidecar/operator/readiness"
 	// +kubebuilder:scaffold:imports
 )
 
-const WebhookPort = 9443
-
 var (
 	scheme   = runtime.NewScheme()
 	setupLog = ctrl.Log.WithName("setup")
+	// version is set during build using -ldflags "-X main.version=<version>"
+	version = "dev"
 )
 
 func init() {
 	utilruntime.Must(clientgoscheme.AddToScheme(scheme))
 
+	utilruntime.Must(apiextensionsv1.AddToScheme(scheme))
+
 	utilruntime.Must(tailingsidecarv1.AddToScheme(scheme))
+	utilruntime.Must(tailingsidecarv2.AddToScheme(scheme))
 	// +kubebuilder:scaffold:scheme
 }
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == renderCommand {
+		if err := runRender(os.Args[2:], os.Stdin, os.Stdout); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		return
+	}
+
 	var metricsAddr string
 	var healthAddr string
 	var enableLeaderElection bool
@@ -107,35 +129,183 @@ func main() {
 		os.Exit(1)
 	}
 
+	var missedInjectionDetector *controllers.MissedInjectionDetector
+	if config.MissedInjection.Enabled {
+		missedInjectionDetector = &controllers.MissedInjectionDetector{
+			Client:                           mgr.GetClient(),
+			MutatingWebhookConfigurationName: config.MissedInjection.MutatingWebhookConfigurationName,
+			WebhookName:                      config.MissedInjection.WebhookName,
+		}
+	}
 	if err = (&controllers.TailingSidecarConfigReconciler{
-		Client: mgr.GetClient(),
-		Log:    ctrl.Log.WithName("controllers").WithName("TailingSidecarConfig"),
-		Scheme: mgr.GetScheme(),
+		Client:                  mgr.GetClient(),
+		Log:                     ctrl.Log.WithName("controllers").WithName("TailingSidecarConfig"),
+		Scheme:                  mgr.GetScheme(),
+		MissedInjectionDetector: missedInjectionDetector,
+		InPlaceResize:           config.InPlaceResize.Enabled,
 	}).SetupWithManager(mgr); err != nil {
 		setupLog.Error(err, "unable to create controller", "controller", "TailingSidecarConfig")
 		os.Exit(1)
 	}
 	// +kubebuilder:scaffold:builder
+	if err = handler.SetupIndexes(context.Background(), mgr.GetFieldIndexer()); err != nil {
+		setupLog.Error(err, "unable to set up field indexes")
+		os.Exit(1)
+	}
 	decoder := admission.NewDecoder(mgr.GetScheme())
-	webhookServer := webhook.NewServer(webhook.Options{
-		Port: WebhookPort,
-	})
+	webhookOptions, err := config.Webhook.Options()
+	if err != nil {
+		setupLog.Error(err, "invalid webhook configuration")
+		os.Exit(1)
+	}
+	if config.Certificates.Enabled {
+		certManager := &certs.Manager{
+			Client:                           mgr.GetClient(),
+			Reader:                           mgr.GetAPIReader(),
+			Log:                              ctrl.Log.WithName("certs"),
+			Namespace:                        config.Certificates.Namespace,
+			SecretName:                       config.Certificates.SecretName,
+			ServiceName:                      config.Certificates.ServiceName,
+			MutatingWebhookConfigurationName: config.Certificates.MutatingWebhookConfigurationName,
+			CustomResourceDefinitionNames:    []string{controllers.TailingSidecarConfigCRDName},
+			Validity:                         time.Duration(config.Certificates.Validity),
+			RotateBefore:                     time.Duration(config.Certificates.RotateBefore),
+		}
+		if err = mgr.Add(certManager); err != nil {
+			setupLog.Error(err, "unable to set up webhook certificates")
+			os.Exit(1)
+		}
+		// webhook server uses certificate from memory, so rotated certificate is served without restart
+		webhookOptions.TLSOpts = append(webhookOptions.TLSOpts, func(c *tls.Config) {
+			c.GetCertificate = certManager.GetCertificate
+		})
+	}
+	webhookServer := webhook.NewServer(webhookOptions)
+	podExtender := &handler.PodExtender{
+		Client:                  mgr.GetClient(),
+		Decoder:                 decoder,
+		TailingSidecarImage:     config.Sidecar.Image,
+		TailingSidecarResources: config.Sidecar.Resources,
+		TailingSidecarVolumes:   config.Sidecar.Volumes,
+		TailingSidecarNaming:    config.Sidecar.Naming,
+		ConfigMapName:           config.Sidecar.Config.Name,
+		ConfigMountPath:         config.Sidecar.Config.MountPath,
+		ConfigMapNamespace:      config.Sidecar.Config.Namespace,
+		OperatorVersion:         version,
+	}
+	if config.InPlaceResize.Enabled {
+		// webhook changes tailing sidecars only in resize requests sent by the operator
+		review := &authenticationv1.SelfSubjectReview{}
+		if err = mgr.GetClient().Create(context.Background(), review); err != nil {
+			setupLog.Error(err, "unable to get user of the operator")
+			os.Exit(1)
+		}
+		podExtender.OperatorUsername = review.Status.UserInfo.Username
+	}
+	if config.Introspection.Enabled {
+		podExtender.Decisions = handler.NewDecisionLog(config.Introspection.Decisions)
+		if err = mgr.AddMetricsServerExtraHandler(introspection.PathPrefix, &introspection.Handler{
+			Config:      config,
+			Client:      mgr.GetClient(),
+			PodExtender: podExtender,
+		}); err != nil {
+			setupLog.Error(err, "unable to set up introspection API")
+			os.Exit(1)
+		}
+	}
+	if err = (&controllers.TailingSessionReconciler{
+		Client:      mgr.GetClient(),
+		Log:         ctrl.Log.WithName("controllers").WithName("TailingSession"),
+		Scheme:      mgr.GetScheme(),
+		PodExtender: podExtender,
+	}).SetupWithManager(mgr); err != nil {
+		setupLog.Error(err, "unable to create controller", "controller", "TailingSession")
+		os.Exit(1)
+	}
+	if err = (&controllers.PodSessionReconciler{
+		Client: mgr.GetClient(),
+		Log:    ctrl.Log.WithName("controllers").WithName("PodSession"),
+		Scheme: mgr.GetScheme(),
+	}).SetupWithManager(mgr); err != nil {
+		setupLog.Error(err, "unable to create controller", "controller", "PodSession")
+		os.Exit(1)
+	}
+	if config.MissedInjection.Enabled {
+		if err = (&controllers.MissedInjectionReconciler{
+			Client:      mgr.GetClient(),
+			Log:         ctrl.Log.WithName("controllers").WithName("MissedInjection"),
+			Recorder:    mgr.GetEventRecorder("tailing-sidecar-operator"),
+			Detector:    missedInjectionDetector,
+			Remediation: config.MissedInjection.Remediation,
+			MinPodAge:   time.Duration(config.MissedInjection.MinPodAge),
+		}).SetupWithManager(mgr); err != nil {
+			setupLog.Error(err, "unable to create controller", "controller", "MissedInjection")
+			os.Exit(1)
+		}
+	}
+	if config.InPlaceResize.Enabled {
+		if err = (&controllers.SidecarResizeReconciler{
+			Client:      mgr.GetClient(),
+			Log:         ctrl.Log.WithName("controllers").WithName("SidecarResize"),
+			PodExtender: podExtender,
+		}).SetupWithManager(mgr); err != nil {
+			setupLog.Error(err, "unable to create controller", "controller", "SidecarResize")
+			os.Exit(1)
+		}
+	}
+	if config.WebhookSelectors.Enabled {
+		if err = (&controllers.WebhookSelectorReconciler{
+			Client:                           mgr.GetClient(),
+			Log:                              ctrl.Log.WithName("controllers").WithName("WebhookSelector"),
+			MutatingWebhookConfigurationName: config.WebhookSelectors.MutatingWebhookConfigurationName,
+			WebhookName:                      config.WebhookSelectors.WebhookName,
+			OptInLabel:                       config.WebhookSelectors.OptInLabel,
+			Reader:                           mgr.GetAPIReader(),
+		}).SetupWithManager(mgr); err != nil {
+			setupLog.Error(err, "unable to create controller", "controller", "WebhookSelector")
+			os.Exit(1)
+		}
+	}
+	// TailingSidecarConfigs are converted between API versions through v1
+	webhookServer.Register("/convert", conversion.NewWebhookHandler(mgr.GetScheme(), conversion.NewRegistry()))
+	if err = mgr.Add(&controllers.StorageVersionMigrator{
+		Client: mgr.GetClient(),
+		Reader: mgr.GetAPIReader(),
+		Log:    ctrl.Log.WithName("controllers").WithName("StorageVersionMigrator"),
+	}); err != nil {
+		setupLog.Error(err, "unable to set up storage version migration")
+		os.Exit(1)
+	}
 	webhookServer.Register("/add-tailing-sidecars-v1-pod", &webhook.Admission{
-		Handler: &handler.PodExtender{
-			Client:                  mgr.GetClient(),
-			Decoder:                 decoder,
-			TailingSidecarImage:     config.Sidecar.Image,
-			TailingSidecarResources: config.Sidecar.Resources,
-			ConfigMapName:           config.Sidecar.Config.Name,
-			ConfigMountPath:         config.Sidecar.Config.MountPath,
-			ConfigMapNamespace:      config.Sidecar.Config.Namespace,
-		},
+		Handler: podExtender,
 	})
+	if config.WorkloadTemplates.Enabled {
+		webhookServer.Register("/add-tailing-sidecars-v1-workload", &webhook.Admission{
+			Handler: &handler.WorkloadExtender{
+				PodExtender:       podExtender,
+				WorkloadTemplates: config.WorkloadTemplates.Workloads,
+			},
+		})
+	}
 	mgr.Add(webhookServer)
 
-	if err = mgr.AddReadyzCheck("readyz", webhookServer.StartedChecker()); err != nil {
-		setupLog.Error(err, "unable to set up readiness check")
-		os.Exit(1)
+	// webhook is ready when it is able to find configurations for admitted objects in cache,
+	// each check is reported separately in /readyz?verbose,
+	// cache of TailingSidecarConfigs reads the storage version, so it does not wait for conversion webhook of the operator
+	readinessLog := ctrl.Log.WithName("readiness")
+	readinessChecks := map[string]healthz.Checker{
+		"webhook":                     webhookServer.StartedChecker(),
+		"tailingsidecarconfigs-crd":   readiness.CustomResourceDefinitionEstablished(mgr.GetAPIReader(), controllers.TailingSidecarConfigCRDName, readinessLog),
+		"tailingsidecarconfigs-cache": readiness.InformerSynced(mgr.GetCache(), &tailingsidecarv1.TailingSidecarConfig{}, readinessLog),
+	}
+	if config.Sidecar.Config.Name != "" && config.Sidecar.Config.MountPath != "" && config.Sidecar.Config.Namespace != "" {
+		readinessChecks["configmaps-cache"] = readiness.InformerSynced(mgr.GetCache(), &corev1.ConfigMap{}, readinessLog)
+	}
+	for name, check := range readinessChecks {
+		if err = mgr.AddReadyzCheck(name, check); err != nil {
+			setupLog.Error(err, "unable to set up readiness check", "check", name)
+			os.Exit(1)
+		}
 	}
 
 	if err = mgr.AddHealthzCheck("healthz", healthz.Ping); err != nil {
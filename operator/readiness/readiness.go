@@ -0,0 +1,74 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package readiness provides readiness checks of the operator, webhook should not receive admission requests
+// before the operator is able to find configurations for admitted objects
+package readiness
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/go-logr/logr"
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/cache"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/healthz"
+)
+
+// InformerSynced returns check which fails until informer for objects of the given type is synced,
+// until then objects listed from cache may be missing
+func InformerSynced(c cache.Informers, obj client.Object, log logr.Logger) healthz.Checker {
+	return logFailure(func(req *http.Request) error {
+		informer, err := c.GetInformer(req.Context(), obj, cache.BlockUntilSynced(false))
+		if err != nil {
+			return fmt.Errorf("cannot get informer for %T: %w", obj, err)
+		}
+		if !informer.HasSynced() {
+			return fmt.Errorf("informer for %T has not synced yet", obj)
+		}
+		return nil
+	}, log)
+}
+
+// CustomResourceDefinitionEstablished returns check which fails when CustomResourceDefinition is not present
+// or it is not established yet
+func CustomResourceDefinitionEstablished(reader client.Reader, name string, log logr.Logger) healthz.Checker {
+	return logFailure(func(req *http.Request) error {
+		crd := &apiextensionsv1.CustomResourceDefinition{}
+		if err := reader.Get(req.Context(), types.NamespacedName{Name: name}, crd); err != nil {
+			return fmt.Errorf("cannot get CustomResourceDefinition %s: %w", name, err)
+		}
+		for _, condition := range crd.Status.Conditions {
+			if condition.Type == apiextensionsv1.Established && condition.Status == apiextensionsv1.ConditionTrue {
+				return nil
+			}
+		}
+		return fmt.Errorf("CustomResourceDefinition %s is not established", name)
+	}, log)
+}
+
+// logFailure logs reason of failed check, because reasons are not included in responses of readiness endpoint
+func logFailure(check healthz.Checker, log logr.Logger) healthz.Checker {
+	return func(req *http.Request) error {
+		err := check(req)
+		if err != nil {
+			log.Info("Readiness check failed", "reason", err.Error())
+		}
+		return err
+	}
+}
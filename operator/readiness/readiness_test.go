@@ -0,0 +1,113 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package readiness
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-logr/logr"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	toolscache "k8s.io/client-go/tools/cache"
+	"sigs.k8s.io/controller-runtime/pkg/cache/informertest"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllertest"
+
+	tailingsidecarv1 "github.com/SumoLogic/tailing-sidecar/operator/api/v1"
+)
+
+const crdName = "tailingsidecarconfigs.tailing-sidecar.sumologic.com"
+
+func newRequest() *http.Request {
+	return httptest.NewRequest(http.MethodGet, "/readyz", nil)
+}
+
+func TestInformerSynced(t *testing.T) {
+	scheme := runtime.NewScheme()
+	require.NoError(t, tailingsidecarv1.AddToScheme(scheme))
+	require.NoError(t, corev1.AddToScheme(scheme))
+	tailingSidecarConfigInformer := controllertest.NewFakeInformer()
+	informers := &informertest.FakeInformers{
+		Scheme: scheme,
+		InformersByGVK: map[schema.GroupVersionKind]toolscache.SharedIndexInformer{
+			tailingsidecarv1.GroupVersion.WithKind("TailingSidecarConfig"): tailingSidecarConfigInformer,
+		},
+	}
+
+	require.Error(t, InformerSynced(informers, &tailingsidecarv1.TailingSidecarConfig{}, logr.Discard())(newRequest()))
+	require.NoError(t, InformerSynced(informers, &corev1.ConfigMap{}, logr.Discard())(newRequest()))
+
+	tailingSidecarConfigInformer.Synced()
+	require.NoError(t, InformerSynced(informers, &tailingsidecarv1.TailingSidecarConfig{}, logr.Discard())(newRequest()))
+}
+
+func TestCustomResourceDefinitionEstablished(t *testing.T) {
+	scheme := runtime.NewScheme()
+	require.NoError(t, apiextensionsv1.AddToScheme(scheme))
+
+	testCases := []struct {
+		name          string
+		conditions    []apiextensionsv1.CustomResourceDefinitionCondition
+		missing       bool
+		expectedError bool
+	}{
+		{
+			name: "established",
+			conditions: []apiextensionsv1.CustomResourceDefinitionCondition{
+				{Type: apiextensionsv1.NamesAccepted, Status: apiextensionsv1.ConditionTrue},
+				{Type: apiextensionsv1.Established, Status: apiextensionsv1.ConditionTrue},
+			},
+		},
+		{
+			name: "not established",
+			conditions: []apiextensionsv1.CustomResourceDefinitionCondition{
+				{Type: apiextensionsv1.Established, Status: apiextensionsv1.ConditionFalse},
+			},
+			expectedError: true,
+		},
+		{
+			name:          "missing",
+			missing:       true,
+			expectedError: true,
+		},
+	}
+
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			builder := fake.NewClientBuilder().WithScheme(scheme)
+			if !tt.missing {
+				builder = builder.WithObjects(&apiextensionsv1.CustomResourceDefinition{
+					ObjectMeta: metav1.ObjectMeta{Name: crdName},
+					Status:     apiextensionsv1.CustomResourceDefinitionStatus{Conditions: tt.conditions},
+				})
+			}
+
+			err := CustomResourceDefinitionEstablished(builder.Build(), crdName, logr.Discard())(newRequest())
+			if tt.expectedError {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+		})
+	}
+}
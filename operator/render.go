@@ -0,0 +1,171 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/log/zap"
+	"sigs.k8s.io/yaml"
+
+	tailingsidecarv1 "github.com/SumoLogic/tailing-sidecar/operator/api/v1"
+	"github.com/SumoLogic/tailing-sidecar/operator/handler"
+	"github.com/SumoLogic/tailing-sidecar/operator/render"
+)
+
+const renderCommand = "render"
+
+// stringsFlag is a flag which can be provided multiple times
+type stringsFlag []string
+
+func (f *stringsFlag) String() string {
+	return strings.Join(*f, ",")
+}
+
+func (f *stringsFlag) Set(value string) error {
+	*f = append(*f, value)
+	return nil
+}
+
+// runRender injects tailing sidecars into manifests read from files or standard input and writes them to standard output,
+// it works also as KRM function when ResourceList is provided on standard input and as Helm post-renderer
+func runRender(args []string, stdin io.Reader, stdout io.Writer) error {
+	var configPath string
+	var namespace string
+	var tailingSidecarConfigPaths stringsFlag
+
+	flags := flag.NewFlagSet(renderCommand, flag.ContinueOnError)
+	flags.StringVar(&configPath, "config", "", "Path to the configuration file")
+	flags.StringVar(&namespace, "namespace", "default", "Namespace used for objects without namespace")
+	flags.Var(&tailingSidecarConfigPaths, "tailing-sidecar-config", "Path to the file with TailingSidecarConfigs, can be provided multiple times")
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: %s %s [flags] [manifest files]\n", os.Args[0], renderCommand)
+		fmt.Fprintln(flags.Output(), "Manifests are read from standard input when no files are provided.")
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	ctrl.SetLogger(zap.New(zap.WriteTo(os.Stderr)))
+
+	input, err := readManifests(flags.Args(), stdin)
+	if err != nil {
+		return err
+	}
+
+	config := GetDefaultConfig()
+	if configPath != "" {
+		if err := ReadConfig(configPath, &config); err != nil {
+			return fmt.Errorf("unable to read configuration: %w", err)
+		}
+	}
+	if functionConfig := input.FunctionConfig(); functionConfig != "" {
+		if err := yaml.Unmarshal([]byte(functionConfig), &config); err != nil {
+			return fmt.Errorf("unable to read configuration from functionConfig: %w", err)
+		}
+	}
+	if err := config.Validate(); err != nil {
+		return err
+	}
+
+	tailingSidecarConfigs, err := readTailingSidecarConfigs(tailingSidecarConfigPaths)
+	if err != nil {
+		return err
+	}
+
+	renderer := &render.Renderer{
+		PodExtender: handler.PodExtender{
+			TailingSidecarImage:     config.Sidecar.Image,
+			TailingSidecarResources: config.Sidecar.Resources,
+			TailingSidecarVolumes:   config.Sidecar.Volumes,
+			TailingSidecarNaming:    config.Sidecar.Naming,
+			ConfigMapName:           config.Sidecar.Config.Name,
+			ConfigMountPath:         config.Sidecar.Config.MountPath,
+			ConfigMapNamespace:      config.Sidecar.Config.Namespace,
+			OperatorVersion:         version,
+		},
+		WorkloadTemplates:     config.WorkloadTemplates.Workloads,
+		TailingSidecarConfigs: tailingSidecarConfigs,
+		Namespace:             namespace,
+	}
+
+	rendered, err := renderer.Render(context.Background(), input.Objects)
+	if err != nil {
+		return err
+	}
+	return render.Write(stdout, input, rendered)
+}
+
+// readManifests reads manifests from files, or from standard input when no files are provided
+func readManifests(paths []string, stdin io.Reader) (render.Input, error) {
+	if len(paths) == 0 || (len(paths) == 1 && paths[0] == "-") {
+		return render.Read(stdin)
+	}
+
+	input := render.Input{}
+	for _, path := range paths {
+		objects, err := readObjects(path)
+		if err != nil {
+			return render.Input{}, err
+		}
+		input.Objects = append(input.Objects, objects...)
+	}
+	return input, nil
+}
+
+// readTailingSidecarConfigs reads TailingSidecarConfigs from files, other objects are ignored
+func readTailingSidecarConfigs(paths []string) ([]tailingsidecarv1.TailingSidecarConfig, error) {
+	tailingSidecarConfigs := make([]tailingsidecarv1.TailingSidecarConfig, 0)
+	for _, path := range paths {
+		objects, err := readObjects(path)
+		if err != nil {
+			return nil, err
+		}
+		for _, object := range objects {
+			tailingSidecarConfig, ok, err := render.ConvertTailingSidecarConfig(object)
+			if err != nil {
+				return nil, fmt.Errorf("invalid TailingSidecarConfig in %s: %w", path, err)
+			}
+			if ok {
+				tailingSidecarConfigs = append(tailingSidecarConfigs, *tailingSidecarConfig)
+			}
+		}
+	}
+	return tailingSidecarConfigs, nil
+}
+
+func readObjects(path string) ([]*unstructured.Unstructured, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	input, err := render.Read(file)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read manifests from %s: %w", path, err)
+	}
+	return input.Objects, nil
+}
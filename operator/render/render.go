@@ -0,0 +1,368 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package render injects tailing sidecars into Kubernetes manifests without access to Kubernetes API,
+// using the same code as admission webhooks of tailing sidecar operator.
+package render
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+
+	tailingsidecarv1 "github.com/SumoLogic/tailing-sidecar/operator/api/v1"
+	tailingsidecarv2 "github.com/SumoLogic/tailing-sidecar/operator/api/v2"
+	"github.com/SumoLogic/tailing-sidecar/operator/handler"
+	jsonpatch "github.com/evanphx/json-patch/v5"
+	admv1 "k8s.io/api/admission/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	utilyaml "k8s.io/apimachinery/pkg/util/yaml"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+	"sigs.k8s.io/yaml"
+)
+
+const (
+	// ResourceListAPIVersion and ResourceListKind identify input and output of KRM function
+	ResourceListAPIVersion = "config.kubernetes.io/v1"
+	ResourceListKind       = "ResourceList"
+
+	// FunctionConfigKey is a key in data of ConfigMap used as functionConfig of KRM function,
+	// which contains configuration of tailing sidecar operator
+	FunctionConfigKey = "config.yaml"
+
+	defaultNamespace  = "default"
+	documentSeparator = "---\n"
+)
+
+var scheme = runtime.NewScheme()
+
+func init() {
+	utilruntime.Must(clientgoscheme.AddToScheme(scheme))
+	utilruntime.Must(tailingsidecarv1.AddToScheme(scheme))
+}
+
+// Renderer injects tailing sidecars into Pods and Pod templates of workloads
+type Renderer struct {
+	// PodExtender configures tailing sidecars, Client and Decoder are set by Renderer
+	PodExtender handler.PodExtender
+	// WorkloadTemplates lists additional kinds of workloads e.g. based on custom resources
+	WorkloadTemplates []handler.WorkloadTemplate
+	// TailingSidecarConfigs are used together with TailingSidecarConfigs found in rendered manifests
+	TailingSidecarConfigs []tailingsidecarv1.TailingSidecarConfig
+	// Namespace is used for objects without namespace
+	Namespace string
+}
+
+// Input contains objects to render, ResourceList is set when objects were read from KRM function input
+type Input struct {
+	Objects      []*unstructured.Unstructured
+	ResourceList *unstructured.Unstructured
+}
+
+// FunctionConfig returns configuration of tailing sidecar operator from functionConfig of KRM function,
+// returns empty string when functionConfig is not a ConfigMap with configuration
+func (in Input) FunctionConfig() string {
+	if in.ResourceList == nil {
+		return ""
+	}
+	config, _, _ := unstructured.NestedString(in.ResourceList.Object, "functionConfig", "data", FunctionConfigKey)
+	return config
+}
+
+// Read reads objects from YAML or JSON documents, or from ResourceList of KRM function
+func Read(reader io.Reader) (Input, error) {
+	yamlReader := utilyaml.NewYAMLReader(bufio.NewReader(reader))
+	input := Input{}
+	for {
+		document, err := yamlReader.Read()
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			return Input{}, err
+		}
+
+		content, err := yaml.YAMLToJSON(document)
+		if err != nil {
+			return Input{}, err
+		}
+		if string(content) == "null" {
+			// empty document
+			continue
+		}
+
+		object := &unstructured.Unstructured{}
+		if err := object.UnmarshalJSON(content); err != nil {
+			return Input{}, err
+		}
+		if object.GetAPIVersion() == ResourceListAPIVersion && object.GetKind() == ResourceListKind {
+			items, err := getResourceListItems(object)
+			if err != nil {
+				return Input{}, err
+			}
+			input.Objects = append(input.Objects, items...)
+			input.ResourceList = object
+			continue
+		}
+		input.Objects = append(input.Objects, object)
+	}
+	return input, nil
+}
+
+// Write writes objects as YAML documents, or as ResourceList when input was read from KRM function input
+func Write(writer io.Writer, input Input, objects []*unstructured.Unstructured) error {
+	if input.ResourceList != nil {
+		items := make([]interface{}, 0, len(objects))
+		for _, object := range objects {
+			items = append(items, object.Object)
+		}
+		resourceList := input.ResourceList.DeepCopy()
+		resourceList.Object["items"] = items
+		objects = []*unstructured.Unstructured{resourceList}
+	}
+
+	for i, object := range objects {
+		content, err := yaml.Marshal(object.Object)
+		if err != nil {
+			return err
+		}
+		if i > 0 {
+			if _, err := io.WriteString(writer, documentSeparator); err != nil {
+				return err
+			}
+		}
+		if _, err := writer.Write(content); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ConvertTailingSidecarConfig converts TailingSidecarConfig in any API version to v1 used by webhooks,
+// returns false when object is not a TailingSidecarConfig
+func ConvertTailingSidecarConfig(object *unstructured.Unstructured) (*tailingsidecarv1.TailingSidecarConfig, bool, error) {
+	tailingSidecarConfig := &tailingsidecarv1.TailingSidecarConfig{}
+	switch object.GroupVersionKind() {
+	case tailingsidecarv1.GroupVersion.WithKind("TailingSidecarConfig"):
+		if err := runtime.DefaultUnstructuredConverter.FromUnstructured(object.Object, tailingSidecarConfig); err != nil {
+			return nil, false, err
+		}
+	case tailingsidecarv2.GroupVersion.WithKind("TailingSidecarConfig"):
+		tailingSidecarConfigV2 := &tailingsidecarv2.TailingSidecarConfig{}
+		if err := runtime.DefaultUnstructuredConverter.FromUnstructured(object.Object, tailingSidecarConfigV2); err != nil {
+			return nil, false, err
+		}
+		if err := tailingSidecarConfigV2.ConvertTo(tailingSidecarConfig); err != nil {
+			return nil, false, err
+		}
+		tailingSidecarConfig.SetGroupVersionKind(tailingsidecarv1.GroupVersion.WithKind("TailingSidecarConfig"))
+	default:
+		return nil, false, nil
+	}
+	return tailingSidecarConfig, true, nil
+}
+
+// Render injects tailing sidecars into objects and returns rendered objects,
+// ConfigMaps with configuration of tailing sidecars created for namespaces of rendered objects are appended to them
+func (r *Renderer) Render(ctx context.Context, objects []*unstructured.Unstructured) ([]*unstructured.Unstructured, error) {
+	initObjects := make([]client.Object, 0)
+	for i := range r.TailingSidecarConfigs {
+		initObjects = append(initObjects, r.TailingSidecarConfigs[i].DeepCopy())
+	}
+	for _, object := range objects {
+		tailingSidecarConfig, ok, err := ConvertTailingSidecarConfig(object)
+		if err != nil {
+			return nil, fmt.Errorf("invalid TailingSidecarConfig %s: %w", object.GetName(), err)
+		}
+		if ok {
+			if tailingSidecarConfig.Namespace == "" {
+				tailingSidecarConfig.Namespace = r.namespace()
+			}
+			initObjects = append(initObjects, tailingSidecarConfig)
+			continue
+		}
+		if object.GroupVersionKind() == corev1.SchemeGroupVersion.WithKind("ConfigMap") {
+			initObject := object.DeepCopy()
+			if initObject.GetNamespace() == "" {
+				initObject.SetNamespace(r.namespace())
+			}
+			initObjects = append(initObjects, initObject)
+		}
+	}
+
+	fakeClient := fake.NewClientBuilder().WithScheme(scheme).WithObjects(initObjects...).Build()
+
+	podExtender := r.PodExtender
+	podExtender.Client = fakeClient
+	podExtender.Decoder = admission.NewDecoder(scheme)
+	workloadExtender := &handler.WorkloadExtender{
+		PodExtender:       &podExtender,
+		WorkloadTemplates: r.WorkloadTemplates,
+	}
+
+	rendered := make([]*unstructured.Unstructured, 0, len(objects))
+	for _, object := range objects {
+		var webhook admission.Handler = workloadExtender
+		if object.GroupVersionKind() == corev1.SchemeGroupVersion.WithKind("Pod") {
+			webhook = &podExtender
+		}
+
+		renderedObject, err := r.renderObject(ctx, webhook, object)
+		if err != nil {
+			return nil, fmt.Errorf("cannot render %s %s: %w", object.GetKind(), object.GetName(), err)
+		}
+		rendered = append(rendered, renderedObject)
+	}
+
+	configMaps, err := r.getCreatedConfigMaps(ctx, fakeClient, objects)
+	if err != nil {
+		return nil, err
+	}
+	return append(rendered, configMaps...), nil
+}
+
+// renderObject sends object to admission webhook and applies returned patches
+func (r *Renderer) renderObject(ctx context.Context, webhook admission.Handler, object *unstructured.Unstructured) (*unstructured.Unstructured, error) {
+	raw, err := object.MarshalJSON()
+	if err != nil {
+		return nil, err
+	}
+
+	gvk := object.GroupVersionKind()
+	namespace := object.GetNamespace()
+	if namespace == "" {
+		namespace = r.namespace()
+	}
+
+	resp := webhook.Handle(ctx, admission.Request{
+		AdmissionRequest: admv1.AdmissionRequest{
+			Operation: admv1.Create,
+			Kind:      metav1.GroupVersionKind{Group: gvk.Group, Version: gvk.Version, Kind: gvk.Kind},
+			Name:      object.GetName(),
+			Namespace: namespace,
+			Object:    runtime.RawExtension{Raw: raw},
+		},
+	})
+	if !resp.Allowed {
+		if resp.Result != nil {
+			return nil, errors.New(resp.Result.Message)
+		}
+		return nil, errors.New("object was rejected")
+	}
+	if len(resp.Patches) == 0 {
+		return object, nil
+	}
+
+	marshaledPatches, err := json.Marshal(resp.Patches)
+	if err != nil {
+		return nil, err
+	}
+	patch, err := jsonpatch.DecodePatch(marshaledPatches)
+	if err != nil {
+		return nil, err
+	}
+	patched, err := patch.Apply(raw)
+	if err != nil {
+		return nil, err
+	}
+
+	renderedObject := &unstructured.Unstructured{}
+	if err := renderedObject.UnmarshalJSON(patched); err != nil {
+		return nil, err
+	}
+	return renderedObject, nil
+}
+
+// getCreatedConfigMaps returns ConfigMaps with configuration of tailing sidecars which are not present in objects
+func (r *Renderer) getCreatedConfigMaps(ctx context.Context, fakeClient client.Client, objects []*unstructured.Unstructured) ([]*unstructured.Unstructured, error) {
+	if r.PodExtender.ConfigMapName == "" {
+		return nil, nil
+	}
+
+	configMapList := &corev1.ConfigMapList{}
+	if err := fakeClient.List(ctx, configMapList); err != nil {
+		return nil, err
+	}
+
+	configMaps := make([]*unstructured.Unstructured, 0)
+	for i := range configMapList.Items {
+		configMap := &configMapList.Items[i]
+		if configMap.Name != r.PodExtender.ConfigMapName || r.isConfigMapInObjects(configMap, objects) {
+			continue
+		}
+
+		configMap.SetResourceVersion("")
+		content, err := runtime.DefaultUnstructuredConverter.ToUnstructured(configMap)
+		if err != nil {
+			return nil, err
+		}
+		object := &unstructured.Unstructured{Object: content}
+		object.SetGroupVersionKind(corev1.SchemeGroupVersion.WithKind("ConfigMap"))
+		unstructured.RemoveNestedField(object.Object, "metadata", "creationTimestamp")
+		configMaps = append(configMaps, object)
+	}
+	return configMaps, nil
+}
+
+// isConfigMapInObjects checks if ConfigMap is one of rendered objects
+func (r *Renderer) isConfigMapInObjects(configMap *corev1.ConfigMap, objects []*unstructured.Unstructured) bool {
+	for _, object := range objects {
+		namespace := object.GetNamespace()
+		if namespace == "" {
+			namespace = r.namespace()
+		}
+		if object.GroupVersionKind() == corev1.SchemeGroupVersion.WithKind("ConfigMap") &&
+			object.GetName() == configMap.Name && namespace == configMap.Namespace {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *Renderer) namespace() string {
+	if r.Namespace == "" {
+		return defaultNamespace
+	}
+	return r.Namespace
+}
+
+// getResourceListItems returns items of ResourceList
+func getResourceListItems(resourceList *unstructured.Unstructured) ([]*unstructured.Unstructured, error) {
+	items, _, err := unstructured.NestedSlice(resourceList.Object, "items")
+	if err != nil {
+		return nil, err
+	}
+
+	objects := make([]*unstructured.Unstructured, 0, len(items))
+	for _, item := range items {
+		content, ok := item.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("invalid item in ResourceList: %v", item)
+		}
+		objects = append(objects, &unstructured.Unstructured{Object: content})
+	}
+	return objects, nil
+}
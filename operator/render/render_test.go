@@ -0,0 +1,198 @@
+package render
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/SumoLogic/tailing-sidecar/operator/handler"
+	"github.com/stretchr/testify/require"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+const manifests = `
+apiVersion: v1
+kind: Pod
+metadata:
+  name: pod-with-annotation
+  annotations:
+    tailing-sidecar: varlog:/var/log/example0.log
+spec:
+  containers:
+  - name: count
+    image: busybox
+    volumeMounts:
+    - name: varlog
+      mountPath: /var/log
+  volumes:
+  - name: varlog
+    emptyDir: {}
+---
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: deployment
+  namespace: production
+spec:
+  template:
+    metadata:
+      labels:
+        app: deployment
+    spec:
+      containers:
+      - name: count
+        image: busybox
+        volumeMounts:
+        - name: varlog
+          mountPath: /var/log
+      volumes:
+      - name: varlog
+        emptyDir: {}
+---
+apiVersion: tailing-sidecar.sumologic.com/v1
+kind: TailingSidecarConfig
+metadata:
+  name: tailing-sidecar-config
+  namespace: production
+spec:
+  podSelector:
+    matchLabels:
+      app: deployment
+  configs:
+    sidecar-0:
+      volumeMount:
+        name: varlog
+        mountPath: /var/log
+      path: /var/log/example1.log
+---
+apiVersion: v1
+kind: Service
+metadata:
+  name: service
+spec:
+  ports:
+  - port: 80
+`
+
+func TestRender(t *testing.T) {
+	input, err := Read(strings.NewReader(manifests))
+	require.NoError(t, err)
+	require.Len(t, input.Objects, 4)
+	require.Nil(t, input.ResourceList)
+
+	renderer := &Renderer{
+		PodExtender: handler.PodExtender{
+			TailingSidecarImage:  "sumologic/tailing-sidecar:latest",
+			TailingSidecarNaming: handler.NamingIndex,
+		},
+	}
+	rendered, err := renderer.Render(context.Background(), input.Objects)
+	require.NoError(t, err)
+	require.Len(t, rendered, 4)
+
+	require.Equal(t, []string{"count", "tailing-sidecar-0"}, getContainerNames(t, rendered[0], "spec", "containers"))
+	require.Equal(t, []string{"count", "sidecar-0"}, getContainerNames(t, rendered[1], "spec", "template", "spec", "containers"))
+	require.Equal(t, "sidecar-0", rendered[1].GetAnnotations()["tailing-sidecar.sumologic.com/injected-sidecars"])
+	require.Equal(t, input.Objects[2], rendered[2])
+	require.Equal(t, input.Objects[3], rendered[3])
+}
+
+func TestRenderV2(t *testing.T) {
+	content := `
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: deployment
+spec:
+  template:
+    metadata:
+      labels:
+        app: deployment
+    spec:
+      containers:
+      - name: count
+        image: busybox
+        volumeMounts:
+        - name: varlog
+          mountPath: /var/log
+---
+apiVersion: tailing-sidecar.sumologic.com/v2
+kind: TailingSidecarConfig
+metadata:
+  name: tailing-sidecar-config
+spec:
+  podSelector:
+    matchLabels:
+      app: deployment
+  sidecars:
+  - name: sidecar-b
+    volumeMount:
+      name: varlog
+      mountPath: /var/log
+    path: /var/log/example0.log
+  - volumeMount:
+      name: varlog
+      mountPath: /var/log
+    path: /var/log/example1.log
+`
+	input, err := Read(strings.NewReader(content))
+	require.NoError(t, err)
+
+	renderer := &Renderer{
+		PodExtender: handler.PodExtender{
+			TailingSidecarImage:  "sumologic/tailing-sidecar:latest",
+			TailingSidecarNaming: handler.NamingIndex,
+		},
+	}
+	rendered, err := renderer.Render(context.Background(), input.Objects)
+	require.NoError(t, err)
+	require.Equal(t, []string{"count", "sidecar-b", "tailing-sidecar-1"}, getContainerNames(t, rendered[0], "spec", "template", "spec", "containers"))
+}
+
+func TestRenderResourceList(t *testing.T) {
+	content := `
+apiVersion: config.kubernetes.io/v1
+kind: ResourceList
+items:
+- apiVersion: v1
+  kind: Service
+  metadata:
+    name: service
+functionConfig:
+  apiVersion: v1
+  kind: ConfigMap
+  metadata:
+    name: tailing-sidecar
+  data:
+    config.yaml: |
+      sidecar:
+        image: my-new-image
+`
+	input, err := Read(strings.NewReader(content))
+	require.NoError(t, err)
+	require.Len(t, input.Objects, 1)
+	require.NotNil(t, input.ResourceList)
+	require.Equal(t, "sidecar:\n  image: my-new-image\n", input.FunctionConfig())
+
+	output := &bytes.Buffer{}
+	require.NoError(t, Write(output, input, input.Objects))
+
+	written, err := Read(output)
+	require.NoError(t, err)
+	require.NotNil(t, written.ResourceList)
+	require.Equal(t, input.Objects, written.Objects)
+	require.Equal(t, input.FunctionConfig(), written.FunctionConfig())
+}
+
+func getContainerNames(t *testing.T, object *unstructured.Unstructured, fields ...string) []string {
+	containers, found, err := unstructured.NestedSlice(object.Object, fields...)
+	require.NoError(t, err)
+	require.True(t, found)
+
+	names := make([]string, 0, len(containers))
+	for _, container := range containers {
+		names = append(names, container.(map[string]interface{})["name"].(string))
+	}
+	return names
+}